@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"github.com/renproject/kv/db"
+)
+
+// The names of the operations passed to the sink.
+const (
+	OpInsert = "insert"
+	OpGet    = "get"
+	OpDelete = "delete"
+)
+
+type auditDB struct {
+	inner db.DB
+	sink  func(op string, key string, err error)
+}
+
+// Wrap returns a `db.DB` that calls the sink after every insert, get, and
+// delete on the inner `db.DB`, with the name of the operation, the key, and the
+// error returned by the operation. Values are never passed to the sink, so that
+// sensitive data is not recorded. The sink is called synchronously, so it
+// should return quickly.
+func Wrap(inner db.DB, sink func(op string, key string, err error)) db.DB {
+	return &auditDB{
+		inner: inner,
+		sink:  sink,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (auditDB *auditDB) Close() error {
+	return auditDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (auditDB *auditDB) Insert(key string, value interface{}) error {
+	err := auditDB.inner.Insert(key, value)
+	auditDB.sink(OpInsert, key, err)
+	return err
+}
+
+// Get implements the `db.DB` interface.
+func (auditDB *auditDB) Get(key string, value interface{}) error {
+	err := auditDB.inner.Get(key, value)
+	auditDB.sink(OpGet, key, err)
+	return err
+}
+
+// Delete implements the `db.DB` interface.
+func (auditDB *auditDB) Delete(key string) error {
+	err := auditDB.inner.Delete(key)
+	auditDB.sink(OpDelete, key, err)
+	return err
+}
+
+// Size implements the `db.DB` interface.
+func (auditDB *auditDB) Size(prefix string) (int, error) {
+	return auditDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (auditDB *auditDB) Iterator(prefix string) db.Iterator {
+	return auditDB.inner.Iterator(prefix)
+}
@@ -0,0 +1,51 @@
+package audit_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/audit"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+type record struct {
+	op  string
+	key string
+	err error
+}
+
+var _ = Describe("audit db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when operating on the db", func() {
+			It("should record one entry per operation", func() {
+				records := []record{}
+				database := Wrap(memdb.New(codec), func(op string, key string, err error) {
+					records = append(records, record{op: op, key: key, err: err})
+				})
+
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+				Expect(database.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(database.Delete("key")).NotTo(HaveOccurred())
+				Expect(database.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+
+				Expect(records).Should(Equal([]record{
+					{op: OpInsert, key: "key"},
+					{op: OpGet, key: "key"},
+					{op: OpDelete, key: "key"},
+					{op: OpGet, key: "key", err: db.ErrKeyNotFound},
+					{op: OpInsert, key: "", err: db.ErrEmptyKey},
+				}))
+			})
+		})
+	}
+})
@@ -3,6 +3,7 @@ package badgerdb
 import (
 	"bytes"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger"
@@ -13,6 +14,13 @@ import (
 type badgerDB struct {
 	db    *badger.DB
 	codec db.Codec
+
+	// closeMu is held for reading while the db is used, and for writing while
+	// it is closed, so that the db is never used after being closed. Badger
+	// panics instead of returning an error when it is used after being
+	// closed.
+	closeMu *sync.RWMutex
+	closed  bool
 }
 
 // New returns a new `db.Iterable`.
@@ -28,8 +36,9 @@ func New(path string, codec db.Codec) db.DB {
 	}
 
 	bdb := &badgerDB{
-		db:    db,
-		codec: codec,
+		db:      db,
+		codec:   codec,
+		closeMu: new(sync.RWMutex),
 	}
 
 	go bdb.gc()
@@ -37,8 +46,16 @@ func New(path string, codec db.Codec) db.DB {
 	return bdb
 }
 
-// Close implements the `db.DB` interface.
+// Close implements the `db.DB` interface. Closing the db more than once
+// returns `db.ErrClosed`.
 func (bdb *badgerDB) Close() error {
+	bdb.closeMu.Lock()
+	defer bdb.closeMu.Unlock()
+
+	if bdb.closed {
+		return db.ErrClosed
+	}
+	bdb.closed = true
 	return bdb.db.Close()
 }
 
@@ -48,6 +65,10 @@ func (bdb *badgerDB) Insert(key string, value interface{}) error {
 	if err != nil {
 		return err
 	}
+	if err := bdb.rlock(); err != nil {
+		return err
+	}
+	defer bdb.closeMu.RUnlock()
 
 	err = bdb.db.Update(func(txn *badger.Txn) error {
 		return txn.Set([]byte(key), data)
@@ -60,6 +81,11 @@ func (bdb *badgerDB) Get(key string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+	if err := bdb.rlock(); err != nil {
+		return err
+	}
+	defer bdb.closeMu.RUnlock()
+
 	err := bdb.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte(key))
 		if err != nil {
@@ -80,6 +106,11 @@ func (bdb *badgerDB) Delete(key string) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+	if err := bdb.rlock(); err != nil {
+		return err
+	}
+	defer bdb.closeMu.RUnlock()
+
 	err := bdb.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete([]byte(key))
 	})
@@ -88,6 +119,11 @@ func (bdb *badgerDB) Delete(key string) error {
 
 // Size implements the `db.DB` interface.
 func (bdb *badgerDB) Size(prefix string) (int, error) {
+	if err := bdb.rlock(); err != nil {
+		return 0, err
+	}
+	defer bdb.closeMu.RUnlock()
+
 	count := 0
 	err := bdb.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
@@ -102,11 +138,75 @@ func (bdb *badgerDB) Size(prefix string) (int, error) {
 	return count, err
 }
 
-// Iterator implements the `db.DB` interface.
+// First implements the `db.Ordered` interface.
+func (bdb *badgerDB) First(value interface{}) (string, error) {
+	return bdb.edge(false, value)
+}
+
+// Last implements the `db.Ordered` interface.
+func (bdb *badgerDB) Last(value interface{}) (string, error) {
+	return bdb.edge(true, value)
+}
+
+// edge gets the smallest key, or the largest key if reverse is true, and
+// writes its value to the value interface.
+func (bdb *badgerDB) edge(reverse bool, value interface{}) (string, error) {
+	if err := bdb.rlock(); err != nil {
+		return "", err
+	}
+	defer bdb.closeMu.RUnlock()
+
+	var key string
+	err := bdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Reverse = reverse
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		it.Rewind()
+		if !it.Valid() {
+			return db.ErrKeyNotFound
+		}
+		data, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		key = string(it.Item().KeyCopy(nil))
+		return bdb.codec.Decode(data, value)
+	})
+	if err != nil {
+		return "", convertErr(err)
+	}
+	return key, nil
+}
+
+// Iterator implements the `db.DB` interface. If the db has been closed, then
+// the iterator is empty and its error is `db.ErrClosed`. The iterator must be
+// closed before the db.
 func (bdb *badgerDB) Iterator(prefix string) db.Iterator {
+	return bdb.newIterator(prefix, true)
+}
+
+// KeyIterator implements the `db.KeyIterable` interface. Values are not
+// prefetched, so they are never read from the value log. It behaves like
+// Iterator when the db has been closed, and must also be closed before the db.
+func (bdb *badgerDB) KeyIterator(prefix string) db.KeyIterator {
+	return bdb.newIterator(prefix, false)
+}
+
+// newIterator returns an iterator over the keys with the given prefix, which
+// prefetches their values if asked to.
+func (bdb *badgerDB) newIterator(prefix string, prefetchValues bool) *iterator {
+	if err := bdb.rlock(); err != nil {
+		return &iterator{err: err}
+	}
+	defer bdb.closeMu.RUnlock()
+
 	tx := bdb.db.NewTransaction(false)
 	opts := badger.DefaultIteratorOptions
 	opts.Prefix = []byte(prefix)
+	opts.PrefetchValues = prefetchValues
 	iter := tx.NewIterator(opts)
 	iter.Rewind()
 	return &iterator{
@@ -122,13 +222,34 @@ func (bdb *badgerDB) gc() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 	for range ticker.C {
-		err := bdb.db.RunValueLogGC(0.5)
-		if err != nil {
+		if err := bdb.runValueLogGC(); err != nil {
 			return
 		}
 	}
 }
 
+// runValueLogGC runs the garbage collection of the value log, unless the db
+// has been closed.
+func (bdb *badgerDB) runValueLogGC() error {
+	if err := bdb.rlock(); err != nil {
+		return err
+	}
+	defer bdb.closeMu.RUnlock()
+
+	return bdb.db.RunValueLogGC(0.5)
+}
+
+// rlock acquires the read lock of the db, unless it has been closed. If it has
+// been closed, then `db.ErrClosed` is returned and the lock is not acquired.
+func (bdb *badgerDB) rlock() error {
+	bdb.closeMu.RLock()
+	if bdb.closed {
+		bdb.closeMu.RUnlock()
+		return db.ErrClosed
+	}
+	return nil
+}
+
 // iterator implements the `db.Iterator` interface.
 type iterator struct {
 	prefix      []byte
@@ -136,10 +257,14 @@ type iterator struct {
 	tx          *badger.Txn
 	iter        *badger.Iterator
 	codec       db.Codec
+	err         error
 }
 
 // Next implements the `db.Iterator` interface.
 func (iter *iterator) Next() bool {
+	if iter.err != nil {
+		return false
+	}
 	if !iter.initialized {
 		iter.initialized = true
 	} else {
@@ -159,7 +284,7 @@ func (iter *iterator) Next() bool {
 
 // Key implements the `db.Iterator` interface.
 func (iter *iterator) Key() (string, error) {
-	if !iter.initialized || !iter.iter.Valid() {
+	if iter.err != nil || !iter.initialized || !iter.iter.Valid() {
 		return "", db.ErrIndexOutOfRange
 	}
 	key := iter.iter.Item().Key()
@@ -168,7 +293,7 @@ func (iter *iterator) Key() (string, error) {
 
 // Value implements the `db.Iterator` interface.
 func (iter *iterator) Value(value interface{}) error {
-	if !iter.initialized || !iter.iter.Valid() {
+	if iter.err != nil || !iter.initialized || !iter.iter.Valid() {
 		return db.ErrIndexOutOfRange
 	}
 	data, err := iter.iter.Item().ValueCopy(nil)
@@ -178,8 +303,18 @@ func (iter *iterator) Value(value interface{}) error {
 	return iter.codec.Decode(data, value)
 }
 
+// Err implements the `db.Iterator` interface. Iterating over badgerdb cannot
+// fail, so it only returns an error if the db was closed before the iterator
+// was created.
+func (iter *iterator) Err() error {
+	return iter.err
+}
+
 // Close implements the `db.Iterator` interface.
 func (iter *iterator) Close() {
+	if iter.err != nil {
+		return
+	}
 	iter.iter.Close()
 	iter.tx.Discard()
 }
@@ -152,6 +152,62 @@ var _ = Describe("badger DB implementation of the db", func() {
 			})
 		})
 
+		Context("when iterating over keys", func() {
+			It("should yield every key with the prefix", func() {
+				badgerDB := New(".badgerdb", codec)
+				defer badgerDB.Close()
+
+				for i := 0; i < 10; i++ {
+					Expect(badgerDB.Insert(fmt.Sprintf("key%v", i), int64(i))).NotTo(HaveOccurred())
+					Expect(badgerDB.Insert(fmt.Sprintf("other%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				iter := badgerDB.(db.KeyIterable).KeyIterator("key")
+				keys := []string{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys = append(keys, key)
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				iter.Close()
+				Expect(keys).Should(Equal([]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}))
+
+				for i := 0; i < 10; i++ {
+					Expect(badgerDB.Delete(fmt.Sprintf("key%v", i))).NotTo(HaveOccurred())
+					Expect(badgerDB.Delete(fmt.Sprintf("other%v", i))).NotTo(HaveOccurred())
+				}
+			})
+		})
+
+		Context("when getting the first and last keys", func() {
+			It("should return the smallest and largest keys as they change", func() {
+				badgerDB := New(".badgerdb", codec)
+				defer badgerDB.Close()
+				Expect(testutil.CheckFirstLast(badgerDB.(testutil.OrderedDB))).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when using the db after closing it", func() {
+			It("should return ErrClosed", func() {
+				badgerDB := New(".badgerdb", codec)
+				Expect(badgerDB.Insert("key", int64(1))).NotTo(HaveOccurred())
+				Expect(badgerDB.Close()).NotTo(HaveOccurred())
+
+				var value int64
+				Expect(badgerDB.Insert("key", int64(1))).Should(Equal(db.ErrClosed))
+				Expect(badgerDB.Get("key", &value)).Should(Equal(db.ErrClosed))
+				Expect(badgerDB.Delete("key")).Should(Equal(db.ErrClosed))
+				_, err := badgerDB.Size("")
+				Expect(err).Should(Equal(db.ErrClosed))
+
+				iter := badgerDB.Iterator("")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeFalse())
+				Expect(iter.Err()).Should(Equal(db.ErrClosed))
+			})
+		})
+
 		Context("when trying to create more than one db using the same path", func() {
 			It("should panic", func() {
 				badgerDB := New(".badgerdb", codec)
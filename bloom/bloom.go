@@ -0,0 +1,264 @@
+package bloom
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// A DB is a `db.DB` that uses a bloom filter to avoid looking up keys that
+// definitely do not exist in the inner `db.DB`.
+type DB interface {
+	db.DB
+
+	// Rebuild the bloom filter from the keys that currently exist in the inner
+	// `db.DB`, so that it no longer includes keys that have been deleted. The
+	// filter is sized for at least the expected number of keys, and more if
+	// the inner `db.DB` has grown beyond it. If the rebuild fails, then the
+	// current filter is kept.
+	Rebuild() error
+
+	// RebuildOnInterval rebuilds the bloom filter on the given interval until
+	// the context is done. It blocks, and should be called in a goroutine.
+	// Failed rebuilds are retried on the next interval.
+	RebuildOnInterval(ctx context.Context, interval time.Duration)
+}
+
+type bloomDB struct {
+	inner             db.DB
+	expectedKeys      int
+	falsePositiveRate float64
+
+	// rebuildMu is used to make sure that only one rebuild happens at a time.
+	rebuildMu *sync.Mutex
+
+	// insertMu is held for reading by inserts, from adding the key to the
+	// filter until the value has been inserted into the inner `db.DB`, and for
+	// writing by rebuilds while they install the next filter. So an insert
+	// either adds its key to the next filter, or has finished before the
+	// rebuild starts iterating over the inner `db.DB`.
+	insertMu *sync.RWMutex
+
+	// filterMu protects the current filter, and the next filter while it is
+	// being rebuilt. Inserts are added to both, so that the next filter does
+	// not miss keys that are inserted during the rebuild.
+	filterMu *sync.RWMutex
+	filter   *filter
+	next     *filter
+}
+
+// Wrap returns a `DB` that keeps a bloom filter of the keys inserted into the
+// inner `db.DB`. Gets for keys that are not in the filter return
+// `db.ErrKeyNotFound` without reaching the inner `db.DB`, and all other gets
+// are delegated. The filter is sized so that, for the expected number of keys,
+// the given fraction of gets for absent keys are delegated.
+//
+// Keys cannot be removed from a bloom filter, so keys that are deleted (or
+// evicted by the inner `db.DB`) remain in the filter and their gets are still
+// delegated. This is always correct, but the filter becomes less effective as
+// keys are deleted. Calling `Rebuild` periodically, or running
+// `RebuildOnInterval`, restores its effectiveness. The filter starts empty, so
+// an inner `db.DB` that already has keys must be rebuilt before it is used.
+func Wrap(inner db.DB, expectedKeys int, falsePositiveRate float64) DB {
+	if expectedKeys <= 0 {
+		panic("expected keys must be positive")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		panic("false positive rate must be between 0 and 1")
+	}
+	return &bloomDB{
+		inner:             inner,
+		expectedKeys:      expectedKeys,
+		falsePositiveRate: falsePositiveRate,
+		rebuildMu:         new(sync.Mutex),
+		insertMu:          new(sync.RWMutex),
+		filterMu:          new(sync.RWMutex),
+		filter:            newFilter(expectedKeys, falsePositiveRate),
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (bloomDB *bloomDB) Close() error {
+	return bloomDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface. The key is added to the filter
+// before the value is inserted, so that a concurrent get never misses it.
+func (bloomDB *bloomDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	bloomDB.insertMu.RLock()
+	defer bloomDB.insertMu.RUnlock()
+
+	bloomDB.filterMu.Lock()
+	bloomDB.filter.add(key)
+	if bloomDB.next != nil {
+		bloomDB.next.add(key)
+	}
+	bloomDB.filterMu.Unlock()
+
+	return bloomDB.inner.Insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (bloomDB *bloomDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	bloomDB.filterMu.RLock()
+	ok := bloomDB.filter.test(key)
+	bloomDB.filterMu.RUnlock()
+
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	return bloomDB.inner.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface. The key is not removed from the
+// filter.
+func (bloomDB *bloomDB) Delete(key string) error {
+	return bloomDB.inner.Delete(key)
+}
+
+// Size implements the `db.DB` interface.
+func (bloomDB *bloomDB) Size(prefix string) (int, error) {
+	return bloomDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (bloomDB *bloomDB) Iterator(prefix string) db.Iterator {
+	return bloomDB.inner.Iterator(prefix)
+}
+
+// Rebuild implements the `DB` interface.
+func (bloomDB *bloomDB) Rebuild() error {
+	bloomDB.rebuildMu.Lock()
+	defer bloomDB.rebuildMu.Unlock()
+
+	size, err := bloomDB.inner.Size("")
+	if err != nil {
+		return err
+	}
+	if size < bloomDB.expectedKeys {
+		size = bloomDB.expectedKeys
+	}
+	next := newFilter(size, bloomDB.falsePositiveRate)
+
+	// Wait for the inserts that have not added their keys to the next filter
+	// to finish, so that the iteration sees their keys.
+	bloomDB.insertMu.Lock()
+	bloomDB.filterMu.Lock()
+	bloomDB.next = next
+	bloomDB.filterMu.Unlock()
+	bloomDB.insertMu.Unlock()
+
+	if err := bloomDB.fill(next); err != nil {
+		bloomDB.filterMu.Lock()
+		bloomDB.next = nil
+		bloomDB.filterMu.Unlock()
+		return err
+	}
+
+	bloomDB.filterMu.Lock()
+	bloomDB.filter = next
+	bloomDB.next = nil
+	bloomDB.filterMu.Unlock()
+	return nil
+}
+
+// RebuildOnInterval implements the `DB` interface.
+func (bloomDB *bloomDB) RebuildOnInterval(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bloomDB.Rebuild()
+		}
+	}
+}
+
+// fill the filter with the keys in the inner `db.DB`.
+func (bloomDB *bloomDB) fill(f *filter) error {
+	iter := bloomDB.inner.Iterator("")
+	defer iter.Close()
+
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return err
+		}
+		bloomDB.filterMu.Lock()
+		f.add(key)
+		bloomDB.filterMu.Unlock()
+	}
+	return iter.Err()
+}
+
+// filter is a standard bloom filter over string keys. It is not safe for
+// concurrent use.
+type filter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+// newFilter returns an empty filter with the optimal number of bits and hash
+// functions for the expected number of keys and false positive rate.
+func newFilter(expectedKeys int, falsePositiveRate float64) *filter {
+	m := math.Ceil(-float64(expectedKeys) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	if m < 64 {
+		m = 64
+	}
+	hashes := math.Round(m / float64(expectedKeys) * math.Ln2)
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &filter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		m:      uint64(m),
+		hashes: uint64(hashes),
+	}
+}
+
+// add the key to the filter.
+func (f *filter) add(key string) {
+	h1, h2 := f.hash(key)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// test whether or not the key might have been added to the filter. It never
+// returns false for a key that has been added.
+func (f *filter) test(key string) bool {
+	h1, h2 := f.hash(key)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash the key into the two hashes that are combined to derive the bits of
+// the key, using double hashing.
+func (f *filter) hash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
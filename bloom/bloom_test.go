@@ -0,0 +1,203 @@
+package bloom_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/bloom"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+// countingDB is a `db.DB` that counts the number of gets that reach it.
+type countingDB struct {
+	db.DB
+	gets int64
+}
+
+func (countingDB *countingDB) Get(key string, value interface{}) error {
+	atomic.AddInt64(&countingDB.gets, 1)
+	return countingDB.DB.Get(key, value)
+}
+
+func (countingDB *countingDB) Gets() int64 {
+	return atomic.LoadInt64(&countingDB.gets)
+}
+
+// blockingDB is a `db.DB` where inserts signal that they have started, and
+// then wait to be released.
+type blockingDB struct {
+	db.DB
+	started chan struct{}
+	release chan struct{}
+}
+
+func (blockingDB *blockingDB) Insert(key string, value interface{}) error {
+	close(blockingDB.started)
+	<-blockingDB.release
+	return blockingDB.DB.Insert(key, value)
+}
+
+var _ = Describe("bloom filter db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		// getAbsent gets keys that have never been inserted, and returns the
+		// number of gets that reached the inner db.
+		getAbsent := func(database db.DB, inner *countingDB) int64 {
+			before := inner.Gets()
+			for i := 0; i < 1000; i++ {
+				var value int64
+				Expect(database.Get(fmt.Sprintf("absent_%v", i), &value)).Should(Equal(db.ErrKeyNotFound))
+			}
+			return inner.Gets() - before
+		}
+
+		Context("when getting keys", func() {
+			It("should short-circuit most absent keys", func() {
+				inner := &countingDB{DB: memdb.New(codec)}
+				database := Wrap(inner, 100, 0.01)
+				for i := 0; i < 100; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				Expect(getAbsent(database, inner)).Should(BeNumerically("<", 50))
+			})
+
+			It("should resolve present keys", func() {
+				inner := &countingDB{DB: memdb.New(codec)}
+				database := Wrap(inner, 100, 0.01)
+				for i := 0; i < 100; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				for i := 0; i < 100; i++ {
+					var value int64
+					Expect(database.Get(fmt.Sprintf("%v", i), &value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(int64(i)))
+				}
+				Expect(inner.Gets()).Should(Equal(int64(100)))
+			})
+
+			It("should return ErrEmptyKey for an empty key", func() {
+				database := Wrap(memdb.New(codec), 100, 0.01)
+				var value int64
+				Expect(database.Insert("", int64(1))).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when deleting keys", func() {
+			It("should still delegate gets until the filter is rebuilt", func() {
+				inner := &countingDB{DB: memdb.New(codec)}
+				database := Wrap(inner, 100, 0.01)
+				for i := 0; i < 100; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+				for i := 0; i < 100; i++ {
+					Expect(database.Delete(fmt.Sprintf("%v", i))).NotTo(HaveOccurred())
+				}
+
+				get := func() int64 {
+					before := inner.Gets()
+					for i := 0; i < 100; i++ {
+						var value int64
+						Expect(database.Get(fmt.Sprintf("%v", i), &value)).Should(Equal(db.ErrKeyNotFound))
+					}
+					return inner.Gets() - before
+				}
+				Expect(get()).Should(Equal(int64(100)))
+
+				Expect(database.Rebuild()).NotTo(HaveOccurred())
+				Expect(get()).Should(BeNumerically("<", 10))
+			})
+		})
+
+		Context("when rebuilding the filter", func() {
+			It("should include the keys that already exist in the inner db", func() {
+				inner := memdb.New(codec)
+				for i := 0; i < 100; i++ {
+					Expect(inner.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+				database := Wrap(inner, 10, 0.01)
+
+				var value int64
+				Expect(database.Get("42", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Rebuild()).NotTo(HaveOccurred())
+				for i := 0; i < 100; i++ {
+					Expect(database.Get(fmt.Sprintf("%v", i), &value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(int64(i)))
+				}
+			})
+
+			It("should not miss keys that are inserted during the rebuild", func() {
+				inner := &blockingDB{DB: memdb.New(codec), started: make(chan struct{}), release: make(chan struct{})}
+				database := Wrap(inner, 100, 0.01)
+
+				// Start an insert that has added its key to the filter, but
+				// has not inserted its value yet.
+				inserted := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(inserted)
+					Expect(database.Insert("key", int64(1))).NotTo(HaveOccurred())
+				}()
+				<-inner.started
+
+				// Rebuild while the insert is blocked, and let the insert
+				// finish once the rebuild has finished or is waiting for it.
+				rebuilt := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(rebuilt)
+					Expect(database.Rebuild()).NotTo(HaveOccurred())
+				}()
+				select {
+				case <-rebuilt:
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(inner.release)
+				<-inserted
+				<-rebuilt
+
+				var value int64
+				Expect(database.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(1)))
+			})
+
+			It("should rebuild on the interval until the context is done", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, 100, 0.01)
+				Expect(inner.Insert("key", int64(1))).NotTo(HaveOccurred())
+
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					database.RebuildOnInterval(ctx, 10*time.Millisecond)
+				}()
+
+				Eventually(func() error {
+					var value int64
+					return database.Get("key", &value)
+				}).ShouldNot(HaveOccurred())
+				cancel()
+				Eventually(done).Should(BeClosed())
+			})
+		})
+	}
+
+	Context("when wrapping with invalid parameters", func() {
+		It("should panic", func() {
+			Expect(func() { Wrap(memdb.New(testutil.Codecs[0]), 0, 0.01) }).Should(Panic())
+			Expect(func() { Wrap(memdb.New(testutil.Codecs[0]), 100, 0) }).Should(Panic())
+			Expect(func() { Wrap(memdb.New(testutil.Codecs[0]), 100, 1) }).Should(Panic())
+		})
+	})
+})
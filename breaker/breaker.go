@@ -0,0 +1,125 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker is open and operations
+// are not being sent to the inner `db.DB`.
+var ErrCircuitOpen = errors.New("circuit open")
+
+type breakerDB struct {
+	inner     db.DB
+	threshold int
+	cooldown  time.Duration
+
+	stateMu  *sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+	trialing bool
+}
+
+// Wrap returns a `db.DB` with a circuit breaker in front of inserts, gets, and
+// deletes on the inner `db.DB`. After the given number of consecutive failures,
+// the breaker opens and operations fail with ErrCircuitOpen for the cooldown.
+// After the cooldown, a single trial operation is allowed through: if it
+// succeeds the breaker closes, otherwise it opens for another cooldown.
+// ErrKeyNotFound and ErrEmptyKey are not counted as failures.
+func Wrap(inner db.DB, threshold int, cooldown time.Duration) db.DB {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &breakerDB{
+		inner:     inner,
+		threshold: threshold,
+		cooldown:  cooldown,
+
+		stateMu: new(sync.Mutex),
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (breakerDB *breakerDB) Close() error {
+	return breakerDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (breakerDB *breakerDB) Insert(key string, value interface{}) error {
+	return breakerDB.do(func() error {
+		return breakerDB.inner.Insert(key, value)
+	})
+}
+
+// Get implements the `db.DB` interface.
+func (breakerDB *breakerDB) Get(key string, value interface{}) error {
+	return breakerDB.do(func() error {
+		return breakerDB.inner.Get(key, value)
+	})
+}
+
+// Delete implements the `db.DB` interface.
+func (breakerDB *breakerDB) Delete(key string) error {
+	return breakerDB.do(func() error {
+		return breakerDB.inner.Delete(key)
+	})
+}
+
+// Size implements the `db.DB` interface.
+func (breakerDB *breakerDB) Size(prefix string) (int, error) {
+	return breakerDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (breakerDB *breakerDB) Iterator(prefix string) db.Iterator {
+	return breakerDB.inner.Iterator(prefix)
+}
+
+// do the operation if the breaker allows it, and record the result.
+func (breakerDB *breakerDB) do(operation func() error) error {
+	if !breakerDB.allow() {
+		return ErrCircuitOpen
+	}
+	err := operation()
+	breakerDB.record(err)
+	return err
+}
+
+// allow returns whether or not an operation can be sent to the inner `db.DB`.
+func (breakerDB *breakerDB) allow() bool {
+	breakerDB.stateMu.Lock()
+	defer breakerDB.stateMu.Unlock()
+
+	if !breakerDB.open {
+		return true
+	}
+	if breakerDB.trialing || time.Since(breakerDB.openedAt) < breakerDB.cooldown {
+		return false
+	}
+	breakerDB.trialing = true
+	return true
+}
+
+// record the result of an operation, and open or close the breaker.
+func (breakerDB *breakerDB) record(err error) {
+	breakerDB.stateMu.Lock()
+	defer breakerDB.stateMu.Unlock()
+
+	if err == nil || errors.Is(err, db.ErrKeyNotFound) || errors.Is(err, db.ErrEmptyKey) {
+		breakerDB.failures = 0
+		breakerDB.open = false
+		breakerDB.trialing = false
+		return
+	}
+
+	breakerDB.failures++
+	if breakerDB.trialing || breakerDB.failures >= breakerDB.threshold {
+		breakerDB.open = true
+		breakerDB.openedAt = time.Now()
+		breakerDB.trialing = false
+	}
+}
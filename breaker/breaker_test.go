@@ -0,0 +1,110 @@
+package breaker_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/breaker"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+)
+
+var errBackend = errors.New("backend failure")
+
+// switchDB is a `db.DB` that fails all operations while it is down, and counts
+// the calls that reach it.
+type switchDB struct {
+	db.DB
+	down  bool
+	calls int
+}
+
+func (switchDB *switchDB) Insert(key string, value interface{}) error {
+	switchDB.calls++
+	if switchDB.down {
+		return errBackend
+	}
+	return switchDB.DB.Insert(key, value)
+}
+
+func (switchDB *switchDB) Get(key string, value interface{}) error {
+	switchDB.calls++
+	if switchDB.down {
+		return errBackend
+	}
+	return switchDB.DB.Get(key, value)
+}
+
+var _ = Describe("circuit breaker db", func() {
+	Context("when the inner db keeps failing", func() {
+		It("should open after the threshold and fail fast", func() {
+			inner := &switchDB{DB: memdb.New(codec.JSONCodec), down: true}
+			database := Wrap(inner, 3, time.Hour)
+
+			for i := 0; i < 3; i++ {
+				Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			}
+			Expect(database.Insert("key", "value")).Should(Equal(ErrCircuitOpen))
+			Expect(database.Get("key", new(string))).Should(Equal(ErrCircuitOpen))
+			Expect(inner.calls).Should(Equal(3))
+		})
+
+		It("should not open when failures are not consecutive", func() {
+			inner := &switchDB{DB: memdb.New(codec.JSONCodec), down: true}
+			database := Wrap(inner, 2, time.Hour)
+
+			Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			inner.down = false
+			Expect(database.Insert("key", "value")).NotTo(HaveOccurred())
+			inner.down = true
+			Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			Expect(database.Insert("key", "value")).Should(Equal(ErrCircuitOpen))
+		})
+	})
+
+	Context("when keys are not found", func() {
+		It("should not count them as failures", func() {
+			database := Wrap(memdb.New(codec.JSONCodec), 1, time.Hour)
+
+			for i := 0; i < 3; i++ {
+				Expect(database.Get("key", new(string))).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Insert("", "value")).Should(Equal(db.ErrEmptyKey))
+			}
+			Expect(database.Insert("key", "value")).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the cooldown has passed", func() {
+		It("should close if the trial succeeds", func() {
+			inner := &switchDB{DB: memdb.New(codec.JSONCodec), down: true}
+			database := Wrap(inner, 1, 20*time.Millisecond)
+
+			Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			Expect(database.Insert("key", "value")).Should(Equal(ErrCircuitOpen))
+
+			inner.down = false
+			time.Sleep(30 * time.Millisecond)
+			Expect(database.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(database.Insert("key", "value")).NotTo(HaveOccurred())
+		})
+
+		It("should open again if the trial fails", func() {
+			inner := &switchDB{DB: memdb.New(codec.JSONCodec), down: true}
+			database := Wrap(inner, 3, 20*time.Millisecond)
+
+			for i := 0; i < 3; i++ {
+				Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			}
+
+			time.Sleep(30 * time.Millisecond)
+			Expect(database.Insert("key", "value")).Should(Equal(errBackend))
+			Expect(database.Insert("key", "value")).Should(Equal(ErrCircuitOpen))
+			Expect(inner.calls).Should(Equal(4))
+		})
+	})
+})
@@ -7,4 +7,7 @@ import (
 var (
 	// ErrExpired is returned when the key-value tuple has expired.
 	ErrExpired = errors.New("expired")
+
+	// ErrDraining is returned when writing to a table that is being drained.
+	ErrDraining = errors.New("draining")
 )
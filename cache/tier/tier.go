@@ -0,0 +1,134 @@
+package tier
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/renproject/kv/db"
+)
+
+// Table is a tiered `db.Table` that can report whether a value was served
+// from the stale table.
+type Table interface {
+	db.Table
+
+	// GetStale is like Get, but also returns whether the value was read from
+	// the stale table because the cold table failed.
+	GetStale(key string, value interface{}) (bool, error)
+}
+
+// An Option configures a tiered table when it is created.
+type Option func(*table)
+
+// ServeStale makes gets fall back to the last-known value of a key when it has
+// expired from the hot table and reading it from the cold table fails, instead
+// of returning the error. Every value that is inserted or read from the cold
+// table is also written to the stale table, which is usually a `ttl.Table`
+// with a longer TTL than the hot table. The TTL of the stale table is the
+// hard TTL that bounds how stale a served value can be, and the TTL of the hot
+// table is the soft TTL after which the cold table is read again. A value that
+// is not found in the cold table is never served from the stale table.
+func ServeStale(stale db.Table) Option {
+	return func(tier *table) {
+		tier.stale = stale
+	}
+}
+
+type table struct {
+	hot   db.Table
+	cold  db.Table
+	stale db.Table
+}
+
+// New returns a tiered `db.Table` over a hot table, which is usually a
+// `ttl.Table` over an in-memory db, and a cold table, which is usually over a
+// persistent db. Inserts write to the cold table and then the hot table. Gets
+// read from the hot table, and on a miss read from the cold table and promote
+// the value into the hot table, so that it is read from the hot table until it
+// expires there. The cold table holds every key/value pair, so sizes and
+// iterators are delegated to it.
+func New(hot, cold db.Table, opts ...Option) Table {
+	tier := &table{
+		hot:  hot,
+		cold: cold,
+	}
+	for _, opt := range opts {
+		opt(tier)
+	}
+	return tier
+}
+
+// Insert implements the `db.Table` interface. If inserting into the hot table
+// fails, the value has already been written to the cold table.
+func (tier *table) Insert(key string, value interface{}) error {
+	if err := tier.cold.Insert(key, value); err != nil {
+		return err
+	}
+	if tier.stale != nil {
+		if err := tier.stale.Insert(key, value); err != nil {
+			return err
+		}
+	}
+	return tier.hot.Insert(key, value)
+}
+
+// Get implements the `db.Table` interface. Failing to promote a value into the
+// hot table is logged, and does not fail the get.
+func (tier *table) Get(key string, value interface{}) error {
+	_, err := tier.GetStale(key, value)
+	return err
+}
+
+// GetStale implements the `Table` interface.
+func (tier *table) GetStale(key string, value interface{}) (bool, error) {
+	err := tier.hot.Get(key, value)
+	if !errors.Is(err, db.ErrKeyNotFound) {
+		return false, err
+	}
+	if err := tier.cold.Get(key, value); err != nil {
+		if tier.stale == nil || errors.Is(err, db.ErrKeyNotFound) {
+			return false, err
+		}
+		if staleErr := tier.stale.Get(key, value); staleErr != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err := tier.hot.Insert(key, value); err != nil {
+		log.Println(fmt.Errorf("failed to promote key=%v: %w", key, err))
+	}
+	if tier.stale != nil {
+		if err := tier.stale.Insert(key, value); err != nil {
+			log.Println(fmt.Errorf("failed to keep stale copy of key=%v: %w", key, err))
+		}
+	}
+	return false, nil
+}
+
+// Delete implements the `db.Table` interface. The key is deleted from the hot
+// and stale tables first, so that a failure to delete it from the cold table
+// never leaves them serving a value that has been deleted.
+func (tier *table) Delete(key string) error {
+	if err := tier.hot.Delete(key); err != nil {
+		return err
+	}
+	if tier.stale != nil {
+		if err := tier.stale.Delete(key); err != nil {
+			return err
+		}
+	}
+	return tier.cold.Delete(key)
+}
+
+// Size implements the `db.Table` interface. It returns the size of the cold
+// table.
+func (tier *table) Size() (int, error) {
+	return tier.cold.Size()
+}
+
+// Iterator implements the `db.Table` interface. It iterates over the cold
+// table.
+func (tier *table) Iterator() db.Iterator {
+	return tier.cold.Iterator()
+}
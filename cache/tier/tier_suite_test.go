@@ -0,0 +1,13 @@
+package tier_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTier(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tier Suite")
+}
@@ -0,0 +1,195 @@
+package tier_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/cache/tier"
+
+	"github.com/renproject/kv/cache/ttl"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+// countingTable is a `db.Table` that counts the number of gets that reach it.
+type countingTable struct {
+	db.Table
+	gets int64
+}
+
+func (table *countingTable) Get(key string, value interface{}) error {
+	atomic.AddInt64(&table.gets, 1)
+	return table.Table.Get(key, value)
+}
+
+func (table *countingTable) Gets() int64 {
+	return atomic.LoadInt64(&table.gets)
+}
+
+// flakyTable is a `db.Table` whose gets fail while it is down.
+type flakyTable struct {
+	db.Table
+	down int64
+}
+
+var errDown = errors.New("down")
+
+func (table *flakyTable) Get(key string, value interface{}) error {
+	if atomic.LoadInt64(&table.down) == 1 {
+		return errDown
+	}
+	return table.Table.Get(key, value)
+}
+
+func (table *flakyTable) SetDown(down bool) {
+	if down {
+		atomic.StoreInt64(&table.down, 1)
+	} else {
+		atomic.StoreInt64(&table.down, 0)
+	}
+}
+
+var _ = Describe("tiered table", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when reading a value that is only in the cold table", func() {
+			It("should promote it into the hot table until it expires", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				hot := ttl.New(ctx, memdb.New(codec), "hot", 100*time.Millisecond)
+				cold := &countingTable{Table: db.NewTable(memdb.New(codec), "cold")}
+				table := New(hot, cold)
+
+				Expect(cold.Insert("key", int64(1))).Should(Succeed())
+				var value int64
+				Expect(hot.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+
+				// A cold hit should populate the hot table.
+				Expect(table.Get("key", &value)).Should(Succeed())
+				Expect(value).Should(Equal(int64(1)))
+				Expect(cold.Gets()).Should(Equal(int64(1)))
+				Expect(hot.Get("key", &value)).Should(Succeed())
+				Expect(value).Should(Equal(int64(1)))
+
+				// Later gets should be served by the hot table.
+				Expect(table.Get("key", &value)).Should(Succeed())
+				Expect(cold.Gets()).Should(Equal(int64(1)))
+
+				// The promoted value should expire from the hot table, but
+				// still be read from the cold table.
+				Eventually(func() error {
+					return hot.Get("key", &value)
+				}, time.Second).Should(Equal(db.ErrKeyNotFound))
+				Expect(table.Get("key", &value)).Should(Succeed())
+				Expect(value).Should(Equal(int64(1)))
+				Expect(cold.Gets()).Should(Equal(int64(2)))
+			})
+		})
+
+		Context("when writing to the table", func() {
+			It("should write to and delete from both tables", func() {
+				hot := db.NewTable(memdb.New(codec), "hot")
+				cold := db.NewTable(memdb.New(codec), "cold")
+				table := New(hot, cold)
+
+				Expect(table.Insert("key", int64(1))).Should(Succeed())
+				var value int64
+				Expect(hot.Get("key", &value)).Should(Succeed())
+				Expect(cold.Get("key", &value)).Should(Succeed())
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+
+				Expect(table.Delete("key")).Should(Succeed())
+				Expect(hot.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(cold.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+		})
+
+		Context("when serving stale values", func() {
+			It("should serve the last-known value while the cold table is down", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				hot := ttl.New(ctx, memdb.New(codec), "hot", 100*time.Millisecond)
+				stale := ttl.New(ctx, memdb.New(codec), "stale", time.Hour)
+				cold := &flakyTable{Table: db.NewTable(memdb.New(codec), "cold")}
+				table := New(hot, cold, ServeStale(stale))
+
+				Expect(table.Insert("key", int64(1))).Should(Succeed())
+				var value int64
+				isStale, err := table.GetStale("key", &value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(isStale).Should(BeFalse())
+				Expect(value).Should(Equal(int64(1)))
+
+				// Once the value expires from the hot table, the cold table is
+				// read again, and its failure should be hidden by the stale
+				// value.
+				Eventually(func() error {
+					return hot.Get("key", &value)
+				}, time.Second).Should(Equal(db.ErrKeyNotFound))
+				cold.SetDown(true)
+				value = 0
+				isStale, err = table.GetStale("key", &value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(isStale).Should(BeTrue())
+				Expect(value).Should(Equal(int64(1)))
+				Expect(table.Get("key", &value)).Should(Succeed())
+
+				// Keys that have never been read cannot be served.
+				Expect(table.Get("other", &value)).Should(Equal(errDown))
+
+				// When the cold table recovers, its values are served again.
+				cold.SetDown(false)
+				isStale, err = table.GetStale("key", &value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(isStale).Should(BeFalse())
+			})
+
+			It("should not serve values older than the stale table's TTL", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				hot := ttl.New(ctx, memdb.New(codec), "hot", 50*time.Millisecond)
+				stale := ttl.New(ctx, memdb.New(codec), "stale", 200*time.Millisecond)
+				cold := &flakyTable{Table: db.NewTable(memdb.New(codec), "cold")}
+				table := New(hot, cold, ServeStale(stale))
+
+				Expect(table.Insert("key", int64(1))).Should(Succeed())
+				cold.SetDown(true)
+				var value int64
+				Eventually(func() error {
+					return stale.Get("key", &value)
+				}, 2*time.Second).Should(Equal(db.ErrKeyNotFound))
+				isStale, err := table.GetStale("key", &value)
+				Expect(err).Should(Equal(errDown))
+				Expect(isStale).Should(BeFalse())
+			})
+
+			It("should not serve deleted or missing values", func() {
+				hot := db.NewTable(memdb.New(codec), "hot")
+				stale := db.NewTable(memdb.New(codec), "stale")
+				cold := &flakyTable{Table: db.NewTable(memdb.New(codec), "cold")}
+				table := New(hot, cold, ServeStale(stale))
+
+				Expect(table.Insert("key", int64(1))).Should(Succeed())
+				Expect(table.Delete("key")).Should(Succeed())
+				var value int64
+				Expect(stale.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+
+				// A miss in the cold table is not an outage.
+				Expect(stale.Insert("key", int64(1))).Should(Succeed())
+				Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+		})
+	}
+})
@@ -0,0 +1,29 @@
+package ttl
+
+import "time"
+
+// SetNow replaces the clock used by the table. It must not be called while
+// the table is being pruned.
+func SetNow(t Table, now func() time.Time) {
+	t.(*table).now = now
+}
+
+// Prune the table immediately.
+func Prune(t Table) error {
+	ttlTable := t.(*table)
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return err
+	}
+	return ttlTable.prune(pointer)
+}
+
+// PrunePointer returns the last slot that has been pruned.
+func PrunePointer(t Table) (int64, error) {
+	return t.(*table).prunePointer()
+}
+
+// SlotNo returns the slot of the moment.
+func SlotNo(t Table, moment time.Time) int64 {
+	return t.(*table).slotNo(moment)
+}
@@ -2,8 +2,17 @@ package ttl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/renproject/kv/db"
@@ -16,152 +25,1850 @@ var (
 	PrunePointerKey = "prunePointer"
 )
 
+// ErrAccessCountsDisabled is returned by AccessCount when the Table was not
+// created with WithAccessCounts.
+var ErrAccessCountsDisabled = errors.New("access counts disabled")
+
+// ErrPruneStalled is returned by HealthCheck when the table has not been pruned
+// for more than twice the prune interval.
+var ErrPruneStalled = errors.New("prune stalled")
+
+// MinInterval is the smallest prune interval, and slot size, that a Table can
+// be created with. Smaller intervals cause the table to prune constantly.
+const MinInterval = time.Millisecond
+
+// ErrIntervalTooSmall is returned when creating a Table with a prune interval,
+// or slot size, that is smaller than MinInterval.
+var ErrIntervalTooSmall = errors.New("interval too small")
+
+// ErrReservedPrefix is returned when creating a Table over a database that has
+// keys with the prefix reserved for the Table, but has never held the Table.
+// This happens when the database already holds a `db.Table` with the same name,
+// and writing to both would silently corrupt them.
+var ErrReservedPrefix = errors.New("reserved prefix in use")
+
+// ErrInvalidHash is returned when creating a Table with a name hash that does
+// not produce a non-empty output of a fixed length.
+var ErrInvalidHash = errors.New("invalid hash")
+
+// ErrRenameNotSupported is returned by Rename and RenameNX when the underlying
+// db does not implement `db.Renamer`.
+var ErrRenameNotSupported = errors.New("db does not support rename")
+
+// A Logger is used by a Table to log errors that happen in the background and
+// cannot be returned. It is satisfied by `*log.Logger`.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// stdLogger is a Logger that uses the standard logger of the log package.
+type stdLogger struct{}
+
+// Printf implements the `Logger` interface.
+func (stdLogger) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// An Option configures a Table when it is created.
+type Option func(*table)
+
+// WithLogger sets the Logger used by the Table. By default, the standard logger
+// of the log package is used.
+func WithLogger(logger Logger) Option {
+	return func(ttlTable *table) {
+		ttlTable.logger = logger
+	}
+}
+
+// WithAccessCounts enables tracking of the number of times each key is read
+// with Get. This adds a write to every Get, so it is disabled by default.
+func WithAccessCounts() Option {
+	return func(ttlTable *table) {
+		ttlTable.accessCountMu = new(sync.Mutex)
+	}
+}
+
+// WithPruneRateLimit limits the number of keys deleted by pruning to the given
+// number per second, so that a large number of expired keys does not starve
+// other operations on the underlying db. Each prune deletes at most the number
+// of keys allowed for one prune interval, and leaves the rest to the following
+// prunes. Keys that have expired but have not been pruned are still treated as
+// missing by Get. By default, the number of keys is not limited.
+func WithPruneRateLimit(deletesPerSecond float64) Option {
+	return func(ttlTable *table) {
+		ttlTable.pruneRate = deletesPerSecond
+	}
+}
+
+// WithPruneConcurrency sets the number of slots that are pruned concurrently
+// when a prune has more than one expired slot to prune, such as after the
+// table has not been pruned for a while. The keys of each slot are deleted
+// independently, and the prune pointer only advances past a slot once it, and
+// all of the slots before it, have been pruned. It has no effect when the
+// prune rate is limited, because the limit is shared by the slots. By default,
+// slots are pruned one at a time.
+func WithPruneConcurrency(concurrency int) Option {
+	return func(ttlTable *table) {
+		ttlTable.pruneConcurrency = concurrency
+	}
+}
+
+// WithMaxPruneDuration limits how long each prune takes, so that pruning a
+// large number of expired slots does not hold up other operations on the
+// underlying db for too long. The time is checked between slots, so a prune
+// stops after the slot that it is pruning when the time runs out, and the
+// following prunes resume from the next slot. Keys that have expired but have
+// not been pruned are still treated as missing by Get. By default, the time
+// is not limited.
+func WithMaxPruneDuration(d time.Duration) Option {
+	return func(ttlTable *table) {
+		ttlTable.maxPruneDuration = d
+	}
+}
+
+// WithNameHash sets the hash used to derive the prefix of the keys of the Table
+// in the underlying db from its name. A shorter hash makes the keys shorter, at
+// the cost of a higher chance of two names colliding. The hash must always
+// produce outputs of the same length, so that the prefix of one Table is never
+// a prefix of the keys of another, and all Tables in the same underlying db
+// should use the same hash. By default, sha3-256 is used.
+func WithNameHash(hash func(data []byte) []byte) Option {
+	return func(ttlTable *table) {
+		ttlTable.hash = hash
+	}
+}
+
+// WithEarlyExpiration enables probabilistic early expiration, using the XFetch
+// algorithm, so that a key/value pair that is about to expire is recomputed by
+// one caller before it expires, instead of by every caller that reads it after
+// it expires. GetEarly reports that the key/value pair expires soon with a
+// probability that increases as the key/value pair approaches its expiry, and
+// with the time that it took to compute the value, as given to
+// InsertWithDelta. The beta scales the probability, where a beta of 1 is
+// usually enough, and larger betas favour earlier recomputation. Key/value
+// pairs inserted without a delta never expire early. Enabling it adds a write
+// to every InsertWithDelta and extra reads to every GetEarly, so it is
+// disabled by default.
+func WithEarlyExpiration(beta float64) Option {
+	return func(ttlTable *table) {
+		ttlTable.earlyExpirationBeta = beta
+	}
+}
+
+// WithExpirationBuffer sets the size of the buffer of the expiration channel.
+// By default, the buffer has a size of DefaultExpirationBuffer. A size that is
+// not positive gives an unbuffered channel, which drops every expired key that
+// is not already being received.
+func WithExpirationBuffer(size int) Option {
+	if size < 0 {
+		size = 0
+	}
+	return func(ttlTable *table) {
+		ttlTable.expirations = make(chan string, size)
+	}
+}
+
+// DefaultExpirationBuffer is the default size of the buffer of the expiration
+// channel.
+const DefaultExpirationBuffer = 1024
+
+// SlotToken is used in the keys of the timestamps stored in the underlying db
+// to separate the table name hash from the slot number.
+const SlotToken = "-slot"
+
+// A Table is a `db.Table` where key/value pairs are automatically pruned after
+// they have been in the table for the prune interval.
+type Table interface {
+	db.Table
+
+	// InsertBatch writes all of the key/value pairs into the Table. All pairs
+	// share the same time slot and will therefore expire in the same prune.
+	InsertBatch(entries map[string]interface{}) error
+
+	// InsertWithDelta writes the key/value pair into the Table, in the same
+	// way as Insert, along with the time that it took to compute the value.
+	// The delta is only used, and only stored, when the Table was created with
+	// WithEarlyExpiration.
+	InsertWithDelta(key string, value interface{}, delta time.Duration) error
+
+	// GetEarly reads the value in the same way as Get, and also returns
+	// whether or not the key/value pair has been chosen to expire early, when
+	// the Table was created with WithEarlyExpiration. If it has, then the
+	// caller should recompute the value and insert it again with
+	// InsertWithDelta, while other callers continue to read the value that is
+	// in the Table.
+	GetEarly(key string, value interface{}) (bool, error)
+
+	// InsertPersistent writes the key/value pair into the Table without a
+	// timestamp, so that it is never pruned. It replaces the timestamp of a
+	// key that was inserted with Insert, and inserting the key with Insert
+	// again makes it expire as usual.
+	InsertPersistent(key string, value interface{}) error
+
+	// LiveIterator over the key/value pairs in the Table that have not
+	// expired, including the ones inserted with InsertPersistent. Unlike
+	// Iterator, it skips key/value pairs that have expired but have not been
+	// pruned yet, in the same way as Get. Expiry is checked against the time
+	// at which the iterator is created. If the timestamps cannot be read, then
+	// the iterator yields nothing and Err returns the error.
+	LiveIterator() db.Iterator
+
+	// HasBatch returns whether or not each of the keys exists, in the same
+	// order as the keys. Key/value pairs that have expired but have not been
+	// pruned yet are reported as missing.
+	HasBatch(keys []string) ([]bool, error)
+
+	// ExpirePrefix deletes all key/value pairs where the key begins with the
+	// given prefix, and returns the number of key/value pairs deleted.
+	ExpirePrefix(prefix string) (int, error)
+
+	// TouchPrefix moves all key/value pairs where the key begins with the
+	// given prefix into the current slot, as if they had just been inserted,
+	// and returns the number of key/value pairs touched. Key/value pairs that
+	// have expired, or that were inserted with InsertPersistent, are not
+	// touched.
+	TouchPrefix(prefix string) (int, error)
+
+	// DeleteRange deletes all key/value pairs where the key is in the
+	// half-open range from start to end, in lexicographic order, along with
+	// their timestamps. It returns the number of key/value pairs deleted.
+	DeleteRange(start, end string) (int, error)
+
+	// GetAndDelete gets the value associated with the given key, writes it to
+	// the value interface, and deletes it along with its timestamp. If the key
+	// cannot be found, then ErrKeyNotFound is returned.
+	GetAndDelete(key string, value interface{}) error
+
+	// Swap writes the key/value pair into the Table, in the same way as
+	// Insert, and writes the value that it replaced to the old value
+	// interface. It returns whether or not the key existed. Key/value pairs
+	// that have expired but have not been pruned yet are treated as missing.
+	Swap(key string, value, old interface{}) (bool, error)
+
+	// DeleteIf deletes the key/value pair, along with its timestamp, only if
+	// the current value is equal to the expected value. It returns whether or
+	// not the key/value pair was deleted.
+	DeleteIf(key string, expected interface{}) (bool, error)
+
+	// Rename moves the key/value pair from the old key to the new key,
+	// replacing the key/value pair of the new key if it exists. The new key
+	// keeps the timestamp of the old key, so it expires when the old key
+	// would have, and a key inserted with InsertPersistent stays persistent.
+	// If the old key cannot be found, then ErrKeyNotFound is returned.
+	// Key/value pairs that have expired but have not been pruned yet are
+	// treated as missing.
+	Rename(oldKey, newKey string) error
+
+	// RenameNX is the same as Rename, but returns ErrKeyExists instead of
+	// replacing the key/value pair of the new key if it exists.
+	RenameNX(oldKey, newKey string) error
+
+	// HealthCheck confirms that the underlying db is functioning and that the
+	// table has been pruned within twice the prune interval. If the table has
+	// not, then ErrPruneStalled is returned.
+	HealthCheck(ctx context.Context) error
+
+	// PruneStats returns a snapshot of the pruning activity of the Table.
+	PruneStats() PruneStats
+
+	// AccessCount returns the number of times the key has been read with Get
+	// since it was inserted. If the key cannot be found, then ErrKeyNotFound
+	// is returned. If access counts are not enabled, then
+	// ErrAccessCountsDisabled is returned.
+	AccessCount(key string) (uint64, error)
+
+	// ExpirationChannel returns a channel that receives each key when it
+	// expires. Keys are dropped, instead of blocking the pruning of the Table,
+	// if the buffer of the channel is full. The number of dropped keys is
+	// reported in the prune stats. The channel is closed once the context of
+	// the Table is done.
+	ExpirationChannel() <-chan string
+
+	// GetByPrefix reads all of the key/value pairs that have not expired where
+	// the key begins with the given prefix, and returns the values by their
+	// key. Values are decoded into the value returned by `newValue`. All of the
+	// key/value pairs are held in memory at once, so LiveIterator should be
+	// used instead for prefixes that match a large number of keys.
+	GetByPrefix(prefix string, newValue func() interface{}) (map[string]interface{}, error)
+
+	// ExpirySchedule returns the number of key/value pairs that expire in each
+	// slot, by slot number. It is derived from the timestamps of the key/value
+	// pairs, so key/value pairs that have been deleted with Delete are counted
+	// until they would have expired. Slots that have already passed hold the
+	// key/value pairs that have expired but have not been pruned yet.
+	ExpirySchedule() (map[int64]int, error)
+
+	// Dump writes the key/value pairs in the Table to the writer in the same
+	// form as `db.Dump`, followed by the time remaining until each key/value
+	// pair expires. Key/value pairs that have expired but have not been pruned
+	// yet are shown as expired, and those inserted with InsertPersistent are
+	// shown as persistent.
+	Dump(w io.Writer, newValue func() interface{}, format func(key string, value interface{}) string) error
+
+	// Prewarm prepares the underlying db for the expected number of new
+	// entries, if it implements `db.Prewarmer`. It is only a hint, and does
+	// not change the behaviour of the Table. A number of entries that is not
+	// positive is ignored.
+	Prewarm(expectedEntries int)
+}
+
+// PruneStats describe the pruning activity of a Table.
+type PruneStats struct {
+	// Runs is the total number of prunes.
+	Runs uint64
+	// KeysDeleted is the total number of keys deleted by prunes.
+	KeysDeleted uint64
+	// LastRun is the time at which the last prune finished.
+	LastRun time.Time
+	// LastDuration is how long the last prune took.
+	LastDuration time.Duration
+	// LastErr is the error returned by the last prune, or nil if it succeeded.
+	LastErr error
+	// ExpirationsDropped is the total number of expired keys that were not
+	// sent to the expiration channel because its buffer was full.
+	ExpirationsDropped uint64
+}
+
 type table struct {
+	// expirationsDropped is accessed atomically, so it is the first field to
+	// keep it 64-bit aligned on 32-bit platforms.
+	expirationsDropped uint64
+
 	db            db.DB
 	nameHash      string
 	pruneInterval time.Duration
+	slotSize      time.Duration
+	now           func() time.Time
+	logger        Logger
+	hash          func(data []byte) []byte
+
+	// writeMu is held for writing by GetAndDelete, Swap and DeleteIf when the
+	// underlying db does not implement `db.GetAndDeleter`, `db.Swapper` or
+	// `db.ConditionalDeleter`, and for reading while inserting a value, so
+	// that the fallbacks are atomic with respect to inserts.
+	writeMu *sync.RWMutex
+
+	// accessCountMu is used to make incrementing access counts atomic. It is
+	// nil if access counts are not enabled.
+	accessCountMu *sync.Mutex
+
+	// earlyExpirationBeta scales the probability of a key/value pair expiring
+	// early. It is zero if early expiration is not enabled.
+	earlyExpirationBeta float64
+
+	// pruneMu is held while pruning, and while expiring a key that is read
+	// after it has expired but before it has been pruned.
+	pruneMu *sync.Mutex
+
+	// pruneRate is the maximum number of keys deleted by pruning per second.
+	// It is zero if the number of keys is not limited.
+	pruneRate float64
+
+	// pruneConcurrency is the maximum number of slots pruned concurrently.
+	pruneConcurrency int
+
+	// maxPruneDuration is the time after which a prune stops starting new
+	// slots. It is zero if the time is not limited.
+	maxPruneDuration time.Duration
+
+	// statsMu protects the prune stats, and the time of the last successful
+	// prune.
+	statsMu   *sync.RWMutex
+	stats     PruneStats
+	lastPrune time.Time
+
+	// expirationsMu protects the expiration channel from being sent to after
+	// it has been closed.
+	expirationsMu     *sync.Mutex
+	expirations       chan string
+	expirationsClosed bool
 }
 
 // Insert the key into the table and also record timestamp associated the key
 // in a corresponding table in the db.
 func (ttlTable *table) Insert(key string, value interface{}) error {
+	return ttlTable.insert(key, value, 0)
+}
+
+// insertValue inserts the value of the key, without its slot.
+func (ttlTable *table) insertValue(key string, value interface{}) error {
+	ttlTable.writeMu.RLock()
+	defer ttlTable.writeMu.RUnlock()
+
+	return ttlTable.db.Insert(ttlTable.keyWithPrefix(key), value)
+}
+
+// InsertWithDelta implements the `Table` interface. A delta of zero is the
+// same as no delta.
+func (ttlTable *table) InsertWithDelta(key string, value interface{}, delta time.Duration) error {
+	return ttlTable.insert(key, value, delta)
+}
+
+// insert the key/value pair, along with its delta if it is positive and early
+// expiration is enabled, and record the key in the current slot.
+func (ttlTable *table) insert(key string, value interface{}, delta time.Duration) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
-	if err := ttlTable.db.Insert(ttlTable.keyWithPrefix(key), value); err != nil {
-		return fmt.Errorf("error inserting ttl data: %v", err)
+	if err := ttlTable.insertValue(key, value); err != nil {
+		return fmt.Errorf("error inserting ttl data: %w", err)
+	}
+	if err := ttlTable.deleteMetadata(key); err != nil {
+		return err
+	}
+	if ttlTable.earlyExpirationBeta > 0 && delta > 0 {
+		if err := ttlTable.db.Insert(ttlTable.keyWithDeltaPrefix(key), int64(delta)); err != nil {
+			return fmt.Errorf("error inserting delta: %w", err)
+		}
 	}
 
-	// Delete it from any previous slots in case it exists to prevent the data
-	// from being pruned in advance.
-	slot := ttlTable.slotNo(time.Now())
+	now := ttlTable.now()
 	pointer, err := ttlTable.prunePointer()
 	if err != nil {
-		return fmt.Errorf("error fetching prune pointer: %v", err)
+		return fmt.Errorf("error fetching prune pointer: %w", err)
 	}
-	for i := pointer; i < slot; i++ {
-		if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(key, i)); err != nil {
-			return fmt.Errorf("error removing key=%v from slot=%d (current slot=%d): %v", key, i, slot, err)
+	return ttlTable.insertSlot(key, now, pointer)
+}
+
+// InsertBatch implements the `Table` interface. The slot and prune pointer are
+// only read once for the whole batch. The underlying db does not support
+// transactions, so an error part way through can leave some of the entries
+// inserted.
+func (ttlTable *table) InsertBatch(entries map[string]interface{}) error {
+	for key := range entries {
+		if key == "" {
+			return db.ErrEmptyKey
+		}
+	}
+	for key, value := range entries {
+		if err := ttlTable.insertValue(key, value); err != nil {
+			return fmt.Errorf("error inserting ttl data: %w", err)
+		}
+		if err := ttlTable.deleteMetadata(key); err != nil {
+			return err
+		}
+	}
+
+	now := ttlTable.now()
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	for key := range entries {
+		if err := ttlTable.insertSlot(key, now, pointer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertPersistent implements the `Table` interface.
+func (ttlTable *table) InsertPersistent(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	if err := ttlTable.insertValue(key, value); err != nil {
+		return fmt.Errorf("error inserting ttl data: %w", err)
+	}
+	if err := ttlTable.deleteMetadata(key); err != nil {
+		return err
+	}
+	return ttlTable.deleteSlots(key)
+}
+
+// Get implements the db.Table interface. Expiry is checked before the value is
+// read, so the value is not written to when the key has expired.
+func (ttlTable *table) Get(key string, value interface{}) error {
+	_, err := ttlTable.get(key, value)
+	return err
+}
+
+// GetEarly implements the `Table` interface.
+func (ttlTable *table) GetEarly(key string, value interface{}) (bool, error) {
+	pointer, err := ttlTable.get(key, value)
+	if err != nil {
+		return false, err
+	}
+	return ttlTable.expiresEarly(key, pointer)
+}
+
+// get the value of the key, if it has not expired, and return the prune
+// pointer that was used to check its expiry.
+func (ttlTable *table) get(key string, value interface{}) (int64, error) {
+	if key == "" {
+		return 0, db.ErrEmptyKey
+	}
+
+	// The key might have expired without being pruned yet, in which case it
+	// is treated as if it has already been pruned.
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return 0, fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	slot, expired, err := ttlTable.expiredSlotOf(key, pointer)
+	if err != nil {
+		return 0, err
+	}
+	if expired {
+		if err := ttlTable.expire(key, slot); err != nil {
+			ttlTable.logger.Printf("failed to expire key=%v: %v", key, err)
+		}
+		return 0, db.ErrKeyNotFound
+	}
+	if err := ttlTable.db.Get(ttlTable.keyWithPrefix(key), value); err != nil {
+		return 0, err
+	}
+	return pointer, ttlTable.incrementAccessCount(key)
+}
+
+// Delete only deletes the data, but not the timestamp which will be handled
+// by the prune function.
+func (ttlTable *table) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	if err := ttlTable.db.Delete(ttlTable.keyWithPrefix(key)); err != nil {
+		return err
+	}
+	return ttlTable.deleteMetadata(key)
+}
+
+// Size implements the db.Table interface.
+func (ttlTable *table) Size() (int, error) {
+	return ttlTable.db.Size(ttlTable.keyWithPrefix(""))
+}
+
+// Iterator implements the db.Table interface.
+func (ttlTable *table) Iterator() db.Iterator {
+	return ttlTable.db.Iterator(ttlTable.keyWithPrefix(""))
+}
+
+// LiveIterator implements the `Table` interface. The keys that have expired
+// are found by iterating over each slot that has expired but has not been
+// pruned yet, so keys without a timestamp in these slots, including persistent
+// keys, are live.
+func (ttlTable *table) LiveIterator() db.Iterator {
+	return ttlTable.liveIterator("")
+}
+
+// liveIterator over the key/value pairs in the table that begin with the
+// prefix and have not expired. The prefix is trimmed from the keys.
+func (ttlTable *table) liveIterator(prefix string) db.Iterator {
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return &liveIterator{
+			Iterator: db.SliceIterator(nil, nil, nil),
+			err:      fmt.Errorf("error fetching prune pointer: %w", err),
+		}
+	}
+	expired, err := ttlTable.expiredKeys(prefix, pointer, func(key string) bool { return true })
+	if err != nil {
+		return &liveIterator{
+			Iterator: db.SliceIterator(nil, nil, nil),
+			err:      err,
+		}
+	}
+
+	return &liveIterator{
+		Iterator: ttlTable.db.Iterator(ttlTable.keyWithPrefix(prefix)),
+		expired:  expired,
+	}
+}
+
+// HasBatch implements the `Table` interface. The keys are checked with
+// `db.HasBatch`, so they are checked at once if the underlying db implements
+// `db.BatchChecker`. Key/value pairs that have expired are not deleted.
+func (ttlTable *table) HasBatch(keys []string) ([]bool, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		if key == "" {
+			return nil, db.ErrEmptyKey
+		}
+		prefixed[i] = ttlTable.keyWithPrefix(key)
+	}
+	found, err := db.HasBatch(ttlTable.db, prefixed)
+	if err != nil {
+		return nil, err
+	}
+
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	candidates := map[string]bool{}
+	for i, key := range keys {
+		if found[i] {
+			candidates[key] = true
+		}
+	}
+	expired, err := ttlTable.expiredKeysOf(candidates, pointer)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		if expired[key] {
+			found[i] = false
 		}
 	}
+	return found, nil
+}
+
+// GetByPrefix implements the `Table` interface. Only the key/value pairs, and
+// the timestamps, that begin with the prefix are iterated over.
+func (ttlTable *table) GetByPrefix(prefix string, newValue func() interface{}) (map[string]interface{}, error) {
+	iter := ttlTable.liveIterator(prefix)
+	defer iter.Close()
+
+	values := map[string]interface{}{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, err
+		}
+		value := newValue()
+		if err := iter.Value(value); err != nil {
+			return nil, err
+		}
+		values[prefix+key] = value
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Dump implements the `Table` interface.
+func (ttlTable *table) Dump(w io.Writer, newValue func() interface{}, format func(key string, value interface{}) string) error {
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	now := ttlTable.now()
+	type marker struct {
+		slot      int64
+		timestamp []byte
+	}
+	markers := map[string]marker{}
+	for slot := pointer + 1; slot <= ttlTable.slotNo(now); slot++ {
+		if err := func() error {
+			iter := ttlTable.db.Iterator(ttlTable.keyWithSlotPrefix("", slot))
+			defer iter.Close()
+
+			for iter.Next() {
+				key, err := iter.Key()
+				if err != nil {
+					return err
+				}
+				var timestamp []byte
+				if err := iter.Value(&timestamp); err != nil {
+					return err
+				}
+				markers[key] = marker{slot: slot, timestamp: timestamp}
+			}
+			return iter.Err()
+		}(); err != nil {
+			return fmt.Errorf("error reading slot=%d: %w", slot, err)
+		}
+	}
+
+	if format == nil {
+		format = func(key string, value interface{}) string {
+			return db.FormatValue(value)
+		}
+	}
+	iter := ttlTable.Iterator()
+	defer iter.Close()
+	return db.Dump(w, iter, newValue, func(key string, value interface{}) string {
+		marker, ok := markers[key]
+		switch {
+		case !ok:
+			return format(key, value) + " ttl=persistent"
+		case marker.slot <= ttlTable.expiredSlot(now) && ttlTable.livedInterval(marker.timestamp, marker.slot, now):
+			return format(key, value) + " ttl=expired"
+		default:
+			return fmt.Sprintf("%v ttl=%v", format(key, value), ttlTable.expiry(marker.timestamp, marker.slot).Sub(now))
+		}
+	})
+}
+
+// Prewarm implements the `Table` interface. Each entry is stored along with
+// its timestamp, and its access count if they are enabled, so room is
+// allocated for all of them.
+func (ttlTable *table) Prewarm(expectedEntries int) {
+	prewarmer, ok := ttlTable.db.(db.Prewarmer)
+	if !ok || expectedEntries <= 0 {
+		return
+	}
+	entriesPerKey := 2
+	if ttlTable.accessCountMu != nil {
+		entriesPerKey++
+	}
+	prewarmer.Prewarm(entriesPerKey * expectedEntries)
+}
+
+// ExpirySchedule implements the `Table` interface. Each key/value pair is
+// scheduled by the expiry of its timestamp, in the same way as Get, so a key
+// that was inserted late in its slot can expire after the other key/value
+// pairs in the slot.
+func (ttlTable *table) ExpirySchedule() (map[int64]int, error) {
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+
+	schedule := map[int64]int{}
+	for slot := pointer + 1; slot <= ttlTable.slotNo(ttlTable.now()); slot++ {
+		if err := func() error {
+			iter := ttlTable.db.Iterator(ttlTable.keyWithSlotPrefix("", slot))
+			defer iter.Close()
+
+			for iter.Next() {
+				var timestamp []byte
+				if err := iter.Value(&timestamp); err != nil {
+					return err
+				}
+				schedule[ttlTable.slotNo(ttlTable.expiry(timestamp, slot))]++
+			}
+			return iter.Err()
+		}(); err != nil {
+			return nil, fmt.Errorf("error reading slot=%d: %w", slot, err)
+		}
+	}
+	return schedule, nil
+}
+
+// ExpirePrefix implements the `Table` interface. Unlike Delete, the timestamps
+// of the keys are also deleted.
+func (ttlTable *table) ExpirePrefix(prefix string) (int, error) {
+	keys, err := ttlTable.keys(ttlTable.keyWithPrefix(prefix))
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := ttlTable.db.Delete(ttlTable.keyWithPrefix(prefix + key)); err != nil {
+			return 0, fmt.Errorf("error deleting ttl data: %w", err)
+		}
+		if err := ttlTable.deleteMetadata(prefix + key); err != nil {
+			return 0, err
+		}
+	}
+
+	// Delete the timestamps from all slots that have not been pruned yet.
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return 0, fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	for slot := pointer + 1; slot <= ttlTable.slotNo(ttlTable.now()); slot++ {
+		slotKeys, err := ttlTable.keys(ttlTable.keyWithSlotPrefix(prefix, slot))
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range slotKeys {
+			if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(prefix+key, slot)); err != nil {
+				return 0, fmt.Errorf("error removing key=%v from slot=%d: %w", prefix+key, slot, err)
+			}
+		}
+	}
+	return len(keys), nil
+}
+
+// TouchPrefix implements the `Table` interface. The keys are found through
+// their timestamps in the slots that have not expired, and their timestamps in
+// older slots are removed so that they are not pruned early.
+func (ttlTable *table) TouchPrefix(prefix string) (int, error) {
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return 0, fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	now := ttlTable.now()
+	slot := ttlTable.slotNo(now)
+	first := ttlTable.expiredSlot(now) + 1
+	if first < pointer+1 {
+		first = pointer + 1
+	}
+
+	touched := map[string]struct{}{}
+	for i := first; i <= slot; i++ {
+		slotKeys, err := ttlTable.keys(ttlTable.keyWithSlotPrefix(prefix, i))
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range slotKeys {
+			key = prefix + key
+			if _, ok := touched[key]; ok {
+				continue
+			}
+			// Timestamps are kept by Delete, so the key might be gone.
+			exists, err := ttlTable.exists(key)
+			if err != nil {
+				return 0, err
+			}
+			if !exists {
+				continue
+			}
+			if err := ttlTable.insertSlot(key, now, pointer); err != nil {
+				return 0, err
+			}
+			touched[key] = struct{}{}
+		}
+	}
+	return len(touched), nil
+}
+
+// DeleteRange implements the `Table` interface. The underlying db is not
+// required to be ordered, so every key in the table is read to find the ones
+// in the range. Each key in the range is removed from every slot that has not
+// been pruned yet, so it is never seen by a prune.
+func (ttlTable *table) DeleteRange(start, end string) (int, error) {
+	keys, err := ttlTable.keys(ttlTable.keyWithPrefix(""))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, key := range keys {
+		if key < start || key >= end {
+			continue
+		}
+		if err := ttlTable.db.Delete(ttlTable.keyWithPrefix(key)); err != nil {
+			return 0, fmt.Errorf("error deleting ttl data: %w", err)
+		}
+		if err := ttlTable.deleteMetadata(key); err != nil {
+			return 0, err
+		}
+		if err := ttlTable.deleteSlots(key); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// GetAndDelete implements the `Table` interface. Unless the underlying db
+// implements `db.GetAndDeleter`, it is only atomic with respect to inserts and
+// other calls to GetAndDelete, Swap and DeleteIf.
+func (ttlTable *table) GetAndDelete(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	if getAndDeleter, ok := ttlTable.db.(db.GetAndDeleter); ok {
+		if err := getAndDeleter.GetAndDelete(ttlTable.keyWithPrefix(key), value); err != nil {
+			return err
+		}
+	} else {
+		if err := func() error {
+			ttlTable.writeMu.Lock()
+			defer ttlTable.writeMu.Unlock()
+
+			if err := ttlTable.db.Get(ttlTable.keyWithPrefix(key), value); err != nil {
+				return err
+			}
+			return ttlTable.db.Delete(ttlTable.keyWithPrefix(key))
+		}(); err != nil {
+			return err
+		}
+	}
+
+	if err := ttlTable.deleteMetadata(key); err != nil {
+		return err
+	}
+	return ttlTable.deleteSlots(key)
+}
+
+// Swap implements the `Table` interface. Unless the underlying db implements
+// `db.Swapper`, it is only atomic with respect to inserts and other calls to
+// GetAndDelete, Swap and DeleteIf.
+func (ttlTable *table) Swap(key string, value, old interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	// Expire the key first if it has expired without being pruned yet, so
+	// that its value is not returned.
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return false, fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	slot, expired, err := ttlTable.expiredSlotOf(key, pointer)
+	if err != nil {
+		return false, err
+	}
+	if expired {
+		if err := ttlTable.expire(key, slot); err != nil {
+			return false, fmt.Errorf("error expiring key=%v: %w", key, err)
+		}
+	}
+
+	var existed bool
+	if swapper, ok := ttlTable.db.(db.Swapper); ok {
+		existed, err = swapper.Swap(ttlTable.keyWithPrefix(key), value, old)
+	} else {
+		existed, err = func() (bool, error) {
+			ttlTable.writeMu.Lock()
+			defer ttlTable.writeMu.Unlock()
+
+			err := ttlTable.db.Get(ttlTable.keyWithPrefix(key), old)
+			if err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+				return false, err
+			}
+			return err == nil, ttlTable.db.Insert(ttlTable.keyWithPrefix(key), value)
+		}()
+	}
+	if err != nil {
+		return false, fmt.Errorf("error swapping ttl data: %w", err)
+	}
+	if err := ttlTable.deleteMetadata(key); err != nil {
+		return false, err
+	}
+	return existed, ttlTable.insertSlot(key, ttlTable.now(), pointer)
+}
+
+// DeleteIf implements the `Table` interface. If the underlying db implements
+// `db.ConditionalDeleter`, then the encodings of the values are compared.
+// Otherwise, the current value is decoded into a new value of the same type as
+// the expected value, and compared with `reflect.DeepEqual`, and it is only
+// atomic with respect to inserts and other calls to GetAndDelete, Swap and
+// DeleteIf. In this case, a nil expected value never matches.
+func (ttlTable *table) DeleteIf(key string, expected interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	var deleted bool
+	var err error
+	if conditionalDeleter, ok := ttlTable.db.(db.ConditionalDeleter); ok {
+		deleted, err = conditionalDeleter.DeleteIf(ttlTable.keyWithPrefix(key), expected)
+	} else {
+		deleted, err = func() (bool, error) {
+			ttlTable.writeMu.Lock()
+			defer ttlTable.writeMu.Unlock()
+
+			if expected == nil {
+				return false, nil
+			}
+			current := reflect.New(reflect.TypeOf(expected))
+			if err := ttlTable.db.Get(ttlTable.keyWithPrefix(key), current.Interface()); err != nil {
+				if errors.Is(err, db.ErrKeyNotFound) {
+					return false, nil
+				}
+				return false, err
+			}
+			if !reflect.DeepEqual(current.Elem().Interface(), expected) {
+				return false, nil
+			}
+			return true, ttlTable.db.Delete(ttlTable.keyWithPrefix(key))
+		}()
+	}
+	if err != nil || !deleted {
+		return false, err
+	}
+
+	if err := ttlTable.deleteMetadata(key); err != nil {
+		return false, err
+	}
+	return true, ttlTable.deleteSlots(key)
+}
+
+// Rename implements the `Table` interface. The underlying db must implement
+// `db.Renamer`, otherwise ErrRenameNotSupported is returned. The access counts
+// and deltas of both keys are deleted.
+func (ttlTable *table) Rename(oldKey, newKey string) error {
+	return ttlTable.rename(oldKey, newKey, true)
+}
+
+// RenameNX implements the `Table` interface. It has the same requirements as
+// Rename.
+func (ttlTable *table) RenameNX(oldKey, newKey string) error {
+	return ttlTable.rename(oldKey, newKey, false)
+}
+
+// rename the old key to the new key, replacing the new key only if allowed,
+// and move the timestamp of the old key to the new key.
+func (ttlTable *table) rename(oldKey, newKey string, replace bool) error {
+	if oldKey == "" || newKey == "" {
+		return db.ErrEmptyKey
+	}
+	renamer, ok := ttlTable.db.(db.Renamer)
+	if !ok {
+		return ErrRenameNotSupported
+	}
+
+	// Expire both keys first if they have expired without being pruned yet,
+	// so that neither of them is treated as existing.
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	for _, key := range []string{oldKey, newKey} {
+		slot, expired, err := ttlTable.expiredSlotOf(key, pointer)
+		if err != nil {
+			return err
+		}
+		if expired {
+			if err := ttlTable.expire(key, slot); err != nil {
+				return fmt.Errorf("error expiring key=%v: %w", key, err)
+			}
+		}
+	}
+
+	// Hold the prune lock so that the old key is not pruned between moving
+	// its value and moving its timestamp.
+	ttlTable.pruneMu.Lock()
+	defer ttlTable.pruneMu.Unlock()
+
+	slot, hasSlot, err := ttlTable.liveSlotOf(oldKey, pointer)
+	if err != nil {
+		return err
+	}
+	if replace {
+		err = renamer.Rename(ttlTable.keyWithPrefix(oldKey), ttlTable.keyWithPrefix(newKey))
+	} else {
+		err = renamer.RenameNX(ttlTable.keyWithPrefix(oldKey), ttlTable.keyWithPrefix(newKey))
+	}
+	if err != nil {
+		return err
+	}
+	if oldKey == newKey {
+		return nil
+	}
+
+	for _, key := range []string{oldKey, newKey} {
+		if err := ttlTable.deleteMetadata(key); err != nil {
+			return err
+		}
+	}
+	if err := ttlTable.deleteSlots(newKey); err != nil {
+		return err
+	}
+	if !hasSlot {
+		return nil
+	}
+	var timestamp []byte
+	if err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(oldKey, slot), &timestamp); err != nil {
+		return fmt.Errorf("error getting key=%v from slot=%d: %w", oldKey, slot, err)
+	}
+	if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(oldKey, slot)); err != nil {
+		return fmt.Errorf("error removing key=%v from slot=%d: %w", oldKey, slot, err)
+	}
+	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(newKey, slot), timestamp)
+}
+
+// AccessCount implements the `Table` interface.
+func (ttlTable *table) AccessCount(key string) (uint64, error) {
+	if ttlTable.accessCountMu == nil {
+		return 0, ErrAccessCountsDisabled
+	}
+	if key == "" {
+		return 0, db.ErrEmptyKey
+	}
+
+	ok, err := ttlTable.exists(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, db.ErrKeyNotFound
+	}
+
+	ttlTable.accessCountMu.Lock()
+	defer ttlTable.accessCountMu.Unlock()
 
-	// Insert the current timestamp for future pruning.
-	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(key, slot), []byte{})
+	return ttlTable.accessCount(key)
 }
 
-// Get implements the db.Table interface.
-func (ttlTable *table) Get(key string, value interface{}) error {
-	if key == "" {
-		return db.ErrEmptyKey
-	}
+// ExpirationChannel implements the `Table` interface.
+func (ttlTable *table) ExpirationChannel() <-chan string {
+	return ttlTable.expirations
+}
 
-	return ttlTable.db.Get(ttlTable.keyWithPrefix(key), value)
+// PruneStats implements the `Table` interface.
+func (ttlTable *table) PruneStats() PruneStats {
+	ttlTable.statsMu.RLock()
+	defer ttlTable.statsMu.RUnlock()
+
+	stats := ttlTable.stats
+	stats.ExpirationsDropped = atomic.LoadUint64(&ttlTable.expirationsDropped)
+	return stats
 }
 
-// Delete only deletes the data, but not the timestamp which will be handled
-// by the prune function.
-func (ttlTable *table) Delete(key string) error {
-	if key == "" {
-		return db.ErrEmptyKey
+// HealthCheck implements the `Table` interface. The round-trip is done directly
+// on the underlying db so that it does not leave a timestamp behind.
+func (ttlTable *table) HealthCheck(ctx context.Context) error {
+	if err := db.HealthCheck(ctx, ttlTable.db); err != nil {
+		return err
 	}
 
-	return ttlTable.db.Delete(ttlTable.keyWithPrefix(key))
+	ttlTable.statsMu.RLock()
+	defer ttlTable.statsMu.RUnlock()
+	if since := ttlTable.now().Sub(ttlTable.lastPrune); since > 2*ttlTable.pruneInterval {
+		return fmt.Errorf("%w: last prune was %v ago", ErrPruneStalled, since)
+	}
+	return nil
 }
 
-// Size implements the db.Table interface.
-func (ttlTable *table) Size() (int, error) {
-	return ttlTable.db.Size(ttlTable.keyWithPrefix(""))
+// New returns a new ttl wrapper over the given database. Key/value pairs are
+// pruned after they have been in the table for at least the prune interval.
+// All keys in the underlying database that begin with the hash of the name are
+// reserved for the table, so the database cannot hold any other table with the
+// same name. It panics if the table cannot be initialized, if the prune
+// interval is smaller than MinInterval, or if the reserved prefix is in use.
+func New(ctx context.Context, database db.DB, name string, pruneInterval time.Duration, opts ...Option) Table {
+	ttlTable, err := TryNew(ctx, database, name, pruneInterval, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create ttl table, err = %v", err))
+	}
+	return ttlTable
 }
 
-// Iterator implements the db.Table interface.
-func (ttlTable *table) Iterator() db.Iterator {
-	return ttlTable.db.Iterator(ttlTable.keyWithPrefix(""))
+// TryNew is the same as New, but returns an error instead of panicking. If the
+// prune interval is smaller than MinInterval, then ErrIntervalTooSmall is
+// returned. If the database has never held the table, but has keys with its
+// reserved prefix, then ErrReservedPrefix is returned. If the name hash does
+// not produce outputs of a fixed length, then ErrInvalidHash is returned.
+func TryNew(ctx context.Context, database db.DB, name string, pruneInterval time.Duration, opts ...Option) (Table, error) {
+	return newTable(ctx, database, name, pruneInterval, pruneInterval, opts)
+}
+
+// NewWithGranularity returns a new ttl wrapper over the given database where
+// the time at which key/value pairs expire is tracked in slots of the given
+// size, instead of slots of the prune interval. Key/value pairs expire between
+// the prune interval and the prune interval plus the slot size after they are
+// inserted, regardless of how often the table is pruned. It panics if either
+// the prune interval or the slot size is smaller than MinInterval.
+func NewWithGranularity(ctx context.Context, database db.DB, name string, pruneInterval, slotSize time.Duration, opts ...Option) Table {
+	ttlTable, err := newTable(ctx, database, name, pruneInterval, slotSize, opts)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create ttl table, err = %v", err))
+	}
+	return ttlTable
 }
 
-// New returns a new ttl wrapper over the given database.
-// The underlying database cannot have any database has a prefix of `ttl_`.
-func New(ctx context.Context, database db.DB, name string, pruneInterval time.Duration) db.Table {
-	hash := sha3.Sum256([]byte(name))
+func newTable(ctx context.Context, database db.DB, name string, pruneInterval, slotSize time.Duration, opts []Option) (Table, error) {
+	if pruneInterval < MinInterval {
+		return nil, fmt.Errorf("%w: prune interval = %v, min interval = %v", ErrIntervalTooSmall, pruneInterval, MinInterval)
+	}
+	if slotSize < MinInterval {
+		return nil, fmt.Errorf("%w: slot size = %v, min interval = %v", ErrIntervalTooSmall, slotSize, MinInterval)
+	}
+
 	ttlDB := &table{
 		db:            database,
-		nameHash:      string(hash[:]),
 		pruneInterval: pruneInterval,
+		slotSize:      slotSize,
+		now:           time.Now,
+		logger:        stdLogger{},
+		hash:          sha3Sum256,
+
+		writeMu: new(sync.RWMutex),
+		pruneMu: new(sync.Mutex),
+
+		statsMu: new(sync.RWMutex),
+
+		expirationsMu: new(sync.Mutex),
+		expirations:   make(chan string, DefaultExpirationBuffer),
 	}
+	for _, opt := range opts {
+		opt(ttlDB)
+	}
+	ttlDB.lastPrune = ttlDB.now()
 
-	// Initialize the prune pointer if not exist
-	_, err := ttlDB.prunePointer()
+	nameHash, err := checkHash(ttlDB.hash, name)
 	if err != nil {
-		panic(fmt.Sprintf("cannot get prune pointer, err = %v", err))
+		return nil, err
+	}
+	ttlDB.nameHash = nameHash
+
+	if err := ttlDB.checkReservedPrefix(name); err != nil {
+		return nil, err
+	}
+
+	// Initialize the prune pointer if not exist
+	if _, err := ttlDB.prunePointer(); err != nil {
+		return nil, fmt.Errorf("error initializing prune pointer: %w", err)
 	}
 
 	// NOTE: WE NEED TO TAKE A EXTERNAL CONTEXT TELLING US WHEN TO STOP PRUNING
 	// OR WHEN THE DB IS CLOSING. THIS IS BECAUSE WE NEED TO CREATE AN ITERATOR
-	// WHEN PRUNING AND IT CAN CAUSE PANIC IF THE UNDERLYING DB IS CLOSED.
+	// WHEN PRUNING AND IT CAN CAUSE PANIC IF THE UNDERLYING DB IS CLOSED. IF THE
+	// DB IS CLOSED BEFORE THE CONTEXT IS DONE, PRUNING STOPS INSTEAD.
 	go ttlDB.runPruneOnInterval(ctx)
-	return ttlDB
+	return ttlDB, nil
 }
 
 // prune will periodically prune the underlying database and stores the prune pointer
-// in the db.
+// in the db. Pruning stops when the context is done, or when a prune fails,
+// which includes the underlying db being closed.
 func (ttlTable *table) runPruneOnInterval(ctx context.Context) {
+	defer ttlTable.closeExpirations()
+
 	ticker := time.NewTicker(ttlTable.pruneInterval)
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			pointer, err := ttlTable.prunePointer()
-			if err != nil {
-				panic(fmt.Sprintf("cannot read prune pointer, err = %v", err))
+			// The ticker and the context can be ready at the same time, so we
+			// check the context again before touching the db as it might
+			// have been closed.
+			if ctx.Err() != nil {
+				return
 			}
-
-			// TODO: How can we catch the error caused by the underlying db
-			// being closed?
-			if err := ttlTable.prune(pointer); err != nil {
-				log.Println(fmt.Errorf("failed to prune table: %v", err))
+			if err := ttlTable.pruneOnce(); err != nil {
+				if errors.Is(err, db.ErrClosed) {
+					ttlTable.logger.Printf("stopped pruning table: %v", err)
+				} else {
+					ttlTable.logger.Printf("failed to prune table: %v", err)
+				}
 				return
 			}
 		}
 	}
 }
 
+// pruneOnce reads the prune pointer and prunes the table. Underlying dbs that
+// do not return `db.ErrClosed` can panic when they are closed during a prune,
+// so panics are recovered and returned as errors.
+func (ttlTable *table) pruneOnce() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered from panic while pruning, the underlying db may be closed: %v", r)
+		}
+	}()
+
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return fmt.Errorf("cannot read prune pointer: %w", err)
+	}
+	return ttlTable.prune(pointer)
+}
+
 func (ttlTable *table) prune(pointer int64) error {
-	// Note: we subtract 1 to ensure pruning is only done on data that has been
-	// around for _at least_ the interval instead of _at most_.
-	newSlotToDelete := ttlTable.slotNo(time.Now().Add(-ttlTable.pruneInterval)) - 1
+	start := time.Now()
+	deleted, err := func() (int, error) {
+		ttlTable.pruneMu.Lock()
+		defer ttlTable.pruneMu.Unlock()
+
+		return ttlTable.pruneSlots(pointer)
+	}()
+
+	ttlTable.statsMu.Lock()
+	defer ttlTable.statsMu.Unlock()
+
+	ttlTable.stats.Runs++
+	ttlTable.stats.KeysDeleted += uint64(deleted)
+	ttlTable.stats.LastRun = ttlTable.now()
+	ttlTable.stats.LastDuration = time.Since(start)
+	ttlTable.stats.LastErr = err
+	if err == nil {
+		ttlTable.lastPrune = ttlTable.stats.LastRun
+	}
+	return err
+}
+
+// pruneSlots prunes all slots after the pointer that have expired, and returns
+// the number of keys deleted. The pointer is only written if it advances.
+func (ttlTable *table) pruneSlots(pointer int64) (int, error) {
+	start := time.Now()
+	limit := ttlTable.pruneLimit()
+	newSlotToDelete := ttlTable.expiredSlot(ttlTable.now())
+	if limit < 0 && ttlTable.pruneConcurrency > 1 && newSlotToDelete > pointer+1 {
+		return ttlTable.pruneSlotsConcurrently(pointer, newSlotToDelete, start)
+	}
+
+	deleted := 0
 	for slot := pointer + 1; slot <= newSlotToDelete; slot++ {
-		if err := ttlTable.pruneTimeSlot(slot); err != nil {
-			return err
+		if slot > pointer+1 && ttlTable.pruneTimedOut(start) {
+			// Resume from this slot in the next prune.
+			newSlotToDelete = slot - 1
+			break
+		}
+		n, done, err := ttlTable.pruneTimeSlot(slot, limit)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if !done {
+			// Resume from this slot in the next prune.
+			newSlotToDelete = slot - 1
+			break
+		}
+		if limit >= 0 {
+			limit -= n
+		}
+	}
+
+	// The pointer is written once, after all of the slots have been pruned,
+	// and only if it has advanced, so that prunes that delete nothing do not
+	// write to the db.
+	if newSlotToDelete <= pointer {
+		return deleted, nil
+	}
+	return deleted, ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), newSlotToDelete)
+}
+
+// pruneSlotsConcurrently prunes the slots after the pointer, up to and
+// including the given slot, using a bounded number of workers, and returns the
+// number of keys deleted. Workers stop starting new slots once the prune that
+// started at the given time has timed out. The prune pointer is advanced to the last slot
+// before the first slot that could not be pruned, so that a crash or an error
+// never leaves a slot behind the pointer with keys in it.
+func (ttlTable *table) pruneSlotsConcurrently(pointer, newSlotToDelete int64, start time.Time) (int, error) {
+	n := int(newSlotToDelete - pointer)
+	concurrency := ttlTable.pruneConcurrency
+	if concurrency > n {
+		concurrency = n
+	}
+
+	deleted := make([]int, n)
+	errs := make([]error, n)
+	var failed int32
+	slots := make(chan int, n)
+	for i := 0; i < n; i++ {
+		slots <- i
+	}
+	close(slots)
+
+	wg := new(sync.WaitGroup)
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range slots {
+				// Stop taking slots once one has failed, because the pointer
+				// cannot advance past it anyway, or once the prune has timed
+				// out. The first slot is always pruned so that pruning makes
+				// progress.
+				if atomic.LoadInt32(&failed) == 1 || i > 0 && ttlTable.pruneTimedOut(start) {
+					errs[i] = errPruneSkipped
+					continue
+				}
+				deleted[i], errs[i] = ttlTable.pruneSlotRecovered(pointer + 1 + int64(i))
+				if errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Find the first slot that was not pruned, and the error that caused the
+	// slots to be skipped.
+	total := 0
+	completed := n
+	var err error
+	for i := 0; i < n; i++ {
+		total += deleted[i]
+		if errs[i] != nil && completed == n {
+			completed = i
+		}
+		if errs[i] != nil && errs[i] != errPruneSkipped && err == nil {
+			err = errs[i]
+		}
+	}
+	if completed > 0 {
+		if insertErr := ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), pointer+int64(completed)); insertErr != nil && err == nil {
+			err = insertErr
+		}
+	}
+	return total, err
+}
+
+// errPruneSkipped marks the slots that were not pruned because another slot
+// failed to be pruned, or because the prune timed out. It also marks a slot
+// that still has keys that have not been in the table for the prune interval,
+// which is pruned again by a later prune.
+var errPruneSkipped = errors.New("prune skipped")
+
+// pruneSlotRecovered prunes all of the keys in the slot. It runs in its own
+// goroutine, where the recover in pruneOnce has no effect, so panics are
+// recovered and returned as errors.
+func (ttlTable *table) pruneSlotRecovered(slot int64) (deleted int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered from panic while pruning slot=%d, the underlying db may be closed: %v", slot, r)
+		}
+	}()
+
+	deleted, done, err := ttlTable.pruneTimeSlot(slot, -1)
+	if err == nil && !done {
+		// The slot still has keys that have not been in the table for the
+		// prune interval, so the pointer cannot advance past it.
+		err = errPruneSkipped
+	}
+	return deleted, err
+}
+
+// pruneTimedOut returns whether or not a prune that started at the given time
+// has run for longer than the max prune duration.
+func (ttlTable *table) pruneTimedOut(start time.Time) bool {
+	return ttlTable.maxPruneDuration > 0 && time.Since(start) >= ttlTable.maxPruneDuration
+}
+
+// pruneLimit returns the maximum number of keys that can be deleted in one
+// prune, or -1 if the number of keys is not limited.
+func (ttlTable *table) pruneLimit() int {
+	if ttlTable.pruneRate <= 0 {
+		return -1
+	}
+	limit := int(ttlTable.pruneRate * ttlTable.pruneInterval.Seconds())
+	if limit < 1 {
+		return 1
+	}
+	return limit
+}
+
+// insertSlot removes the key from any slot after the prune pointer and before
+// the slot of the given moment, and then records the key in that slot along
+// with the moment at which it was inserted.
+func (ttlTable *table) insertSlot(key string, now time.Time, pointer int64) error {
+	slot := ttlTable.slotNo(now)
+
+	// Delete it from any previous slots in case it exists to prevent the data
+	// from being pruned in advance.
+	for i := pointer; i < slot; i++ {
+		if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(key, i)); err != nil {
+			return fmt.Errorf("error removing key=%v from slot=%d (current slot=%d): %w", key, i, slot, err)
+		}
+	}
+
+	// Insert the current timestamp for future pruning.
+	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(key, slot), insertTimestamp(now))
+}
+
+// deleteSlots removes the key from all slots that have not been pruned yet.
+func (ttlTable *table) deleteSlots(key string) error {
+	pointer, err := ttlTable.prunePointer()
+	if err != nil {
+		return fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	slot := ttlTable.slotNo(ttlTable.now())
+	for i := pointer + 1; i <= slot; i++ {
+		if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(key, i)); err != nil {
+			return fmt.Errorf("error removing key=%v from slot=%d (current slot=%d): %w", key, i, slot, err)
 		}
 	}
-	pointer = newSlotToDelete
-	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), newSlotToDelete)
+	return nil
 }
 
-func (ttlTable *table) pruneTimeSlot(slot int64) error {
+// pruneTimeSlot deletes the keys in the slot, up to the given limit, and
+// returns the number of keys deleted and whether or not the slot is empty. A
+// negative limit means that the number of keys is not limited. Keys that have
+// not been in the table for the prune interval, according to their insert
+// timestamp, are kept, and the slot is not empty.
+func (ttlTable *table) pruneTimeSlot(slot int64, limit int) (int, bool, error) {
+	now := ttlTable.now()
 	slotTable := ttlTable.keyWithSlotPrefix("", slot)
 	iter := ttlTable.db.Iterator(slotTable)
 	defer iter.Close()
 
+	deleted := 0
+	done := true
 	for iter.Next() {
+		if limit >= 0 && deleted >= limit {
+			return deleted, false, nil
+		}
 		key, err := iter.Key()
 		if err != nil {
-			return err
+			return deleted, false, err
+		}
+		var timestamp []byte
+		if err := iter.Value(&timestamp); err != nil {
+			return deleted, false, err
+		}
+		if !ttlTable.livedInterval(timestamp, slot, now) {
+			done = false
+			continue
 		}
 		if err := ttlTable.db.Delete(ttlTable.keyWithPrefix(key)); err != nil {
-			return err
+			return deleted, false, err
+		}
+		if err := ttlTable.deleteMetadata(key); err != nil {
+			return deleted, false, err
 		}
 		if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(key, slot)); err != nil {
-			return err
+			return deleted, false, err
+		}
+		ttlTable.publishExpiration(key)
+		deleted++
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, false, err
+	}
+
+	return deleted, done, nil
+}
+
+// expiredSlotOf returns the slot of the key if the slot has expired but has not
+// been pruned yet, and the key has been in the table for the prune interval. A
+// key that is not in any such slot has not expired. It gets the key from each
+// of these slots in turn, so its cost grows with the number of slots that
+// pruning has fallen behind by, in the same way as insertSlot.
+func (ttlTable *table) expiredSlotOf(key string, pointer int64) (int64, bool, error) {
+	now := ttlTable.now()
+	for slot := pointer + 1; slot <= ttlTable.expiredSlot(now); slot++ {
+		var timestamp []byte
+		err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(key, slot), &timestamp)
+		if err == nil {
+			return slot, ttlTable.livedInterval(timestamp, slot, now), nil
+		}
+		if !errors.Is(err, db.ErrKeyNotFound) {
+			return 0, false, fmt.Errorf("error getting key=%v from slot=%d: %w", key, slot, err)
+		}
+	}
+	return 0, false, nil
+}
+
+// expiredKeysOf returns which of the keys have expired in the same way as
+// expiredSlotOf. Instead of getting each key from each slot, each slot that has
+// expired but has not been pruned yet is iterated over once, so the cost grows
+// with the number of keys in these slots, and not with the number of keys that
+// are checked.
+func (ttlTable *table) expiredKeysOf(keys map[string]bool, pointer int64) (map[string]bool, error) {
+	if len(keys) == 0 {
+		return map[string]bool{}, nil
+	}
+	return ttlTable.expiredKeys("", pointer, func(key string) bool { return keys[key] })
+}
+
+// expiredKeys returns which of the keys that begin with the prefix, and are
+// kept, have expired in the same way as expiredSlotOf. Keys that are not in a
+// slot that has expired but has not been pruned yet are not returned. The
+// prefix is trimmed from the keys, and the keys that are kept.
+func (ttlTable *table) expiredKeys(prefix string, pointer int64, keep func(key string) bool) (map[string]bool, error) {
+	expired := map[string]bool{}
+	now := ttlTable.now()
+	for slot := pointer + 1; slot <= ttlTable.expiredSlot(now); slot++ {
+		if err := func() error {
+			iter := ttlTable.db.Iterator(ttlTable.keyWithSlotPrefix(prefix, slot))
+			defer iter.Close()
+
+			for iter.Next() {
+				key, err := iter.Key()
+				if err != nil {
+					return err
+				}
+				if _, ok := expired[key]; ok || !keep(key) {
+					// Like expiredSlotOf, only the first slot of the key
+					// is checked.
+					continue
+				}
+				var timestamp []byte
+				if err := iter.Value(&timestamp); err != nil {
+					return err
+				}
+				expired[key] = ttlTable.livedInterval(timestamp, slot, now)
+			}
+			return iter.Err()
+		}(); err != nil {
+			return nil, fmt.Errorf("error reading slot=%d: %w", slot, err)
 		}
 	}
+	return expired, nil
+}
+
+// expire deletes a key that has expired in the given slot, in the same way as
+// it would be deleted by a prune. The key is only deleted if it is still in
+// the slot once the prune lock is held, so that it is not deleted if the slot
+// has been pruned in the meantime.
+func (ttlTable *table) expire(key string, slot int64) error {
+	ttlTable.pruneMu.Lock()
+	defer ttlTable.pruneMu.Unlock()
+
+	var timestamp []byte
+	if err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(key, slot), &timestamp); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := ttlTable.db.Delete(ttlTable.keyWithPrefix(key)); err != nil {
+		return err
+	}
+	if err := ttlTable.deleteMetadata(key); err != nil {
+		return err
+	}
+	if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(key, slot)); err != nil {
+		return err
+	}
+	ttlTable.publishExpiration(key)
+	return nil
+}
+
+// publishExpiration sends the key to the expiration channel, or drops it if
+// the buffer of the channel is full.
+func (ttlTable *table) publishExpiration(key string) {
+	ttlTable.expirationsMu.Lock()
+	defer ttlTable.expirationsMu.Unlock()
+
+	if ttlTable.expirationsClosed {
+		return
+	}
+	select {
+	case ttlTable.expirations <- key:
+	default:
+		atomic.AddUint64(&ttlTable.expirationsDropped, 1)
+	}
+}
+
+// closeExpirations closes the expiration channel.
+func (ttlTable *table) closeExpirations() {
+	ttlTable.expirationsMu.Lock()
+	defer ttlTable.expirationsMu.Unlock()
+
+	ttlTable.expirationsClosed = true
+	close(ttlTable.expirations)
+}
+
+// accessCount returns the access count of the key. The caller must hold the
+// access count lock.
+func (ttlTable *table) accessCount(key string) (uint64, error) {
+	var count uint64
+	if err := ttlTable.db.Get(ttlTable.keyWithCountPrefix(key), &count); err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+		return 0, fmt.Errorf("error getting access count: %w", err)
+	}
+	return count, nil
+}
+
+// incrementAccessCount of the key, if access counts are enabled.
+func (ttlTable *table) incrementAccessCount(key string) error {
+	if ttlTable.accessCountMu == nil {
+		return nil
+	}
+
+	ttlTable.accessCountMu.Lock()
+	defer ttlTable.accessCountMu.Unlock()
+
+	count, err := ttlTable.accessCount(key)
+	if err != nil {
+		return err
+	}
+	if err := ttlTable.db.Insert(ttlTable.keyWithCountPrefix(key), count+1); err != nil {
+		return fmt.Errorf("error inserting access count: %w", err)
+	}
+	return nil
+}
+
+// deleteAccessCount of the key, if access counts are enabled.
+func (ttlTable *table) deleteAccessCount(key string) error {
+	if ttlTable.accessCountMu == nil {
+		return nil
+	}
 
+	ttlTable.accessCountMu.Lock()
+	defer ttlTable.accessCountMu.Unlock()
+
+	if err := ttlTable.db.Delete(ttlTable.keyWithCountPrefix(key)); err != nil {
+		return fmt.Errorf("error deleting access count: %w", err)
+	}
+	return nil
+}
+
+// deleteMetadata deletes the access count and the delta of the key, if they
+// are enabled.
+func (ttlTable *table) deleteMetadata(key string) error {
+	if err := ttlTable.deleteAccessCount(key); err != nil {
+		return err
+	}
+	if ttlTable.earlyExpirationBeta > 0 {
+		if err := ttlTable.db.Delete(ttlTable.keyWithDeltaPrefix(key)); err != nil {
+			return fmt.Errorf("error deleting delta: %w", err)
+		}
+	}
 	return nil
 }
 
+// expiresEarly returns whether or not the key, which has not expired, should
+// be reported as expiring early, if early expiration is enabled. A key that
+// has no delta, or is not in any slot that has not expired, never expires
+// early.
+func (ttlTable *table) expiresEarly(key string, pointer int64) (bool, error) {
+	if ttlTable.earlyExpirationBeta <= 0 {
+		return false, nil
+	}
+
+	var delta int64
+	if err := ttlTable.db.Get(ttlTable.keyWithDeltaPrefix(key), &delta); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting delta: %w", err)
+	}
+
+	slot, ok, err := ttlTable.liveSlotOf(key, pointer)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// The key expires once the slot after it has been in the table for the
+	// prune interval. Subtracting the logarithm of a number in (0, 1] gives an
+	// exponentially distributed gap, so the probability of expiring early is
+	// exp(-remaining / (delta * beta)).
+	now := ttlTable.now()
+	expiry := time.Unix(0, (slot+1)*ttlTable.slotSize.Nanoseconds()).Add(ttlTable.pruneInterval)
+	gap := -float64(delta) * ttlTable.earlyExpirationBeta * math.Log(1-rand.Float64())
+	return !now.Add(time.Duration(gap)).Before(expiry), nil
+}
+
+// liveSlotOf returns the slot of the key if the slot has not expired. A key
+// that is not in any such slot has either expired, or has no timestamp.
+func (ttlTable *table) liveSlotOf(key string, pointer int64) (int64, bool, error) {
+	now := ttlTable.now()
+	from := ttlTable.expiredSlot(now) + 1
+	if pointer >= from {
+		from = pointer + 1
+	}
+	for slot := ttlTable.slotNo(now); slot >= from; slot-- {
+		var timestamp []byte
+		err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(key, slot), &timestamp)
+		if err == nil {
+			return slot, true, nil
+		}
+		if !errors.Is(err, db.ErrKeyNotFound) {
+			return 0, false, fmt.Errorf("error getting key=%v from slot=%d: %w", key, slot, err)
+		}
+	}
+	return 0, false, nil
+}
+
+// exists returns whether or not the key is in the table, without decoding its
+// value. It is checked with `db.HasBatch`, so the underlying db does not need
+// to iterate over the keys that begin with it if it can check keys directly.
+func (ttlTable *table) exists(key string) (bool, error) {
+	found, err := db.HasBatch(ttlTable.db, []string{ttlTable.keyWithPrefix(key)})
+	if err != nil {
+		return false, err
+	}
+	return found[0], nil
+}
+
+// keys returns all keys in the underlying db that begin with the given prefix.
+// The prefix is trimmed from the returned keys. Keys are read before they are
+// returned so that callers can safely delete them.
+func (ttlTable *table) keys(prefix string) ([]string, error) {
+	iter := ttlTable.db.Iterator(prefix)
+	defer iter.Close()
+
+	keys := []string{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// insertTimestamp returns the timestamp that is recorded in the slot of a key
+// inserted at the given moment.
+func insertTimestamp(moment time.Time) []byte {
+	return []byte(strconv.FormatInt(moment.UnixNano(), 10))
+}
+
+// livedInterval returns whether or not a key with the given insert timestamp
+// in the given slot has been in the table for at least the prune interval at
+// the given moment. Keys inserted before timestamps were recorded have an empty
+// timestamp, and only expire with their slot.
+func (ttlTable *table) livedInterval(timestamp []byte, slot int64, moment time.Time) bool {
+	insertedAt, ok := ttlTable.insertedAt(timestamp, slot)
+	return !ok || moment.Sub(insertedAt) >= ttlTable.pruneInterval
+}
+
+// insertedAt returns the moment at which a key in the given slot was inserted,
+// according to its timestamp, and whether or not it has a valid timestamp. A
+// timestamp after the end of the slot comes from a clock that has moved
+// backwards, or from a corrupt marker. It is capped at one prune interval after
+// the end of the slot, so that it can delay the pruning of the slot, and so the
+// advance of the prune pointer, by at most one prune interval.
+func (ttlTable *table) insertedAt(timestamp []byte, slot int64) (time.Time, bool) {
+	if len(timestamp) == 0 {
+		return time.Time{}, false
+	}
+	ns, err := strconv.ParseInt(string(timestamp), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	insertedAt := time.Unix(0, ns)
+	latest := time.Unix(0, (slot+1)*ttlTable.slotSize.Nanoseconds()).Add(ttlTable.pruneInterval)
+	if insertedAt.After(latest) {
+		return latest, true
+	}
+	return insertedAt, true
+}
+
+// expiry returns the moment at which a key with the given insert timestamp in
+// the given slot expires, which is once the end of its slot, and the moment at
+// which it was inserted, are both at least the prune interval ago.
+func (ttlTable *table) expiry(timestamp []byte, slot int64) time.Time {
+	expiry := time.Unix(0, (slot+1)*ttlTable.slotSize.Nanoseconds()).Add(ttlTable.pruneInterval)
+	if insertedAt, ok := ttlTable.insertedAt(timestamp, slot); ok && insertedAt.Add(ttlTable.pruneInterval).After(expiry) {
+		return insertedAt.Add(ttlTable.pruneInterval)
+	}
+	return expiry
+}
+
 // slotNo returns the slot number in which the given unix timestamp is belonging to.
 func (ttlTable *table) slotNo(moment time.Time) int64 {
-	return moment.UnixNano() / ttlTable.pruneInterval.Nanoseconds()
+	return moment.UnixNano() / ttlTable.slotSize.Nanoseconds()
+}
+
+// expiredSlot returns the latest slot which has expired at the given moment.
+// All slots before or equal to it have expired.
+func (ttlTable *table) expiredSlot(moment time.Time) int64 {
+	// Note: we subtract 1 to ensure pruning is only done on data that has been
+	// around for _at least_ the interval instead of _at most_.
+	return ttlTable.slotNo(moment.Add(-ttlTable.pruneInterval)) - 1
+}
+
+// sha3Sum256 is the default hash of the table name.
+func sha3Sum256(data []byte) []byte {
+	hash := sha3.Sum256(data)
+	return hash[:]
+}
+
+// checkHash returns the hash of the name, or ErrInvalidHash if the hash is
+// empty, or if it does not have the same length as the hash of other inputs.
+// The length can only be checked for a few inputs, so this catches hashes that
+// are obviously not of a fixed length.
+func checkHash(hash func(data []byte) []byte, name string) (string, error) {
+	nameHash := hash([]byte(name))
+	if len(nameHash) == 0 {
+		return "", fmt.Errorf("%w: empty hash of name %v", ErrInvalidHash, name)
+	}
+	for _, data := range []string{"", "a", strings.Repeat("a", 1024)} {
+		if n := len(hash([]byte(data))); n != len(nameHash) {
+			return "", fmt.Errorf("%w: hash of name %v has length %v, but hash of %v bytes has length %v", ErrInvalidHash, name, len(nameHash), len(data), n)
+		}
+	}
+	return string(nameHash), nil
+}
+
+// checkReservedPrefix returns ErrReservedPrefix if the prune pointer has never
+// been initialized, but there are keys with the prefix reserved for the table.
+// The prune pointer is initialized when the table is created, so its absence
+// means that the keys were written by something else. Tables that already
+// exist are not scanned, so that reopening a large table stays cheap.
+func (ttlTable *table) checkReservedPrefix(name string) error {
+	var pointer int64
+	err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), &pointer)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, db.ErrKeyNotFound) {
+		return fmt.Errorf("error fetching prune pointer: %w", err)
+	}
+	size, err := ttlTable.db.Size(ttlTable.nameHash)
+	if err != nil {
+		return fmt.Errorf("error checking reserved prefix: %w", err)
+	}
+	if size > 0 {
+		return fmt.Errorf("%w: %v keys have the prefix of table %v", ErrReservedPrefix, size, name)
+	}
+	return nil
 }
 
 // prunePointer returns the current prune pointer which all slots before or equals to
@@ -169,18 +1876,65 @@ func (ttlTable *table) slotNo(moment time.Time) int64 {
 func (ttlTable *table) prunePointer() (int64, error) {
 	var pointer int64
 	err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), &pointer)
-	if err == db.ErrKeyNotFound {
-		slot := ttlTable.slotNo(time.Now())
+	if errors.Is(err, db.ErrKeyNotFound) {
+		slot := ttlTable.slotNo(ttlTable.now())
 		return slot - 1, ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), slot-1)
 	}
 	return pointer, err
 }
 
+// The keys in the underlying db begin with the fixed-length hash of the table
+// name, followed by a marker that ends with "_", and end with the key. The
+// markers never contain the key, and the only variable part of a marker is a
+// decimal slot number, which cannot contain "_". So a key can contain any
+// bytes, including the separators, without colliding with another key, and
+// iterating over a marker never includes the keys of another marker.
+
 func (ttlTable *table) keyWithSlotPrefix(key string, i int64) string {
 	// Use "-" instead of "_" to distinguish between the actual data and time-slot data.
-	return fmt.Sprintf("%v-slot%d_%v", ttlTable.nameHash, i, key)
+	return ttlTable.nameHash + SlotToken + strconv.FormatInt(i, 10) + "_" + key
+}
+
+func (ttlTable *table) keyWithCountPrefix(key string) string {
+	return ttlTable.nameHash + "-count_" + key
+}
+
+func (ttlTable *table) keyWithDeltaPrefix(key string) string {
+	return ttlTable.nameHash + "-delta_" + key
 }
 
 func (ttlTable *table) keyWithPrefix(name string) string {
-	return fmt.Sprintf("%v_%v", ttlTable.nameHash, name)
+	return ttlTable.nameHash + "_" + name
+}
+
+// liveIterator is a `db.Iterator` that skips keys which have expired.
+type liveIterator struct {
+	db.Iterator
+	expired map[string]bool
+
+	// err is the error from reading the expired keys, if any.
+	err error
+}
+
+// Err implements the `db.Iterator` interface.
+func (iter *liveIterator) Err() error {
+	if iter.err != nil {
+		return iter.err
+	}
+	return iter.Iterator.Err()
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *liveIterator) Next() bool {
+	for iter.Iterator.Next() {
+		key, err := iter.Iterator.Key()
+		if err != nil {
+			// Let the caller see the error when calling Key.
+			return true
+		}
+		if !iter.expired[key] {
+			return true
+		}
+	}
+	return false
 }
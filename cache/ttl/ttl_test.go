@@ -1,9 +1,15 @@
 package ttl_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing/quick"
 	"time"
 
@@ -11,10 +17,197 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/renproject/kv/cache/ttl"
 
+	"github.com/renproject/kv/codec"
 	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/leveldb"
+	"github.com/renproject/kv/memdb"
 	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
 )
 
+var errFailure = errors.New("failure")
+
+// failingDB is a `db.DB` that returns an error from every insert and get after
+// it has been told to fail, and from every delete after it has been told to
+// fail deletes. Deletes can be told to fail while the table is being pruned in
+// the background.
+type failingDB struct {
+	db.DB
+	fail        bool
+	failDeletes int32
+}
+
+func (failingDB *failingDB) Insert(key string, value interface{}) error {
+	if failingDB.fail {
+		return errFailure
+	}
+	return failingDB.DB.Insert(key, value)
+}
+
+func (failingDB *failingDB) Get(key string, value interface{}) error {
+	if failingDB.fail {
+		return errFailure
+	}
+	return failingDB.DB.Get(key, value)
+}
+
+func (failingDB *failingDB) Delete(key string) error {
+	if atomic.LoadInt32(&failingDB.failDeletes) == 1 {
+		return errFailure
+	}
+	return failingDB.DB.Delete(key)
+}
+
+// poisonedDB is a `db.DB` that returns an error when deleting keys that end
+// with "poison" while it is poisoned.
+type poisonedDB struct {
+	db.DB
+	poisoned int32
+}
+
+func (poisonedDB *poisonedDB) Delete(key string) error {
+	if atomic.LoadInt32(&poisonedDB.poisoned) == 1 && strings.HasSuffix(key, "poison") {
+		return errFailure
+	}
+	return poisonedDB.DB.Delete(key)
+}
+
+// slowDB is a `db.DB` where every delete takes the given time. The time must
+// not be changed while the db is being used.
+type slowDB struct {
+	db.DB
+	delay time.Duration
+}
+
+func (slowDB *slowDB) Delete(key string) error {
+	time.Sleep(slowDB.delay)
+	return slowDB.DB.Delete(key)
+}
+
+// closingDB is a `db.DB` that panics when creating an iterator after it has
+// been closed, like an underlying db that does not detect being closed.
+type closingDB struct {
+	db.DB
+	closed int32
+}
+
+func (closingDB *closingDB) Iterator(prefix string) db.Iterator {
+	if atomic.LoadInt32(&closingDB.closed) == 1 {
+		panic("db closed")
+	}
+	return closingDB.DB.Iterator(prefix)
+}
+
+// failingSlotsDB is a `db.DB` where iterating over the keys in a slot fails
+// after they have been read.
+type failingSlotsDB struct {
+	db.DB
+}
+
+func (failingSlotsDB *failingSlotsDB) Iterator(prefix string) db.Iterator {
+	iter := failingSlotsDB.DB.Iterator(prefix)
+	if !strings.Contains(prefix, SlotToken) {
+		return iter
+	}
+	return &failingIterator{Iterator: iter}
+}
+
+// failingIterator is a `db.Iterator` that fails once the inner iterator is
+// done.
+type failingIterator struct {
+	db.Iterator
+}
+
+func (iter *failingIterator) Err() error {
+	return errFailure
+}
+
+// scanningDB is a `db.DB` that records the prefixes with which the keys of the
+// values, and not of the timestamps, are iterated over. It checks keys in
+// batches using the inner `db.DB`, which must implement `db.BatchChecker`.
+type scanningDB struct {
+	db.DB
+	scans int32
+
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func (scanningDB *scanningDB) Iterator(prefix string) db.Iterator {
+	if !strings.Contains(prefix, SlotToken) {
+		atomic.AddInt32(&scanningDB.scans, 1)
+
+		scanningDB.mu.Lock()
+		scanningDB.prefixes = append(scanningDB.prefixes, prefix)
+		scanningDB.mu.Unlock()
+	}
+	return scanningDB.DB.Iterator(prefix)
+}
+
+func (scanningDB *scanningDB) HasBatch(keys []string) ([]bool, error) {
+	return scanningDB.DB.(db.BatchChecker).HasBatch(keys)
+}
+
+// countingDB is a `db.DB` that counts the number of times that the prune
+// pointer is written, and the number of times that a slot is read with Get.
+type countingDB struct {
+	db.DB
+	pointerWrites int32
+	slotGets      int32
+}
+
+func (countingDB *countingDB) Get(key string, value interface{}) error {
+	if strings.Contains(key, SlotToken) && !strings.HasSuffix(key, SlotToken+"0_"+PrunePointerKey) {
+		atomic.AddInt32(&countingDB.slotGets, 1)
+	}
+	return countingDB.DB.Get(key, value)
+}
+
+func (countingDB *countingDB) Insert(key string, value interface{}) error {
+	if strings.HasSuffix(key, SlotToken+"0_"+PrunePointerKey) {
+		atomic.AddInt32(&countingDB.pointerWrites, 1)
+	}
+	return countingDB.DB.Insert(key, value)
+}
+
+// pausingDB is a `db.DB` that pauses the next get after it has been armed,
+// once the value has been read, until it is released.
+type pausingDB struct {
+	db.DB
+	armed   int32
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (pausingDB *pausingDB) Get(key string, value interface{}) error {
+	err := pausingDB.DB.Get(key, value)
+	if atomic.CompareAndSwapInt32(&pausingDB.armed, 1, 0) {
+		close(pausingDB.read)
+		<-pausingDB.release
+	}
+	return err
+}
+
+// capturingLogger is a `Logger` that keeps all logged lines.
+type capturingLogger struct {
+	mu    *sync.Mutex
+	lines []string
+}
+
+func (logger *capturingLogger) Printf(format string, args ...interface{}) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.lines = append(logger.lines, fmt.Sprintf(format, args...))
+}
+
+func (logger *capturingLogger) Lines() []string {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	return append([]string{}, logger.lines...)
+}
+
 var _ = Describe("TTL cache", func() {
 
 	readAndWrite := func(table db.Table, key string, value testutil.TestStruct) bool {
@@ -142,6 +335,45 @@ var _ = Describe("TTL cache", func() {
 				})
 			})
 
+			Context("when getting and deleting concurrently", func() {
+				It("should only let one caller get each value", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+					table := New(ctx, database, "name", time.Hour)
+
+					numKeys := 100
+					for i := 0; i < numKeys; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+					}
+
+					claims := make([]int64, numKeys)
+					phi.ParForAll(8, func(worker int) {
+						for i := 0; i < numKeys; i++ {
+							var value int64
+							err := table.GetAndDelete(fmt.Sprintf("%v", i), &value)
+							if err == db.ErrKeyNotFound {
+								continue
+							}
+							Expect(err).NotTo(HaveOccurred())
+							Expect(value).Should(Equal(int64(i)))
+							atomic.AddInt64(&claims[i], 1)
+						}
+					})
+					for i := range claims {
+						Expect(claims[i]).Should(Equal(int64(1)))
+					}
+
+					// The timestamps should also have been deleted, leaving only
+					// the prune pointer.
+					size, err := database.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(1))
+				})
+			})
+
 			Context("when creating multiple ttl table with same underlying db", func() {
 				It("should not affect each other", func() {
 					database := initializer(codec)
@@ -253,6 +485,76 @@ var _ = Describe("TTL cache", func() {
 					Expect(quick.Check(readAndWrite, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
 				})
 
+				It("should prune a batch of entries in the same prune", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					// While the batch is inserted, the clock moves forward by a
+					// slot every time it is read, so entries that do not share
+					// the time of the batch end up in later slots.
+					mu := new(sync.Mutex)
+					start := time.Now()
+					now, ticking := start, true
+					table := New(ctx, database, "batch", time.Hour)
+					SetNow(table, func() time.Time {
+						mu.Lock()
+						defer mu.Unlock()
+
+						moment := now
+						if ticking {
+							now = now.Add(time.Hour)
+						}
+						return moment
+					})
+					setNow := func(moment time.Time) {
+						mu.Lock()
+						defer mu.Unlock()
+
+						now, ticking = moment, false
+					}
+
+					entries := map[string]interface{}{}
+					for i := 0; i < 20; i++ {
+						value := testutil.RandomTestStruct()
+						entries[fmt.Sprintf("%v", i)] = &value
+					}
+					Expect(table.InsertBatch(entries)).NotTo(HaveOccurred())
+
+					setNow(start.Add(time.Hour))
+					Expect(Prune(table)).NotTo(HaveOccurred())
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(len(entries)))
+
+					// Only the slot of the batch, and the one after it, have
+					// expired.
+					setNow(start.Add(3 * time.Hour))
+					Expect(Prune(table)).NotTo(HaveOccurred())
+					size, err = table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(0))
+				})
+
+				It("should return ErrEmptyKey when a batch contains an empty key", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					table := New(ctx, database, "batch", 5*time.Second)
+					value := testutil.RandomTestStruct()
+					entries := map[string]interface{}{"key": &value, "": &value}
+					Expect(table.InsertBatch(entries)).Should(Equal(db.ErrEmptyKey))
+
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).To(Equal(0))
+				})
+
 				It("should not prune if the same key is added again before the interval expires", func() {
 					database := initializer(codec)
 					defer database.Close()
@@ -279,4 +581,1910 @@ var _ = Describe("TTL cache", func() {
 			})
 		}
 	}
+
+	Context("when the underlying db returns an error", func() {
+		It("should be possible to unwrap the error", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &failingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", 5*time.Second)
+			database.fail = true
+
+			err := table.Insert("key", "value")
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, errFailure)).Should(BeTrue())
+
+			err = table.InsertBatch(map[string]interface{}{"key": "value"})
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, errFailure)).Should(BeTrue())
+		})
+	})
+
+	Context("when using binary keys", func() {
+		It("should store, expire and prune them like any other key", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Keys that contain the separators used in the keys of the
+			// underlying db.
+			separators := []string{"_", "__", "-", "-slot", "-slot0_", "-slot1_x", "-count_", "prunePointer", "\x00", "\xff\xfe_\x00"}
+
+			test := func(binaryKeys [][]byte, value int64) bool {
+				now := time.Now()
+				table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithAccessCounts())
+				SetNow(table, func() time.Time { return now })
+
+				keys := map[string]bool{}
+				for _, key := range separators {
+					keys[key] = true
+				}
+				for _, key := range binaryKeys {
+					if len(key) > 0 {
+						keys[string(key)] = true
+					}
+				}
+				for key := range keys {
+					Expect(table.Insert(key, value)).NotTo(HaveOccurred())
+				}
+				for key := range keys {
+					var stored int64
+					Expect(table.Get(key, &stored)).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(value))
+					count, err := table.AccessCount(key)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(count).Should(Equal(uint64(1)))
+				}
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(len(keys)))
+
+				for _, newIter := range []func() db.Iterator{table.Iterator, table.LiveIterator} {
+					iter := newIter()
+					iterated := map[string]bool{}
+					for iter.Next() {
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						iterated[key] = true
+					}
+					Expect(iter.Err()).NotTo(HaveOccurred())
+					iter.Close()
+					Expect(iterated).Should(Equal(keys))
+				}
+
+				// Deleting a key should not affect keys that it is a prefix of.
+				Expect(table.Delete("-slot")).NotTo(HaveOccurred())
+				delete(keys, "-slot")
+				for key := range keys {
+					var stored int64
+					Expect(table.Get(key, &stored)).NotTo(HaveOccurred())
+				}
+
+				now = now.Add(3 * time.Hour)
+				Expect(Prune(table)).NotTo(HaveOccurred())
+				size, err = table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+				for key := range keys {
+					var stored int64
+					Expect(table.Get(key, &stored)).Should(Equal(db.ErrKeyNotFound))
+				}
+				return true
+			}
+
+			Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when dumping the table", func() {
+		It("should show the remaining ttl of each entry sorted by key", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("b", int64(1))).NotTo(HaveOccurred())
+			Expect(table.InsertPersistent("c", int64(2))).NotTo(HaveOccurred())
+			now = start.Add(time.Hour)
+			Expect(table.Insert("a", int64(3))).NotTo(HaveOccurred())
+			newValue := func() interface{} { return new(int64) }
+
+			now = start.Add(90 * time.Minute)
+			buf := new(strings.Builder)
+			Expect(table.Dump(buf, newValue, nil)).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(Equal("\"a\" 3 ttl=1h30m0s\n\"b\" 1 ttl=30m0s\n\"c\" 2 ttl=persistent\n"))
+
+			now = start.Add(150 * time.Minute)
+			buf.Reset()
+			format := func(key string, value interface{}) string {
+				return fmt.Sprintf("value=%v", *value.(*int64))
+			}
+			Expect(table.Dump(buf, newValue, format)).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(Equal("\"a\" value=3 ttl=30m0s\n\"b\" value=1 ttl=expired\n\"c\" value=2 ttl=persistent\n"))
+		})
+	})
+
+	Context("when iterating over live entries", func() {
+		It("should skip entries that have expired but have not been pruned", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Use a long interval so that the table is never pruned during
+			// the test.
+			now := time.Now()
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			for i := 0; i < 10; i++ {
+				Expect(table.Insert(fmt.Sprintf("expired%v", i), i)).NotTo(HaveOccurred())
+			}
+			now = now.Add(3 * time.Hour)
+			for i := 0; i < 10; i++ {
+				Expect(table.Insert(fmt.Sprintf("live%v", i), i)).NotTo(HaveOccurred())
+			}
+
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(20))
+
+			iter := table.LiveIterator()
+			defer iter.Close()
+
+			keys := map[string]int{}
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				var value int
+				Expect(iter.Value(&value)).NotTo(HaveOccurred())
+				keys[key] = value
+			}
+			Expect(keys).Should(HaveLen(10))
+			for i := 0; i < 10; i++ {
+				Expect(keys[fmt.Sprintf("live%v", i)]).Should(Equal(i))
+			}
+		})
+
+		It("should return the error if the timestamps cannot be read", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The slot of the entry has expired, so it is read.
+			now := time.Now()
+			table := New(ctx, &failingSlotsDB{DB: memdb.New(codec.JSONCodec)}, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", 1)).NotTo(HaveOccurred())
+			now = now.Add(3 * time.Hour)
+
+			iter := table.LiveIterator()
+			defer iter.Close()
+			Expect(iter.Next()).Should(BeFalse())
+			Expect(errors.Is(iter.Err(), errFailure)).Should(BeTrue())
+
+			_, err := table.GetByPrefix("", func() interface{} { return new(int) })
+			Expect(errors.Is(err, errFailure)).Should(BeTrue())
+		})
+
+		It("should include persistent entries", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			now := time.Now()
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("grp/expired", 0)).NotTo(HaveOccurred())
+			now = now.Add(3 * time.Hour)
+			Expect(table.Insert("grp/a", 1)).NotTo(HaveOccurred())
+			Expect(table.InsertPersistent("grp/b", 2)).NotTo(HaveOccurred())
+
+			var value int
+			Expect(table.Get("grp/b", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(2))
+
+			iter := table.LiveIterator()
+			defer iter.Close()
+			keys := []string{}
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				keys = append(keys, key)
+			}
+			Expect(iter.Err()).NotTo(HaveOccurred())
+			Expect(keys).Should(ConsistOf("grp/a", "grp/b"))
+
+			values, err := table.GetByPrefix("grp/", func() interface{} { return new(int) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).Should(HaveLen(2))
+			Expect(*values["grp/a"].(*int)).Should(Equal(1))
+			Expect(*values["grp/b"].(*int)).Should(Equal(2))
+		})
+
+		It("should check expiry against the time the iterator was created", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			now := time.Now()
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", 1)).NotTo(HaveOccurred())
+
+			// The entry expires after the iterator has been created.
+			iter := table.LiveIterator()
+			defer iter.Close()
+			now = now.Add(3 * time.Hour)
+
+			Expect(iter.Next()).Should(BeTrue())
+			key, err := iter.Key()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).Should(Equal("key"))
+			Expect(iter.Next()).Should(BeFalse())
+		})
+	})
+
+	Context("when expiring entries by prefix", func() {
+		It("should only delete entries that begin with the prefix", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			for _, key := range []string{"user1/a", "user1/b", "user2/a", "other"} {
+				Expect(table.Insert(key, key)).NotTo(HaveOccurred())
+			}
+			// Include an entry that was deleted but still has a timestamp.
+			Expect(table.Insert("user1/c", "user1/c")).NotTo(HaveOccurred())
+			Expect(table.Delete("user1/c")).NotTo(HaveOccurred())
+
+			n, err := table.ExpirePrefix("user1/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(2))
+
+			var value string
+			Expect(table.Get("user1/a", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Get("user1/b", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Get("user2/a", &value)).NotTo(HaveOccurred())
+			Expect(table.Get("other", &value)).NotTo(HaveOccurred())
+
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(2))
+
+			// Only the remaining data, their timestamps, and the prune
+			// pointer should be left in the underlying db.
+			size, err = database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(5))
+		})
+	})
+
+	Context("when touching entries by prefix", func() {
+		It("should check that each entry exists without scanning the keys that begin with it", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &scanningDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", time.Hour, WithAccessCounts())
+			key := "a"
+			for i := 0; i < 10; i++ {
+				Expect(table.Insert(key, key)).NotTo(HaveOccurred())
+				key += "/a"
+			}
+			scans := atomic.LoadInt32(&database.scans)
+
+			n, err := table.TouchPrefix("a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(10))
+			_, err = table.AccessCount("a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(atomic.LoadInt32(&database.scans)).Should(Equal(scans))
+		})
+
+		It("should keep the entries that begin with the prefix past their original expiry", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			for _, key := range []string{"user1/a", "user1/b", "user1/c", "other"} {
+				Expect(table.Insert(key, key)).NotTo(HaveOccurred())
+			}
+			Expect(table.InsertPersistent("user1/persistent", "user1/persistent")).NotTo(HaveOccurred())
+			// Include an entry that was deleted but still has a timestamp.
+			Expect(table.Insert("user1/deleted", "user1/deleted")).NotTo(HaveOccurred())
+			Expect(table.Delete("user1/deleted")).NotTo(HaveOccurred())
+
+			now = start.Add(90 * time.Minute)
+			n, err := table.TouchPrefix("user1/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(3))
+
+			// The original entries have expired, but the touched entries have
+			// not.
+			now = start.Add(150 * time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			var value string
+			for _, key := range []string{"user1/a", "user1/b", "user1/c", "user1/persistent"} {
+				Expect(table.Get(key, &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(key))
+			}
+			Expect(table.Get("other", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Get("user1/deleted", &value)).Should(Equal(db.ErrKeyNotFound))
+
+			// The old timestamps should have been removed, so only the data,
+			// the timestamps in the current slot, and the prune pointer should
+			// be left in the underlying db.
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(8))
+
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			for _, key := range []string{"user1/a", "user1/b", "user1/c"} {
+				Expect(table.Get(key, &value)).Should(Equal(db.ErrKeyNotFound))
+			}
+			Expect(table.Get("user1/persistent", &value)).NotTo(HaveOccurred())
+		})
+
+		It("should not touch entries that have expired", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("user1/a", "user1/a")).NotTo(HaveOccurred())
+			now = start.Add(2 * time.Hour)
+			n, err := table.TouchPrefix("user1/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(0))
+
+			var value string
+			Expect(table.Get("user1/a", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when swapping entries", func() {
+		// The failingDB hides the `db.Swapper` implementation of the memdb, so
+		// that the table has to make swaps atomic itself.
+		dbs := map[string]func() db.DB{
+			"swapper":     func() db.DB { return memdb.New(codec.JSONCodec) },
+			"not swapper": func() db.DB { return &failingDB{DB: memdb.New(codec.JSONCodec)} },
+		}
+		for _, name := range []string{"swapper", "not swapper"} {
+			newDB := dbs[name]
+
+			It(fmt.Sprintf("should return the value that it replaces and refresh its ttl (%v)", name), func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				start := time.Now().Truncate(time.Hour)
+				now := start
+				table := New(ctx, newDB(), "name", time.Hour)
+				SetNow(table, func() time.Time { return now })
+
+				old := "none"
+				existed, err := table.Swap("key", "old", &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeFalse())
+				Expect(old).Should(Equal("none"))
+
+				now = start.Add(90 * time.Minute)
+				existed, err = table.Swap("key", "new", &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeTrue())
+				Expect(old).Should(Equal("old"))
+
+				// The key should not expire with the slot it was first
+				// inserted in.
+				now = start.Add(150 * time.Minute)
+				Expect(Prune(table)).NotTo(HaveOccurred())
+				var value string
+				Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal("new"))
+
+				now = start.Add(3 * time.Hour)
+				Expect(Prune(table)).NotTo(HaveOccurred())
+				Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It(fmt.Sprintf("should treat entries that have expired as missing (%v)", name), func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				start := time.Now().Truncate(time.Hour)
+				now := start
+				table := New(ctx, newDB(), "name", time.Hour)
+				SetNow(table, func() time.Time { return now })
+
+				Expect(table.Insert("key", "old")).NotTo(HaveOccurred())
+				now = start.Add(2 * time.Hour)
+				old := "none"
+				existed, err := table.Swap("key", "new", &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeFalse())
+				Expect(old).Should(Equal("none"))
+
+				var value string
+				Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal("new"))
+			})
+		}
+	})
+
+	Context("when deleting entries if they are unchanged", func() {
+		// The failingDB hides the `db.ConditionalDeleter` implementation of
+		// the memdb, so that the table has to compare the values itself.
+		dbs := map[string]func() db.DB{
+			"conditional deleter":     func() db.DB { return memdb.New(codec.JSONCodec) },
+			"not conditional deleter": func() db.DB { return &failingDB{DB: memdb.New(codec.JSONCodec)} },
+		}
+		for _, name := range []string{"conditional deleter", "not conditional deleter"} {
+			newDB := dbs[name]
+
+			It(fmt.Sprintf("should only delete entries and their timestamps if they are as expected (%v)", name), func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				database := newDB()
+				table := New(ctx, database, "name", time.Hour)
+				Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+				deleted, err := table.DeleteIf("key", "other")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeFalse())
+				deleted, err = table.DeleteIf("missing", "value")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeFalse())
+				deleted, err = table.DeleteIf("key", "value")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeTrue())
+
+				var value string
+				Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+
+				// Only the prune pointer should be left in the underlying db.
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+			})
+
+			It(fmt.Sprintf("should not delete an entry that is updated while it is deleted (%v)", name), func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				table := New(ctx, newDB(), "name", time.Hour)
+				Expect(testutil.RaceDeleteIf(table, 100)).NotTo(HaveOccurred())
+			})
+		}
+
+		It("should not delete an entry that is inserted after it is read, when comparing the values itself", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &pausingDB{DB: memdb.New(codec.JSONCodec), read: make(chan struct{}), release: make(chan struct{})}
+			table := New(ctx, database, "name", time.Hour)
+			Expect(table.Insert("key", "old")).NotTo(HaveOccurred())
+
+			// Pause the conditional delete once it has read the old value,
+			// and insert a new value in the meantime.
+			atomic.StoreInt32(&database.armed, 1)
+			deleted := make(chan bool, 1)
+			go func() {
+				defer GinkgoRecover()
+				ok, err := table.DeleteIf("key", "old")
+				Expect(err).NotTo(HaveOccurred())
+				deleted <- ok
+			}()
+			<-database.read
+			inserted := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(inserted)
+				Expect(table.Insert("key", "new")).NotTo(HaveOccurred())
+			}()
+			select {
+			case <-inserted:
+			case <-time.After(100 * time.Millisecond):
+			}
+			close(database.release)
+			Expect(<-deleted).Should(BeTrue())
+			<-inserted
+
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("new"))
+		})
+	})
+
+	Context("when checking whether entries exist in a batch", func() {
+		It("should report missing and expired entries as absent", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("old", "value")).NotTo(HaveOccurred())
+			Expect(table.InsertPersistent("persistent", "value")).NotTo(HaveOccurred())
+			now = start.Add(90 * time.Minute)
+			Expect(table.Insert("new", "value")).NotTo(HaveOccurred())
+			Expect(table.Insert("deleted", "value")).NotTo(HaveOccurred())
+			Expect(table.Delete("deleted")).NotTo(HaveOccurred())
+
+			keys := []string{"new", "old", "missing", "persistent", "deleted"}
+			found, err := table.HasBatch(keys)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).Should(Equal([]bool{true, true, false, true, false}))
+
+			// The old entry has expired, but has not been pruned yet.
+			now = start.Add(2 * time.Hour)
+			found, err = table.HasBatch(keys)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).Should(Equal([]bool{true, false, false, true, false}))
+
+			_, err = table.HasBatch([]string{""})
+			Expect(err).Should(Equal(db.ErrEmptyKey))
+		})
+
+		It("should not get each entry from each slot that has not been pruned", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := &countingDB{DB: memdb.New(codec.JSONCodec)}
+			table := NewWithGranularity(ctx, database, "name", time.Hour, time.Minute)
+			SetNow(table, func() time.Time { return now })
+
+			keys := []string{}
+			for i := 0; i < 100; i++ {
+				keys = append(keys, fmt.Sprintf("%v", i))
+				Expect(table.Insert(keys[i], "value")).NotTo(HaveOccurred())
+			}
+
+			// Many slots have expired without being pruned.
+			now = start.Add(3 * time.Hour)
+			atomic.StoreInt32(&database.slotGets, 0)
+			found, err := table.HasBatch(keys)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).Should(Equal(make([]bool, len(keys))))
+			Expect(atomic.LoadInt32(&database.slotGets)).Should(BeZero())
+		})
+	})
+
+	Context("when renaming entries", func() {
+		It("should move the entry and its timestamp, replacing an existing entry", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("staging", "new")).NotTo(HaveOccurred())
+			now = start.Add(30 * time.Minute)
+			Expect(table.Insert("live", "old")).NotTo(HaveOccurred())
+			now = start.Add(90 * time.Minute)
+			Expect(table.Insert("live", "old")).NotTo(HaveOccurred())
+
+			Expect(table.Rename("staging", "live")).NotTo(HaveOccurred())
+			var value string
+			Expect(table.Get("staging", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Get("live", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("new"))
+
+			// Only the data, its timestamp, and the prune pointer should be
+			// left in the underlying db.
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+
+			// The renamed entry should expire when the old entry would have,
+			// even though the replaced entry was inserted later.
+			now = start.Add(2 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("live", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+
+		It("should keep persistent entries persistent", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.InsertPersistent("staging", "new")).NotTo(HaveOccurred())
+			Expect(table.Insert("live", "old")).NotTo(HaveOccurred())
+			Expect(table.Rename("staging", "live")).NotTo(HaveOccurred())
+
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			var value string
+			Expect(table.Get("live", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("new"))
+		})
+
+		It("should fail to rename missing or expired entries", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Rename("missing", "live")).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Insert("staging", "new")).NotTo(HaveOccurred())
+			Expect(table.Insert("live", "old")).NotTo(HaveOccurred())
+			Expect(table.RenameNX("staging", "live")).Should(Equal(db.ErrKeyExists))
+
+			// Expired entries should be treated as missing, even if they have
+			// not been pruned yet.
+			now = start.Add(2 * time.Hour)
+			Expect(table.Rename("staging", "live")).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Insert("staging", "new")).NotTo(HaveOccurred())
+			Expect(table.RenameNX("staging", "live")).NotTo(HaveOccurred())
+			var value string
+			Expect(table.Get("live", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("new"))
+		})
+
+		It("should return ErrRenameNotSupported if the underlying db cannot rename", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			table := New(ctx, &failingDB{DB: memdb.New(codec.JSONCodec)}, "name", time.Hour)
+			Expect(table.Insert("staging", "new")).NotTo(HaveOccurred())
+			Expect(table.Rename("staging", "live")).Should(Equal(ErrRenameNotSupported))
+		})
+	})
+
+	Context("when deleting a range of entries", func() {
+		It("should delete the entries in the half-open range and their timestamps", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			for _, key := range []string{"a", "b", "bb", "c", "d"} {
+				Expect(table.Insert(key, key)).NotTo(HaveOccurred())
+			}
+
+			n, err := table.DeleteRange("b", "c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(2))
+
+			var value string
+			Expect(table.Get("a", &value)).NotTo(HaveOccurred())
+			Expect(table.Get("b", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Get("bb", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.Get("c", &value)).NotTo(HaveOccurred())
+			Expect(table.Get("d", &value)).NotTo(HaveOccurred())
+
+			// Only the remaining data, their timestamps, and the prune
+			// pointer should be left in the underlying db.
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(7))
+
+			n, err = table.DeleteRange("c", "c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(0))
+		})
+	})
+
+	Context("when inserting persistent entries", func() {
+		It("should never prune them, while pruning the expiring entries", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.InsertPersistent("config", "value")).NotTo(HaveOccurred())
+			Expect(table.Insert("expiring", "value")).NotTo(HaveOccurred())
+			Expect(table.Insert("becomes-persistent", "value")).NotTo(HaveOccurred())
+			Expect(table.InsertPersistent("becomes-expiring", "value")).NotTo(HaveOccurred())
+
+			now = start.Add(time.Hour)
+			Expect(table.InsertPersistent("becomes-persistent", "value")).NotTo(HaveOccurred())
+			Expect(table.Insert("becomes-expiring", "value")).NotTo(HaveOccurred())
+
+			expectFound := func(found map[string]bool) {
+				for key, ok := range found {
+					var value string
+					if ok {
+						Expect(table.Get(key, &value)).NotTo(HaveOccurred())
+					} else {
+						Expect(table.Get(key, &value)).Should(Equal(db.ErrKeyNotFound))
+					}
+				}
+			}
+
+			now = start.Add(2*time.Hour + time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			expectFound(map[string]bool{"config": true, "expiring": false, "becomes-persistent": true, "becomes-expiring": true})
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+
+			now = start.Add(3*time.Hour + time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			expectFound(map[string]bool{"config": true, "becomes-persistent": true, "becomes-expiring": false})
+
+			for i := 4; i < 10; i++ {
+				now = start.Add(time.Duration(i) * time.Hour)
+				Expect(Prune(table)).NotTo(HaveOccurred())
+			}
+			expectFound(map[string]bool{"config": true, "becomes-persistent": true})
+			size, err = table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(2))
+		})
+	})
+
+	Context("when the slot size is smaller than the prune interval", func() {
+		It("should expire entries with the resolution of the slot size", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := NewWithGranularity(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, time.Minute)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			var value string
+			now = start.Add(time.Hour - time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+
+			now = start.Add(time.Hour + 2*time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+
+		It("should expire entries with the resolution of the prune interval by default", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			var value string
+			now = start.Add(time.Hour + 2*time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+		})
+
+		It("should keep entries inserted just before a slot boundary for the prune interval", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			inserted := time.Now().Truncate(time.Minute).Add(time.Minute - time.Nanosecond)
+			now := inserted
+			table := NewWithGranularity(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, time.Minute)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			var value string
+			for _, elapsed := range []time.Duration{time.Nanosecond, time.Minute, time.Hour - time.Nanosecond} {
+				now = inserted.Add(elapsed)
+				Expect(Prune(table)).NotTo(HaveOccurred())
+				Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			}
+
+			now = inserted.Add(time.Hour + time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when an entry has an insert timestamp after its slot", func() {
+		It("should keep entries in an expired slot until they have been inserted for the prune interval", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			hash := func(data []byte) []byte {
+				hash := sha256.Sum256(data)
+				return hash[:4]
+			}
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour, WithNameHash(hash))
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			// Record an insert timestamp that is later than the slot of the
+			// entry, as if the clock had moved backwards.
+			slot := SlotNo(table, start)
+			marker := fmt.Sprintf("%v%v%v_key", string(hash([]byte("name"))), SlotToken, slot)
+			insertedAt := start.Add(90 * time.Minute)
+			Expect(database.Insert(marker, []byte(fmt.Sprintf("%v", insertedAt.UnixNano())))).NotTo(HaveOccurred())
+
+			var value string
+			now = start.Add(2 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			pointer, err := PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pointer).Should(Equal(slot - 1))
+
+			now = insertedAt.Add(time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			pointer, err = PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pointer).Should(Equal(SlotNo(table, now.Add(-time.Hour)) - 1))
+		})
+
+		It("should keep entries for at most another prune interval", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			hash := func(data []byte) []byte {
+				hash := sha256.Sum256(data)
+				return hash[:4]
+			}
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour, WithNameHash(hash))
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			// Record an insert timestamp that is far in the future.
+			slot := SlotNo(table, start)
+			marker := fmt.Sprintf("%v%v%v_key", string(hash([]byte("name"))), SlotToken, slot)
+			Expect(database.Insert(marker, []byte(fmt.Sprintf("%v", start.Add(1000*time.Hour).UnixNano())))).NotTo(HaveOccurred())
+
+			now = start.Add(3*time.Hour - time.Nanosecond)
+			buf := new(bytes.Buffer)
+			Expect(table.Dump(buf, func() interface{} { return new(string) }, nil)).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(ContainSubstring("ttl=1ns"))
+			schedule, err := table.ExpirySchedule()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule).Should(Equal(map[int64]int{SlotNo(table, start.Add(3*time.Hour)): 1}))
+			iter := table.LiveIterator()
+			Expect(iter.Next()).Should(BeTrue())
+			iter.Close()
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+
+			now = start.Add(3 * time.Hour)
+			buf.Reset()
+			Expect(table.Dump(buf, func() interface{} { return new(string) }, nil)).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(ContainSubstring("ttl=expired"))
+			iter = table.LiveIterator()
+			Expect(iter.Next()).Should(BeFalse())
+			iter.Close()
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			pointer, err := PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pointer).Should(Equal(SlotNo(table, now.Add(-time.Hour)) - 1))
+		})
+	})
+
+	Context("when checking the health of the table", func() {
+		It("should pass while the table is being pruned", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.HealthCheck(ctx)).NotTo(HaveOccurred())
+
+			now = start.Add(3 * time.Hour)
+			Expect(errors.Is(table.HealthCheck(ctx), ErrPruneStalled)).Should(BeTrue())
+
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.HealthCheck(ctx)).NotTo(HaveOccurred())
+
+			// Only the prune pointer should be left in the db.
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+		})
+
+		It("should fail when the underlying db fails", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &failingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", time.Hour)
+			Expect(table.HealthCheck(ctx)).NotTo(HaveOccurred())
+
+			database.fail = true
+			Expect(errors.Is(table.HealthCheck(ctx), errFailure)).Should(BeTrue())
+		})
+	})
+
+	Context("when pruning the table", func() {
+		It("should update the prune stats", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := &failingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.PruneStats()).Should(Equal(PruneStats{}))
+
+			for i := 0; i < 3; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+
+			stats := table.PruneStats()
+			Expect(stats.Runs).Should(Equal(uint64(1)))
+			Expect(stats.KeysDeleted).Should(Equal(uint64(3)))
+			Expect(stats.LastRun).Should(Equal(now))
+			Expect(stats.LastErr).Should(BeNil())
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			atomic.StoreInt32(&database.failDeletes, 1)
+			now = start.Add(6 * time.Hour)
+			Expect(Prune(table)).To(HaveOccurred())
+
+			stats = table.PruneStats()
+			Expect(stats.Runs).Should(Equal(uint64(2)))
+			Expect(stats.KeysDeleted).Should(Equal(uint64(3)))
+			Expect(stats.LastRun).Should(Equal(now))
+			Expect(errors.Is(stats.LastErr, errFailure)).Should(BeTrue())
+		})
+	})
+
+	Context("when writing the prune pointer", func() {
+		It("should not write the pointer when no slots have expired", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := &countingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			pointer, err := PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			writes := atomic.LoadInt32(&database.pointerWrites)
+
+			for i := 0; i < 3; i++ {
+				Expect(Prune(table)).NotTo(HaveOccurred())
+			}
+			Expect(atomic.LoadInt32(&database.pointerWrites)).Should(Equal(writes))
+			Expect(PrunePointer(table)).Should(Equal(pointer))
+		})
+
+		It("should write the pointer once when slots have expired", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := &countingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+			for i := 0; i < 3; i++ {
+				now = start.Add(time.Duration(i) * time.Hour)
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+			writes := atomic.LoadInt32(&database.pointerWrites)
+
+			now = start.Add(5 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(atomic.LoadInt32(&database.pointerWrites)).Should(Equal(writes + 1))
+			Expect(table.PruneStats().KeysDeleted).Should(Equal(uint64(3)))
+			Expect(PrunePointer(table)).Should(Equal(SlotNo(table, now.Add(-time.Hour)) - 1))
+		})
+	})
+
+	Context("when the table cannot be initialized", func() {
+		It("should return an error from TryNew", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &failingDB{DB: memdb.New(codec.JSONCodec), fail: true}
+			table, err := TryNew(ctx, database, "name", time.Hour)
+			Expect(errors.Is(err, errFailure)).Should(BeTrue())
+			Expect(table).Should(BeNil())
+		})
+
+		It("should panic from New", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &failingDB{DB: memdb.New(codec.JSONCodec), fail: true}
+			Expect(func() {
+				New(ctx, database, "name", time.Hour)
+			}).Should(Panic())
+		})
+	})
+
+	Context("when pruning in the background fails", func() {
+		It("should log the error with the logger", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			logger := &capturingLogger{mu: new(sync.Mutex)}
+			database := &failingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", 10*time.Millisecond, WithLogger(logger))
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			atomic.StoreInt32(&database.failDeletes, 1)
+
+			Eventually(logger.Lines).Should(ContainElement(ContainSubstring(errFailure.Error())))
+		})
+	})
+
+	Context("when the underlying db is closed while pruning in the background", func() {
+		It("should recover from the panic and stop pruning", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			logger := &capturingLogger{mu: new(sync.Mutex)}
+			database := &closingDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", 10*time.Millisecond, WithLogger(logger))
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			atomic.StoreInt32(&database.closed, 1)
+
+			Eventually(table.ExpirationChannel()).Should(BeClosed())
+			Expect(logger.Lines()).Should(ContainElement(ContainSubstring("recovered from panic")))
+		})
+
+		It("should stop pruning if the db returns ErrClosed", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			logger := &capturingLogger{mu: new(sync.Mutex)}
+			database := leveldb.New(".leveldb", codec.JSONCodec)
+			table := New(ctx, database, "name", 10*time.Millisecond, WithLogger(logger))
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(database.Close()).NotTo(HaveOccurred())
+
+			Eventually(table.ExpirationChannel()).Should(BeClosed())
+			Expect(logger.Lines()).Should(ContainElement(ContainSubstring(db.ErrClosed.Error())))
+		})
+	})
+
+	Context("when tracking access counts", func() {
+		It("should count reads since the key was inserted", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour, WithAccessCounts())
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(table.Insert("keyb", "value")).NotTo(HaveOccurred())
+			_, err := table.AccessCount("missing")
+			Expect(err).Should(Equal(db.ErrKeyNotFound))
+
+			var value string
+			for i := 0; i < 3; i++ {
+				Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			}
+			count, err := table.AccessCount("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).Should(Equal(uint64(3)))
+			count, err = table.AccessCount("keyb")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).Should(Equal(uint64(0)))
+
+			// Inserting again should reset the count.
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			count, err = table.AccessCount("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).Should(Equal(uint64(0)))
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			count, err = table.AccessCount("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).Should(Equal(uint64(1)))
+
+			// Counts should be pruned with the keys.
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			_, err = table.AccessCount("key")
+			Expect(err).Should(Equal(db.ErrKeyNotFound))
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+		})
+
+		It("should return an error if access counts are not enabled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			_, err := table.AccessCount("key")
+			Expect(err).Should(Equal(ErrAccessCountsDisabled))
+
+			// Only the data, timestamp, and prune pointer should be stored.
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+		})
+	})
+
+	Context("when reading an entry that has expired but has not been pruned", func() {
+		It("should not find the entry", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+
+			now = start.Add(3 * time.Hour)
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+
+			// The entry should have been deleted, without being pruned.
+			Expect(table.PruneStats().Runs).Should(BeZero())
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(BeZero())
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			Expect(table.PruneStats().KeysDeleted).Should(BeZero())
+		})
+
+		It("should not write the value of the entry", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			now = start.Add(3 * time.Hour)
+			value := "unchanged"
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(value).Should(Equal("unchanged"))
+		})
+
+		It("should find entries that were inserted again before being read", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "old")).NotTo(HaveOccurred())
+			now = start.Add(3 * time.Hour)
+			Expect(table.Insert("key", "new")).NotTo(HaveOccurred())
+
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("new"))
+		})
+
+		It("should find entries without a timestamp", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			iter := database.Iterator("")
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				if strings.Contains(key, SlotToken) && strings.HasSuffix(key, "_key") {
+					Expect(database.Delete(key)).NotTo(HaveOccurred())
+				}
+			}
+			iter.Close()
+
+			now = start.Add(3 * time.Hour)
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+		})
+	})
+
+	Context("when the reserved prefix is already in use", func() {
+		It("should return an error from TryNew", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := memdb.New(codec.JSONCodec)
+			Expect(db.NewTable(database, "name").Insert("key", "value")).NotTo(HaveOccurred())
+			table, err := TryNew(ctx, database, "name", time.Hour)
+			Expect(errors.Is(err, ErrReservedPrefix)).Should(BeTrue())
+			Expect(table).Should(BeNil())
+
+			// Tables with other names should not be affected.
+			_, err = TryNew(ctx, database, "other", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not return an error when reopening the table", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := memdb.New(codec.JSONCodec)
+			table, err := TryNew(ctx, database, "name", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+
+			table, err = TryNew(ctx, database, "name", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+		})
+	})
+
+	Context("when the prune interval is too small", func() {
+		It("should return an error from TryNew", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			for _, interval := range []time.Duration{0, -time.Second, time.Nanosecond, 500 * time.Microsecond} {
+				table, err := TryNew(ctx, memdb.New(codec.JSONCodec), "name", interval)
+				Expect(errors.Is(err, ErrIntervalTooSmall)).Should(BeTrue())
+				Expect(table).Should(BeNil())
+			}
+		})
+
+		It("should panic from New", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			Expect(func() {
+				New(ctx, memdb.New(codec.JSONCodec), "name", 0)
+			}).Should(Panic())
+		})
+
+		It("should panic from NewWithGranularity if the slot size is too small", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			Expect(func() {
+				NewWithGranularity(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, 0)
+			}).Should(Panic())
+		})
+	})
+
+	Context("when using a custom name hash", func() {
+		truncatedHash := func(data []byte) []byte {
+			hash := sha256.Sum256(data)
+			return hash[:4]
+		}
+
+		It("should keep the tables that share a db separate", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := memdb.New(codec.JSONCodec)
+			table1 := New(ctx, database, "table1", time.Hour, WithNameHash(truncatedHash))
+			table2 := New(ctx, database, "table2", time.Hour, WithNameHash(truncatedHash))
+			Expect(table1.Insert("key", "value1")).NotTo(HaveOccurred())
+			Expect(table2.Insert("key", "value2")).NotTo(HaveOccurred())
+
+			var value string
+			Expect(table1.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value1"))
+			Expect(table2.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value2"))
+			Expect(table1.Delete("key")).NotTo(HaveOccurred())
+			Expect(table2.Get("key", &value)).NotTo(HaveOccurred())
+
+			// The keys in the underlying db should begin with the truncated
+			// hash of the name.
+			prefix := string(truncatedHash([]byte("table2")))
+			size, err := database.Size(prefix + "_")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+		})
+
+		It("should return an error from TryNew if the hash does not have a fixed length", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			identity := func(data []byte) []byte { return data }
+			_, err := TryNew(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithNameHash(identity))
+			Expect(errors.Is(err, ErrInvalidHash)).Should(BeTrue())
+
+			empty := func(data []byte) []byte { return nil }
+			_, err = TryNew(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithNameHash(empty))
+			Expect(errors.Is(err, ErrInvalidHash)).Should(BeTrue())
+		})
+	})
+
+	Context("when subscribing to expirations", func() {
+		It("should receive the keys that expire", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			keys := []string{}
+			for i := 0; i < 5; i++ {
+				keys = append(keys, fmt.Sprintf("%v", i))
+				Expect(table.Insert(keys[i], "value")).NotTo(HaveOccurred())
+			}
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+
+			expired := []string{}
+			for range keys {
+				expired = append(expired, <-table.ExpirationChannel())
+			}
+			Expect(expired).Should(ConsistOf(keys))
+			Expect(table.ExpirationChannel()).ShouldNot(Receive())
+		})
+
+		It("should receive the keys that expire when they are read", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			now = start.Add(3 * time.Hour)
+			var value string
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(table.ExpirationChannel()).Should(Receive(Equal("key")))
+		})
+
+		It("should drop keys when the buffer is full", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithExpirationBuffer(2))
+			SetNow(table, func() time.Time { return now })
+
+			for i := 0; i < 5; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+
+			Expect(table.PruneStats().KeysDeleted).Should(Equal(uint64(5)))
+			Expect(table.PruneStats().ExpirationsDropped).Should(Equal(uint64(3)))
+			Expect(table.ExpirationChannel()).Should(HaveLen(2))
+		})
+
+		It("should drop every key if the buffer size is negative", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithExpirationBuffer(-1))
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+
+			Expect(table.PruneStats().KeysDeleted).Should(Equal(uint64(1)))
+			Expect(table.PruneStats().ExpirationsDropped).Should(Equal(uint64(1)))
+			Expect(table.ExpirationChannel()).Should(BeEmpty())
+		})
+
+		It("should close the channel when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			cancel()
+
+			Eventually(table.ExpirationChannel()).Should(BeClosed())
+		})
+	})
+
+	Context("when getting values by prefix", func() {
+		It("should only return the live values of the requested prefix", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour, WithAccessCounts())
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.Insert("a_expired", "a_")).NotTo(HaveOccurred())
+			now = start.Add(2 * time.Hour)
+			for _, group := range []string{"a_", "b_"} {
+				for i := 0; i < 3; i++ {
+					key := fmt.Sprintf("%v%v", group, i)
+					Expect(table.Insert(key, group)).NotTo(HaveOccurred())
+					var value string
+					Expect(table.Get(key, &value)).NotTo(HaveOccurred())
+				}
+			}
+			Expect(database.Insert("a_other", "other")).NotTo(HaveOccurred())
+
+			values, err := table.GetByPrefix("a_", func() interface{} { return new(string) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).Should(HaveLen(3))
+			for i := 0; i < 3; i++ {
+				value, ok := values[fmt.Sprintf("a_%v", i)]
+				Expect(ok).Should(BeTrue())
+				Expect(*value.(*string)).Should(Equal("a_"))
+			}
+		})
+
+		It("should only iterate over the keys with the prefix", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &scanningDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, database, "name", time.Hour)
+			for _, key := range []string{"a_0", "a_1", "b_0"} {
+				Expect(table.Insert(key, key)).NotTo(HaveOccurred())
+			}
+
+			values, err := table.GetByPrefix("a_", func() interface{} { return new(string) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).Should(HaveLen(2))
+			database.mu.Lock()
+			defer database.mu.Unlock()
+			Expect(database.prefixes).Should(HaveLen(1))
+			Expect(database.prefixes[0]).Should(HaveSuffix("_a_"))
+		})
+	})
+
+	Context("when the prune rate is limited", func() {
+		It("should spread the deletes across multiple prunes", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Allow 10 deletes per prune interval.
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithPruneRateLimit(10/time.Hour.Seconds()))
+			SetNow(table, func() time.Time { return now })
+
+			for i := 0; i < 25; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+			now = start.Add(3 * time.Hour)
+
+			for _, remaining := range []int{15, 5, 0} {
+				Expect(Prune(table)).NotTo(HaveOccurred())
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(remaining))
+			}
+			Expect(table.PruneStats().Runs).Should(Equal(uint64(3)))
+			Expect(table.PruneStats().KeysDeleted).Should(Equal(uint64(25)))
+		})
+
+		It("should treat keys that have not been pruned yet as missing", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithPruneRateLimit(1/time.Hour.Seconds()))
+			SetNow(table, func() time.Time { return now })
+
+			for i := 0; i < 5; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+			now = start.Add(3 * time.Hour)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+
+			for i := 0; i < 5; i++ {
+				var value string
+				Expect(table.Get(fmt.Sprintf("%v", i), &value)).Should(Equal(db.ErrKeyNotFound))
+			}
+		})
+
+		It("should not delete keys that have not expired", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithPruneRateLimit(10/time.Hour.Seconds()))
+			SetNow(table, func() time.Time { return now })
+
+			for i := 0; i < 15; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+			now = start.Add(3 * time.Hour)
+			Expect(table.Insert("live", "value")).NotTo(HaveOccurred())
+
+			for i := 0; i < 3; i++ {
+				Expect(Prune(table)).NotTo(HaveOccurred())
+			}
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+			var value string
+			Expect(table.Get("live", &value)).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when pruning slots concurrently", func() {
+		It("should prune all of the expired slots and advance the pointer past them", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithPruneConcurrency(4))
+			SetNow(table, func() time.Time { return now })
+
+			// Populate 20 slots with 5 entries each.
+			for i := 0; i < 20; i++ {
+				now = start.Add(time.Duration(i) * time.Hour)
+				for j := 0; j < 5; j++ {
+					Expect(table.Insert(fmt.Sprintf("%v-%v", i, j), "value")).NotTo(HaveOccurred())
+				}
+			}
+			now = start.Add(21 * time.Hour)
+			Expect(table.Insert("live", "value")).NotTo(HaveOccurred())
+
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+			Expect(table.PruneStats().KeysDeleted).Should(Equal(uint64(100)))
+			schedule, err := table.ExpirySchedule()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule).Should(HaveLen(1))
+
+			pointer, err := PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pointer).Should(Equal(SlotNo(table, start.Add(19*time.Hour))))
+		})
+
+		It("should not advance the pointer past a slot that fails to be pruned", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			poisonedDB := &poisonedDB{DB: memdb.New(codec.JSONCodec)}
+			table := New(ctx, poisonedDB, "name", time.Hour, WithPruneConcurrency(4))
+			SetNow(table, func() time.Time { return now })
+
+			for i := 0; i < 10; i++ {
+				now = start.Add(time.Duration(i) * time.Hour)
+				for j := 0; j < 5; j++ {
+					Expect(table.Insert(fmt.Sprintf("%v-%v", i, j), "value")).NotTo(HaveOccurred())
+				}
+				if i == 5 {
+					Expect(table.Insert("poison", "value")).NotTo(HaveOccurred())
+				}
+			}
+			now = start.Add(11 * time.Hour)
+
+			atomic.StoreInt32(&poisonedDB.poisoned, 1)
+			Expect(errors.Is(Prune(table), errFailure)).Should(BeTrue())
+			pointer, err := PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pointer).Should(Equal(SlotNo(table, start.Add(4*time.Hour))))
+
+			// The slots before the poisoned slot are always pruned.
+			iter := table.Iterator()
+			defer iter.Close()
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(MatchRegexp("^(poison|[5-9]-.*)$"))
+			}
+			Expect(iter.Err()).NotTo(HaveOccurred())
+
+			// Once the slot can be pruned, the remaining slots are pruned.
+			atomic.StoreInt32(&poisonedDB.poisoned, 0)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(0))
+			pointer, err = PrunePointer(table)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pointer).Should(Equal(SlotNo(table, start.Add(9*time.Hour))))
+		})
+	})
+
+	Context("when the prune duration is limited", func() {
+		for _, concurrency := range []int{1, 4} {
+			concurrency := concurrency
+
+			It(fmt.Sprintf("should stop near the deadline and resume in the next prune (concurrency=%v)", concurrency), func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				start := time.Now().Truncate(time.Hour)
+				now := start
+				slowDB := &slowDB{DB: memdb.New(codec.JSONCodec)}
+				table := New(ctx, slowDB, "name", time.Hour, WithMaxPruneDuration(50*time.Millisecond), WithPruneConcurrency(concurrency))
+				SetNow(table, func() time.Time { return now })
+
+				// Pruning each slot takes at least 20ms.
+				for i := 0; i < 20; i++ {
+					now = start.Add(time.Duration(i) * time.Hour)
+					for j := 0; j < 10; j++ {
+						Expect(table.Insert(fmt.Sprintf("%v-%v", i, j), "value")).NotTo(HaveOccurred())
+					}
+				}
+				now = start.Add(21 * time.Hour)
+				last := SlotNo(table, start.Add(19*time.Hour))
+				slowDB.delay = time.Millisecond
+
+				Expect(Prune(table)).NotTo(HaveOccurred())
+				Expect(table.PruneStats().LastDuration).Should(BeNumerically("<", 500*time.Millisecond))
+				pointer, err := PrunePointer(table)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pointer).Should(BeNumerically(">=", SlotNo(table, start)))
+				Expect(pointer).Should(BeNumerically("<", last))
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(BeNumerically(">", 0))
+
+				// Every prune makes progress until all of the slots have been
+				// pruned.
+				for pointer < last {
+					Expect(Prune(table)).NotTo(HaveOccurred())
+					next, err := PrunePointer(table)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(next).Should(BeNumerically(">", pointer))
+					pointer = next
+				}
+				size, err = table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+		}
+	})
+
+	Context("when getting the expiry schedule", func() {
+		It("should count the entries that expire in each slot", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Minute)
+			now := start
+			table := NewWithGranularity(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, time.Minute)
+			SetNow(table, func() time.Time { return now })
+
+			schedule, err := table.ExpirySchedule()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule).Should(BeEmpty())
+
+			insert := func(offset time.Duration, n int) {
+				now = start.Add(offset)
+				for i := 0; i < n; i++ {
+					Expect(table.Insert(fmt.Sprintf("%v_%v", offset, i), "value")).NotTo(HaveOccurred())
+				}
+			}
+			insert(0, 2)
+			insert(time.Minute, 3)
+			insert(5*time.Minute+30*time.Second, 1)
+
+			// Entries expire between the prune interval and the prune
+			// interval plus the slot size after they are inserted, so they
+			// expire in the slot after the one that is an hour later.
+			slot := start.UnixNano() / time.Minute.Nanoseconds()
+			schedule, err = table.ExpirySchedule()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule).Should(Equal(map[int64]int{
+				slot + 61: 2,
+				slot + 62: 3,
+				slot + 66: 1,
+			}))
+
+			// Once the first entries have been pruned, they should no longer
+			// be scheduled.
+			now = start.Add(61 * time.Minute)
+			Expect(Prune(table)).NotTo(HaveOccurred())
+			schedule, err = table.ExpirySchedule()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule).Should(Equal(map[int64]int{
+				slot + 62: 3,
+				slot + 66: 1,
+			}))
+		})
+	})
+
+	Context("when prewarming the table", func() {
+		It("should not change the entries in the table", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			Expect(table.Insert("before", "value")).NotTo(HaveOccurred())
+			table.Prewarm(100)
+			for i := 0; i < 100; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), "value")).NotTo(HaveOccurred())
+			}
+
+			size, err := table.Size()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(101))
+			var value string
+			Expect(table.Get("before", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+		})
+
+		It("should ignore a number of entries that is not positive", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour)
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			table.Prewarm(-100)
+			var value string
+			Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+		})
+
+		It("should ignore an underlying db that cannot be prewarmed", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			table := New(ctx, &failingDB{DB: memdb.New(codec.JSONCodec)}, "name", time.Hour)
+			table.Prewarm(100)
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when expiring entries early", func() {
+		readConcurrently := func(table Table, key string, n int) int {
+			early := int64(0)
+			wg := new(sync.WaitGroup)
+			wg.Add(n)
+			for i := 0; i < n; i++ {
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					var value string
+					expiresSoon, err := table.GetEarly(key, &value)
+					Expect(err).NotTo(HaveOccurred())
+					if expiresSoon {
+						atomic.AddInt64(&early, 1)
+					}
+					// The value should be read either way.
+					Expect(value).Should(Equal("value"))
+				}()
+			}
+			wg.Wait()
+			return int(early)
+		}
+
+		It("should only signal a small fraction of reads near expiry", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			table := New(ctx, memdb.New(codec.JSONCodec), "name", time.Hour, WithEarlyExpiration(1))
+			SetNow(table, func() time.Time { return now })
+			Expect(table.InsertWithDelta("key", "value", time.Minute)).NotTo(HaveOccurred())
+
+			// Entries inserted at the start of a slot expire after the slot
+			// and the prune interval have passed.
+			Expect(readConcurrently(table, "key", 1000)).Should(Equal(0))
+
+			// With three deltas remaining, about 5% of reads should be
+			// signalled.
+			now = start.Add(2*time.Hour - 3*time.Minute)
+			early := readConcurrently(table, "key", 1000)
+			Expect(early).Should(BeNumerically(">", 0))
+			Expect(early).Should(BeNumerically("<", 150))
+
+			// Right before expiry, almost every read should be signalled.
+			now = start.Add(2*time.Hour - time.Second)
+			Expect(readConcurrently(table, "key", 1000)).Should(BeNumerically(">", 900))
+
+			// Get should never signal early expiry.
+			for i := 0; i < 100; i++ {
+				var value string
+				Expect(table.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal("value"))
+			}
+
+			// Once it has expired, it should be missing as usual.
+			now = start.Add(2 * time.Hour)
+			var value string
+			Expect(table.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+
+		It("should not expire entries without a delta early", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour, WithEarlyExpiration(1))
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.InsertWithDelta("key", "value", time.Minute)).NotTo(HaveOccurred())
+			Expect(table.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(table.Insert("other", "value")).NotTo(HaveOccurred())
+			now = start.Add(2*time.Hour - time.Second)
+			Expect(readConcurrently(table, "key", 100)).Should(Equal(0))
+			Expect(readConcurrently(table, "other", 100)).Should(Equal(0))
+
+			// Deleting an entry should delete its delta, so only the
+			// timestamps and the prune pointer should be left.
+			Expect(table.InsertWithDelta("key", "value", time.Minute)).NotTo(HaveOccurred())
+			Expect(table.Delete("key")).NotTo(HaveOccurred())
+			Expect(table.Delete("other")).NotTo(HaveOccurred())
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+		})
+
+		It("should not store deltas or expire early when disabled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now().Truncate(time.Hour)
+			now := start
+			database := memdb.New(codec.JSONCodec)
+			table := New(ctx, database, "name", time.Hour)
+			SetNow(table, func() time.Time { return now })
+
+			Expect(table.InsertWithDelta("key", "value", time.Minute)).NotTo(HaveOccurred())
+			now = start.Add(2*time.Hour - time.Second)
+			Expect(readConcurrently(table, "key", 100)).Should(Equal(0))
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+		})
+	})
 })
@@ -0,0 +1,17 @@
+package windowed
+
+import (
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// SetNow replaces the clock used by the DB.
+func SetNow(database db.DB, now func() time.Time) {
+	windowedDB := database.(*windowedDB)
+	windowedDB.mu.Lock()
+	defer windowedDB.mu.Unlock()
+
+	windowedDB.now = now
+	windowedDB.current = windowedDB.windowNo(now())
+}
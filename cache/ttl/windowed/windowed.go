@@ -0,0 +1,216 @@
+package windowed
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+type windowedDB struct {
+	factory    func() db.DB
+	windowSize time.Duration
+	now        func() time.Time
+
+	// mu protects the windows. The read lock is held while using the windows,
+	// and the write lock is held while rotating them.
+	mu *sync.RWMutex
+
+	// windows is ordered from the newest to the oldest, and current is the
+	// number of the newest window.
+	windows []db.DB
+	current int64
+}
+
+// New returns a `db.DB` where key/value pairs expire by partitioning them into
+// time windows. Each window is a separate `db.DB` returned by the factory, and
+// covers the given window size. Inserts go into the newest window, and gets
+// check every window from the newest to the oldest. Only the given number of
+// windows are kept, and when a new window begins the oldest window is dropped
+// wholesale by closing it, so expiring key/value pairs does not require
+// iterating over them.
+//
+// A key/value pair expires between `(windows-1)*windowSize` and
+// `windows*windowSize` after it was last inserted, depending on when in its
+// window it was inserted. Inserting a key deletes it from the older windows, so
+// every key is stored in exactly one window. Windows are rotated lazily when
+// the DB is used, and iterators over a window that has been dropped may fail.
+func New(factory func() db.DB, windowSize time.Duration, windows int) db.DB {
+	if factory == nil {
+		panic("factory cannot be nil")
+	}
+	if windowSize <= 0 {
+		panic(fmt.Sprintf("window size must be positive, got %v", windowSize))
+	}
+	if windows <= 0 {
+		panic(fmt.Sprintf("windows must be positive, got %v", windows))
+	}
+
+	windowedDB := &windowedDB{
+		factory:    factory,
+		windowSize: windowSize,
+		now:        time.Now,
+		mu:         new(sync.RWMutex),
+		windows:    make([]db.DB, windows),
+	}
+	for i := range windowedDB.windows {
+		windowedDB.windows[i] = factory()
+	}
+	windowedDB.current = windowedDB.windowNo(windowedDB.now())
+	return windowedDB
+}
+
+// Close implements the `db.DB` interface. It closes every window.
+func (windowedDB *windowedDB) Close() error {
+	windowedDB.mu.Lock()
+	defer windowedDB.mu.Unlock()
+
+	var err error
+	for _, window := range windowedDB.windows {
+		if closeErr := window.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Insert implements the `db.DB` interface.
+func (windowedDB *windowedDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	err := windowedDB.rlock()
+	defer windowedDB.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, window := range windowedDB.windows[1:] {
+		if err := window.Delete(key); err != nil {
+			return err
+		}
+	}
+	return windowedDB.windows[0].Insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (windowedDB *windowedDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	err := windowedDB.rlock()
+	defer windowedDB.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, window := range windowedDB.windows {
+		err := window.Get(key, value)
+		if !errors.Is(err, db.ErrKeyNotFound) {
+			return err
+		}
+	}
+	return db.ErrKeyNotFound
+}
+
+// Delete implements the `db.DB` interface.
+func (windowedDB *windowedDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	err := windowedDB.rlock()
+	defer windowedDB.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, window := range windowedDB.windows {
+		if err := window.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size implements the `db.DB` interface.
+func (windowedDB *windowedDB) Size(prefix string) (int, error) {
+	err := windowedDB.rlock()
+	defer windowedDB.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	size := 0
+	for _, window := range windowedDB.windows {
+		n, err := window.Size(prefix)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// Iterator implements the `db.DB` interface. It iterates over the windows from
+// the newest to the oldest.
+func (windowedDB *windowedDB) Iterator(prefix string) db.Iterator {
+	// The windows have been rotated even if closing a dropped window fails,
+	// so the error does not prevent iteration.
+	windowedDB.rlock()
+	defer windowedDB.mu.RUnlock()
+
+	iters := make([]db.Iterator, len(windowedDB.windows))
+	for i, window := range windowedDB.windows {
+		iters[i] = window.Iterator(prefix)
+	}
+	return db.ConcatIterator(iters...)
+}
+
+// rlock acquires the read lock, after rotating the windows if a new window has
+// begun. The read lock is always acquired, even if closing a dropped window
+// fails.
+func (windowedDB *windowedDB) rlock() error {
+	windowedDB.mu.RLock()
+	if windowedDB.windowNo(windowedDB.now()) <= windowedDB.current {
+		return nil
+	}
+	windowedDB.mu.RUnlock()
+
+	windowedDB.mu.Lock()
+	err := windowedDB.rotate()
+	windowedDB.mu.Unlock()
+	windowedDB.mu.RLock()
+	return err
+}
+
+// rotate the windows so that the newest window is the current window, closing
+// the windows that have been dropped. The caller must hold the write lock.
+func (windowedDB *windowedDB) rotate() error {
+	current := windowedDB.windowNo(windowedDB.now())
+	steps := current - windowedDB.current
+	if steps <= 0 {
+		return nil
+	}
+	if steps > int64(len(windowedDB.windows)) {
+		steps = int64(len(windowedDB.windows))
+	}
+
+	var err error
+	for i := int64(0); i < steps; i++ {
+		oldest := windowedDB.windows[len(windowedDB.windows)-1]
+		if closeErr := oldest.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("cannot close window: %w", closeErr)
+		}
+		copy(windowedDB.windows[1:], windowedDB.windows)
+		windowedDB.windows[0] = windowedDB.factory()
+	}
+	windowedDB.current = current
+	return err
+}
+
+// windowNo returns the number of the window that contains the given time.
+func (windowedDB *windowedDB) windowNo(t time.Time) int64 {
+	return t.UnixNano() / int64(windowedDB.windowSize)
+}
@@ -0,0 +1,13 @@
+package windowed_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestWindowed(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Windowed Suite")
+}
@@ -0,0 +1,196 @@
+package windowed_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/cache/ttl/windowed"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+// closingDB is a `db.DB` that records whether or not it has been closed.
+type closingDB struct {
+	db.DB
+	closed bool
+}
+
+func (closingDB *closingDB) Close() error {
+	closingDB.closed = true
+	return closingDB.DB.Close()
+}
+
+var _ = Describe("time windowed db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		// newDB returns a db with 3 windows of an hour, and a function that
+		// advances its clock.
+		newDB := func() (db.DB, func(time.Duration)) {
+			database := New(func() db.DB { return memdb.New(codec) }, time.Hour, 3)
+			now := time.Unix(0, 0)
+			SetNow(database, func() time.Time { return now })
+			return database, func(d time.Duration) { now = now.Add(d) }
+		}
+
+		// expectFound checks whether or not each key can be found.
+		expectFound := func(database db.DB, found map[string]bool) {
+			for key, ok := range found {
+				var value int64
+				err := database.Get(key, &value)
+				if ok {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).Should(Equal(db.ErrKeyNotFound))
+				}
+			}
+		}
+
+		Context("when getting keys", func() {
+			It("should find keys across windows", func() {
+				database, advance := newDB()
+				for i := 0; i < 3; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+					advance(time.Hour)
+				}
+				advance(-time.Hour)
+
+				for i := 0; i < 3; i++ {
+					var value int64
+					Expect(database.Get(fmt.Sprintf("%v", i), &value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(int64(i)))
+				}
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(3))
+			})
+
+			It("should return ErrEmptyKey for an empty key", func() {
+				database, _ := newDB()
+				var value int64
+				Expect(database.Insert("", int64(1))).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when the windows rotate", func() {
+			It("should expire the oldest window", func() {
+				database, advance := newDB()
+				Expect(database.Insert("0", int64(0))).NotTo(HaveOccurred())
+				advance(time.Hour)
+				Expect(database.Insert("1", int64(1))).NotTo(HaveOccurred())
+				advance(time.Hour)
+				expectFound(database, map[string]bool{"0": true, "1": true})
+
+				advance(time.Hour)
+				expectFound(database, map[string]bool{"0": false, "1": true})
+				advance(time.Hour)
+				expectFound(database, map[string]bool{"0": false, "1": false})
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+
+			It("should expire every window if the clock jumps", func() {
+				database, advance := newDB()
+				Expect(database.Insert("key", int64(1))).NotTo(HaveOccurred())
+				advance(100 * time.Hour)
+				expectFound(database, map[string]bool{"key": false})
+			})
+
+			It("should close the windows that are dropped", func() {
+				windows := []*closingDB{}
+				database := New(func() db.DB {
+					window := &closingDB{DB: memdb.New(codec)}
+					windows = append(windows, window)
+					return window
+				}, time.Hour, 3)
+				now := time.Unix(0, 0)
+				SetNow(database, func() time.Time { return now })
+
+				now = now.Add(2 * time.Hour)
+				expectFound(database, map[string]bool{"key": false})
+				Expect(windows).Should(HaveLen(5))
+				Expect(windows[1].closed).Should(BeTrue())
+				Expect(windows[2].closed).Should(BeTrue())
+				Expect(windows[0].closed).Should(BeFalse())
+
+				Expect(database.Close()).NotTo(HaveOccurred())
+				for _, window := range windows {
+					Expect(window.closed).Should(BeTrue())
+				}
+			})
+		})
+
+		Context("when inserting an existing key", func() {
+			It("should move it to the newest window", func() {
+				database, advance := newDB()
+				Expect(database.Insert("key", int64(1))).NotTo(HaveOccurred())
+				advance(2 * time.Hour)
+				Expect(database.Insert("key", int64(2))).NotTo(HaveOccurred())
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+
+				advance(2 * time.Hour)
+				var value int64
+				Expect(database.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+			})
+		})
+
+		Context("when deleting a key", func() {
+			It("should delete it from every window", func() {
+				database, advance := newDB()
+				Expect(database.Insert("key", int64(1))).NotTo(HaveOccurred())
+				advance(time.Hour)
+				Expect(database.Delete("key")).NotTo(HaveOccurred())
+				expectFound(database, map[string]bool{"key": false})
+			})
+		})
+
+		Context("when iterating", func() {
+			It("should iterate over every window", func() {
+				database, advance := newDB()
+				for i := 0; i < 9; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+					if i%3 == 2 {
+						advance(time.Hour)
+					}
+				}
+
+				iter := database.Iterator("")
+				defer iter.Close()
+				values := map[string]int64{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					values[key] = value
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(values).Should(HaveLen(6))
+				for i := 3; i < 9; i++ {
+					Expect(values[fmt.Sprintf("%v", i)]).Should(Equal(int64(i)))
+				}
+			})
+		})
+	}
+
+	Context("when creating a db with invalid parameters", func() {
+		It("should panic", func() {
+			factory := func() db.DB { return memdb.New(testutil.Codecs[0]) }
+			Expect(func() { New(nil, time.Hour, 3) }).Should(Panic())
+			Expect(func() { New(factory, 0, 3) }).Should(Panic())
+			Expect(func() { New(factory, time.Hour, 0) }).Should(Panic())
+		})
+	})
+})
@@ -0,0 +1,230 @@
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv/cache"
+	"github.com/renproject/kv/db"
+)
+
+// A Table is a `db.Table` where writes go to a front table immediately, and
+// are flushed to a back table in the background.
+type Table interface {
+	db.Table
+
+	// Close stops flushing in the background, and flushes all writes that
+	// have not been flushed yet. If flushing fails, then Close can be called
+	// again to retry. Otherwise, the Table must not be used after being
+	// closed.
+	Close() error
+
+	// Drain stops accepting writes, and flushes all writes that have not been
+	// flushed yet. Inserts and deletes return `cache.ErrDraining` once
+	// draining has started, but reads continue to work. Flushing is retried
+	// until it succeeds or the context is done.
+	Drain(ctx context.Context) error
+}
+
+// entry is a write that has not been flushed to the back table yet.
+type entry struct {
+	value   interface{}
+	deleted bool
+}
+
+type table struct {
+	front db.Table
+	back  db.Table
+
+	// dirtyMu protects the latest write of each key that has not been flushed
+	// yet. Only the latest write is kept, so multiple writes to the same key
+	// are flushed as one.
+	dirtyMu  *sync.Mutex
+	dirty    map[string]entry
+	draining bool
+
+	// flushMu is used to make sure that writes are flushed in order.
+	flushMu       *sync.Mutex
+	flushInterval time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New returns a write-behind table. Inserts and deletes are applied to the
+// front table, and flushed to the back table on the given interval until the
+// context is done or the table is closed. The front table must not evict
+// values that have not been flushed yet.
+func New(ctx context.Context, front, back db.Table, flushInterval time.Duration) Table {
+	ctx, cancel := context.WithCancel(ctx)
+	writeBehind := &table{
+		front: front,
+		back:  back,
+
+		dirtyMu: new(sync.Mutex),
+		dirty:   map[string]entry{},
+
+		flushMu:       new(sync.Mutex),
+		flushInterval: flushInterval,
+
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go writeBehind.runFlushOnInterval(ctx, flushInterval)
+	return writeBehind
+}
+
+// Insert implements the `db.Table` interface. The value is read back from the
+// front table, and the copy is flushed, so the caller can modify the value once
+// it has been inserted.
+func (writeBehind *table) Insert(key string, value interface{}) error {
+	writeBehind.dirtyMu.Lock()
+	defer writeBehind.dirtyMu.Unlock()
+
+	if writeBehind.draining {
+		return cache.ErrDraining
+	}
+	if err := writeBehind.front.Insert(key, value); err != nil {
+		return err
+	}
+	if value != nil {
+		copied := reflect.New(reflect.TypeOf(value))
+		if err := writeBehind.front.Get(key, copied.Interface()); err != nil {
+			return fmt.Errorf("error copying value of key=%v: %w", key, err)
+		}
+		value = copied.Elem().Interface()
+	}
+	writeBehind.dirty[key] = entry{value: value}
+	return nil
+}
+
+// Get implements the `db.Table` interface. Values that are not in the front
+// table are read from the back table.
+func (writeBehind *table) Get(key string, value interface{}) error {
+	writeBehind.dirtyMu.Lock()
+	entry, ok := writeBehind.dirty[key]
+	writeBehind.dirtyMu.Unlock()
+	if ok && entry.deleted {
+		return db.ErrKeyNotFound
+	}
+
+	err := writeBehind.front.Get(key, value)
+	if !errors.Is(err, db.ErrKeyNotFound) {
+		return err
+	}
+	return writeBehind.back.Get(key, value)
+}
+
+// Delete implements the `db.Table` interface.
+func (writeBehind *table) Delete(key string) error {
+	writeBehind.dirtyMu.Lock()
+	defer writeBehind.dirtyMu.Unlock()
+
+	if writeBehind.draining {
+		return cache.ErrDraining
+	}
+	if err := writeBehind.front.Delete(key); err != nil {
+		return err
+	}
+	writeBehind.dirty[key] = entry{deleted: true}
+	return nil
+}
+
+// Size implements the `db.Table` interface. It returns the size of the back
+// table, which does not include writes that have not been flushed yet.
+func (writeBehind *table) Size() (int, error) {
+	return writeBehind.back.Size()
+}
+
+// Iterator implements the `db.Table` interface. It iterates over the back
+// table, which does not include writes that have not been flushed yet.
+func (writeBehind *table) Iterator() db.Iterator {
+	return writeBehind.back.Iterator()
+}
+
+// Close implements the `Table` interface.
+func (writeBehind *table) Close() error {
+	writeBehind.cancel()
+	<-writeBehind.done
+	return writeBehind.flush()
+}
+
+// Drain implements the `Table` interface.
+func (writeBehind *table) Drain(ctx context.Context) error {
+	writeBehind.dirtyMu.Lock()
+	writeBehind.draining = true
+	writeBehind.dirtyMu.Unlock()
+
+	ticker := time.NewTicker(writeBehind.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		err := writeBehind.flush()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (writeBehind *table) runFlushOnInterval(ctx context.Context, flushInterval time.Duration) {
+	defer close(writeBehind.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := writeBehind.flush(); err != nil {
+				log.Println(fmt.Errorf("failed to flush table: %w", err))
+			}
+		}
+	}
+}
+
+// flush all dirty writes to the back table. If a write fails, then it and all
+// writes that have not been flushed are kept, unless they have since been
+// overwritten.
+func (writeBehind *table) flush() error {
+	writeBehind.flushMu.Lock()
+	defer writeBehind.flushMu.Unlock()
+
+	writeBehind.dirtyMu.Lock()
+	dirty := writeBehind.dirty
+	writeBehind.dirty = map[string]entry{}
+	writeBehind.dirtyMu.Unlock()
+
+	for key, entry := range dirty {
+		var err error
+		if entry.deleted {
+			err = writeBehind.back.Delete(key)
+		} else {
+			err = writeBehind.back.Insert(key, entry.value)
+		}
+		if err != nil {
+			writeBehind.dirtyMu.Lock()
+			defer writeBehind.dirtyMu.Unlock()
+
+			for key, entry := range dirty {
+				if _, ok := writeBehind.dirty[key]; !ok {
+					writeBehind.dirty[key] = entry
+				}
+			}
+			return fmt.Errorf("error flushing key=%v: %w", key, err)
+		}
+		delete(dirty, key)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package writebehind_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteBehind(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Write Behind Suite")
+}
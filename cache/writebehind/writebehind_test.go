@@ -0,0 +1,186 @@
+package writebehind_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/cache/writebehind"
+
+	"github.com/renproject/kv/cache"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errBack = errors.New("back failure")
+
+// countingTable is a `db.Table` that counts inserts, and fails them while it is
+// told to.
+type countingTable struct {
+	db.Table
+	inserts int64
+	fail    int32
+}
+
+func (table *countingTable) Insert(key string, value interface{}) error {
+	if atomic.LoadInt32(&table.fail) == 1 {
+		return errBack
+	}
+	atomic.AddInt64(&table.inserts, 1)
+	return table.Table.Insert(key, value)
+}
+
+var _ = Describe("write-behind table", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when writing to the table", func() {
+			It("should read the writes before they are flushed", func() {
+				back := db.NewTable(memdb.New(codec), "back")
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, time.Hour)
+				defer table.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(table.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+				Expect(back.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should flush the value as it was inserted", func() {
+				back := db.NewTable(memdb.New(codec), "back")
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, time.Hour)
+
+				value := testutil.RandomTestStruct()
+				value.D = append(value.D, 1)
+				expected := value
+				expected.D = append([]byte{}, value.D...)
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+				value.D[0]++
+				Expect(table.Close()).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(back.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(expected))
+			})
+
+			It("should read from the back table when the front table misses", func() {
+				back := db.NewTable(memdb.New(codec), "back")
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, time.Hour)
+				defer table.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(back.Insert("key", value)).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(table.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				// Deletes should hide the value in the back table before they
+				// are flushed.
+				Expect(table.Delete("key")).NotTo(HaveOccurred())
+				Expect(table.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+			})
+		})
+
+		Context("when flushing", func() {
+			It("should flush on the interval", func() {
+				back := db.NewTable(memdb.New(codec), "back")
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, 10*time.Millisecond)
+				defer table.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+				Eventually(func() error {
+					stored := testutil.TestStruct{D: []byte{}}
+					return back.Get("key", &stored)
+				}).Should(Succeed())
+
+				Expect(table.Delete("key")).NotTo(HaveOccurred())
+				Eventually(func() error {
+					stored := testutil.TestStruct{D: []byte{}}
+					return back.Get("key", &stored)
+				}).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should only flush the latest write of each key", func() {
+				back := &countingTable{Table: db.NewTable(memdb.New(codec), "back")}
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, time.Hour)
+
+				var value testutil.TestStruct
+				for i := 0; i < 10; i++ {
+					value = testutil.RandomTestStruct()
+					Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+				}
+				Expect(table.Close()).NotTo(HaveOccurred())
+
+				Expect(back.inserts).Should(Equal(int64(1)))
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(back.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+			})
+
+			It("should keep writes that fail to flush", func() {
+				back := &countingTable{Table: db.NewTable(memdb.New(codec), "back"), fail: 1}
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, time.Hour)
+
+				value := testutil.RandomTestStruct()
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+				Expect(errors.Is(table.Close(), errBack)).Should(BeTrue())
+
+				atomic.StoreInt32(&back.fail, 0)
+				Expect(table.Close()).NotTo(HaveOccurred())
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(back.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+			})
+		})
+
+		Context("when draining", func() {
+			It("should reject writes, allow reads, and flush pending writes", func() {
+				back := db.NewTable(memdb.New(codec), "back")
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, time.Hour)
+				defer table.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+				Expect(table.Drain(context.Background())).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(back.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				Expect(table.Insert("other", value)).Should(Equal(cache.ErrDraining))
+				Expect(table.Delete("key")).Should(Equal(cache.ErrDraining))
+				stored = testutil.TestStruct{D: []byte{}}
+				Expect(table.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+			})
+
+			It("should retry flushing until the context is done", func() {
+				back := &countingTable{Table: db.NewTable(memdb.New(codec), "back"), fail: 1}
+				table := New(context.Background(), db.NewTable(memdb.New(codec), "front"), back, 10*time.Millisecond)
+				defer table.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				Expect(errors.Is(table.Drain(ctx), context.DeadlineExceeded)).Should(BeTrue())
+
+				atomic.StoreInt32(&back.fail, 0)
+				Expect(table.Drain(context.Background())).NotTo(HaveOccurred())
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(back.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+			})
+		})
+	}
+})
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Copy inserts all of the key/value pairs in the source into the destination,
+// and returns the number of key/value pairs copied. Values are decoded into the
+// value returned by `newValue`. If the destination has a limited capacity, it
+// can evict key/value pairs while they are being copied, so it can have less
+// than the returned number of key/value pairs. If any key/value pair cannot be
+// copied, the error is returned along with the number of key/value pairs that
+// were copied before it.
+func Copy(dst Inserter, src DB, newValue func() interface{}) (int, error) {
+	iter := src.Iterator("")
+	defer iter.Close()
+
+	copied := 0
+	for iter.Next() {
+		key, value, err := read(iter, newValue)
+		if err != nil {
+			return copied, err
+		}
+		if err := dst.Insert(key, value); err != nil {
+			return copied, fmt.Errorf("error copying key=%v: %w", key, err)
+		}
+		copied++
+	}
+	return copied, iter.Err()
+}
+
+// CopyConcurrently is the same as Copy, but key/value pairs are inserted into
+// the destination by the given number of workers at the same time. This is
+// useful when the destination is sharded, or otherwise benefits from
+// concurrent inserts. The destination must be safe for concurrent use. If any
+// key/value pair cannot be copied, no more key/value pairs are read from the
+// source, but the key/value pairs that have already been read are still
+// copied.
+func CopyConcurrently(dst Inserter, src DB, newValue func() interface{}, workers int) (int, error) {
+	if workers <= 0 {
+		panic(fmt.Sprintf("number of workers must be positive, got %v", workers))
+	}
+
+	type pair struct {
+		key   string
+		value interface{}
+	}
+	pairs := make(chan pair, workers)
+	done := make(chan struct{})
+
+	mu := new(sync.Mutex)
+	copied := 0
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if firstErr == nil {
+			firstErr = err
+			close(done)
+		}
+	}
+
+	wg := new(sync.WaitGroup)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for pair := range pairs {
+				if err := dst.Insert(pair.key, pair.value); err != nil {
+					fail(fmt.Errorf("error copying key=%v: %w", pair.key, err))
+					continue
+				}
+				mu.Lock()
+				copied++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	func() {
+		defer close(pairs)
+
+		iter := src.Iterator("")
+		defer iter.Close()
+
+		for iter.Next() {
+			key, value, err := read(iter, newValue)
+			if err != nil {
+				fail(err)
+				return
+			}
+			select {
+			case pairs <- pair{key: key, value: value}:
+			case <-done:
+				return
+			}
+		}
+		if err := iter.Err(); err != nil {
+			fail(err)
+		}
+	}()
+	wg.Wait()
+
+	return copied, firstErr
+}
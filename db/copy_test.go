@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("copy", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newValue := func() interface{} {
+			return &testutil.TestStruct{D: []byte{}}
+		}
+
+		fill := func(database DB, n int) {
+			for i := 0; i < n; i++ {
+				Expect(database.Insert(fmt.Sprintf("%v", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+			}
+		}
+
+		Context("when copying between dbs", func() {
+			It("should copy all of the key/value pairs", func() {
+				src, dst := rrdb.New(codec, 100), rrdb.New(codec, 100)
+				fill(src, 100)
+
+				copied, err := Copy(dst, src, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(copied).Should(Equal(100))
+				Expect(testutil.CheckSame(src, dst, newValue)).NotTo(HaveOccurred())
+			})
+
+			It("should count key/value pairs evicted by the destination", func() {
+				src, dst := rrdb.New(codec, 100), rrdb.New(codec, 10)
+				fill(src, 100)
+
+				copied, err := Copy(dst, src, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(copied).Should(Equal(100))
+				size, err := dst.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+			})
+
+			It("should return an error if an insert fails", func() {
+				src := rrdb.New(codec, 100)
+				fill(src, 10)
+
+				copied, err := Copy(failingInserter{}, src, newValue)
+				Expect(errors.Is(err, errInsert)).Should(BeTrue())
+				Expect(copied).Should(BeZero())
+			})
+		})
+
+		Context("when copying between dbs concurrently", func() {
+			It("should copy all of the key/value pairs", func() {
+				src, dst := rrdb.New(codec, 100), rrdb.New(codec, 100)
+				fill(src, 100)
+
+				copied, err := CopyConcurrently(dst, src, newValue, 8)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(copied).Should(Equal(100))
+				Expect(testutil.CheckSame(src, dst, newValue)).NotTo(HaveOccurred())
+			})
+
+			It("should return an error if an insert fails", func() {
+				src := rrdb.New(codec, 100)
+				fill(src, 100)
+
+				copied, err := CopyConcurrently(failingInserter{}, src, newValue, 8)
+				Expect(errors.Is(err, errInsert)).Should(BeTrue())
+				Expect(copied).Should(BeZero())
+			})
+
+			It("should panic if the number of workers is not positive", func() {
+				Expect(func() { CopyConcurrently(rrdb.New(codec, 10), rrdb.New(codec, 10), newValue, 0) }).Should(Panic())
+			})
+		})
+	}
+})
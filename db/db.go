@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"io"
 )
 
 // ErrKeyNotFound is returned when there is no value associated with a key.
@@ -10,6 +11,14 @@ var ErrKeyNotFound = errors.New("key not found")
 // ErrEmptyKey is returned when key is empty.
 var ErrEmptyKey = errors.New("key cannot be empty")
 
+// ErrClosed is returned when using a DB that has been closed. Not all DBs
+// detect this, and using them after they have been closed can panic instead.
+var ErrClosed = errors.New("db closed")
+
+// ErrKeyExists is returned when a key that must not exist already has a value
+// associated with it.
+var ErrKeyExists = errors.New("key already exists")
+
 // ErrIndexOutOfRange is returned when the iterator index is not in a valid
 // range.
 var ErrIndexOutOfRange = errors.New("iterator index out of range")
@@ -55,6 +64,203 @@ type DB interface {
 	Iterator(prefix string) Iterator
 }
 
+// GetAndDeleter is implemented by DBs that can get and delete a value in one
+// atomic step.
+type GetAndDeleter interface {
+
+	// GetAndDelete gets the value associated with the given key, writes it to
+	// the value interface, and deletes it. The value interface must be a
+	// pointer. If the key cannot be found, then ErrKeyNotFound is returned. No
+	// two calls will get the same value.
+	GetAndDelete(key string, value interface{}) error
+}
+
+// CompareAndSwapper is implemented by DBs that can replace a value in one
+// atomic step, only if the current value is as expected.
+type CompareAndSwapper interface {
+
+	// CompareAndSwap replaces the value associated with the given key with the
+	// new value, only if the encoding of the current value is equal to the
+	// encoding of the old value. A nil old value means that the key must not
+	// exist, and a nil new value means that the key is deleted. It returns
+	// whether or not the value was replaced.
+	CompareAndSwap(key string, old, new interface{}) (bool, error)
+}
+
+// Swapper is implemented by DBs that can replace a value, and get the value
+// that it replaced, in one atomic step.
+type Swapper interface {
+
+	// Swap writes the value associated with the given key, and writes the
+	// value that it replaced to the old value interface, which must be a
+	// pointer. It returns whether or not the key existed. If it did not, the
+	// old value interface is not modified.
+	Swap(key string, value, old interface{}) (bool, error)
+}
+
+// ConditionalDeleter is implemented by DBs that can delete a value in one
+// atomic step, only if the current value is as expected.
+type ConditionalDeleter interface {
+
+	// DeleteIf deletes the value associated with the given key, only if the
+	// encoding of the current value is equal to the encoding of the expected
+	// value. It returns whether or not the value was deleted.
+	DeleteIf(key string, expected interface{}) (bool, error)
+}
+
+// Renamer is implemented by DBs that can move a value from one key to another
+// in one atomic step.
+type Renamer interface {
+
+	// Rename moves the value associated with the old key to the new key,
+	// replacing the value of the new key if it exists. If the old key cannot
+	// be found, then ErrKeyNotFound is returned.
+	Rename(oldKey, newKey string) error
+
+	// RenameNX is the same as Rename, but returns ErrKeyExists instead of
+	// replacing the value of the new key if it exists.
+	RenameNX(oldKey, newKey string) error
+}
+
+// Merger is implemented by DBs that can read, modify, and write a value in one
+// atomic step.
+type Merger interface {
+
+	// Merge the value associated with the given key. If the key exists, its
+	// value is written to the value interface, which must be a pointer. Then,
+	// the merge function is called with whether or not the key exists, and the
+	// value it returns is written. If the merge function returns an error,
+	// nothing is written and the error is returned.
+	Merge(key string, value interface{}, mergeFn func(found bool) (interface{}, error)) error
+}
+
+// Ordered is implemented by DBs that store keys in lexicographic order.
+type Ordered interface {
+
+	// First gets the smallest key and writes its value to the value interface.
+	// The value interface must be a pointer. If the DB is empty, then
+	// ErrKeyNotFound is returned.
+	First(value interface{}) (string, error)
+
+	// Last gets the largest key and writes its value to the value interface.
+	// The value interface must be a pointer. If the DB is empty, then
+	// ErrKeyNotFound is returned.
+	Last(value interface{}) (string, error)
+}
+
+// RangeDeleter is implemented by DBs that can delete a range of keys in one
+// call.
+type RangeDeleter interface {
+
+	// DeleteRange deletes all key/value pairs where the key is in the
+	// half-open range from start to end, in lexicographic order, and returns
+	// the number of key/value pairs deleted. Keys equal to start are deleted,
+	// and keys equal to end are not.
+	DeleteRange(start, end string) (int, error)
+}
+
+// StreamStore is implemented by DBs that can stream values, so that large
+// values do not need to be held in memory. Streams hold the encoded values, so
+// a value inserted with Insert can be read with GetStream and decoded with the
+// Codec of the DB, and the other way around.
+type StreamStore interface {
+
+	// InsertStream writes the encoded value read from the reader into the DB,
+	// until the reader returns io.EOF.
+	InsertStream(key string, r io.Reader) error
+
+	// GetStream returns a reader of the encoded value associated with the
+	// given key, which must be closed after reading. If the key cannot be
+	// found, then ErrKeyNotFound is returned.
+	GetStream(key string) (io.ReadCloser, error)
+}
+
+// KeyIterable is implemented by DBs that can iterate over keys without reading
+// their values.
+type KeyIterable interface {
+
+	// KeyIterator over the keys in the DB that begin with the given prefix.
+	// The values are never read, which saves memory, and IO for DBs that
+	// store values on disk.
+	KeyIterator(prefix string) KeyIterator
+}
+
+// BatchChecker is implemented by DBs that can check whether many keys exist at
+// once, more cheaply than getting each of them.
+type BatchChecker interface {
+
+	// HasBatch returns whether or not each of the keys exists, in the same
+	// order as the keys. The values are never read.
+	HasBatch(keys []string) ([]bool, error)
+}
+
+// Prewarmer is implemented by DBs that can prepare for a burst of inserts.
+type Prewarmer interface {
+
+	// Prewarm allocates room for the expected number of new entries, so that
+	// the DB does not need to grow while they are inserted. It is only a hint,
+	// and does not change the behaviour of the DB. A number of entries that is
+	// not positive is ignored.
+	Prewarm(expectedEntries int)
+}
+
+// Capacitor is implemented by DBs that can hold a limited number of key/value
+// pairs. Along with Size, it lets callers compute how full the DB is.
+type Capacitor interface {
+
+	// Cap returns the maximum number of key/value pairs that the DB can hold,
+	// or -1 if the number is not limited.
+	Cap() int
+}
+
+// Capabilities returns the names of the optional interfaces that are
+// implemented by the given value, so that callers can adapt to what a DB
+// supports. The names are returned in the order in which the interfaces are
+// declared in this package.
+func Capabilities(v interface{}) []string {
+	capabilities := []string{}
+	if _, ok := v.(GetAndDeleter); ok {
+		capabilities = append(capabilities, "GetAndDeleter")
+	}
+	if _, ok := v.(CompareAndSwapper); ok {
+		capabilities = append(capabilities, "CompareAndSwapper")
+	}
+	if _, ok := v.(Swapper); ok {
+		capabilities = append(capabilities, "Swapper")
+	}
+	if _, ok := v.(ConditionalDeleter); ok {
+		capabilities = append(capabilities, "ConditionalDeleter")
+	}
+	if _, ok := v.(Renamer); ok {
+		capabilities = append(capabilities, "Renamer")
+	}
+	if _, ok := v.(Merger); ok {
+		capabilities = append(capabilities, "Merger")
+	}
+	if _, ok := v.(Ordered); ok {
+		capabilities = append(capabilities, "Ordered")
+	}
+	if _, ok := v.(RangeDeleter); ok {
+		capabilities = append(capabilities, "RangeDeleter")
+	}
+	if _, ok := v.(StreamStore); ok {
+		capabilities = append(capabilities, "StreamStore")
+	}
+	if _, ok := v.(KeyIterable); ok {
+		capabilities = append(capabilities, "KeyIterable")
+	}
+	if _, ok := v.(BatchChecker); ok {
+		capabilities = append(capabilities, "BatchChecker")
+	}
+	if _, ok := v.(Prewarmer); ok {
+		capabilities = append(capabilities, "Prewarmer")
+	}
+	if _, ok := v.(Capacitor); ok {
+		capabilities = append(capabilities, "Capacitor")
+	}
+	return capabilities
+}
+
 // Iterator is used to iterate through the data in the store.
 type Iterator interface {
 
@@ -72,8 +278,34 @@ type Iterator interface {
 	// `ErrIndexOutOfRange`
 	Value(value interface{}) error
 
+	// Err returns the error that stopped the iteration, if any. It should be
+	// checked after Next returns false, to distinguish between an iteration
+	// that has finished and one that has failed.
+	Err() error
+
 	// Close must be called after finishing the iteration to release associated
 	// resources. Close should always success and can be called multiple times
 	// without causing error.
 	Close()
 }
+
+// KeyIterator is used to iterate through the keys in the store, without their
+// values. Every Iterator is also a KeyIterator.
+type KeyIterator interface {
+
+	// Next will progress the iterator to the next key. If there are more keys
+	// in the iterator, then it will return true, otherwise it will return
+	// false.
+	Next() bool
+
+	// Key that is current. Calling Key() without calling Next() or when no
+	// next item in the iter may result in `ErrIndexOutOfRange`
+	Key() (string, error)
+
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+
+	// Close must be called after finishing the iteration to release associated
+	// resources.
+	Close()
+}
@@ -1 +1,24 @@
 package db_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/leveldb"
+	"github.com/renproject/kv/memdb/rrdb"
+)
+
+var _ = Describe("capabilities", func() {
+	It("should report the optional interfaces implemented by rrdb", func() {
+		Expect(Capabilities(rrdb.New(codec.JSONCodec, 10))).Should(Equal([]string{"GetAndDeleter", "CompareAndSwapper", "Swapper", "ConditionalDeleter", "Renamer", "Merger", "RangeDeleter", "StreamStore", "KeyIterable", "BatchChecker", "Prewarmer", "Capacitor"}))
+	})
+
+	It("should report the optional interfaces implemented by leveldb", func() {
+		database := leveldb.New(".leveldb", codec.JSONCodec)
+		defer database.Close()
+
+		Expect(Capabilities(database)).Should(Equal([]string{"Ordered"}))
+	})
+})
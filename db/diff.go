@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Diff compares the key/value pairs of two iterators, and returns the keys that
+// are only in the first iterator, the keys that are only in the second
+// iterator, and the keys that are in both but have different values. Values
+// are decoded into the value returned by `newValue`, and compared using
+// `reflect.DeepEqual`. All of the key/value pairs in the second iterator are
+// read into memory, so that the iterators can be in any order. The iterators
+// are not closed, and the returned keys are sorted.
+func Diff(a, b Iterator, newValue func() interface{}) (onlyInA, onlyInB, different []string, err error) {
+	valuesInB := map[string]interface{}{}
+	for b.Next() {
+		key, value, err := read(b, newValue)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		valuesInB[key] = value
+	}
+	if err := b.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	onlyInA, onlyInB, different = []string{}, []string{}, []string{}
+	for a.Next() {
+		key, value, err := read(a, newValue)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		valueInB, ok := valuesInB[key]
+		if !ok {
+			onlyInA = append(onlyInA, key)
+			continue
+		}
+		if !reflect.DeepEqual(value, valueInB) {
+			different = append(different, key)
+		}
+		delete(valuesInB, key)
+	}
+	if err := a.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	for key := range valuesInB {
+		onlyInB = append(onlyInB, key)
+	}
+
+	sort.Strings(onlyInA)
+	sort.Strings(onlyInB)
+	sort.Strings(different)
+	return onlyInA, onlyInB, different, nil
+}
+
+// DiffSorted is the same as Diff, but it requires both iterators to be ordered
+// by key (for example, iterators over a leveldb or badgerdb). The iterators are
+// read side by side, so only one key/value pair from each is in memory at a
+// time. If a key is found to be out of order, an error is returned.
+func DiffSorted(a, b Iterator, newValue func() interface{}) (onlyInA, onlyInB, different []string, err error) {
+	onlyInA, onlyInB, different = []string{}, []string{}, []string{}
+	sortedA := &sortedIterator{Iterator: a}
+	sortedB := &sortedIterator{Iterator: b}
+
+	okA, errA := sortedA.next(newValue)
+	okB, errB := sortedB.next(newValue)
+	for {
+		if errA != nil {
+			return nil, nil, nil, errA
+		}
+		if errB != nil {
+			return nil, nil, nil, errB
+		}
+
+		switch {
+		case !okA && !okB:
+			return onlyInA, onlyInB, different, nil
+		case okA && (!okB || sortedA.key < sortedB.key):
+			onlyInA = append(onlyInA, sortedA.key)
+			okA, errA = sortedA.next(newValue)
+		case okB && (!okA || sortedB.key < sortedA.key):
+			onlyInB = append(onlyInB, sortedB.key)
+			okB, errB = sortedB.next(newValue)
+		default:
+			if !reflect.DeepEqual(sortedA.value, sortedB.value) {
+				different = append(different, sortedA.key)
+			}
+			okA, errA = sortedA.next(newValue)
+			okB, errB = sortedB.next(newValue)
+		}
+	}
+}
+
+// sortedIterator keeps the current key/value pair of an iterator, and checks
+// that the keys are ordered.
+type sortedIterator struct {
+	Iterator
+	started bool
+	key     string
+	value   interface{}
+}
+
+// next progresses the iterator and reads the next key/value pair.
+func (iter *sortedIterator) next(newValue func() interface{}) (bool, error) {
+	if !iter.Iterator.Next() {
+		return false, iter.Iterator.Err()
+	}
+	key, value, err := read(iter.Iterator, newValue)
+	if err != nil {
+		return false, err
+	}
+	if iter.started && key <= iter.key {
+		return false, fmt.Errorf("iterator is not sorted: key=%v is after key=%v", key, iter.key)
+	}
+	iter.started = true
+	iter.key = key
+	iter.value = value
+	return true, nil
+}
+
+// read the current key/value pair of the iterator.
+func read(iter Iterator, newValue func() interface{}) (string, interface{}, error) {
+	key, err := iter.Key()
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading key: %w", err)
+	}
+	value := newValue()
+	if err := iter.Value(value); err != nil {
+		return "", nil, fmt.Errorf("error reading value of key=%v: %w", key, err)
+	}
+	return key, value, nil
+}
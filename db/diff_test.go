@@ -0,0 +1,107 @@
+package db_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/leveldb"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("diff", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newValue := func() interface{} {
+			return &testutil.TestStruct{D: []byte{}}
+		}
+
+		// fill the dbs so that "a" and "b" are only in the first db, "x" is
+		// only in the second db, "c" has a different value, and "d" and "e"
+		// are the same.
+		fill := func(a, b DB) {
+			same := testutil.RandomTestStruct()
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				Expect(a.Insert(key, same)).NotTo(HaveOccurred())
+			}
+			for _, key := range []string{"c", "d", "e", "x"} {
+				Expect(b.Insert(key, same)).NotTo(HaveOccurred())
+			}
+			different := testutil.RandomTestStruct()
+			different.A = same.A + "different"
+			Expect(b.Insert("c", different)).NotTo(HaveOccurred())
+		}
+
+		Context("when comparing unsorted iterators", func() {
+			It("should classify the keys", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				fill(a, b)
+
+				iterA, iterB := a.Iterator(""), b.Iterator("")
+				defer iterA.Close()
+				defer iterB.Close()
+
+				onlyInA, onlyInB, different, err := Diff(iterA, iterB, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(onlyInA).Should(Equal([]string{"a", "b"}))
+				Expect(onlyInB).Should(Equal([]string{"x"}))
+				Expect(different).Should(Equal([]string{"c"}))
+			})
+
+			It("should find every key of disjoint sets of keys in only one of them", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				Expect(a.Insert("a", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				Expect(b.Insert("b", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+
+				iterA, iterB := a.Iterator(""), b.Iterator("")
+				defer iterA.Close()
+				defer iterB.Close()
+
+				onlyInA, onlyInB, different, err := Diff(iterA, iterB, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(onlyInA).Should(Equal([]string{"a"}))
+				Expect(onlyInB).Should(Equal([]string{"b"}))
+				Expect(different).Should(BeEmpty())
+			})
+		})
+
+		Context("when comparing sorted iterators", func() {
+			It("should classify the keys", func() {
+				a := leveldb.New(".leveldb/a", codec)
+				defer a.Close()
+				b := leveldb.New(".leveldb/b", codec)
+				defer b.Close()
+				fill(a, b)
+
+				iterA, iterB := a.Iterator(""), b.Iterator("")
+				defer iterA.Close()
+				defer iterB.Close()
+
+				onlyInA, onlyInB, different, err := DiffSorted(iterA, iterB, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(onlyInA).Should(Equal([]string{"a", "b"}))
+				Expect(onlyInB).Should(Equal([]string{"x"}))
+				Expect(different).Should(Equal([]string{"c"}))
+			})
+
+			It("should return an error if an iterator is not sorted", func() {
+				a := memdb.New(codec)
+				for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+					Expect(a.Insert(key, testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				}
+
+				// Repeat the comparison until the map iteration order of the
+				// memdb is unsorted.
+				Eventually(func() error {
+					iterA, iterB := a.Iterator(""), memdb.New(codec).Iterator("")
+					defer iterA.Close()
+					defer iterB.Close()
+					_, _, _, err := DiffSorted(iterA, iterB, newValue)
+					return err
+				}).Should(HaveOccurred())
+			})
+		})
+	}
+})
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrCorruptDump is returned by Import and Warm when the length of a key or a
+// value is greater than MaxDumpLength.
+var ErrCorruptDump = errors.New("corrupt dump")
+
+// ErrDumpTooLarge is returned by Export when a key or an encoded value is
+// greater than MaxDumpLength.
+var ErrDumpTooLarge = errors.New("key or value too large to dump")
+
+// MaxDumpLength is the maximum length of a key or an encoded value in a dump
+// written by Export. It bounds the memory that is allocated by Import and Warm
+// for each length that is read.
+const MaxDumpLength = 64 << 20
+
+// Export writes all of the key/value pairs in the iterator to the writer. Each
+// value is decoded into the value returned by `newValue`, encoded using the
+// codec, and written as a length-prefixed key followed by a length-prefixed
+// value. If a key or an encoded value is greater than MaxDumpLength, then
+// ErrDumpTooLarge is returned. The iterator is not closed.
+func Export(w io.Writer, iter Iterator, codec Codec, newValue func() interface{}) error {
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return fmt.Errorf("error reading key: %w", err)
+		}
+		value := newValue()
+		if err := iter.Value(value); err != nil {
+			return fmt.Errorf("error reading value of key=%v: %w", key, err)
+		}
+		data, err := codec.Encode(value)
+		if err != nil {
+			return fmt.Errorf("error encoding value of key=%v: %w", key, err)
+		}
+		if err := writeBytes(w, []byte(key)); err != nil {
+			return err
+		}
+		if err := writeBytes(w, data); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Import reads key/value pairs that were written by Export from the reader, and
+// inserts them. Each value is decoded using the codec into the value returned
+// by `newValue`, which must be a pointer. If the length of a key or a value is
+// greater than MaxDumpLength, then ErrCorruptDump is returned.
+func Import(inserter Inserter, r io.Reader, codec Codec, newValue func() interface{}) error {
+	return Warm(inserter, r, codec, newValue, 1)
+}
+
+// Warm reads key/value pairs that were written by Export from the reader, and
+// inserts them using the given number of concurrent workers. This is useful
+// for populating a DB that scales with concurrent inserts. Each value is
+// decoded using the codec into the value returned by `newValue`, which must be
+// a pointer. Inserts into a DB with a limited capacity may evict other
+// key/value pairs.
+func Warm(inserter Inserter, r io.Reader, codec Codec, newValue func() interface{}, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type record struct {
+		key  string
+		data []byte
+	}
+	records := make(chan record, concurrency)
+	done := make(chan struct{})
+
+	errsMu := new(sync.Mutex)
+	var errs []error
+	fail := func(err error) {
+		errsMu.Lock()
+		defer errsMu.Unlock()
+
+		if len(errs) == 0 {
+			close(done)
+		}
+		errs = append(errs, err)
+	}
+
+	wg := new(sync.WaitGroup)
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for record := range records {
+				value := newValue()
+				if err := codec.Decode(record.data, value); err != nil {
+					fail(fmt.Errorf("error decoding value of key=%v: %w", record.key, err))
+					return
+				}
+				if err := inserter.Insert(record.key, value); err != nil {
+					fail(fmt.Errorf("error inserting key=%v: %w", record.key, err))
+					return
+				}
+			}
+		}()
+	}
+
+	br := bufio.NewReader(r)
+	func() {
+		defer close(records)
+		for {
+			key, err := readBytes(br)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			data, err := readBytes(br)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			select {
+			case <-done:
+				return
+			case records <- record{key: string(key), data: data}:
+			}
+		}
+	}()
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// jsonlRecord is a line of a JSON-lines dump. Keys that are valid UTF-8 are
+// written as JSON strings, and other keys are written in base64, because JSON
+// strings cannot hold invalid UTF-8. Values are always written in base64.
+type jsonlRecord struct {
+	Key       string `json:"key,omitempty"`
+	KeyBase64 []byte `json:"key_base64,omitempty"`
+	Value     []byte `json:"value"`
+}
+
+// ExportJSONL writes all of the key/value pairs in the iterator to the writer
+// as JSON lines, so that they can be read and edited by other tools. Each line
+// is an object with the key, and the value encoded using the codec and then in
+// base64. Keys that are not valid UTF-8 are written in base64 instead, with the
+// name "key_base64". Each value is decoded into the value returned by
+// `newValue`. The iterator is not closed.
+func ExportJSONL(w io.Writer, iter Iterator, codec Codec, newValue func() interface{}) error {
+	encoder := json.NewEncoder(w)
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return fmt.Errorf("error reading key: %w", err)
+		}
+		value := newValue()
+		if err := iter.Value(value); err != nil {
+			return fmt.Errorf("error reading value of key=%v: %w", key, err)
+		}
+		data, err := codec.Encode(value)
+		if err != nil {
+			return fmt.Errorf("error encoding value of key=%v: %w", key, err)
+		}
+
+		record := jsonlRecord{Value: data}
+		if utf8.ValidString(key) {
+			record.Key = key
+		} else {
+			record.KeyBase64 = []byte(key)
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("error writing key=%v: %w", key, err)
+		}
+	}
+	return iter.Err()
+}
+
+// ImportJSONL reads key/value pairs that were written by ExportJSONL from the
+// reader, and inserts them. Each value is decoded using the codec into the
+// value returned by `newValue`, which must be a pointer.
+func ImportJSONL(inserter Inserter, r io.Reader, codec Codec, newValue func() interface{}) error {
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record jsonlRecord
+		if err := decoder.Decode(&record); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading line %v: %w", line, err)
+		}
+
+		key := record.Key
+		if len(record.KeyBase64) > 0 {
+			key = string(record.KeyBase64)
+		}
+		value := newValue()
+		if err := codec.Decode(record.Value, value); err != nil {
+			return fmt.Errorf("error decoding value of key=%v: %w", key, err)
+		}
+		if err := inserter.Insert(key, value); err != nil {
+			return fmt.Errorf("error inserting key=%v: %w", key, err)
+		}
+	}
+}
+
+// Dump writes the key/value pairs in the iterator to the writer in a
+// human-readable form, for troubleshooting. Each key/value pair is written on
+// its own line, as the quoted key followed by the value, and the lines are
+// sorted by key so that the output is stable. Each value is decoded into the
+// value returned by `newValue`, and formatted by `format` along with its key,
+// or by FormatValue if it is nil. All of the lines are held in memory to sort
+// them. The iterator is not closed.
+func Dump(w io.Writer, iter Iterator, newValue func() interface{}, format func(key string, value interface{}) string) error {
+	if format == nil {
+		format = func(key string, value interface{}) string {
+			return FormatValue(value)
+		}
+	}
+
+	lines := map[string]string{}
+	keys := []string{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return fmt.Errorf("error reading key: %w", err)
+		}
+		value := newValue()
+		if err := iter.Value(value); err != nil {
+			return fmt.Errorf("error reading value of key=%v: %w", key, err)
+		}
+		lines[key] = format(key, value)
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%q %v\n", key, lines[key]); err != nil {
+			return fmt.Errorf("error writing key=%v: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// FormatValue formats a value for Dump. Byte slices are hex-encoded, and other
+// values are formatted with their field names. Pointers are formatted as the
+// value that they point to.
+func FormatValue(value interface{}) string {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return hex.EncodeToString(v.Bytes())
+	}
+	if !v.IsValid() {
+		return fmt.Sprintf("%+v", value)
+	}
+	return fmt.Sprintf("%+v", v.Interface())
+}
+
+// writeBytes writes the length of the bytes followed by the bytes.
+func writeBytes(w io.Writer, data []byte) error {
+	if len(data) > MaxDumpLength {
+		return ErrDumpTooLarge
+	}
+	prefix := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(prefix, uint64(len(data)))
+	if _, err := w.Write(prefix[:n]); err != nil {
+		return fmt.Errorf("error writing length: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing data: %w", err)
+	}
+	return nil
+}
+
+// readBytes reads bytes that were written by writeBytes. It returns io.EOF if,
+// and only if, there are no more bytes to read.
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading length: %w", err)
+	}
+	if length > MaxDumpLength {
+		return nil, fmt.Errorf("%w: length = %v, max length = %v", ErrCorruptDump, length, MaxDumpLength)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("error reading data: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,203 @@
+package db_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("dump", func() {
+	dumpCodec := codec.GobCodec
+	newValue := func() interface{} {
+		return &testutil.TestStruct{D: []byte{}}
+	}
+
+	dump := func(n int) ([]byte, map[string]testutil.TestStruct) {
+		table := NewTable(memdb.New(codec.GobCodec), "source")
+		values := map[string]testutil.TestStruct{}
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("%v", i)
+			values[key] = testutil.RandomTestStruct()
+			Expect(table.Insert(key, values[key])).NotTo(HaveOccurred())
+		}
+
+		buf := new(bytes.Buffer)
+		iter := table.Iterator()
+		defer iter.Close()
+		Expect(Export(buf, iter, dumpCodec, newValue)).NotTo(HaveOccurred())
+		return buf.Bytes(), values
+	}
+
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when importing a dump", func() {
+			It("should insert all of the key/value pairs", func() {
+				data, values := dump(100)
+				table := NewTable(memdb.New(codec), "destination")
+				Expect(Import(table, bytes.NewReader(data), dumpCodec, newValue)).NotTo(HaveOccurred())
+
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(len(values)))
+				for key, value := range values {
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(table.Get(key, &stored)).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(value))
+				}
+			})
+		})
+
+		Context("when warming from a dump", func() {
+			It("should insert all of the key/value pairs using concurrent workers", func() {
+				data, values := dump(100)
+				table := NewTable(memdb.New(codec), "destination")
+				Expect(Warm(table, bytes.NewReader(data), dumpCodec, newValue, 8)).NotTo(HaveOccurred())
+
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(len(values)))
+				for key, value := range values {
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(table.Get(key, &stored)).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(value))
+				}
+			})
+
+			It("should respect the capacity of the db", func() {
+				data, _ := dump(100)
+				table := NewTable(rrdb.New(codec, 10), "destination")
+				Expect(Warm(table, bytes.NewReader(data), dumpCodec, newValue, 8)).NotTo(HaveOccurred())
+
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+			})
+		})
+	}
+
+	Context("when the dump is truncated", func() {
+		It("should return an error", func() {
+			data, _ := dump(10)
+			table := NewTable(memdb.New(dumpCodec), "destination")
+			Expect(Warm(table, bytes.NewReader(data[:len(data)-1]), dumpCodec, newValue, 4)).To(HaveOccurred())
+		})
+	})
+
+	Context("when the length of a key is corrupt", func() {
+		It("should return ErrCorruptDump", func() {
+			data := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}
+			table := NewTable(memdb.New(dumpCodec), "destination")
+			Expect(errors.Is(Import(table, bytes.NewReader(data), dumpCodec, newValue), ErrCorruptDump)).Should(BeTrue())
+		})
+	})
+
+	Context("when exporting as JSON lines", func() {
+		It("should round-trip keys with special characters and non-ASCII bytes", func() {
+			keys := []string{"plain", "\"quoted\"", "new\nline", "back\\slash", "日本語", "\xff\xfe invalid", "{\"key\": 1}"}
+			source := memdb.New(codec.JSONCodec)
+			values := map[string]testutil.TestStruct{}
+			for _, key := range keys {
+				values[key] = testutil.RandomTestStruct()
+				Expect(source.Insert(key, values[key])).NotTo(HaveOccurred())
+			}
+
+			buf := new(bytes.Buffer)
+			iter := source.Iterator("")
+			defer iter.Close()
+			Expect(ExportJSONL(buf, iter, dumpCodec, newValue)).NotTo(HaveOccurred())
+			Expect(strings.Count(buf.String(), "\n")).Should(Equal(len(keys)))
+
+			destination := memdb.New(codec.JSONCodec)
+			Expect(ImportJSONL(destination, buf, dumpCodec, newValue)).NotTo(HaveOccurred())
+			size, err := destination.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(len(keys)))
+			for key, value := range values {
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(destination.Get(key, &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+			}
+		})
+
+		It("should write readable keys and base64 values", func() {
+			database := memdb.New(codec.JSONCodec)
+			Expect(database.Insert("a\"b", []byte{0xde, 0xad})).NotTo(HaveOccurred())
+
+			buf := new(bytes.Buffer)
+			iter := database.Iterator("")
+			defer iter.Close()
+			Expect(ExportJSONL(buf, iter, codec.BinaryCodec, func() interface{} { return new([]byte) })).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(Equal("{\"key\":\"a\\\"b\",\"value\":\"3q0=\"}\n"))
+		})
+
+		It("should return an error if a line is not valid", func() {
+			database := memdb.New(codec.JSONCodec)
+			err := ImportJSONL(database, strings.NewReader("{\"key\":\"a\",\"value\":\"3q0=\"}\n{\"key\":"), codec.BinaryCodec, func() interface{} { return new([]byte) })
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("line 2"))
+
+			var value []byte
+			Expect(database.Get("a", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{0xde, 0xad}))
+		})
+	})
+
+	Context("when dumping in a human-readable form", func() {
+		It("should write each key/value pair on its own line sorted by key", func() {
+			database := memdb.New(codec.JSONCodec)
+			Expect(database.Insert("b", []byte{0xde, 0xad})).NotTo(HaveOccurred())
+			Expect(database.Insert("a", []byte{0xbe, 0xef})).NotTo(HaveOccurred())
+			Expect(database.Insert("c\n", []byte{})).NotTo(HaveOccurred())
+
+			buf := new(bytes.Buffer)
+			iter := database.Iterator("")
+			defer iter.Close()
+			Expect(Dump(buf, iter, func() interface{} { return new([]byte) }, nil)).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(Equal("\"a\" beef\n\"b\" dead\n\"c\\n\" \n"))
+		})
+
+		It("should format values with the given formatter", func() {
+			database := memdb.New(codec.JSONCodec)
+			for i := int64(0); i < 3; i++ {
+				Expect(database.Insert(fmt.Sprintf("key%v", 2-i), i)).NotTo(HaveOccurred())
+			}
+
+			buf := new(bytes.Buffer)
+			iter := database.Iterator("key")
+			defer iter.Close()
+			format := func(key string, value interface{}) string {
+				return fmt.Sprintf("key=%v n=%v", key, *value.(*int64))
+			}
+			Expect(Dump(buf, iter, func() interface{} { return new(int64) }, format)).NotTo(HaveOccurred())
+			Expect(buf.String()).Should(Equal("\"0\" key=0 n=2\n\"1\" key=1 n=1\n\"2\" key=2 n=0\n"))
+		})
+
+		It("should return the error from the iterator", func() {
+			iter := &failingIterator{Iterator: memdb.New(codec.JSONCodec).Iterator("")}
+			Expect(Dump(new(bytes.Buffer), iter, func() interface{} { return new(int64) }, nil)).Should(Equal(errIteration))
+		})
+	})
+
+	Context("when formatting values", func() {
+		It("should hex-encode bytes and format other values with their fields", func() {
+			Expect(FormatValue([]byte{1, 2})).Should(Equal("0102"))
+			data := []byte{0xff}
+			Expect(FormatValue(&data)).Should(Equal("ff"))
+			n := int64(42)
+			Expect(FormatValue(&n)).Should(Equal("42"))
+			Expect(FormatValue(struct{ A int }{1})).Should(Equal("{A:1}"))
+			Expect(FormatValue(nil)).Should(Equal("<nil>"))
+		})
+	})
+})
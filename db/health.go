@@ -0,0 +1,52 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+)
+
+// HealthCheckPrefix is the prefix of the keys written by HealthCheck. Each
+// check uses a different key so that concurrent checks do not interfere with
+// each other.
+const HealthCheckPrefix = "__healthcheck_"
+
+var healthCheckValue = []byte("ok")
+
+// HealthCheck confirms that the store is functioning by inserting, getting, and
+// deleting a sentinel value. It returns the first error encountered, or the
+// context error if the context is done before the round-trip completes.
+func HealthCheck(ctx context.Context, database ReadWriter) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- healthCheck(database)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+func healthCheck(database ReadWriter) error {
+	key := fmt.Sprintf("%v%d", HealthCheckPrefix, rand.Int63())
+	if err := database.Insert(key, healthCheckValue); err != nil {
+		return fmt.Errorf("error inserting health check value: %w", err)
+	}
+
+	value := []byte{}
+	if err := database.Get(key, &value); err != nil {
+		return fmt.Errorf("error getting health check value: %w", err)
+	}
+	if !bytes.Equal(value, healthCheckValue) {
+		return fmt.Errorf("unexpected health check value: expected = %v, got = %v", healthCheckValue, value)
+	}
+
+	if err := database.Delete(key); err != nil {
+		return fmt.Errorf("error deleting health check value: %w", err)
+	}
+	return nil
+}
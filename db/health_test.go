@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errInsert = errors.New("insert failure")
+
+// failingInserter is a `DB` where all inserts fail.
+type failingInserter struct {
+	DB
+}
+
+func (failingInserter) Insert(key string, value interface{}) error {
+	return errInsert
+}
+
+// blockingDB is a `DB` where all inserts block until the channel is closed.
+type blockingDB struct {
+	DB
+	unblock chan struct{}
+}
+
+func (database blockingDB) Insert(key string, value interface{}) error {
+	<-database.unblock
+	return database.DB.Insert(key, value)
+}
+
+var _ = Describe("health check", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when the store is healthy", func() {
+			It("should pass and leave nothing behind", func() {
+				database := memdb.New(codec)
+				table := NewTable(database, "table")
+
+				Expect(HealthCheck(context.Background(), database)).NotTo(HaveOccurred())
+				Expect(HealthCheck(context.Background(), table)).NotTo(HaveOccurred())
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+		})
+	}
+
+	Context("when the underlying db fails", func() {
+		It("should return the error", func() {
+			database := failingInserter{DB: memdb.New(testutil.Codecs[0])}
+			err := HealthCheck(context.Background(), database)
+			Expect(errors.Is(err, errInsert)).Should(BeTrue())
+		})
+	})
+
+	Context("when the context is done before the check completes", func() {
+		It("should return the context error", func() {
+			database := blockingDB{DB: memdb.New(testutil.Codecs[0]), unblock: make(chan struct{})}
+			defer close(database.unblock)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			Expect(HealthCheck(ctx, database)).Should(Equal(context.DeadlineExceeded))
+		})
+	})
+})
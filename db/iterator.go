@@ -0,0 +1,297 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FilterIterator returns an iterator that only yields the key/value pairs for
+// which `keep` returns true. The value of a key/value pair can be read by
+// calling `decode`, which behaves like the Value method of an Iterator. If the
+// key cannot be read, the pair is yielded so that the error can be seen by the
+// caller.
+func FilterIterator(iter Iterator, keep func(key string, decode func(value interface{}) error) bool) Iterator {
+	return &filterIterator{
+		Iterator: iter,
+		keep:     keep,
+	}
+}
+
+type filterIterator struct {
+	Iterator
+	keep func(key string, decode func(value interface{}) error) bool
+}
+
+// Next implements the `Iterator` interface.
+func (iter *filterIterator) Next() bool {
+	for iter.Iterator.Next() {
+		key, err := iter.Iterator.Key()
+		if err != nil || iter.keep(key, iter.Iterator.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MapIterator returns an iterator that transforms values as they are read.
+// After a value has been decoded, `transform` is called with the key and the
+// decoded value so that it can modify the value in place. An error returned by
+// `transform` is returned by the Value method of the iterator.
+func MapIterator(iter Iterator, transform func(key string, value interface{}) error) Iterator {
+	return &mapIterator{
+		Iterator:  iter,
+		transform: transform,
+	}
+}
+
+type mapIterator struct {
+	Iterator
+	transform func(key string, value interface{}) error
+}
+
+// Value implements the `Iterator` interface.
+func (iter *mapIterator) Value(value interface{}) error {
+	key, err := iter.Iterator.Key()
+	if err != nil {
+		return err
+	}
+	if err := iter.Iterator.Value(value); err != nil {
+		return err
+	}
+	return iter.transform(key, value)
+}
+
+// ProgressIterator returns an iterator that reports how many key/value pairs
+// have been iterated, given the expected total. `onProgress` is called with
+// the number of key/value pairs iterated every 1% of the total, or on every
+// key/value pair if the total is less than 100, and once more when the
+// iteration finishes if the last call was not for the final count. It is
+// called inline by Next, so it must be cheap.
+func ProgressIterator(iter Iterator, total int, onProgress func(done int)) Iterator {
+	every := total / 100
+	if every < 1 {
+		every = 1
+	}
+	return &progressIterator{
+		Iterator:   iter,
+		every:      every,
+		onProgress: onProgress,
+	}
+}
+
+type progressIterator struct {
+	Iterator
+	every      int
+	done       int
+	reported   int
+	finished   bool
+	onProgress func(done int)
+}
+
+// Next implements the `Iterator` interface.
+func (iter *progressIterator) Next() bool {
+	if !iter.Iterator.Next() {
+		if !iter.finished && iter.reported != iter.done {
+			iter.report()
+		}
+		iter.finished = true
+		return false
+	}
+	iter.done++
+	if iter.done%iter.every == 0 {
+		iter.report()
+	}
+	return true
+}
+
+func (iter *progressIterator) report() {
+	iter.reported = iter.done
+	iter.onProgress(iter.done)
+}
+
+// ConcatIterator returns an iterator that yields the key/value pairs of each of
+// the given iterators in turn. If one of the iterators fails, the iteration
+// stops. Closing it closes all of the iterators.
+func ConcatIterator(iters ...Iterator) Iterator {
+	return &concatIterator{
+		iters: iters,
+	}
+}
+
+type concatIterator struct {
+	index int
+	iters []Iterator
+}
+
+// Next implements the `Iterator` interface.
+func (iter *concatIterator) Next() bool {
+	for iter.index < len(iter.iters) {
+		if iter.iters[iter.index].Next() {
+			return true
+		}
+		if iter.iters[iter.index].Err() != nil {
+			return false
+		}
+		iter.index++
+	}
+	return false
+}
+
+// Key implements the `Iterator` interface.
+func (iter *concatIterator) Key() (string, error) {
+	if iter.index >= len(iter.iters) {
+		return "", ErrIndexOutOfRange
+	}
+	return iter.iters[iter.index].Key()
+}
+
+// Value implements the `Iterator` interface.
+func (iter *concatIterator) Value(value interface{}) error {
+	if iter.index >= len(iter.iters) {
+		return ErrIndexOutOfRange
+	}
+	return iter.iters[iter.index].Value(value)
+}
+
+// Err implements the `Iterator` interface. It returns the error of the
+// iterator that stopped the iteration.
+func (iter *concatIterator) Err() error {
+	if iter.index >= len(iter.iters) {
+		return nil
+	}
+	return iter.iters[iter.index].Err()
+}
+
+// Close implements the `Iterator` interface.
+func (iter *concatIterator) Close() {
+	for _, iter := range iter.iters {
+		iter.Close()
+	}
+}
+
+// SliceIterator returns an iterator over the given keys and their encoded
+// values, in order. Values are decoded using the codec. It is used by in-memory
+// DBs, which copy their key/value pairs when the iterator is created. The keys
+// and values must have the same length.
+func SliceIterator(codec Codec, keys []string, values [][]byte) Iterator {
+	return &sliceIterator{
+		index:  -1,
+		codec:  codec,
+		keys:   keys,
+		values: values,
+	}
+}
+
+type sliceIterator struct {
+	index int
+	codec Codec
+
+	keys   []string
+	values [][]byte
+}
+
+// Next implements the `Iterator` interface.
+func (iter *sliceIterator) Next() bool {
+	iter.index++
+	return iter.index < len(iter.keys)
+}
+
+// Key implements the `Iterator` interface.
+func (iter *sliceIterator) Key() (string, error) {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return "", ErrIndexOutOfRange
+	}
+	return iter.keys[iter.index], nil
+}
+
+// Value implements the `Iterator` interface.
+func (iter *sliceIterator) Value(value interface{}) error {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return ErrIndexOutOfRange
+	}
+	return iter.codec.Decode(iter.values[iter.index], value)
+}
+
+// Err implements the `Iterator` interface. It always returns nil.
+func (iter *sliceIterator) Err() error {
+	return nil
+}
+
+// Close implements the `Iterator` interface.
+func (iter *sliceIterator) Close() {}
+
+// A BatchIterator reads key/value pairs in batches, instead of one at a time.
+type BatchIterator interface {
+
+	// NextBatch reads the next batch of key/value pairs and returns their keys.
+	// The values must be a pointer to a slice, which is replaced by the decoded
+	// values of the batch. Every batch has the batch size, except for the last
+	// one, which can be smaller. When there are no more key/value pairs, false
+	// is returned.
+	NextBatch(values interface{}) ([]string, bool, error)
+
+	// Close must be called after finishing the iteration to release
+	// associated resources.
+	Close()
+}
+
+// NewBatchIterator returns a BatchIterator that reads batches of the given
+// size from the iterator.
+func NewBatchIterator(iter Iterator, size int) BatchIterator {
+	if size <= 0 {
+		panic(fmt.Sprintf("batch size must be positive, got %v", size))
+	}
+	return &batchIterator{
+		iter: iter,
+		size: size,
+	}
+}
+
+type batchIterator struct {
+	iter Iterator
+	size int
+}
+
+// NextBatch implements the `BatchIterator` interface.
+func (iter *batchIterator) NextBatch(values interface{}) ([]string, bool, error) {
+	dest := reflect.ValueOf(values)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() || dest.Elem().Kind() != reflect.Slice {
+		return nil, false, fmt.Errorf("expected non-nil pointer to slice, got %T", values)
+	}
+	slice := dest.Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, iter.size))
+
+	keys := make([]string, 0, iter.size)
+	for len(keys) < iter.size && iter.iter.Next() {
+		key, err := iter.iter.Key()
+		if err != nil {
+			return nil, false, err
+		}
+		value := reflect.New(slice.Type().Elem())
+		if err := iter.iter.Value(value.Interface()); err != nil {
+			return nil, false, err
+		}
+		keys = append(keys, key)
+		slice.Set(reflect.Append(slice, value.Elem()))
+	}
+	if err := iter.iter.Err(); err != nil {
+		return nil, false, err
+	}
+	return keys, len(keys) > 0, nil
+}
+
+// Close implements the `BatchIterator` interface.
+func (iter *batchIterator) Close() {
+	iter.iter.Close()
+}
+
+// NewKeyIterator returns an iterator over the keys in the DB that begin with
+// the given prefix. If the DB implements KeyIterable, then the values are never
+// read. Otherwise, the Iterator of the DB is used, and values are only read if
+// the DB reads them when iterating.
+func NewKeyIterator(database DB, prefix string) KeyIterator {
+	if keyIterable, ok := database.(KeyIterable); ok {
+		return keyIterable.KeyIterator(prefix)
+	}
+	return database.Iterator(prefix)
+}
@@ -0,0 +1,383 @@
+package db_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errIteration = errors.New("iteration failure")
+
+// failingIterator is an `Iterator` that fails after yielding the key/value
+// pairs of the inner iterator.
+type failingIterator struct {
+	Iterator
+	err error
+}
+
+func (iter *failingIterator) Next() bool {
+	if iter.Iterator.Next() {
+		return true
+	}
+	iter.err = errIteration
+	return false
+}
+
+func (iter *failingIterator) Err() error {
+	return iter.err
+}
+
+// countingCodec is a `Codec` that counts the number of values it decodes.
+type countingCodec struct {
+	Codec
+	decodes int
+}
+
+func (codec *countingCodec) Decode(data []byte, value interface{}) error {
+	codec.decodes++
+	return codec.Codec.Decode(data, value)
+}
+
+var _ = Describe("iterator adapters", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newTable := func() Table {
+			table := NewTable(memdb.New(codec), "table")
+			for i := 0; i < 10; i++ {
+				Expect(table.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+			}
+			return table
+		}
+
+		Context("when filtering an iterator", func() {
+			It("should only yield the key/value pairs that are kept", func() {
+				iter := FilterIterator(newTable().Iterator(), func(key string, decode func(interface{}) error) bool {
+					var value int64
+					Expect(decode(&value)).NotTo(HaveOccurred())
+					return value%2 == 0
+				})
+				defer iter.Close()
+
+				values := map[string]int64{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					values[key] = value
+				}
+				Expect(values).Should(Equal(map[string]int64{"0": 0, "2": 2, "4": 4, "6": 6, "8": 8}))
+			})
+		})
+
+		Context("when mapping an iterator", func() {
+			It("should transform the values", func() {
+				iter := MapIterator(newTable().Iterator(), func(key string, value interface{}) error {
+					*value.(*int64) *= 10
+					return nil
+				})
+				defer iter.Close()
+
+				count := 0
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(strconv.FormatInt(value/10, 10)).Should(Equal(key))
+					count++
+				}
+				Expect(count).Should(Equal(10))
+			})
+
+			It("should return the error from the transform", func() {
+				errTransform := errors.New("transform failure")
+				iter := MapIterator(newTable().Iterator(), func(key string, value interface{}) error {
+					if key == "5" {
+						return errTransform
+					}
+					return nil
+				})
+				defer iter.Close()
+
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value int64
+					if key == "5" {
+						Expect(iter.Value(&value)).Should(Equal(errTransform))
+					} else {
+						Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					}
+				}
+			})
+		})
+
+		Context("when concatenating iterators", func() {
+			It("should yield the key/value pairs of every iterator", func() {
+				iter := ConcatIterator(newTable().Iterator(), NewTable(memdb.New(codec), "empty").Iterator(), newTable().Iterator())
+				defer iter.Close()
+
+				_, err := iter.Key()
+				Expect(err).Should(Equal(ErrIndexOutOfRange))
+
+				counts := map[string]int{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(strconv.FormatInt(value, 10)).Should(Equal(key))
+					counts[key]++
+				}
+				Expect(counts).Should(HaveLen(10))
+				for _, count := range counts {
+					Expect(count).Should(Equal(2))
+				}
+
+				_, err = iter.Key()
+				Expect(err).Should(Equal(ErrIndexOutOfRange))
+			})
+		})
+
+		Context("when iterating over slices", func() {
+			It("should yield the key/value pairs in order", func() {
+				keys := []string{"b", "a", "c"}
+				values := make([][]byte, len(keys))
+				for i := range keys {
+					data, err := codec.Encode(int64(i))
+					Expect(err).NotTo(HaveOccurred())
+					values[i] = data
+				}
+				iter := SliceIterator(codec, keys, values)
+				defer iter.Close()
+
+				_, err := iter.Key()
+				Expect(err).Should(Equal(ErrIndexOutOfRange))
+				for i := range keys {
+					Expect(iter.Next()).Should(BeTrue())
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal(keys[i]))
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(int64(i)))
+				}
+				Expect(iter.Next()).Should(BeFalse())
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				var value int64
+				Expect(iter.Value(&value)).Should(Equal(ErrIndexOutOfRange))
+			})
+		})
+
+		Context("when iterating in batches", func() {
+			It("should yield every key/value pair once", func() {
+				iter := NewBatchIterator(newTable().Iterator(), 3)
+				defer iter.Close()
+
+				sizes := []int{}
+				seen := map[string]int64{}
+				for {
+					var values []int64
+					keys, ok, err := iter.NextBatch(&values)
+					Expect(err).NotTo(HaveOccurred())
+					if !ok {
+						break
+					}
+					Expect(values).Should(HaveLen(len(keys)))
+					for i, key := range keys {
+						Expect(seen).ShouldNot(HaveKey(key))
+						seen[key] = values[i]
+					}
+					sizes = append(sizes, len(keys))
+				}
+				Expect(sizes).Should(Equal([]int{3, 3, 3, 1}))
+				Expect(seen).Should(HaveLen(10))
+				for key, value := range seen {
+					Expect(strconv.FormatInt(value, 10)).Should(Equal(key))
+				}
+			})
+
+			It("should return an error if the values are not a pointer to a slice", func() {
+				iter := NewBatchIterator(newTable().Iterator(), 3)
+				defer iter.Close()
+
+				var value int64
+				_, _, err := iter.NextBatch(&value)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when reporting progress", func() {
+			It("should report every 1% of the total", func() {
+				table := NewTable(memdb.New(codec), "table")
+				for i := 0; i < 1000; i++ {
+					Expect(table.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				reports := []int{}
+				iter := ProgressIterator(table.Iterator(), 1000, func(done int) {
+					reports = append(reports, done)
+				})
+				defer iter.Close()
+				for iter.Next() {
+				}
+				Expect(iter.Next()).Should(BeFalse())
+
+				Expect(reports).Should(HaveLen(100))
+				for i, done := range reports {
+					Expect(done).Should(Equal(10 * (i + 1)))
+				}
+			})
+
+			It("should report every key/value pair if the total is small", func() {
+				reports := []int{}
+				iter := ProgressIterator(newTable().Iterator(), 5, func(done int) {
+					reports = append(reports, done)
+				})
+				defer iter.Close()
+				for iter.Next() {
+				}
+				Expect(iter.Next()).Should(BeFalse())
+
+				Expect(reports).Should(Equal([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+			})
+
+			It("should report the final count if it is not a multiple of the interval", func() {
+				reports := []int{}
+				iter := ProgressIterator(newTable().Iterator(), 300, func(done int) {
+					reports = append(reports, done)
+				})
+				defer iter.Close()
+				for iter.Next() {
+				}
+
+				Expect(reports).Should(Equal([]int{3, 6, 9, 10}))
+			})
+		})
+
+		Context("when composing adapters", func() {
+			It("should filter and then transform the values", func() {
+				iter := MapIterator(FilterIterator(newTable().Iterator(), func(key string, decode func(interface{}) error) bool {
+					return key == "3"
+				}), func(key string, value interface{}) error {
+					*value.(*int64)++
+					return nil
+				})
+				defer iter.Close()
+
+				Expect(iter.Next()).Should(BeTrue())
+				var value int64
+				Expect(iter.Value(&value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(4)))
+				Expect(iter.Next()).Should(BeFalse())
+			})
+		})
+
+		Context("when an iterator fails part way through", func() {
+			It("should surface the error from the adapters", func() {
+				iter := FilterIterator(&failingIterator{Iterator: newTable().Iterator()}, func(string, func(interface{}) error) bool {
+					return true
+				})
+				n := 0
+				for iter.Next() {
+					n++
+				}
+				Expect(n).Should(Equal(10))
+				Expect(iter.Err()).Should(Equal(errIteration))
+			})
+
+			It("should stop concatenating", func() {
+				iter := ConcatIterator(&failingIterator{Iterator: newTable().Iterator()}, newTable().Iterator())
+				defer iter.Close()
+
+				n := 0
+				for iter.Next() {
+					n++
+				}
+				Expect(n).Should(Equal(10))
+				Expect(iter.Err()).Should(Equal(errIteration))
+			})
+
+			It("should return the error from the batch", func() {
+				iter := NewBatchIterator(&failingIterator{Iterator: newTable().Iterator()}, 20)
+				defer iter.Close()
+
+				var values []int64
+				_, ok, err := iter.NextBatch(&values)
+				Expect(err).Should(Equal(errIteration))
+				Expect(ok).Should(BeFalse())
+			})
+
+			It("should return the error from the helpers", func() {
+				newValue := func() interface{} { return new(int64) }
+
+				_, _, _, err := Diff(&failingIterator{Iterator: newTable().Iterator()}, newTable().Iterator(), newValue)
+				Expect(err).Should(Equal(errIteration))
+				err = Export(new(bytes.Buffer), &failingIterator{Iterator: newTable().Iterator()}, codec, newValue)
+				Expect(err).Should(Equal(errIteration))
+			})
+		})
+
+		Context("when an iterator finishes", func() {
+			It("should not return an error", func() {
+				iter := ConcatIterator(newTable().Iterator(), newTable().Iterator())
+				defer iter.Close()
+
+				for iter.Next() {
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when iterating over keys", func() {
+			keys := func(iter KeyIterator) []string {
+				defer iter.Close()
+
+				keys := []string{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys = append(keys, key)
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				return keys
+			}
+
+			It("should yield every key without decoding values", func() {
+				counting := &countingCodec{Codec: codec}
+				database := rrdb.New(counting, 100)
+				expected := []string{}
+				for i := 0; i < 10; i++ {
+					Expect(database.Insert(fmt.Sprintf("key%v", i), int64(i))).Should(Succeed())
+					Expect(database.Insert(fmt.Sprintf("other%v", i), int64(i))).Should(Succeed())
+					expected = append(expected, strconv.Itoa(i))
+				}
+
+				iter := NewKeyIterator(database, "key")
+				_, err := iter.Key()
+				Expect(err).Should(Equal(ErrIndexOutOfRange))
+				Expect(keys(iter)).Should(ConsistOf(expected))
+				Expect(counting.decodes).Should(Equal(0))
+			})
+
+			It("should fall back to the iterator of DBs that cannot iterate over keys", func() {
+				database := memdb.New(codec)
+				for i := 0; i < 10; i++ {
+					Expect(database.Insert(fmt.Sprintf("key%v", i), int64(i))).Should(Succeed())
+				}
+				Expect(keys(NewKeyIterator(database, "key"))).Should(HaveLen(10))
+			})
+		})
+	}
+})
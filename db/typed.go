@@ -0,0 +1,54 @@
+package db
+
+// A TypedTable is a Table where all values have the same type, so that the
+// type of values is checked at compile time instead of when they are decoded.
+type TypedTable[V any] interface {
+
+	// Insert writes the key-value into the TypedTable.
+	Insert(key string, value V) error
+
+	// Get the value associated with the given key. If the key cannot be found,
+	// then the zero value and ErrKeyNotFound are returned.
+	Get(key string) (V, error)
+
+	// Delete the value with the given key from the TypedTable.
+	Delete(key string) error
+
+	// Size returns the number of key/value pairs in the TypedTable.
+	Size() (int, error)
+}
+
+type typedTable[V any] struct {
+	table Table
+}
+
+// NewTypedTable returns a TypedTable that stores values in the given Table.
+// Values are encoded and decoded using the Codec of the underlying DB, which
+// must be able to encode values of type V. If the Table is safe for concurrent
+// use, then the TypedTable is safe for concurrent use.
+func NewTypedTable[V any](table Table) TypedTable[V] {
+	return &typedTable[V]{
+		table: table,
+	}
+}
+
+func (t *typedTable[V]) Insert(key string, value V) error {
+	return t.table.Insert(key, value)
+}
+
+func (t *typedTable[V]) Get(key string) (V, error) {
+	var value V
+	if err := t.table.Get(key, &value); err != nil {
+		var zero V
+		return zero, err
+	}
+	return value, nil
+}
+
+func (t *typedTable[V]) Delete(key string) error {
+	return t.table.Delete(key)
+}
+
+func (t *typedTable[V]) Size() (int, error) {
+	return t.table.Size()
+}
@@ -0,0 +1,43 @@
+package db_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("typed table", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when inserting and getting values", func() {
+			It("should round-trip values of the table type", func() {
+				table := NewTypedTable[testutil.TestStruct](NewTable(memdb.New(codec), "table"))
+
+				value := testutil.RandomTestStruct()
+				Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+
+				stored, err := table.Get("key")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+			})
+
+			It("should return the zero value if the key cannot be found", func() {
+				table := NewTypedTable[testutil.TestStruct](NewTable(memdb.New(codec), "table"))
+				Expect(table.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				Expect(table.Delete("key")).NotTo(HaveOccurred())
+
+				stored, err := table.Get("key")
+				Expect(err).Should(Equal(ErrKeyNotFound))
+				Expect(stored).Should(Equal(testutil.TestStruct{}))
+			})
+		})
+	}
+})
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// A Getter reads the value associated with a key. Both `DB` and `Table` are
+// Getters.
+type Getter interface {
+
+	// Get the value associated with the given key and write it to the value
+	// interface. The value interface must be a pointer. If the key cannot be
+	// found, then ErrKeyNotFound is returned.
+	Get(key string, value interface{}) error
+}
+
+// An Inserter writes a value associated with a key. Both `DB` and `Table` are
+// Inserters.
+type Inserter interface {
+
+	// Insert writes the key-value.
+	Insert(key string, value interface{}) error
+}
+
+// A Deleter deletes the value associated with a key. Both `DB` and `Table` are
+// Deleters.
+type Deleter interface {
+
+	// Delete the value with the given key.
+	Delete(key string) error
+}
+
+// A ReadWriter can get, insert, and delete values. Both `DB` and `Table` are
+// ReadWriters.
+type ReadWriter interface {
+	Getter
+	Inserter
+	Deleter
+}
+
+// GetOrDefault gets the value associated with the given key and writes it to
+// the value interface. If the key cannot be found, then the default is written
+// to the value interface instead and no error is returned. The value interface
+// must be a pointer, and the default must be assignable to the value it points
+// to (or be a pointer to such a value).
+func GetOrDefault(getter Getter, key string, value, def interface{}) error {
+	err := getter.Get(key, value)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	dest := reflect.ValueOf(value)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("expected non-nil pointer, got %T", value)
+	}
+	dest = dest.Elem()
+	if def == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	src := reflect.ValueOf(def)
+	if !src.Type().AssignableTo(dest.Type()) && src.Kind() == reflect.Ptr && !src.IsNil() {
+		src = src.Elem()
+	}
+	if !src.Type().AssignableTo(dest.Type()) {
+		return fmt.Errorf("cannot assign default of type %T to value of type %v", def, dest.Type())
+	}
+	dest.Set(src)
+	return nil
+}
+
+// GetByPrefix reads all of the key/value pairs where the key begins with the
+// given prefix, and returns the values by their key. Values are decoded into
+// the value returned by `newValue`. All of the key/value pairs are held in
+// memory at once, so an Iterator should be used instead for prefixes that
+// match a large number of keys.
+func GetByPrefix(database DB, prefix string, newValue func() interface{}) (map[string]interface{}, error) {
+	iter := database.Iterator(prefix)
+	defer iter.Close()
+
+	values := map[string]interface{}{}
+	for iter.Next() {
+		key, value, err := read(iter, newValue)
+		if err != nil {
+			return nil, err
+		}
+		values[prefix+key] = value
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// HasBatch returns whether or not each of the keys exists in the DB, in the
+// same order as the keys. If the DB implements BatchChecker, then it is used.
+// Otherwise, the keys are checked one at a time, without decoding the values.
+// A DB that implements StreamStore gets the encoded value of each key, and a
+// DB that is Ordered only reads the first key that begins with each key.
+// Otherwise, every key that begins with each key is iterated over, so the cost
+// grows with the number of keys that share it as a prefix.
+func HasBatch(database DB, keys []string) ([]bool, error) {
+	if checker, ok := database.(BatchChecker); ok {
+		return checker.HasBatch(keys)
+	}
+
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		if key == "" {
+			return nil, ErrEmptyKey
+		}
+		ok, err := has(database, key)
+		if err != nil {
+			return nil, err
+		}
+		found[i] = ok
+	}
+	return found, nil
+}
+
+// has returns whether or not the key exists in the DB.
+func has(database DB, key string) (bool, error) {
+	if streamStore, ok := database.(StreamStore); ok {
+		r, err := streamStore.GetStream(key)
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, r.Close()
+	}
+
+	iter := NewKeyIterator(database, key)
+	defer iter.Close()
+
+	// The key itself is the smallest key that begins with it, so an ordered
+	// DB only needs to read the first key.
+	_, ordered := database.(Ordered)
+	for iter.Next() {
+		suffix, err := iter.Key()
+		if err != nil {
+			return false, err
+		}
+		if suffix == "" {
+			return true, nil
+		}
+		if ordered {
+			return false, nil
+		}
+	}
+	return false, iter.Err()
+}
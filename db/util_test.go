@@ -0,0 +1,147 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/leveldb"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errGet = errors.New("get failure")
+
+// failingGetter is a `Getter` that always returns an error.
+type failingGetter struct{}
+
+func (failingGetter) Get(key string, value interface{}) error {
+	return errGet
+}
+
+// plainDB is a `DB` that hides the optional interfaces of the DB it embeds.
+type plainDB struct {
+	DB
+}
+
+// streamDB is a `DB` that only exposes the `StreamStore` interface of the DB it
+// embeds.
+type streamDB struct {
+	DB
+	StreamStore
+}
+
+var _ = Describe("utilities", func() {
+	Context("when getting a value with a default", func() {
+		It("should return the stored value if the key is present", func() {
+			table := NewTable(memdb.New(codec.JSONCodec), "table")
+			value := testutil.RandomTestStruct()
+			Expect(table.Insert("key", value)).NotTo(HaveOccurred())
+
+			stored := testutil.TestStruct{D: []byte{}}
+			Expect(GetOrDefault(table, "key", &stored, testutil.TestStruct{A: "default"})).NotTo(HaveOccurred())
+			Expect(stored).Should(Equal(value))
+		})
+
+		It("should return the default if the key is absent", func() {
+			table := NewTable(memdb.New(codec.JSONCodec), "table")
+
+			var str string
+			Expect(GetOrDefault(table, "key", &str, "default")).NotTo(HaveOccurred())
+			Expect(str).Should(Equal("default"))
+
+			stored := testutil.TestStruct{}
+			def := testutil.RandomTestStruct()
+			Expect(GetOrDefault(table, "key", &stored, &def)).NotTo(HaveOccurred())
+			Expect(stored).Should(Equal(def))
+
+			Expect(GetOrDefault(table, "key", &str, nil)).NotTo(HaveOccurred())
+			Expect(str).Should(Equal(""))
+		})
+
+		It("should return an error if the default cannot be assigned to the value", func() {
+			table := NewTable(memdb.New(codec.JSONCodec), "table")
+
+			var str string
+			Expect(GetOrDefault(table, "key", &str, 1)).To(HaveOccurred())
+			Expect(GetOrDefault(table, "key", str, "default")).To(HaveOccurred())
+		})
+
+		It("should return an error if the getter fails", func() {
+			str := "unchanged"
+			err := GetOrDefault(failingGetter{}, "key", &str, "default")
+			Expect(err).Should(Equal(errGet))
+			Expect(str).Should(Equal("unchanged"))
+		})
+	})
+
+	Context("when getting values by prefix", func() {
+		It("should only return the values of the requested prefix", func() {
+			database := memdb.New(codec.JSONCodec)
+			for _, group := range []string{"a_", "b_", "ab_"} {
+				for i := 0; i < 3; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v%v", group, i), group)).NotTo(HaveOccurred())
+				}
+			}
+
+			values, err := GetByPrefix(database, "a_", func() interface{} { return new(string) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).Should(HaveLen(3))
+			for i := 0; i < 3; i++ {
+				value, ok := values[fmt.Sprintf("a_%v", i)]
+				Expect(ok).Should(BeTrue())
+				Expect(*value.(*string)).Should(Equal("a_"))
+			}
+
+			values, err = GetByPrefix(database, "c_", func() interface{} { return new(string) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).Should(BeEmpty())
+		})
+	})
+
+	Context("when checking whether keys exist in a batch", func() {
+		dbs := map[string]func() DB{
+			"batch checker":     func() DB { return memdb.New(codec.JSONCodec) },
+			"not batch checker": func() DB { return plainDB{memdb.New(codec.JSONCodec)} },
+			"stream store": func() DB {
+				database := rrdb.New(codec.JSONCodec, 100)
+				return streamDB{DB: database, StreamStore: database.(StreamStore)}
+			},
+			"ordered": func() DB {
+				Expect(os.RemoveAll(".leveldb")).NotTo(HaveOccurred())
+				return leveldb.New(".leveldb", codec.JSONCodec)
+			},
+		}
+		for _, name := range []string{"batch checker", "not batch checker", "stream store", "ordered"} {
+			newDB := dbs[name]
+
+			It(fmt.Sprintf("should return whether each key exists in the order of the keys (%v)", name), func() {
+				defer os.RemoveAll(".leveldb")
+				database := newDB()
+				defer database.Close()
+				for _, key := range []string{"ab", "b", "c", "d"} {
+					Expect(database.Insert(key, key)).NotTo(HaveOccurred())
+				}
+				Expect(database.Delete("c")).NotTo(HaveOccurred())
+
+				// Keys that are only a prefix of another key do not exist.
+				found, err := HasBatch(database, []string{"d", "a", "ab", "c", "b", "e", "d"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found).Should(Equal([]bool{true, false, true, false, true, false, true}))
+
+				found, err = HasBatch(database, []string{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found).Should(BeEmpty())
+
+				_, err = HasBatch(database, []string{"a", ""})
+				Expect(err).Should(Equal(ErrEmptyKey))
+			})
+		}
+	})
+})
@@ -0,0 +1,205 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/renproject/kv/db"
+	"golang.org/x/crypto/sha3"
+)
+
+// Prefixes of the keys in the inner `db.DB`. Keys are stored with the hash of
+// their value, and each distinct value is stored once along with the number of
+// keys that reference it.
+const (
+	keyPrefix  = "key_"
+	blobPrefix = "blob_"
+	refsPrefix = "refs_"
+)
+
+type dedupDB struct {
+	mu    *sync.Mutex
+	inner db.DB
+	codec db.Codec
+}
+
+// Wrap returns a `db.DB` that stores each distinct value in the inner
+// `db.DB` only once. Values are encoded with the given codec and identified by
+// the sha3 hash of their encoding, and each key only stores the hash of its
+// value. Values are reference counted so that they are deleted once no key
+// references them. Equal values are only deduplicated if the codec always
+// encodes them to the same bytes, which is not the case for maps with the gob
+// and binary codecs.
+//
+// If the inner `db.DB` evicts key/value pairs, for example because it has a
+// limited capacity, then the reference counts can become incorrect and values
+// can be deleted while keys still reference them. Because values are
+// identified by their hash, this can only cause a key to be missing, and it is
+// never resolved to the wrong value. Keys whose value is missing are reported
+// as not found.
+func Wrap(inner db.DB, codec db.Codec) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	return &dedupDB{
+		mu:    new(sync.Mutex),
+		inner: inner,
+		codec: codec,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (dedupDB *dedupDB) Close() error {
+	return dedupDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (dedupDB *dedupDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := dedupDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	hashBytes := sha3.Sum256(data)
+	hash := hex.EncodeToString(hashBytes[:])
+
+	dedupDB.mu.Lock()
+	defer dedupDB.mu.Unlock()
+
+	oldHash, ok, err := dedupDB.hash(key)
+	if err != nil {
+		return err
+	}
+	if ok && oldHash == hash {
+		return nil
+	}
+
+	refs, err := dedupDB.refs(hash)
+	if err != nil {
+		return err
+	}
+	if refs == 0 {
+		if err := dedupDB.inner.Insert(blobPrefix+hash, data); err != nil {
+			return err
+		}
+	}
+	if err := dedupDB.inner.Insert(refsPrefix+hash, refs+1); err != nil {
+		return err
+	}
+	if err := dedupDB.inner.Insert(keyPrefix+key, []byte(hash)); err != nil {
+		return err
+	}
+	if ok {
+		return dedupDB.release(oldHash)
+	}
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (dedupDB *dedupDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	var hash []byte
+	if err := dedupDB.inner.Get(keyPrefix+key, &hash); err != nil {
+		return err
+	}
+	return dedupDB.decode(string(hash), value)
+}
+
+// Delete implements the `db.DB` interface.
+func (dedupDB *dedupDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	dedupDB.mu.Lock()
+	defer dedupDB.mu.Unlock()
+
+	hash, ok, err := dedupDB.hash(key)
+	if err != nil || !ok {
+		return err
+	}
+	if err := dedupDB.inner.Delete(keyPrefix + key); err != nil {
+		return err
+	}
+	return dedupDB.release(hash)
+}
+
+// Size implements the `db.DB` interface.
+func (dedupDB *dedupDB) Size(prefix string) (int, error) {
+	return dedupDB.inner.Size(keyPrefix + prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (dedupDB *dedupDB) Iterator(prefix string) db.Iterator {
+	return &iterator{
+		Iterator: dedupDB.inner.Iterator(keyPrefix + prefix),
+		dedupDB:  dedupDB,
+	}
+}
+
+// hash returns the hash of the value of the key, and whether or not the key
+// exists.
+func (dedupDB *dedupDB) hash(key string) (string, bool, error) {
+	var hash []byte
+	err := dedupDB.inner.Get(keyPrefix+key, &hash)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return "", false, nil
+	}
+	return string(hash), err == nil, err
+}
+
+// refs returns the number of keys that reference the value with the given
+// hash.
+func (dedupDB *dedupDB) refs(hash string) (uint64, error) {
+	var refs uint64
+	if err := dedupDB.inner.Get(refsPrefix+hash, &refs); err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+		return 0, err
+	}
+	return refs, nil
+}
+
+// release a reference to the value with the given hash, and delete the value
+// if it is no longer referenced. The caller must hold the lock.
+func (dedupDB *dedupDB) release(hash string) error {
+	refs, err := dedupDB.refs(hash)
+	if err != nil {
+		return err
+	}
+	if refs > 1 {
+		return dedupDB.inner.Insert(refsPrefix+hash, refs-1)
+	}
+	if err := dedupDB.inner.Delete(blobPrefix + hash); err != nil {
+		return err
+	}
+	return dedupDB.inner.Delete(refsPrefix + hash)
+}
+
+// decode the value with the given hash.
+func (dedupDB *dedupDB) decode(hash string, value interface{}) error {
+	var data []byte
+	if err := dedupDB.inner.Get(blobPrefix+hash, &data); err != nil {
+		return err
+	}
+	return dedupDB.codec.Decode(data, value)
+}
+
+// iterator is a `db.Iterator` that resolves the hashes of the inner iterator
+// to their values.
+type iterator struct {
+	db.Iterator
+	dedupDB *dedupDB
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *iterator) Value(value interface{}) error {
+	var hash []byte
+	if err := iter.Iterator.Value(&hash); err != nil {
+		return err
+	}
+	return iter.dedupDB.decode(string(hash), value)
+}
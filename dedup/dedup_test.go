@@ -0,0 +1,149 @@
+package dedup_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/dedup"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("deduplicating db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when inserting duplicate values", func() {
+			It("should only store one copy of each value", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, codec)
+
+				value := []byte("value")
+				for i := 0; i < 100; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), value)).NotTo(HaveOccurred())
+				}
+
+				// There is an entry for each key, and a single value with its
+				// reference count.
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(102))
+
+				size, err = database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(100))
+				for i := 0; i < 100; i++ {
+					stored := []byte{}
+					Expect(database.Get(fmt.Sprintf("%v", i), &stored)).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(value))
+				}
+			})
+		})
+
+		Context("when deleting keys", func() {
+			It("should keep values that are still referenced", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, codec)
+
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("a", value)).NotTo(HaveOccurred())
+				Expect(database.Insert("b", value)).NotTo(HaveOccurred())
+				Expect(database.Delete("a")).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("a", &stored)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Get("b", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				Expect(database.Delete("b")).NotTo(HaveOccurred())
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(BeZero())
+			})
+
+			It("should release the old value when overwriting a key", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, codec)
+
+				Expect(database.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(3))
+
+				Expect(database.Delete("key")).NotTo(HaveOccurred())
+				size, err = inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(BeZero())
+			})
+		})
+
+		Context("when iterating", func() {
+			It("should resolve the values", func() {
+				database := Wrap(memdb.New(codec), codec)
+
+				values := map[string]testutil.TestStruct{}
+				for i := 0; i < 10; i++ {
+					values[fmt.Sprintf("%v", i)] = testutil.RandomTestStruct()
+					values[fmt.Sprintf("%v", i+10)] = values[fmt.Sprintf("%v", i)]
+				}
+				for key, value := range values {
+					Expect(database.Insert(key, value)).NotTo(HaveOccurred())
+				}
+
+				iter := database.Iterator("")
+				defer iter.Close()
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(iter.Value(&stored)).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(values[key]))
+					delete(values, key)
+				}
+				Expect(values).Should(BeEmpty())
+			})
+		})
+
+		Context("when the inner db evicts entries", func() {
+			It("should never resolve a key to the wrong value", func() {
+				database := Wrap(rrdb.New(codec, 20), codec)
+
+				values := make([]testutil.TestStruct, 5)
+				for i := range values {
+					values[i] = testutil.RandomTestStruct()
+				}
+				for i := 0; i < 100; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), values[i%len(values)])).NotTo(HaveOccurred())
+				}
+				for i := 0; i < 100; i += 2 {
+					Expect(database.Delete(fmt.Sprintf("%v", i))).NotTo(HaveOccurred())
+				}
+
+				for i := 0; i < 100; i++ {
+					stored := testutil.TestStruct{D: []byte{}}
+					err := database.Get(fmt.Sprintf("%v", i), &stored)
+					if err == db.ErrKeyNotFound {
+						continue
+					}
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(values[i%len(values)]))
+				}
+			})
+		})
+	}
+
+	Context("when wrapping with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() { Wrap(memdb.New(codec.JSONCodec), nil) }).Should(Panic())
+		})
+	})
+})
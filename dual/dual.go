@@ -0,0 +1,121 @@
+package dual
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// A DB is a `db.DB` that writes to both a primary and a secondary `db.DB`, but
+// only reads from the primary. It is useful when migrating from one `db.DB` to
+// another without downtime.
+type DB interface {
+	db.DB
+
+	// SecondaryErrors returns the errors returned by the secondary `db.DB`
+	// since the last call to SecondaryErrors. Errors are only collected when
+	// the DB is not strict.
+	SecondaryErrors() []error
+}
+
+type dual struct {
+	primary   db.DB
+	secondary db.DB
+	strict    bool
+
+	errsMu *sync.Mutex
+	errs   []error
+}
+
+// New returns a DB that writes to both the primary and the secondary, and
+// reads from the primary. Errors returned by the secondary are collected, but
+// do not fail the operation.
+func New(primary, secondary db.DB) DB {
+	return &dual{
+		primary:   primary,
+		secondary: secondary,
+		strict:    false,
+		errsMu:    new(sync.Mutex),
+	}
+}
+
+// NewStrict returns a DB that writes to both the primary and the secondary, and
+// reads from the primary. Errors returned by the secondary fail the operation.
+func NewStrict(primary, secondary db.DB) DB {
+	return &dual{
+		primary:   primary,
+		secondary: secondary,
+		strict:    true,
+		errsMu:    new(sync.Mutex),
+	}
+}
+
+// Close implements the `db.DB` interface. Both the primary and the secondary
+// are closed.
+func (dual *dual) Close() error {
+	primaryErr := dual.primary.Close()
+	secondaryErr := dual.secondary.Close()
+	if primaryErr != nil {
+		return primaryErr
+	}
+	return secondaryErr
+}
+
+// Insert implements the `db.DB` interface.
+func (dual *dual) Insert(key string, value interface{}) error {
+	if err := dual.primary.Insert(key, value); err != nil {
+		return err
+	}
+	return dual.handleSecondaryErr(dual.secondary.Insert(key, value))
+}
+
+// Get implements the `db.DB` interface. It only reads from the primary.
+func (dual *dual) Get(key string, value interface{}) error {
+	return dual.primary.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (dual *dual) Delete(key string) error {
+	if err := dual.primary.Delete(key); err != nil {
+		return err
+	}
+	return dual.handleSecondaryErr(dual.secondary.Delete(key))
+}
+
+// Size implements the `db.DB` interface. It only reads from the primary.
+func (dual *dual) Size(prefix string) (int, error) {
+	return dual.primary.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface. It only reads from the primary.
+func (dual *dual) Iterator(prefix string) db.Iterator {
+	return dual.primary.Iterator(prefix)
+}
+
+// SecondaryErrors implements the `DB` interface.
+func (dual *dual) SecondaryErrors() []error {
+	dual.errsMu.Lock()
+	defer dual.errsMu.Unlock()
+
+	errs := dual.errs
+	dual.errs = nil
+	return errs
+}
+
+// handleSecondaryErr returns the error if the DB is strict, otherwise it
+// collects the error and returns nil.
+func (dual *dual) handleSecondaryErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if dual.strict {
+		return fmt.Errorf("error writing to secondary: %w", err)
+	}
+
+	dual.errsMu.Lock()
+	defer dual.errsMu.Unlock()
+
+	dual.errs = append(dual.errs, err)
+	return nil
+}
@@ -0,0 +1,13 @@
+package dual_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDual(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dual Suite")
+}
@@ -0,0 +1,118 @@
+package dual_test
+
+import (
+	"errors"
+	"reflect"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/dual"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errSecondary = errors.New("secondary failure")
+
+// failingDB is a `db.DB` where all writes fail.
+type failingDB struct {
+	db.DB
+}
+
+func (failingDB) Insert(key string, value interface{}) error {
+	return errSecondary
+}
+
+func (failingDB) Delete(key string) error {
+	return errSecondary
+}
+
+var _ = Describe("dual write db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when writing to a dual db", func() {
+			It("should write to both the primary and the secondary", func() {
+				primary := memdb.New(codec)
+				secondary := memdb.New(codec)
+				dual := New(primary, secondary)
+				defer dual.Close()
+
+				test := func(key string, value testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+
+					Expect(dual.Insert(key, value)).NotTo(HaveOccurred())
+					for _, database := range []db.DB{dual, primary, secondary} {
+						val := testutil.TestStruct{D: []byte{}}
+						Expect(database.Get(key, &val)).NotTo(HaveOccurred())
+						Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+					}
+
+					Expect(dual.Delete(key)).NotTo(HaveOccurred())
+					for _, database := range []db.DB{dual, primary, secondary} {
+						val := testutil.TestStruct{D: []byte{}}
+						Expect(database.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					}
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when reading from a dual db", func() {
+			It("should only read from the primary", func() {
+				primary := memdb.New(codec)
+				secondary := memdb.New(codec)
+				dual := New(primary, secondary)
+				defer dual.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(secondary.Insert("key", value)).NotTo(HaveOccurred())
+
+				val := testutil.TestStruct{D: []byte{}}
+				Expect(dual.Get("key", &val)).Should(Equal(db.ErrKeyNotFound))
+
+				size, err := dual.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+
+				iter := dual.Iterator("")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeFalse())
+			})
+		})
+	}
+
+	Context("when the secondary fails", func() {
+		It("should collect the errors if the db is not strict", func() {
+			primary := memdb.New(testutil.Codecs[0])
+			dual := New(primary, failingDB{})
+
+			Expect(dual.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(dual.Delete("key")).NotTo(HaveOccurred())
+			Expect(dual.SecondaryErrors()).Should(Equal([]error{errSecondary, errSecondary}))
+			Expect(dual.SecondaryErrors()).Should(BeEmpty())
+		})
+
+		It("should return the errors if the db is strict", func() {
+			primary := memdb.New(testutil.Codecs[0])
+			dual := NewStrict(primary, failingDB{})
+
+			// The primary should still be written to.
+			var value string
+			err := dual.Insert("key", "value")
+			Expect(errors.Is(err, errSecondary)).Should(BeTrue())
+			Expect(primary.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+
+			Expect(dual.Delete("key")).To(HaveOccurred())
+			Expect(primary.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(dual.SecondaryErrors()).Should(BeEmpty())
+		})
+	})
+})
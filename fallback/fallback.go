@@ -0,0 +1,231 @@
+package fallback
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// A DB is a `db.DB` that falls back to a secondary `db.DB` when its primary
+// `db.DB` fails.
+type DB interface {
+	db.DB
+
+	// Replay applies the writes that were made to the secondary `db.DB`, while
+	// the primary `db.DB` was failing, to the primary `db.DB`. Writes that are
+	// replayed are removed from the secondary `db.DB`. Replay is also done
+	// automatically after the primary `db.DB` succeeds, so it only needs to be
+	// called to recover without waiting for the next operation.
+	Replay() error
+
+	// Pending returns the number of keys with writes that have not been
+	// replayed yet.
+	Pending() int
+}
+
+// entry is a write that has not been replayed to the primary `db.DB` yet.
+type entry struct {
+	value   interface{}
+	deleted bool
+}
+
+type fallbackDB struct {
+	primary   db.DB
+	secondary db.DB
+
+	// mu protects the writes that have not been replayed yet. Only the latest
+	// write of each key is kept. It is held while writing, so that a write to
+	// the primary `db.DB` cannot be overwritten by replaying an older write,
+	// and while reading a pending write, so that it is not replayed and
+	// removed from the secondary `db.DB` in the meantime.
+	mu      *sync.Mutex
+	pending map[string]entry
+}
+
+// New returns a `db.DB` that sends operations to the primary `db.DB`, and
+// retries them against the secondary `db.DB` if they fail. ErrKeyNotFound and
+// ErrEmptyKey are not failures, and are returned without retrying. Writes that
+// fall back are remembered, so that gets of their keys are served by the
+// secondary `db.DB` until they are replayed to the primary `db.DB`. The values
+// of these writes are held until they are replayed, so they must not be
+// modified after being inserted. Size falls back in the same way, but Iterator
+// only iterates over the primary `db.DB`.
+func New(primary, secondary db.DB) DB {
+	return &fallbackDB{
+		primary:   primary,
+		secondary: secondary,
+
+		mu:      new(sync.Mutex),
+		pending: map[string]entry{},
+	}
+}
+
+// Close implements the `db.DB` interface. It closes both `db.DB`s, and any
+// writes that have not been replayed yet are lost.
+func (fallbackDB *fallbackDB) Close() error {
+	primaryErr := fallbackDB.primary.Close()
+	secondaryErr := fallbackDB.secondary.Close()
+	if primaryErr != nil {
+		return primaryErr
+	}
+	return secondaryErr
+}
+
+// Insert implements the `db.DB` interface.
+func (fallbackDB *fallbackDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	fallbackDB.mu.Lock()
+	defer fallbackDB.mu.Unlock()
+
+	err := fallbackDB.primary.Insert(key, value)
+	if !failed(err) {
+		fallbackDB.recovered(key)
+		return err
+	}
+	if err := fallbackDB.secondary.Insert(key, value); err != nil {
+		return fmt.Errorf("error inserting into secondary: %w", err)
+	}
+	fallbackDB.pending[key] = entry{value: value}
+	return nil
+}
+
+// Get implements the `db.DB` interface. Keys with writes that have not been
+// replayed yet are read from the secondary `db.DB`.
+func (fallbackDB *fallbackDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	pending, err := func() (bool, error) {
+		fallbackDB.mu.Lock()
+		defer fallbackDB.mu.Unlock()
+
+		pending, ok := fallbackDB.pending[key]
+		if !ok {
+			return false, nil
+		}
+		if pending.deleted {
+			return true, db.ErrKeyNotFound
+		}
+		return true, fallbackDB.secondary.Get(key, value)
+	}()
+	if pending {
+		return err
+	}
+
+	err = fallbackDB.primary.Get(key, value)
+	if !failed(err) {
+		return err
+	}
+	return fallbackDB.secondary.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (fallbackDB *fallbackDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	fallbackDB.mu.Lock()
+	defer fallbackDB.mu.Unlock()
+
+	err := fallbackDB.primary.Delete(key)
+	if !failed(err) {
+		fallbackDB.recovered(key)
+		return err
+	}
+	if err := fallbackDB.secondary.Delete(key); err != nil {
+		return fmt.Errorf("error deleting from secondary: %w", err)
+	}
+	fallbackDB.pending[key] = entry{deleted: true}
+	return nil
+}
+
+// Size implements the `db.DB` interface.
+func (fallbackDB *fallbackDB) Size(prefix string) (int, error) {
+	size, err := fallbackDB.primary.Size(prefix)
+	if !failed(err) {
+		return size, err
+	}
+	return fallbackDB.secondary.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface. It only iterates over the primary
+// `db.DB`, so it does not include writes that have not been replayed yet.
+func (fallbackDB *fallbackDB) Iterator(prefix string) db.Iterator {
+	return fallbackDB.primary.Iterator(prefix)
+}
+
+// Replay implements the `DB` interface.
+func (fallbackDB *fallbackDB) Replay() error {
+	fallbackDB.mu.Lock()
+	defer fallbackDB.mu.Unlock()
+
+	return fallbackDB.replay()
+}
+
+// Pending implements the `DB` interface.
+func (fallbackDB *fallbackDB) Pending() int {
+	fallbackDB.mu.Lock()
+	defer fallbackDB.mu.Unlock()
+
+	return len(fallbackDB.pending)
+}
+
+// recovered is called after a write of the key to the primary `db.DB` has
+// succeeded. The write replaces any pending write of the key, and the other
+// pending writes are replayed, because the primary `db.DB` is likely to have
+// recovered. The mutex must be held.
+func (fallbackDB *fallbackDB) recovered(key string) {
+	if _, ok := fallbackDB.pending[key]; ok {
+		delete(fallbackDB.pending, key)
+		// The secondary `db.DB` only holds writes that have not been replayed,
+		// and the key is no longer one of them. Failing to delete it only
+		// wastes space, because it is never read.
+		if err := fallbackDB.secondary.Delete(key); err != nil {
+			log.Println(fmt.Errorf("failed to delete key=%v from secondary: %w", key, err))
+		}
+	}
+	if len(fallbackDB.pending) > 0 {
+		// The writes are kept if replaying fails, and are retried on the next
+		// success.
+		if err := fallbackDB.replay(); err != nil {
+			log.Println(fmt.Errorf("failed to replay writes: %w", err))
+		}
+	}
+}
+
+// replay the pending writes to the primary `db.DB`, and stop at the first one
+// that fails. The mutex must be held.
+func (fallbackDB *fallbackDB) replay() error {
+	for key, pending := range fallbackDB.pending {
+		var err error
+		if pending.deleted {
+			err = fallbackDB.primary.Delete(key)
+		} else {
+			err = fallbackDB.primary.Insert(key, pending.value)
+		}
+		if err != nil {
+			return fmt.Errorf("error replaying key=%v: %w", key, err)
+		}
+		delete(fallbackDB.pending, key)
+		if !pending.deleted {
+			if err := fallbackDB.secondary.Delete(key); err != nil {
+				return fmt.Errorf("error deleting replayed key=%v from secondary: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// failed returns whether or not the error means that a `db.DB` has failed, as
+// opposed to an error about the operation itself.
+func failed(err error) bool {
+	return err != nil && !errors.Is(err, db.ErrKeyNotFound) && !errors.Is(err, db.ErrEmptyKey)
+}
@@ -0,0 +1,13 @@
+package fallback_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFallback(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fallback Suite")
+}
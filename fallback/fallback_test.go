@@ -0,0 +1,219 @@
+package fallback_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/fallback"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errBackend = errors.New("backend failure")
+
+// switchDB is a `db.DB` that fails all operations while it is down.
+type switchDB struct {
+	db.DB
+	down bool
+}
+
+func (switchDB *switchDB) Insert(key string, value interface{}) error {
+	if switchDB.down {
+		return errBackend
+	}
+	return switchDB.DB.Insert(key, value)
+}
+
+func (switchDB *switchDB) Get(key string, value interface{}) error {
+	if switchDB.down {
+		return errBackend
+	}
+	return switchDB.DB.Get(key, value)
+}
+
+func (switchDB *switchDB) Delete(key string) error {
+	if switchDB.down {
+		return errBackend
+	}
+	return switchDB.DB.Delete(key)
+}
+
+func (switchDB *switchDB) Size(prefix string) (int, error) {
+	if switchDB.down {
+		return 0, errBackend
+	}
+	return switchDB.DB.Size(prefix)
+}
+
+// hookDB is a `db.DB` that calls a hook before the first get.
+type hookDB struct {
+	db.DB
+	once      *sync.Once
+	beforeGet func()
+}
+
+func (hookDB *hookDB) Get(key string, value interface{}) error {
+	hookDB.once.Do(hookDB.beforeGet)
+	return hookDB.DB.Get(key, value)
+}
+
+var _ = Describe("fallback db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when the primary db is available", func() {
+			It("should not use the secondary db", func() {
+				primary := &switchDB{DB: memdb.New(codec)}
+				secondary := memdb.New(codec)
+				database := New(primary, secondary)
+
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).Should(Succeed())
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).Should(Succeed())
+				Expect(stored).Should(Equal(value))
+				Expect(database.Get("missing", &stored)).Should(Equal(db.ErrKeyNotFound))
+
+				size, err := secondary.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+		})
+
+		Context("when the primary db fails", func() {
+			It("should keep reading and writing against the secondary db", func() {
+				primary := &switchDB{DB: memdb.New(codec)}
+				database := New(primary, memdb.New(codec))
+
+				before := testutil.RandomTestStruct()
+				Expect(database.Insert("before", before)).Should(Succeed())
+				Expect(database.Insert("deleted", before)).Should(Succeed())
+				primary.down = true
+
+				values := map[string]testutil.TestStruct{}
+				for i := 0; i < 10; i++ {
+					key := fmt.Sprintf("%v", i)
+					values[key] = testutil.RandomTestStruct()
+					Expect(database.Insert(key, values[key])).Should(Succeed())
+				}
+				Expect(database.Delete("deleted")).Should(Succeed())
+				Expect(database.Pending()).Should(Equal(11))
+
+				for key, value := range values {
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(database.Get(key, &stored)).Should(Succeed())
+					Expect(stored).Should(Equal(value))
+				}
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("deleted", &stored)).Should(Equal(db.ErrKeyNotFound))
+
+				// Keys that were written before the primary db failed are
+				// not in the secondary db.
+				Expect(database.Get("before", &stored)).Should(Equal(db.ErrKeyNotFound))
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+			})
+
+			It("should replay the writes once the primary db recovers", func() {
+				primary := &switchDB{DB: memdb.New(codec)}
+				secondary := memdb.New(codec)
+				database := New(primary, secondary)
+
+				Expect(database.Insert("deleted", testutil.RandomTestStruct())).Should(Succeed())
+				primary.down = true
+				values := map[string]testutil.TestStruct{}
+				for i := 0; i < 10; i++ {
+					key := fmt.Sprintf("%v", i)
+					values[key] = testutil.RandomTestStruct()
+					Expect(database.Insert(key, values[key])).Should(Succeed())
+				}
+				Expect(database.Delete("deleted")).Should(Succeed())
+				Expect(errors.Is(database.Replay(), errBackend)).Should(BeTrue())
+
+				// The next successful write replays the others.
+				primary.down = false
+				values["after"] = testutil.RandomTestStruct()
+				Expect(database.Insert("after", values["after"])).Should(Succeed())
+				Expect(database.Pending()).Should(Equal(0))
+
+				size, err := primary.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(11))
+				for key, value := range values {
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(primary.Get(key, &stored)).Should(Succeed())
+					Expect(stored).Should(Equal(value))
+				}
+				size, err = secondary.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+
+			It("should not replay a write over a newer one", func() {
+				primary := &switchDB{DB: memdb.New(codec)}
+				database := New(primary, memdb.New(codec))
+
+				primary.down = true
+				Expect(database.Insert("key", testutil.RandomTestStruct())).Should(Succeed())
+				primary.down = false
+				newer := testutil.RandomTestStruct()
+				Expect(database.Insert("key", newer)).Should(Succeed())
+				Expect(database.Replay()).Should(Succeed())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).Should(Succeed())
+				Expect(stored).Should(Equal(newer))
+			})
+
+			It("should not miss a pending write that is replayed while it is read", func() {
+				primary := &switchDB{DB: memdb.New(codec)}
+				var database DB
+				replayed := make(chan struct{})
+				secondary := &hookDB{DB: memdb.New(codec), once: new(sync.Once), beforeGet: func() {
+					// Replay the pending write with a successful write, and
+					// read once the replay has finished or is waiting for the
+					// read.
+					go func() {
+						defer GinkgoRecover()
+						defer close(replayed)
+						Expect(database.Insert("other", testutil.RandomTestStruct())).Should(Succeed())
+					}()
+					select {
+					case <-replayed:
+					case <-time.After(100 * time.Millisecond):
+					}
+				}}
+				database = New(primary, secondary)
+
+				primary.down = true
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).Should(Succeed())
+				primary.down = false
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).Should(Succeed())
+				Expect(stored).Should(Equal(value))
+				<-replayed
+				Expect(database.Pending()).Should(Equal(0))
+			})
+		})
+
+		Context("when doing operations with empty keys", func() {
+			It("should return ErrEmptyKey", func() {
+				database := New(memdb.New(codec), memdb.New(codec))
+				var value testutil.TestStruct
+				Expect(database.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Delete("")).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Pending()).Should(Equal(0))
+			})
+		})
+	}
+})
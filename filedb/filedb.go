@@ -0,0 +1,318 @@
+package filedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/renproject/kv/db"
+	"golang.org/x/crypto/sha3"
+)
+
+// tempPattern is the pattern of the names of the files that values are written
+// to before they are renamed. Files are otherwise named by the hex encoding of
+// a hash, so temporary files can never be mistaken for values.
+const tempPattern = ".tmp-*"
+
+// ErrKeyTooLarge is returned when inserting a key that is longer than
+// MaxKeyLength.
+var ErrKeyTooLarge = errors.New("key too large")
+
+// ErrCorruptFile is returned when the key at the beginning of a file is longer
+// than MaxKeyLength.
+var ErrCorruptFile = errors.New("corrupt file")
+
+// MaxKeyLength is the maximum length of a key. It bounds the memory that is
+// allocated when reading the key at the beginning of a file.
+const MaxKeyLength = 1 << 20
+
+// fileDB is a file-based implementation of the `db.DB`.
+type fileDB struct {
+	dir   string
+	codec db.Codec
+}
+
+// New returns a new `db.DB` that stores each key/value pair in its own file in
+// the given directory. Files are named by the hash of their key, and begin
+// with the key followed by the encoded value. Writes go to a temporary file
+// that is renamed once it is complete, so readers never see a partially
+// written value. The `db.DB` implements `db.StreamStore`, and values that are
+// streamed are never held in memory. Size and Iterator read the key of every
+// file in the directory, so the `db.DB` is best suited to a small number of
+// large values. Files in the directory that are not named by a hash are
+// ignored.
+func New(dir string, codec db.Codec) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		panic(fmt.Sprintf("error initialising filedb: %v", err))
+	}
+	return &fileDB{
+		dir:   dir,
+		codec: codec,
+	}
+}
+
+// Close implements the `db.DB` interface. It does nothing, as no files are
+// held open between calls.
+func (fileDB *fileDB) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface.
+func (fileDB *fileDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := fileDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return fileDB.write(key, bytes.NewReader(data))
+}
+
+// Get implements the `db.DB` interface.
+func (fileDB *fileDB) Get(key string, value interface{}) error {
+	r, err := fileDB.GetStream(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading value: %w", err)
+	}
+	return fileDB.codec.Decode(data, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (fileDB *fileDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	if err := os.Remove(fileDB.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// InsertStream implements the `db.StreamStore` interface.
+func (fileDB *fileDB) InsertStream(key string, r io.Reader) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return fileDB.write(key, r)
+}
+
+// GetStream implements the `db.StreamStore` interface.
+func (fileDB *fileDB) GetStream(key string) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+	f, err := os.Open(fileDB.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, db.ErrKeyNotFound
+		}
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	if _, err := readKey(br); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &file{Reader: br, f: f}, nil
+}
+
+// Size implements the `db.DB` interface.
+func (fileDB *fileDB) Size(prefix string) (int, error) {
+	keys, err := fileDB.keys(prefix)
+	return len(keys), err
+}
+
+// Iterator implements the `db.DB` interface. The keys are read when the
+// iterator is created, and the values are read as they are iterated. Key/value
+// pairs that are deleted during the iteration are reported as not found.
+func (fileDB *fileDB) Iterator(prefix string) db.Iterator {
+	keys, err := fileDB.keys(prefix)
+	return &iterator{
+		index:  -1,
+		fileDB: fileDB,
+		prefix: prefix,
+		keys:   keys,
+		err:    err,
+	}
+}
+
+// write the key followed by the data read from the reader to a temporary file,
+// and then rename it to the file of the key.
+func (fileDB *fileDB) write(key string, r io.Reader) error {
+	if len(key) > MaxKeyLength {
+		return ErrKeyTooLarge
+	}
+	f, err := os.CreateTemp(fileDB.dir, tempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := func() error {
+		defer f.Close()
+
+		if err := writeKey(f, key); err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("error writing value: %w", err)
+		}
+		return f.Sync()
+	}(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fileDB.path(key))
+}
+
+// keys returns the sorted keys of all files in the directory that begin with
+// the given prefix. Files that are not named by a hash were not written by the
+// fileDB, and are skipped.
+func (fileDB *fileDB) keys(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(fileDB.dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, entry := range entries {
+		if !isHashName(entry.Name()) {
+			continue
+		}
+		key, err := fileDB.readKey(entry.Name())
+		if errors.Is(err, os.ErrNotExist) {
+			// The file has been deleted since reading the directory.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// readKey reads the key from the beginning of the file with the given name.
+func (fileDB *fileDB) readKey(name string) (string, error) {
+	f, err := os.Open(filepath.Join(fileDB.dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readKey(bufio.NewReader(f))
+}
+
+// isHashName returns whether or not the file name is the hex encoding of a
+// hash, like the names of the files of keys.
+func isHashName(name string) bool {
+	if len(name) != hex.EncodedLen(len(sha3.Sum256(nil))) {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// path returns the path of the file of the key.
+func (fileDB *fileDB) path(key string) string {
+	hash := sha3.Sum256([]byte(key))
+	return filepath.Join(fileDB.dir, hex.EncodeToString(hash[:]))
+}
+
+// writeKey writes the length of the key followed by the key.
+func writeKey(w io.Writer, key string) error {
+	prefix := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(prefix, uint64(len(key)))
+	if _, err := w.Write(append(prefix[:n], key...)); err != nil {
+		return fmt.Errorf("error writing key: %w", err)
+	}
+	return nil
+}
+
+// readKey reads a key that was written by writeKey.
+func readKey(r *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", fmt.Errorf("error reading key length: %w", err)
+	}
+	if length > MaxKeyLength {
+		return "", fmt.Errorf("%w: key length = %v, max key length = %v", ErrCorruptFile, length, MaxKeyLength)
+	}
+	key := make([]byte, length)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return "", fmt.Errorf("error reading key: %w", err)
+	}
+	return string(key), nil
+}
+
+// file is an `io.ReadCloser` that reads the value of a file through a buffer.
+type file struct {
+	io.Reader
+	f *os.File
+}
+
+// Close implements the `io.Closer` interface.
+func (file *file) Close() error {
+	return file.f.Close()
+}
+
+// iterator is a file-based implementation of the `db.Iterator`.
+type iterator struct {
+	index  int
+	fileDB *fileDB
+	prefix string
+	keys   []string
+	err    error
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *iterator) Next() bool {
+	if iter.err != nil {
+		return false
+	}
+	iter.index++
+	return iter.index < len(iter.keys)
+}
+
+// Key implements the `db.Iterator` interface.
+func (iter *iterator) Key() (string, error) {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return "", db.ErrIndexOutOfRange
+	}
+	return strings.TrimPrefix(iter.keys[iter.index], iter.prefix), nil
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *iterator) Value(value interface{}) error {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return db.ErrIndexOutOfRange
+	}
+	return iter.fileDB.Get(iter.keys[iter.index], value)
+}
+
+// Err implements the `db.Iterator` interface. It returns the error from
+// reading the keys when the iterator was created.
+func (iter *iterator) Err() error {
+	return iter.err
+}
+
+// Close implements the `db.Iterator` interface.
+func (iter *iterator) Close() {}
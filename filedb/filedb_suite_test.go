@@ -0,0 +1,19 @@
+package filedb_test
+
+import (
+	"os/exec"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFiledb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Filedb Suite")
+}
+
+// Clean the fileDB instance after each test
+var _ = JustAfterEach(func() {
+	Expect(exec.Command("rm", "-rf", "./.filedb").Run()).NotTo(HaveOccurred())
+})
@@ -0,0 +1,200 @@
+package filedb_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/filedb"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/testutil"
+)
+
+// totalAlloc returns the total number of bytes allocated on the heap.
+func totalAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.TotalAlloc
+}
+
+var _ = Describe("file DB implementation of the db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when doing operation on a fileDB implementation of DB", func() {
+			It("should be able to do read, write and delete", func() {
+				fileDB := New(".filedb", codec)
+				defer fileDB.Close()
+
+				readAndWrite := func(key string, value testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+					val := testutil.TestStruct{D: []byte{}}
+					Expect(fileDB.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+
+					Expect(fileDB.Insert(key, value)).NotTo(HaveOccurred())
+					Expect(fileDB.Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+
+					Expect(fileDB.Delete(key)).NotTo(HaveOccurred())
+					Expect(fileDB.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					return true
+				}
+
+				Expect(quick.Check(readAndWrite, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+			})
+
+			It("should be able to iterate through the db with a prefix", func() {
+				fileDB := New(".filedb", codec)
+				defer fileDB.Close()
+
+				values := map[string]testutil.TestStruct{}
+				for i := 0; i < 10; i++ {
+					value := testutil.RandomTestStruct()
+					Expect(fileDB.Insert(fmt.Sprintf("prefix%v", i), value)).NotTo(HaveOccurred())
+					values[fmt.Sprintf("%v", i)] = value
+				}
+				Expect(fileDB.Insert("other", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+
+				size, err := fileDB.Size("prefix")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+
+				iter := fileDB.Iterator("prefix")
+				defer iter.Close()
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					value := testutil.TestStruct{D: []byte{}}
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(value, values[key])).Should(BeTrue())
+					delete(values, key)
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(values).Should(BeEmpty())
+
+				_, err = iter.Key()
+				Expect(err).Should(Equal(db.ErrIndexOutOfRange))
+			})
+		})
+
+		Context("when operating with empty key", func() {
+			It("should return ErrEmptyKey error", func() {
+				fileDB := New(".filedb", codec)
+				defer fileDB.Close()
+
+				var val []byte
+				Expect(fileDB.Insert("", []byte{1})).Should(Equal(db.ErrEmptyKey))
+				Expect(fileDB.Get("", &val)).Should(Equal(db.ErrEmptyKey))
+				Expect(fileDB.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when streaming values", func() {
+			It("should read values that were inserted with the codec", func() {
+				fileDB := New(".filedb", codec)
+				defer fileDB.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(fileDB.Insert("key", value)).NotTo(HaveOccurred())
+
+				r, err := fileDB.(db.StreamStore).GetStream("key")
+				Expect(err).NotTo(HaveOccurred())
+				defer r.Close()
+				data, err := io.ReadAll(r)
+				Expect(err).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(codec.Decode(data, &stored)).NotTo(HaveOccurred())
+				Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+			})
+		})
+	}
+
+	Context("when streaming a large value", func() {
+		It("should not hold the value in memory", func() {
+			fileDB := New(".filedb", testutil.Codecs[0])
+			defer fileDB.Close()
+			streamStore := fileDB.(db.StreamStore)
+
+			const size = 64 * 1024 * 1024
+			written := sha256.New()
+			payload := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(0)), size), written)
+
+			before := totalAlloc()
+			Expect(streamStore.InsertStream("key", payload)).NotTo(HaveOccurred())
+
+			r, err := streamStore.GetStream("key")
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+			read := sha256.New()
+			n, err := io.Copy(read, r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(totalAlloc() - before).Should(BeNumerically("<", size/8))
+
+			Expect(n).Should(Equal(int64(size)))
+			Expect(read.Sum(nil)).Should(Equal(written.Sum(nil)))
+		})
+
+		It("should return ErrKeyNotFound for a missing key", func() {
+			fileDB := New(".filedb", testutil.Codecs[0])
+			defer fileDB.Close()
+
+			_, err := fileDB.(db.StreamStore).GetStream("missing")
+			Expect(err).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when the directory holds files that were not written by the db", func() {
+		corrupt := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}
+
+		It("should skip files that are not named by a hash", func() {
+			fileDB := New(".filedb", testutil.Codecs[0])
+			defer fileDB.Close()
+			Expect(fileDB.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(".filedb", "stray"), corrupt, 0600)).NotTo(HaveOccurred())
+
+			size, err := fileDB.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+		})
+
+		It("should return ErrCorruptFile if the length of a key is too large", func() {
+			fileDB := New(".filedb", testutil.Codecs[0])
+			defer fileDB.Close()
+			name := strings.Repeat("ab", 32)
+			Expect(os.WriteFile(filepath.Join(".filedb", name), corrupt, 0600)).NotTo(HaveOccurred())
+
+			_, err := fileDB.Size("")
+			Expect(errors.Is(err, ErrCorruptFile)).Should(BeTrue())
+		})
+	})
+
+	Context("when inserting a key that is too large", func() {
+		It("should return ErrKeyTooLarge", func() {
+			fileDB := New(".filedb", testutil.Codecs[0])
+			defer fileDB.Close()
+			Expect(fileDB.Insert(strings.Repeat("k", MaxKeyLength+1), "value")).Should(Equal(ErrKeyTooLarge))
+		})
+	})
+
+	Context("when initializing the db with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() {
+				New(".filedb", nil)
+			}).Should(Panic())
+		})
+	})
+})
@@ -0,0 +1,269 @@
+package fsadapter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// errIsDir is returned when reading from a directory.
+var errIsDir = errors.New("is a directory")
+
+type fileSystem struct {
+	inner db.DB
+}
+
+// New returns a read-only `fs.FS` over the `db.DB`, where the keys are paths
+// and the values are the contents of the files. Values must be `[]byte`. Keys
+// that contain "/" form a tree of directories, which only exist while there
+// are keys below them, and are listed by iterating over the keys with their
+// path as a prefix. The root directory is named ".", and keys that are not
+// valid paths, as defined by `fs.ValidPath`, cannot be opened. If a key is
+// both a file and the directory of other keys, then it is opened as a file.
+// The returned `fs.FS` can be served with `http.FS`.
+func New(inner db.DB) fs.FS {
+	return &fileSystem{inner: inner}
+}
+
+// Open implements the `fs.FS` interface.
+func (fsys *fileSystem) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	data, isFile, err := fsys.get(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if isFile {
+		return &file{
+			Reader: bytes.NewReader(data),
+			info:   fileInfo{name: path.Base(name), size: int64(len(data))},
+		}, nil
+	}
+
+	entries, err := fsys.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &dir{
+		name:    name,
+		info:    fileInfo{name: path.Base(name), dir: true},
+		entries: entries,
+	}, nil
+}
+
+// get the contents of the file with the given name, and whether or not it is
+// a file. The root directory is never a file.
+func (fsys *fileSystem) get(name string) ([]byte, bool, error) {
+	if name == "." {
+		return nil, false, nil
+	}
+	var data []byte
+	if err := fsys.inner.Get(name, &data); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// readDir returns the entries of the directory with the given name, sorted by
+// name. Keys below the directory that are not valid paths are skipped.
+func (fsys *fileSystem) readDir(name string) ([]fs.DirEntry, error) {
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+	iter := db.NewKeyIterator(fsys.inner, prefix)
+	defer iter.Close()
+
+	// A child is a directory unless it is also a key, in which case it is
+	// opened as a file.
+	isDir := map[string]bool{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, err
+		}
+		if !fs.ValidPath(prefix + key) {
+			continue
+		}
+		i := strings.IndexByte(key, '/')
+		if i < 0 {
+			isDir[key] = false
+			continue
+		}
+		if _, ok := isDir[key[:i]]; !ok {
+			isDir[key[:i]] = true
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(isDir))
+	for child, dir := range isDir {
+		entries = append(entries, &dirEntry{
+			fsys: fsys,
+			path: path.Join(name, child),
+			info: fileInfo{name: child, dir: dir},
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// file is an `fs.File` over the contents of a key. It also implements
+// `io.Seeker` and `io.ReaderAt`, which are used by `http.FileServer`.
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+// Stat implements the `fs.File` interface.
+func (file *file) Stat() (fs.FileInfo, error) {
+	return file.info, nil
+}
+
+// Close implements the `fs.File` interface.
+func (file *file) Close() error {
+	return nil
+}
+
+// dir is an `fs.ReadDirFile` over the entries of a directory, which are read
+// when it is opened.
+type dir struct {
+	name    string
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+// Stat implements the `fs.File` interface.
+func (dir *dir) Stat() (fs.FileInfo, error) {
+	return dir.info, nil
+}
+
+// Read implements the `fs.File` interface. Directories cannot be read.
+func (dir *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.name, Err: errIsDir}
+}
+
+// Close implements the `fs.File` interface.
+func (dir *dir) Close() error {
+	return nil
+}
+
+// ReadDir implements the `fs.ReadDirFile` interface.
+func (dir *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := dir.entries[dir.offset:]
+	if n <= 0 {
+		dir.offset = len(dir.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	dir.offset += n
+	return remaining[:n], nil
+}
+
+// dirEntry is an entry of a directory. The size of a file is only read when
+// its info is requested.
+type dirEntry struct {
+	fsys *fileSystem
+	path string
+	info fileInfo
+}
+
+// Name implements the `fs.DirEntry` interface.
+func (entry *dirEntry) Name() string {
+	return entry.info.name
+}
+
+// IsDir implements the `fs.DirEntry` interface.
+func (entry *dirEntry) IsDir() bool {
+	return entry.info.dir
+}
+
+// Type implements the `fs.DirEntry` interface.
+func (entry *dirEntry) Type() fs.FileMode {
+	return entry.info.Mode().Type()
+}
+
+// Info implements the `fs.DirEntry` interface. The key might have been deleted
+// since the directory was read, in which case `fs.ErrNotExist` is returned.
+func (entry *dirEntry) Info() (fs.FileInfo, error) {
+	if entry.info.dir {
+		return entry.info, nil
+	}
+	data, isFile, err := entry.fsys.get(entry.path)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: entry.path, Err: err}
+	}
+	if !isFile {
+		return nil, &fs.PathError{Op: "stat", Path: entry.path, Err: fs.ErrNotExist}
+	}
+	info := entry.info
+	info.size = int64(len(data))
+	return info, nil
+}
+
+// fileInfo describes a file or a directory. Keys do not have a modification
+// time, so it is always the zero time.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+// Name implements the `fs.FileInfo` interface.
+func (info fileInfo) Name() string {
+	return info.name
+}
+
+// Size implements the `fs.FileInfo` interface.
+func (info fileInfo) Size() int64 {
+	return info.size
+}
+
+// Mode implements the `fs.FileInfo` interface. Files and directories are read
+// only.
+func (info fileInfo) Mode() fs.FileMode {
+	if info.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime implements the `fs.FileInfo` interface.
+func (info fileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+// IsDir implements the `fs.FileInfo` interface.
+func (info fileInfo) IsDir() bool {
+	return info.dir
+}
+
+// Sys implements the `fs.FileInfo` interface.
+func (info fileInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,13 @@
+package fsadapter_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFsadapter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fsadapter Suite")
+}
@@ -0,0 +1,169 @@
+package fsadapter_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/fsadapter"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("fs adapter", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		// newDB with a small tree of files.
+		newDB := func() db.DB {
+			database := memdb.New(codec)
+			files := map[string]string{
+				"index.html":         "<html></html>",
+				"css/main.css":       "body {}",
+				"js/app.js":          "app()",
+				"js/vendor/lib.js":   "lib()",
+				"js/vendor/other.js": "other()",
+			}
+			for key, contents := range files {
+				Expect(database.Insert(key, []byte(contents))).NotTo(HaveOccurred())
+			}
+			return database
+		}
+
+		Context(fmt.Sprintf("when opening files using %v", codec), func() {
+			It("should read the contents of the files", func() {
+				fsys := New(newDB())
+
+				data, err := fs.ReadFile(fsys, "js/vendor/lib.js")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).Should(Equal("lib()"))
+
+				f, err := fsys.Open("index.html")
+				Expect(err).NotTo(HaveOccurred())
+				defer f.Close()
+				info, err := f.Stat()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Name()).Should(Equal("index.html"))
+				Expect(info.Size()).Should(Equal(int64(len("<html></html>"))))
+				Expect(info.IsDir()).Should(BeFalse())
+				data, err = io.ReadAll(f)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).Should(Equal("<html></html>"))
+			})
+
+			It("should return fs.ErrNotExist for missing keys", func() {
+				fsys := New(newDB())
+				for _, name := range []string{"missing.html", "js/missing.js", "missing", "js/vendor/lib.js/missing"} {
+					_, err := fsys.Open(name)
+					Expect(errors.Is(err, fs.ErrNotExist)).Should(BeTrue())
+				}
+			})
+
+			It("should return fs.ErrInvalid for invalid paths", func() {
+				fsys := New(newDB())
+				for _, name := range []string{"/index.html", "js/", "js/../index.html", ""} {
+					_, err := fsys.Open(name)
+					Expect(errors.Is(err, fs.ErrInvalid)).Should(BeTrue())
+				}
+			})
+
+			It("should pass the tests of the fs package", func() {
+				Expect(fstest.TestFS(New(newDB()), "index.html", "css/main.css", "js/app.js", "js/vendor/lib.js", "js/vendor/other.js")).NotTo(HaveOccurred())
+			})
+		})
+
+		Context(fmt.Sprintf("when listing directories using %v", codec), func() {
+			// names of the entries.
+			names := func(entries []fs.DirEntry) []string {
+				names := make([]string, len(entries))
+				for i, entry := range entries {
+					names[i] = entry.Name()
+					if entry.IsDir() {
+						names[i] += "/"
+					}
+				}
+				return names
+			}
+
+			It("should list the files and directories in a directory", func() {
+				fsys := New(newDB())
+
+				entries, err := fs.ReadDir(fsys, ".")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names(entries)).Should(Equal([]string{"css/", "index.html", "js/"}))
+
+				entries, err = fs.ReadDir(fsys, "js")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names(entries)).Should(Equal([]string{"app.js", "vendor/"}))
+
+				entries, err = fs.ReadDir(fsys, "js/vendor")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names(entries)).Should(Equal([]string{"lib.js", "other.js"}))
+				info, err := entries[1].Info()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Size()).Should(Equal(int64(len("other()"))))
+			})
+
+			It("should list an empty root directory", func() {
+				entries, err := fs.ReadDir(New(memdb.New(codec)), ".")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).Should(BeEmpty())
+			})
+
+			It("should open a key that is also a directory as a file", func() {
+				database := newDB()
+				Expect(database.Insert("js", []byte("file"))).NotTo(HaveOccurred())
+				fsys := New(database)
+
+				data, err := fs.ReadFile(fsys, "js")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).Should(Equal("file"))
+
+				entries, err := fs.ReadDir(fsys, ".")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names(entries)).Should(Equal([]string{"css/", "index.html", "js"}))
+			})
+
+			It("should skip keys that are not valid paths", func() {
+				database := newDB()
+				Expect(database.Insert("js//empty.js", []byte("empty"))).NotTo(HaveOccurred())
+				Expect(database.Insert("/absolute.js", []byte("absolute"))).NotTo(HaveOccurred())
+
+				entries, err := fs.ReadDir(New(database), "js")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names(entries)).Should(Equal([]string{"app.js", "vendor/"}))
+				entries, err = fs.ReadDir(New(database), ".")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names(entries)).Should(Equal([]string{"css/", "index.html", "js/"}))
+			})
+		})
+
+		Context(fmt.Sprintf("when serving files over http using %v", codec), func() {
+			It("should serve the contents of the files", func() {
+				server := httptest.NewServer(http.FileServer(http.FS(New(newDB()))))
+				defer server.Close()
+
+				resp, err := http.Get(server.URL + "/css/main.css")
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+				data, err := io.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).Should(Equal("body {}"))
+
+				missing, err := http.Get(server.URL + "/missing.css")
+				Expect(err).NotTo(HaveOccurred())
+				defer missing.Body.Close()
+				Expect(missing.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+	}
+})
@@ -0,0 +1,201 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+const (
+	// dataPrefix is the prefix of the keys used to store the encoded values.
+	dataPrefix = "data_"
+
+	// indexPrefix is the prefix of the keys used to store the index entries
+	// from index keys to primary keys.
+	indexPrefix = "index_"
+)
+
+// A DB is a `db.DB` that maintains a secondary index over its values, so that
+// keys can be looked up by a field of their value.
+type DB interface {
+	db.DB
+
+	// Lookup returns the primary keys of all values whose index key is equal
+	// to the given index key.
+	Lookup(indexKey string) ([]string, error)
+}
+
+type indexedDB struct {
+	// mu is used to keep the index consistent with the data.
+	mu      *sync.Mutex
+	inner   db.DB
+	codec   db.Codec
+	extract func(value []byte) (string, error)
+}
+
+// Wrap returns a `DB` that stores the data and the index in the inner `db.DB`.
+// Values are encoded with the given codec, and the index key of each value is
+// extracted from its encoding. Values with an empty index key are not
+// indexed. The index entry of a key is replaced when it is inserted, and
+// removed when it is deleted, which requires reading its current value. The
+// inner `db.DB` must not be shared with anything else.
+func Wrap(inner db.DB, codec db.Codec, extract func(value []byte) (string, error)) DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	if extract == nil {
+		panic("extract function cannot be nil")
+	}
+	return &indexedDB{
+		mu:      new(sync.Mutex),
+		inner:   inner,
+		codec:   codec,
+		extract: extract,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (indexedDB *indexedDB) Close() error {
+	return indexedDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface. If the index key cannot be
+// extracted from the value, then nothing is written and the error is returned.
+func (indexedDB *indexedDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := indexedDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	indexKey, err := indexedDB.extract(data)
+	if err != nil {
+		return fmt.Errorf("error extracting index key: %w", err)
+	}
+
+	indexedDB.mu.Lock()
+	defer indexedDB.mu.Unlock()
+
+	if err := indexedDB.removeIndex(key); err != nil {
+		return err
+	}
+	if err := indexedDB.inner.Insert(dataPrefix+key, data); err != nil {
+		return err
+	}
+	if indexKey == "" {
+		return nil
+	}
+	if err := indexedDB.inner.Insert(indexEntryKey(indexKey, key), []byte{}); err != nil {
+		return fmt.Errorf("error inserting index entry for index key=%v: %w", indexKey, err)
+	}
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (indexedDB *indexedDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	var data []byte
+	if err := indexedDB.inner.Get(dataPrefix+key, &data); err != nil {
+		return err
+	}
+	return indexedDB.codec.Decode(data, value)
+}
+
+// Delete implements the `db.DB` interface. The key is also removed from the
+// index.
+func (indexedDB *indexedDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	indexedDB.mu.Lock()
+	defer indexedDB.mu.Unlock()
+
+	if err := indexedDB.removeIndex(key); err != nil {
+		return err
+	}
+	return indexedDB.inner.Delete(dataPrefix + key)
+}
+
+// Size implements the `db.DB` interface. Only the data is counted.
+func (indexedDB *indexedDB) Size(prefix string) (int, error) {
+	return indexedDB.inner.Size(dataPrefix + prefix)
+}
+
+// Iterator implements the `db.DB` interface. Only the data is iterated.
+func (indexedDB *indexedDB) Iterator(prefix string) db.Iterator {
+	return &iterator{
+		Iterator: indexedDB.inner.Iterator(dataPrefix + prefix),
+		codec:    indexedDB.codec,
+	}
+}
+
+// Lookup implements the `DB` interface.
+func (indexedDB *indexedDB) Lookup(indexKey string) ([]string, error) {
+	iter := indexedDB.inner.Iterator(indexEntryKey(indexKey, ""))
+	defer iter.Close()
+
+	keys := []string{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, fmt.Errorf("error reading index entry: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error reading index: %w", err)
+	}
+	return keys, nil
+}
+
+// removeIndex removes the index entry of the current value of the key, if it
+// exists. The caller must hold the lock.
+func (indexedDB *indexedDB) removeIndex(key string) error {
+	var data []byte
+	if err := indexedDB.inner.Get(dataPrefix+key, &data); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error getting current value: %w", err)
+	}
+	indexKey, err := indexedDB.extract(data)
+	if err != nil {
+		return fmt.Errorf("error extracting current index key: %w", err)
+	}
+	if indexKey == "" {
+		return nil
+	}
+	if err := indexedDB.inner.Delete(indexEntryKey(indexKey, key)); err != nil {
+		return fmt.Errorf("error deleting index entry for index key=%v: %w", indexKey, err)
+	}
+	return nil
+}
+
+// indexEntryKey returns the key of the index entry for the given index key and
+// primary key. The index key is prefixed by its length so that no index key
+// can be a prefix of another.
+func indexEntryKey(indexKey, key string) string {
+	return fmt.Sprintf("%v%d_%v%v", indexPrefix, len(indexKey), indexKey, key)
+}
+
+// iterator is a `db.Iterator` that decodes the encoded values of the inner
+// iterator.
+type iterator struct {
+	db.Iterator
+	codec db.Codec
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *iterator) Value(value interface{}) error {
+	var data []byte
+	if err := iter.Iterator.Value(&data); err != nil {
+		return err
+	}
+	return iter.codec.Decode(data, value)
+}
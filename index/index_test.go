@@ -0,0 +1,157 @@
+package index_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/index"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("indexed db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		// extract indexes values by their A field.
+		extract := func(data []byte) (string, error) {
+			value := testutil.TestStruct{D: []byte{}}
+			if err := codec.Decode(data, &value); err != nil {
+				return "", err
+			}
+			return value.A, nil
+		}
+
+		// valueWithA returns a random value with the given A field.
+		valueWithA := func(a string) testutil.TestStruct {
+			value := testutil.RandomTestStruct()
+			value.A = a
+			return value
+		}
+
+		// lookup the primary keys of the index key.
+		lookup := func(database DB, indexKey string) []string {
+			keys, err := database.Lookup(indexKey)
+			Expect(err).NotTo(HaveOccurred())
+			return keys
+		}
+
+		Context("when inserting values", func() {
+			It("should be able to look up keys by index key", func() {
+				database := Wrap(memdb.New(codec), codec, extract)
+
+				value := valueWithA("red")
+				Expect(database.Insert("a", value)).NotTo(HaveOccurred())
+				Expect(database.Insert("b", valueWithA("red"))).NotTo(HaveOccurred())
+				Expect(database.Insert("c", valueWithA("re"))).NotTo(HaveOccurred())
+				Expect(database.Insert("d", valueWithA(""))).NotTo(HaveOccurred())
+
+				Expect(lookup(database, "red")).Should(ConsistOf("a", "b"))
+				Expect(lookup(database, "re")).Should(ConsistOf("c"))
+				Expect(lookup(database, "blue")).Should(BeEmpty())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("a", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(4))
+			})
+
+			It("should reindex when inserting again", func() {
+				database := Wrap(memdb.New(codec), codec, extract)
+
+				Expect(database.Insert("a", valueWithA("red"))).NotTo(HaveOccurred())
+				Expect(database.Insert("a", valueWithA("blue"))).NotTo(HaveOccurred())
+				Expect(lookup(database, "red")).Should(BeEmpty())
+				Expect(lookup(database, "blue")).Should(ConsistOf("a"))
+
+				Expect(database.Insert("a", valueWithA(""))).NotTo(HaveOccurred())
+				Expect(lookup(database, "blue")).Should(BeEmpty())
+			})
+
+			It("should not write anything if the index key cannot be extracted", func() {
+				errExtract := errors.New("extract failure")
+				inner := memdb.New(codec)
+				database := Wrap(inner, codec, func([]byte) (string, error) {
+					return "", errExtract
+				})
+
+				Expect(errors.Is(database.Insert("a", valueWithA("red")), errExtract)).Should(BeTrue())
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+		})
+
+		Context("when deleting values", func() {
+			It("should remove the key from the index", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, codec, extract)
+
+				Expect(database.Insert("a", valueWithA("red"))).NotTo(HaveOccurred())
+				Expect(database.Insert("b", valueWithA("red"))).NotTo(HaveOccurred())
+				Expect(database.Delete("a")).NotTo(HaveOccurred())
+				Expect(database.Delete("missing")).NotTo(HaveOccurred())
+
+				Expect(lookup(database, "red")).Should(ConsistOf("b"))
+				value := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("a", &value)).Should(Equal(db.ErrKeyNotFound))
+
+				// Only the data and index entry of b should be left.
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(2))
+			})
+		})
+
+		Context("when iterating", func() {
+			It("should only iterate over the data", func() {
+				database := Wrap(memdb.New(codec), codec, extract)
+				values := map[string]testutil.TestStruct{
+					"a": valueWithA("red"),
+					"b": valueWithA("blue"),
+				}
+				for key, value := range values {
+					Expect(database.Insert(key, value)).NotTo(HaveOccurred())
+				}
+
+				iter := database.Iterator("")
+				defer iter.Close()
+				n := 0
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					value := testutil.TestStruct{D: []byte{}}
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(values[key]))
+					n++
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(n).Should(Equal(2))
+			})
+		})
+
+		Context("when using an empty key", func() {
+			It("should return ErrEmptyKey", func() {
+				database := Wrap(memdb.New(codec), codec, extract)
+				value := testutil.TestStruct{D: []byte{}}
+				Expect(database.Insert("", valueWithA("red"))).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+	}
+
+	Context("when wrapping with a nil codec or extract function", func() {
+		It("should panic", func() {
+			codec := testutil.Codecs[0]
+			Expect(func() { Wrap(memdb.New(codec), nil, func([]byte) (string, error) { return "", nil }) }).Should(Panic())
+			Expect(func() { Wrap(memdb.New(codec), codec, nil) }).Should(Panic())
+		})
+	})
+})
@@ -1,17 +1,23 @@
 package kv_test
 
 import (
+	"context"
 	"math/rand"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 
 	"github.com/renproject/kv/badgerdb"
 	"github.com/renproject/kv/cache/lru"
+	"github.com/renproject/kv/cache/ttl"
 	"github.com/renproject/kv/codec"
 	"github.com/renproject/kv/db"
 	"github.com/renproject/kv/leveldb"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
 	"github.com/renproject/kv/testutil"
 )
 
@@ -67,20 +73,87 @@ func BenchmarkBadgerDBWithLRUCache(b *testing.B) {
 	}
 }
 
+func BenchmarkTTLBurst(b *testing.B) {
+	benchmarkTTLBurst(b, false)
+}
+
+func BenchmarkTTLBurstWithPrewarm(b *testing.B) {
+	benchmarkTTLBurst(b, true)
+}
+
+func BenchmarkRRDBParallelReads(b *testing.B) {
+	benchmarkParallelReads(b, rrdb.New(codec.BinaryCodec, benchmarkWrites))
+}
+
+func BenchmarkRRDBCOWParallelReads(b *testing.B) {
+	benchmarkParallelReads(b, rrdb.NewCOW(codec.BinaryCodec, benchmarkWrites))
+}
+
+// benchmarkParallelReads measures the throughput of gets from many goroutines
+// while another goroutine keeps writing.
+func benchmarkParallelReads(b *testing.B, database db.DB) {
+	for i := 0; i < benchmarkWrites; i++ {
+		if err := database.Insert(strconv.Itoa(i), int64(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			database.Insert(strconv.Itoa(i%benchmarkWrites), int64(i))
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var value int64
+		for i := 0; pb.Next(); i++ {
+			if err := database.Get(strconv.Itoa(i%benchmarkWrites), &value); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func benchmarkTTLBurst(b *testing.B, prewarm bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		table := ttl.New(ctx, memdb.New(codec.BinaryCodec), "burst", time.Hour)
+		if prewarm {
+			table.Prewarm(benchmarkWrites)
+		}
+		for i := 0; i < benchmarkWrites; i++ {
+			if err := table.Insert(strconv.Itoa(i), int64(i)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func benchmarkDB(database db.DB) {
 	key := "testKey"
 
 	vals := make([]testutil.TestStruct, benchmarkWrites)
 
 	for i := 0; i < benchmarkWrites; i++ {
-		newKey := key + string(i)
+		newKey := key + strconv.Itoa(i)
 		vals[i] = testutil.RandomTestStruct()
 		Expect(database.Insert(newKey, vals[i])).NotTo(HaveOccurred())
 	}
 
 	for i := 0; i < benchmarkReads; i++ {
 		queryIndex := rand.Intn(benchmarkWrites)
-		queryKey := key + string(queryIndex)
+		queryKey := key + strconv.Itoa(queryIndex)
 		val := testutil.TestStruct{D: []byte{}}
 		err := database.Get(queryKey, &val)
 		Expect(err).NotTo(HaveOccurred())
@@ -94,14 +167,14 @@ func benchmarkTable(table db.Table) {
 	vals := make([]testutil.TestStruct, benchmarkWrites)
 
 	for i := 0; i < benchmarkWrites; i++ {
-		newKey := key + string(i)
+		newKey := key + strconv.Itoa(i)
 		vals[i] = testutil.RandomTestStruct()
 		Expect(table.Insert(newKey, vals[i])).NotTo(HaveOccurred())
 	}
 
 	for i := 0; i < benchmarkReads; i++ {
 		queryIndex := rand.Intn(benchmarkWrites)
-		queryKey := key + string(queryIndex)
+		queryKey := key + strconv.Itoa(queryIndex)
 		val := testutil.TestStruct{D: []byte{}}
 		err := table.Get(queryKey, &val)
 		Expect(err).NotTo(HaveOccurred())
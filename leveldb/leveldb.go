@@ -10,6 +10,35 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// A DB is a `db.DB` that stores keys in lexicographic order on disk.
+type DB interface {
+	db.DB
+	db.Ordered
+
+	// CursorIterator over the key/value pairs in the DB where the key begins
+	// with the given prefix, in lexicographic order of the keys. Unlike
+	// Iterator, which iterates over a snapshot taken when it is created, it
+	// reads the DB as it is when Next is called, so it can be used while the
+	// DB is being written to. Each call to Next reads the smallest key that is
+	// greater than the previous key, along with its value, at the time of the
+	// call. So:
+	//
+	//  - keys are returned in increasing order, and each key at most once,
+	//  - a key that exists from when the iterator is created until the
+	//    iterator reaches it is always returned, with its value at the time
+	//    it is reached, rather than its value when the iterator was created,
+	//  - keys that are inserted after the previous key are returned, and keys
+	//    that are inserted at or before it are not, and
+	//  - keys that are deleted before the iterator reaches them are not
+	//    returned.
+	//
+	// The key/value pairs that are returned might never have been in the DB
+	// at the same time, so it is not a consistent view of the DB as a whole.
+	// Each call to Next seeks to the next key, which is more expensive than
+	// the Next of Iterator.
+	CursorIterator(prefix string) db.Iterator
+}
+
 // levelDB is a leveldb implementation of the `db.Iterable`.
 type levelDB struct {
 	db    *leveldb.DB
@@ -17,7 +46,7 @@ type levelDB struct {
 }
 
 // New returns a new `db.Iterable`.
-func New(path string, codec db.Codec) db.DB {
+func New(path string, codec db.Codec) DB {
 	if codec == nil {
 		panic("codec cannot be nil")
 	}
@@ -47,7 +76,7 @@ func (ldb *levelDB) Insert(key string, value interface{}) error {
 		return err
 	}
 
-	return ldb.db.Put([]byte(key), data, nil)
+	return convertErr(ldb.db.Put([]byte(key), data, nil))
 }
 
 // Get implements the `db.DB` interface.
@@ -69,7 +98,7 @@ func (ldb *levelDB) Delete(key string) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
-	return ldb.db.Delete([]byte(key), nil)
+	return convertErr(ldb.db.Delete([]byte(key), nil))
 }
 
 // Size implements the `db.DB` interface.
@@ -81,7 +110,37 @@ func (ldb *levelDB) Size(prefix string) (int, error) {
 	for iter.Next() {
 		counter++
 	}
-	return counter, nil
+	return counter, convertErr(iter.Error())
+}
+
+// First implements the `db.Ordered` interface.
+func (ldb *levelDB) First(value interface{}) (string, error) {
+	iter := ldb.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	return ldb.decode(iter, iter.First(), value)
+}
+
+// Last implements the `db.Ordered` interface.
+func (ldb *levelDB) Last(value interface{}) (string, error) {
+	iter := ldb.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	return ldb.decode(iter, iter.Last(), value)
+}
+
+// decode the current key/value pair of the iterator, if it is valid.
+func (ldb *levelDB) decode(iter iterator.Iterator, valid bool, value interface{}) (string, error) {
+	if !valid {
+		if err := iter.Error(); err != nil {
+			return "", convertErr(err)
+		}
+		return "", db.ErrKeyNotFound
+	}
+	if err := ldb.codec.Decode(iter.Value(), value); err != nil {
+		return "", err
+	}
+	return string(iter.Key()), nil
 }
 
 // Iterator implements the `db.DB` interface.
@@ -94,19 +153,31 @@ func (ldb *levelDB) Iterator(prefix string) db.Iterator {
 	}
 }
 
+// CursorIterator implements the `DB` interface.
+func (ldb *levelDB) CursorIterator(prefix string) db.Iterator {
+	return &cursor{
+		db:     ldb.db,
+		prefix: []byte(prefix),
+		codec:  ldb.codec,
+	}
+}
+
 // iter implements the `db.Iterator` interface.
 type iter struct {
 	prefix []byte
 	iter   iterator.Iterator
 	codec  db.Codec
+	err    error
 }
 
 // Next implements the `db.Iterator` interface.
 func (iter *iter) Next() bool {
 	next := iter.iter.Next()
 
-	// Release the iter when it finishes iterating.
+	// Release the iter when it finishes iterating, keeping the error as it
+	// cannot be read after releasing.
 	if !next {
+		iter.err = convertErr(iter.iter.Error())
 		iter.iter.Release()
 	}
 	return next
@@ -130,16 +201,92 @@ func (iter *iter) Value(value interface{}) error {
 	return iter.codec.Decode(val, value)
 }
 
+// Err implements the `db.Iterator` interface.
+func (iter *iter) Err() error {
+	return iter.err
+}
+
 // Close implements the `db.Iterator` interface.
 func (iter *iter) Close() {
 	iter.iter.Release()
 }
 
+// cursor implements the `db.Iterator` interface by seeking from the previous
+// key on every call to Next.
+type cursor struct {
+	db     *leveldb.DB
+	prefix []byte
+	codec  db.Codec
+
+	// key and value are copies of the current key/value pair, because the
+	// iterator that read them is released straight away. The key is nil
+	// before the first call to Next and after the last.
+	key   []byte
+	value []byte
+	done  bool
+	err   error
+}
+
+// Next implements the `db.Iterator` interface.
+func (cursor *cursor) Next() bool {
+	if cursor.done {
+		return false
+	}
+
+	// The smallest key that is greater than the previous key is the previous
+	// key followed by a zero byte.
+	slice := util.BytesPrefix(cursor.prefix)
+	if cursor.key != nil {
+		slice.Start = append(append([]byte{}, cursor.key...), 0)
+	}
+	iter := cursor.db.NewIterator(slice, nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		cursor.err = convertErr(iter.Error())
+		cursor.done = true
+		cursor.key, cursor.value = nil, nil
+		return false
+	}
+	cursor.key = append([]byte{}, iter.Key()...)
+	cursor.value = append([]byte{}, iter.Value()...)
+	return true
+}
+
+// Key implements the `db.Iterator` interface.
+func (cursor *cursor) Key() (string, error) {
+	if cursor.key == nil {
+		return "", db.ErrIndexOutOfRange
+	}
+	return string(bytes.TrimPrefix(cursor.key, cursor.prefix)), nil
+}
+
+// Value implements the `db.Iterator` interface.
+func (cursor *cursor) Value(value interface{}) error {
+	if cursor.key == nil {
+		return db.ErrIndexOutOfRange
+	}
+	return cursor.codec.Decode(cursor.value, value)
+}
+
+// Err implements the `db.Iterator` interface.
+func (cursor *cursor) Err() error {
+	return cursor.err
+}
+
+// Close implements the `db.Iterator` interface.
+func (cursor *cursor) Close() {
+	cursor.done = true
+	cursor.key, cursor.value = nil, nil
+}
+
 // convertErr will convert levelDB-specific error to kv error.
 func convertErr(err error) error {
 	switch err {
 	case leveldb.ErrNotFound:
 		return db.ErrKeyNotFound
+	case leveldb.ErrClosed:
+		return db.ErrClosed
 	default:
 		return err
 	}
@@ -156,6 +156,137 @@ var _ = Describe("level DB implementation of the db", func() {
 			})
 		})
 
+		Context("when getting the first and last keys", func() {
+			It("should return the smallest and largest keys as they change", func() {
+				levelDB := New(".leveldb", codec)
+				defer levelDB.Close()
+				Expect(testutil.CheckFirstLast(levelDB.(testutil.OrderedDB))).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when iterating with a cursor while writing", func() {
+			It("should see the writes ahead of the cursor but not behind it", func() {
+				levelDB := New(".leveldb", codec)
+				defer levelDB.Close()
+
+				for _, i := range []int64{1, 3, 5} {
+					Expect(levelDB.Insert(fmt.Sprintf("key%v", i), i)).NotTo(HaveOccurred())
+				}
+				Expect(levelDB.Insert("other", int64(0))).NotTo(HaveOccurred())
+				snapshot := levelDB.Iterator("key")
+				defer snapshot.Close()
+				iter := levelDB.CursorIterator("key")
+				defer iter.Close()
+
+				Expect(iter.Next()).Should(BeTrue())
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("1"))
+
+				// Write behind the cursor, at the cursor, and ahead of it.
+				Expect(levelDB.Insert("key0", int64(0))).NotTo(HaveOccurred())
+				Expect(levelDB.Insert("key1", int64(10))).NotTo(HaveOccurred())
+				Expect(levelDB.Insert("key2", int64(2))).NotTo(HaveOccurred())
+				Expect(levelDB.Insert("key3", int64(30))).NotTo(HaveOccurred())
+				Expect(levelDB.Delete("key5")).NotTo(HaveOccurred())
+
+				keys := []string{}
+				values := []int64{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					keys = append(keys, key)
+					values = append(values, value)
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(keys).Should(Equal([]string{"2", "3"}))
+				Expect(values).Should(Equal([]int64{2, 30}))
+				_, err = iter.Key()
+				Expect(err).Should(Equal(db.ErrIndexOutOfRange))
+
+				// The snapshot iterator does not see any of the writes.
+				keys = []string{}
+				for snapshot.Next() {
+					key, err := snapshot.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys = append(keys, key)
+				}
+				Expect(keys).Should(Equal([]string{"1", "3", "5"}))
+
+				for _, key := range []string{"key0", "key1", "key2", "key3", "other"} {
+					Expect(levelDB.Delete(key)).NotTo(HaveOccurred())
+				}
+			})
+
+			It("should return every key exactly once while other keys are written concurrently", func() {
+				levelDB := New(".leveldb", codec)
+				defer levelDB.Close()
+
+				for i := 0; i < 100; i++ {
+					Expect(levelDB.Insert(fmt.Sprintf("key%03d", 2*i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					for i := 0; i < 100; i++ {
+						Expect(levelDB.Insert(fmt.Sprintf("key%03d", 2*i+1), int64(i))).NotTo(HaveOccurred())
+					}
+				}()
+
+				iter := levelDB.CursorIterator("key")
+				defer iter.Close()
+				seen := map[string]bool{}
+				previous := ""
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key > previous).Should(BeTrue())
+					seen[key] = true
+					previous = key
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				<-done
+
+				// Every key that existed before the iterator was created is
+				// returned.
+				for i := 0; i < 100; i++ {
+					Expect(seen[fmt.Sprintf("%03d", 2*i)]).Should(BeTrue())
+				}
+
+				all := levelDB.Iterator("")
+				defer all.Close()
+				for all.Next() {
+					key, err := all.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(levelDB.Delete(key)).NotTo(HaveOccurred())
+				}
+			})
+		})
+
+		Context("when using the db after closing it", func() {
+			It("should return ErrClosed", func() {
+				levelDB := New(".leveldb", codec)
+				Expect(levelDB.Insert("key", int64(1))).NotTo(HaveOccurred())
+				Expect(levelDB.Close()).NotTo(HaveOccurred())
+
+				var value int64
+				Expect(levelDB.Insert("key", int64(1))).Should(Equal(db.ErrClosed))
+				Expect(levelDB.Get("key", &value)).Should(Equal(db.ErrClosed))
+				Expect(levelDB.Delete("key")).Should(Equal(db.ErrClosed))
+				_, err := levelDB.Size("")
+				Expect(err).Should(Equal(db.ErrClosed))
+
+				iter := levelDB.Iterator("")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeFalse())
+				Expect(iter.Err()).Should(Equal(db.ErrClosed))
+			})
+		})
+
 		Context("when trying to create more than one db using the same path", func() {
 			It("should panic", func() {
 				levelDB := New(".leveldb", codec)
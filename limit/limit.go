@@ -0,0 +1,77 @@
+package limit
+
+import (
+	"fmt"
+
+	"github.com/renproject/kv/db"
+)
+
+// ErrValueTooLarge is returned when inserting a value that is larger than the
+// maximum number of bytes once encoded.
+type ErrValueTooLarge struct {
+	Size          int
+	MaxValueBytes int
+}
+
+// Error implements the `error` interface.
+func (err ErrValueTooLarge) Error() string {
+	return fmt.Sprintf("value too large: size = %v, max value bytes = %v", err.Size, err.MaxValueBytes)
+}
+
+type limitDB struct {
+	inner         db.DB
+	codec         db.Codec
+	maxValueBytes int
+}
+
+// Wrap returns a `db.DB` that rejects values which are larger than the given
+// number of bytes when encoded with the given codec. The size of values is
+// checked independently of the capacity of the inner `db.DB`.
+func Wrap(inner db.DB, codec db.Codec, maxValueBytes int) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	return &limitDB{
+		inner:         inner,
+		codec:         codec,
+		maxValueBytes: maxValueBytes,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (limitDB *limitDB) Close() error {
+	return limitDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface. It returns ErrValueTooLarge when
+// the encoded value is larger than the maximum number of bytes.
+func (limitDB *limitDB) Insert(key string, value interface{}) error {
+	data, err := limitDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	if len(data) > limitDB.maxValueBytes {
+		return ErrValueTooLarge{Size: len(data), MaxValueBytes: limitDB.maxValueBytes}
+	}
+	return limitDB.inner.Insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (limitDB *limitDB) Get(key string, value interface{}) error {
+	return limitDB.inner.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (limitDB *limitDB) Delete(key string) error {
+	return limitDB.inner.Delete(key)
+}
+
+// Size implements the `db.DB` interface.
+func (limitDB *limitDB) Size(prefix string) (int, error) {
+	return limitDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (limitDB *limitDB) Iterator(prefix string) db.Iterator {
+	return limitDB.inner.Iterator(prefix)
+}
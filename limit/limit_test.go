@@ -0,0 +1,64 @@
+package limit_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/limit"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+)
+
+var _ = Describe("value size limiting db", func() {
+	Context("when inserting values", func() {
+		It("should accept values below and at the limit", func() {
+			inner := memdb.New(codec.BinaryCodec)
+			database := Wrap(inner, codec.BinaryCodec, 8)
+
+			for i, size := range []int{0, 4, 8} {
+				key := string(rune('a' + i))
+				Expect(database.Insert(key, make([]byte, size))).NotTo(HaveOccurred())
+
+				value := []byte{}
+				Expect(inner.Get(key, &value)).NotTo(HaveOccurred())
+				Expect(value).Should(HaveLen(size))
+			}
+		})
+
+		It("should reject values above the limit", func() {
+			inner := memdb.New(codec.BinaryCodec)
+			database := Wrap(inner, codec.BinaryCodec, 8)
+
+			err := database.Insert("key", make([]byte, 9))
+			var errTooLarge ErrValueTooLarge
+			Expect(errors.As(err, &errTooLarge)).Should(BeTrue())
+			Expect(errTooLarge.Size).Should(Equal(9))
+			Expect(errTooLarge.MaxValueBytes).Should(Equal(8))
+
+			value := []byte{}
+			Expect(inner.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+
+		It("should not overwrite an existing value when rejecting", func() {
+			database := Wrap(memdb.New(codec.BinaryCodec), codec.BinaryCodec, 8)
+
+			Expect(database.Insert("key", []byte{1})).NotTo(HaveOccurred())
+			Expect(database.Insert("key", make([]byte, 16))).To(HaveOccurred())
+
+			value := []byte{}
+			Expect(database.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{1}))
+		})
+	})
+
+	Context("when initializing the db with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() {
+				Wrap(memdb.New(codec.BinaryCodec), nil, 8)
+			}).Should(Panic())
+		})
+	})
+})
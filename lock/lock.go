@@ -0,0 +1,112 @@
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+var (
+	// ErrLocked is returned when acquiring a lock that is held by someone else
+	// and has not expired.
+	ErrLocked = errors.New("locked")
+
+	// ErrNotOwner is returned when releasing a lock that has expired and has
+	// been acquired, or released, by someone else.
+	ErrNotOwner = errors.New("lock not owned")
+
+	// ErrCompareAndSwapNotSupported is returned when the db does not implement
+	// `db.CompareAndSwapper`.
+	ErrCompareAndSwapNotSupported = errors.New("db does not support compare and swap")
+)
+
+// A Lock is held from when it is acquired until it is released, or until it
+// expires.
+type Lock interface {
+
+	// Release the lock. If the lock has expired and has been acquired by
+	// someone else, then it is not released and ErrNotOwner is returned.
+	Release() error
+}
+
+type lock struct {
+	cas    db.CompareAndSwapper
+	name   string
+	record []byte
+}
+
+// Acquire the lock with the given name. The lock is stored in the db under the
+// name, and expires after the ttl so that it can be acquired by others even if
+// it is never released. If the lock is held by someone else and has not
+// expired, then ErrLocked is returned. The db must implement
+// `db.CompareAndSwapper`, and expiry is checked using the local clock.
+func Acquire(database db.DB, name string, ttl time.Duration) (Lock, error) {
+	cas, ok := database.(db.CompareAndSwapper)
+	if !ok {
+		return nil, ErrCompareAndSwapNotSupported
+	}
+
+	// The current record is nil if the lock does not exist, so that the swap
+	// only succeeds if the lock still does not exist.
+	var current interface{}
+	var data []byte
+	if err := database.Get(name, &data); err != nil {
+		if !errors.Is(err, db.ErrKeyNotFound) {
+			return nil, fmt.Errorf("error getting lock: %w", err)
+		}
+	} else {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("malformed lock: %v bytes", len(data))
+		}
+		expiry := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+		if time.Now().Before(expiry) {
+			return nil, ErrLocked
+		}
+		current = data
+	}
+
+	record, err := newRecord(time.Now().Add(ttl))
+	if err != nil {
+		return nil, err
+	}
+	swapped, err := cas.CompareAndSwap(name, current, record)
+	if err != nil {
+		return nil, fmt.Errorf("error acquiring lock: %w", err)
+	}
+	if !swapped {
+		return nil, ErrLocked
+	}
+	return &lock{
+		cas:    cas,
+		name:   name,
+		record: record,
+	}, nil
+}
+
+// Release implements the `Lock` interface.
+func (lock *lock) Release() error {
+	swapped, err := lock.cas.CompareAndSwap(lock.name, lock.record, nil)
+	if err != nil {
+		return fmt.Errorf("error releasing lock: %w", err)
+	}
+	if !swapped {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// newRecord returns the value stored for a lock that expires at the given
+// time. It is the expiry as big-endian unix nanoseconds, followed by a random
+// token that identifies the owner of the lock.
+func newRecord(expiry time.Time) ([]byte, error) {
+	record := make([]byte, 8+16)
+	binary.BigEndian.PutUint64(record, uint64(expiry.UnixNano()))
+	if _, err := rand.Read(record[8:]); err != nil {
+		return nil, fmt.Errorf("error generating token: %w", err)
+	}
+	return record, nil
+}
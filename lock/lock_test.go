@@ -0,0 +1,89 @@
+package lock_test
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/lock"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/nulldb"
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+var _ = Describe("lock", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newDBs := []func() db.DB{
+			func() db.DB { return memdb.New(codec) },
+			func() db.DB { return rrdb.New(codec, 100) },
+		}
+		for j := range newDBs {
+			newDB := newDBs[j]
+
+			Context("when acquiring a lock concurrently", func() {
+				It("should only let one caller acquire it", func() {
+					database := newDB()
+
+					var winners int64
+					phi.ParForAll(16, func(i int) {
+						_, err := Acquire(database, "lock", time.Hour)
+						if err == ErrLocked {
+							return
+						}
+						Expect(err).NotTo(HaveOccurred())
+						atomic.AddInt64(&winners, 1)
+					})
+					Expect(winners).Should(Equal(int64(1)))
+				})
+			})
+
+			Context("when releasing a lock", func() {
+				It("should let others acquire it", func() {
+					database := newDB()
+
+					lock, err := Acquire(database, "lock", time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = Acquire(database, "lock", time.Hour)
+					Expect(err).Should(Equal(ErrLocked))
+
+					Expect(lock.Release()).NotTo(HaveOccurred())
+					Expect(lock.Release()).Should(Equal(ErrNotOwner))
+					_, err = Acquire(database, "lock", time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when a lock expires", func() {
+				It("should let others acquire it and stop the holder from releasing it", func() {
+					database := newDB()
+
+					crashed, err := Acquire(database, "lock", 20*time.Millisecond)
+					Expect(err).NotTo(HaveOccurred())
+
+					time.Sleep(30 * time.Millisecond)
+					lock, err := Acquire(database, "lock", time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(crashed.Release()).Should(Equal(ErrNotOwner))
+					_, err = Acquire(database, "lock", time.Hour)
+					Expect(err).Should(Equal(ErrLocked))
+					Expect(lock.Release()).NotTo(HaveOccurred())
+				})
+			})
+		}
+	}
+
+	Context("when the db does not support compare and swap", func() {
+		It("should return an error", func() {
+			_, err := Acquire(nulldb.New(), "lock", time.Hour)
+			Expect(err).Should(Equal(ErrCompareAndSwapNotSupported))
+		})
+	})
+})
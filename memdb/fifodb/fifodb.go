@@ -0,0 +1,171 @@
+package fifodb
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// An Option configures a fifodb when it is created.
+type Option func(*fifodb)
+
+// ResetOnInsert makes inserting an existing key move it to the back of the
+// queue, as if it had been deleted and inserted again. By default, inserting
+// an existing key updates its value but keeps its position in the queue.
+func ResetOnInsert() Option {
+	return func(fifodb *fifodb) {
+		fifodb.resetOnInsert = true
+	}
+}
+
+// fifodb is a in-memory implementation of the `db.DB` that evicts key/value
+// pairs in the order in which they were inserted.
+type fifodb struct {
+	mu    *sync.RWMutex
+	data  map[string][]byte
+	codec db.Codec
+
+	// queue of the keys in the order in which they were inserted, and the
+	// element of each key in the queue.
+	queue *list.List
+	elems map[string]*list.Element
+
+	cap           int
+	resetOnInsert bool
+}
+
+// New returns a new `db.DB` that can store at most `cap` key/value pairs. When
+// inserting into a full DB, the key/value pair that was inserted first is
+// evicted, regardless of how recently it has been read. Iterators yield the
+// key/value pairs in the order in which they will be evicted.
+func New(codec db.Codec, cap int, opts ...Option) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	if cap <= 0 {
+		panic(fmt.Sprintf("cap must be positive, got %v", cap))
+	}
+	fifodb := &fifodb{
+		mu:    new(sync.RWMutex),
+		data:  map[string][]byte{},
+		codec: codec,
+		queue: list.New(),
+		elems: map[string]*list.Element{},
+		cap:   cap,
+	}
+	for _, opt := range opts {
+		opt(fifodb)
+	}
+	return fifodb
+}
+
+// Close implements the `db.DB` interface.
+func (fifodb *fifodb) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface.
+func (fifodb *fifodb) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := fifodb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	fifodb.mu.Lock()
+	defer fifodb.mu.Unlock()
+
+	if elem, ok := fifodb.elems[key]; ok {
+		fifodb.data[key] = data
+		if fifodb.resetOnInsert {
+			fifodb.queue.MoveToBack(elem)
+		}
+		return nil
+	}
+	if len(fifodb.data) >= fifodb.cap {
+		fifodb.remove(fifodb.queue.Front().Value.(string))
+	}
+	fifodb.data[key] = data
+	fifodb.elems[key] = fifodb.queue.PushBack(key)
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (fifodb *fifodb) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	fifodb.mu.RLock()
+	defer fifodb.mu.RUnlock()
+
+	data, ok := fifodb.data[key]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	return fifodb.codec.Decode(data, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (fifodb *fifodb) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	fifodb.mu.Lock()
+	defer fifodb.mu.Unlock()
+
+	fifodb.remove(key)
+	return nil
+}
+
+// Size implements the `db.DB` interface.
+func (fifodb *fifodb) Size(prefix string) (int, error) {
+	fifodb.mu.RLock()
+	defer fifodb.mu.RUnlock()
+
+	counter := 0
+	for key := range fifodb.data {
+		if strings.HasPrefix(key, prefix) {
+			counter++
+		}
+	}
+	return counter, nil
+}
+
+// Cap implements the `db.Capacitor` interface.
+func (fifodb *fifodb) Cap() int {
+	return fifodb.cap
+}
+
+// Iterator implements the `db.DB` interface. It iterates from the key/value
+// pair that will be evicted first to the one that will be evicted last.
+func (fifodb *fifodb) Iterator(prefix string) db.Iterator {
+	fifodb.mu.RLock()
+	defer fifodb.mu.RUnlock()
+
+	keys := make([]string, 0, len(fifodb.data))
+	values := make([][]byte, 0, len(fifodb.data))
+	for elem := fifodb.queue.Front(); elem != nil; elem = elem.Next() {
+		if key := elem.Value.(string); strings.HasPrefix(key, prefix) {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+			values = append(values, fifodb.data[key])
+		}
+	}
+	return db.SliceIterator(fifodb.codec, keys, values)
+}
+
+// remove the key from the data and the queue. The caller must hold the write
+// lock.
+func (fifodb *fifodb) remove(key string) {
+	if elem, ok := fifodb.elems[key]; ok {
+		fifodb.queue.Remove(elem)
+		delete(fifodb.elems, key)
+		delete(fifodb.data, key)
+	}
+}
@@ -0,0 +1,13 @@
+package fifodb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFifodb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fifodb Suite")
+}
@@ -0,0 +1,153 @@
+package fifodb_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/memdb/fifodb"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("in-memory fifo implementation of the db", func() {
+	keys := func(fifodb db.DB) []string {
+		iter := fifodb.Iterator("")
+		defer iter.Close()
+
+		keys := []string{}
+		for iter.Next() {
+			key, err := iter.Key()
+			Expect(err).NotTo(HaveOccurred())
+			keys = append(keys, key)
+		}
+		Expect(iter.Err()).NotTo(HaveOccurred())
+		return keys
+	}
+
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when doing operations on a fifo db", func() {
+			It("should be able to do read, write and delete", func() {
+				fifodb := New(codec, 100)
+				defer fifodb.Close()
+
+				test := func(key string, value testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+
+					val := testutil.TestStruct{D: []byte{}}
+					Expect(fifodb.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					Expect(fifodb.Insert(key, value)).NotTo(HaveOccurred())
+					Expect(fifodb.Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+					Expect(fifodb.Delete(key)).NotTo(HaveOccurred())
+					Expect(fifodb.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+
+			It("should return ErrEmptyKey when doing operations with empty keys", func() {
+				fifodb := New(codec, 100)
+				value := testutil.RandomTestStruct()
+				Expect(fifodb.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+				Expect(fifodb.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(fifodb.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+	}
+
+	Context("when the db is full", func() {
+		It("should evict in strict insertion order and stay bounded", func() {
+			fifodb := New(codec.BinaryCodec, 10)
+			for i := 0; i < 100; i++ {
+				Expect(fifodb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+
+				// Reading the oldest key should not protect it.
+				oldest := i - 9
+				if oldest < 0 {
+					oldest = 0
+				}
+				var value []byte
+				Expect(fifodb.Get(fmt.Sprintf("%v", oldest), &value)).NotTo(HaveOccurred())
+
+				size, err := fifodb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				if i < 10 {
+					Expect(size).Should(Equal(i + 1))
+				} else {
+					Expect(size).Should(Equal(10))
+					Expect(fifodb.Get(fmt.Sprintf("%v", i-10), &value)).Should(Equal(db.ErrKeyNotFound))
+				}
+			}
+			Expect(keys(fifodb)).Should(Equal([]string{"90", "91", "92", "93", "94", "95", "96", "97", "98", "99"}))
+		})
+
+		It("should not evict deleted keys", func() {
+			fifodb := New(codec.BinaryCodec, 3)
+			for _, key := range []string{"a", "b", "c"} {
+				Expect(fifodb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+			Expect(fifodb.Delete("b")).NotTo(HaveOccurred())
+			Expect(fifodb.Insert("d", []byte("d"))).NotTo(HaveOccurred())
+			Expect(keys(fifodb)).Should(Equal([]string{"a", "c", "d"}))
+			Expect(fifodb.Insert("e", []byte("e"))).NotTo(HaveOccurred())
+			Expect(keys(fifodb)).Should(Equal([]string{"c", "d", "e"}))
+		})
+	})
+
+	Context("when inserting an existing key", func() {
+		It("should keep its position by default", func() {
+			fifodb := New(codec.BinaryCodec, 3)
+			for _, key := range []string{"a", "b", "c"} {
+				Expect(fifodb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+			Expect(fifodb.Insert("a", []byte("A"))).NotTo(HaveOccurred())
+			Expect(keys(fifodb)).Should(Equal([]string{"a", "b", "c"}))
+
+			var value []byte
+			Expect(fifodb.Get("a", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte("A")))
+			Expect(fifodb.Insert("d", []byte("d"))).NotTo(HaveOccurred())
+			Expect(fifodb.Get("a", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+
+		It("should move it to the back if configured to", func() {
+			fifodb := New(codec.BinaryCodec, 3, ResetOnInsert())
+			for _, key := range []string{"a", "b", "c"} {
+				Expect(fifodb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+			Expect(fifodb.Insert("a", []byte("A"))).NotTo(HaveOccurred())
+			Expect(keys(fifodb)).Should(Equal([]string{"b", "c", "a"}))
+
+			Expect(fifodb.Insert("d", []byte("d"))).NotTo(HaveOccurred())
+			var value []byte
+			Expect(fifodb.Get("a", &value)).NotTo(HaveOccurred())
+			Expect(fifodb.Get("b", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when reporting the capacity", func() {
+		It("should return the cap that it was created with", func() {
+			fifodb := New(codec.BinaryCodec, 10)
+			capacitor, ok := fifodb.(db.Capacitor)
+			Expect(ok).Should(BeTrue())
+			Expect(capacitor.Cap()).Should(Equal(10))
+		})
+	})
+
+	Context("when initializing the db", func() {
+		It("should panic with a nil codec or a non-positive cap", func() {
+			Expect(func() { New(nil, 10) }).Should(Panic())
+			Expect(func() { New(codec.BinaryCodec, 0) }).Should(Panic())
+		})
+	})
+})
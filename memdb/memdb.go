@@ -1,6 +1,7 @@
 package memdb
 
 import (
+	"bytes"
 	"strings"
 	"sync"
 
@@ -55,6 +56,22 @@ func (memdb *memdb) Insert(key string, value interface{}) error {
 	return nil
 }
 
+// Prewarm implements the `db.Prewarmer` interface.
+func (memdb *memdb) Prewarm(expectedEntries int) {
+	if expectedEntries <= 0 {
+		return
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	data := make(map[string][]byte, len(memdb.data)+expectedEntries)
+	for key, value := range memdb.data {
+		data[key] = value
+	}
+	memdb.data = data
+}
+
 // Get implements the `db.DB` interface.
 func (memdb *memdb) Get(key string, value interface{}) error {
 	if key == "" {
@@ -84,6 +101,198 @@ func (memdb *memdb) Delete(key string) error {
 	return nil
 }
 
+// GetAndDelete implements the `db.GetAndDeleter` interface.
+func (memdb *memdb) GetAndDelete(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	data, ok := memdb.data[key]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	if err := memdb.codec.Decode(data, value); err != nil {
+		return err
+	}
+	delete(memdb.data, key)
+	return nil
+}
+
+// CompareAndSwap implements the `db.CompareAndSwapper` interface.
+func (memdb *memdb) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	data, ok := memdb.data[key]
+	if old == nil {
+		if ok {
+			return false, nil
+		}
+	} else {
+		oldData, err := memdb.codec.Encode(old)
+		if err != nil {
+			return false, err
+		}
+		if !ok || !bytes.Equal(data, oldData) {
+			return false, nil
+		}
+	}
+
+	if new == nil {
+		delete(memdb.data, key)
+		return true, nil
+	}
+	newData, err := memdb.codec.Encode(new)
+	if err != nil {
+		return false, err
+	}
+	memdb.data[key] = newData
+	return true, nil
+}
+
+// Swap implements the `db.Swapper` interface.
+func (memdb *memdb) Swap(key string, value, old interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := memdb.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	oldData, ok := memdb.data[key]
+	if ok {
+		if err := memdb.codec.Decode(oldData, old); err != nil {
+			return false, err
+		}
+	}
+	memdb.data[key] = data
+	return ok, nil
+}
+
+// DeleteIf implements the `db.ConditionalDeleter` interface.
+func (memdb *memdb) DeleteIf(key string, expected interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	expectedData, err := memdb.codec.Encode(expected)
+	if err != nil {
+		return false, err
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	data, ok := memdb.data[key]
+	if !ok || !bytes.Equal(data, expectedData) {
+		return false, nil
+	}
+	delete(memdb.data, key)
+	return true, nil
+}
+
+// HasBatch implements the `db.BatchChecker` interface. All of the keys are
+// checked under a single read lock.
+func (memdb *memdb) HasBatch(keys []string) ([]bool, error) {
+	for _, key := range keys {
+		if key == "" {
+			return nil, db.ErrEmptyKey
+		}
+	}
+
+	memdb.dataMu.RLock()
+	defer memdb.dataMu.RUnlock()
+
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		_, found[i] = memdb.data[key]
+	}
+	return found, nil
+}
+
+// Rename implements the `db.Renamer` interface.
+func (memdb *memdb) Rename(oldKey, newKey string) error {
+	return memdb.rename(oldKey, newKey, true)
+}
+
+// RenameNX implements the `db.Renamer` interface.
+func (memdb *memdb) RenameNX(oldKey, newKey string) error {
+	return memdb.rename(oldKey, newKey, false)
+}
+
+// rename the old key to the new key, replacing the new key only if allowed.
+func (memdb *memdb) rename(oldKey, newKey string, replace bool) error {
+	if oldKey == "" || newKey == "" {
+		return db.ErrEmptyKey
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	data, ok := memdb.data[oldKey]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	if _, ok := memdb.data[newKey]; ok && !replace {
+		return db.ErrKeyExists
+	}
+	delete(memdb.data, oldKey)
+	memdb.data[newKey] = data
+	return nil
+}
+
+// Merge implements the `db.Merger` interface.
+func (memdb *memdb) Merge(key string, value interface{}, mergeFn func(found bool) (interface{}, error)) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	data, ok := memdb.data[key]
+	if ok {
+		if err := memdb.codec.Decode(data, value); err != nil {
+			return err
+		}
+	}
+	merged, err := mergeFn(ok)
+	if err != nil {
+		return err
+	}
+	mergedData, err := memdb.codec.Encode(merged)
+	if err != nil {
+		return err
+	}
+	memdb.data[key] = mergedData
+	return nil
+}
+
+// DeleteRange implements the `db.RangeDeleter` interface.
+func (memdb *memdb) DeleteRange(start, end string) (int, error) {
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	n := 0
+	for key := range memdb.data {
+		if start <= key && key < end {
+			delete(memdb.data, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
 // Size implements the `db.DB` interface.
 func (memdb *memdb) Size(prefix string) (int, error) {
 	memdb.dataMu.RLock()
@@ -103,54 +312,14 @@ func (memdb *memdb) Iterator(prefix string) db.Iterator {
 	memdb.dataMu.RLock()
 	defer memdb.dataMu.RUnlock()
 
-	iter := &iterator{
-		index:  -1,
-		codec:  memdb.codec,
-		keys:   make([]string, 0, len(memdb.data)),
-		values: make([][]byte, 0, len(memdb.data)),
-	}
+	keys := make([]string, 0, len(memdb.data))
+	values := make([][]byte, 0, len(memdb.data))
 	for key, value := range memdb.data {
 		if strings.HasPrefix(key, prefix) {
-			iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
-			iter.values = append(iter.values, value)
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+			values = append(values, value)
 		}
 	}
 
-	return iter
-}
-
-// iterator is a in-memory implementation of the `db.Iterator`.
-type iterator struct {
-	index int
-	codec db.Codec
-
-	keys   []string
-	values [][]byte
-}
-
-// Next implements the `db.Iterator` interface.
-func (iter *iterator) Next() bool {
-	iter.index++
-	return iter.index < len(iter.keys)
+	return db.SliceIterator(memdb.codec, keys, values)
 }
-
-// Key implements the `db.Iterator` interface.
-func (iter *iterator) Key() (string, error) {
-	if iter.index == -1 || iter.index >= len(iter.keys) {
-		return "", db.ErrIndexOutOfRange
-	}
-
-	return iter.keys[iter.index], nil
-}
-
-// Value implements the `db.Iterator` interface.
-func (iter *iterator) Value(value interface{}) error {
-	if iter.index == -1 || iter.index >= len(iter.keys) {
-		return db.ErrIndexOutOfRange
-	}
-	data := iter.values[iter.index]
-	return iter.codec.Decode(data, value)
-}
-
-// Close implements the `db.Iterator` interface.
-func (iter *iterator) Close() {}
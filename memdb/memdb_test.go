@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync/atomic"
 	"testing/quick"
 
 	. "github.com/onsi/ginkgo"
@@ -138,6 +140,223 @@ var _ = Describe("im-memory implementation of the db", func() {
 			})
 		})
 
+		Context("when getting and deleting concurrently", func() {
+			It("should only let one caller get each value", func() {
+				memdb := New(codec)
+
+				numKeys := 100
+				for i := 0; i < numKeys; i++ {
+					Expect(memdb.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				claims := make([]int64, numKeys)
+				phi.ParForAll(8, func(worker int) {
+					for i := 0; i < numKeys; i++ {
+						var value int64
+						err := memdb.(db.GetAndDeleter).GetAndDelete(fmt.Sprintf("%v", i), &value)
+						if err == db.ErrKeyNotFound {
+							continue
+						}
+						Expect(err).NotTo(HaveOccurred())
+						Expect(value).Should(Equal(int64(i)))
+						atomic.AddInt64(&claims[i], 1)
+					}
+				})
+				for i := range claims {
+					Expect(claims[i]).Should(Equal(int64(1)))
+				}
+			})
+		})
+
+		Context("when comparing and swapping", func() {
+			It("should only swap values that are as expected", func() {
+				memdb := New(codec)
+				cas := memdb.(db.CompareAndSwapper)
+
+				swapped, err := cas.CompareAndSwap("key", nil, int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+				swapped, err = cas.CompareAndSwap("key", nil, int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeFalse())
+
+				swapped, err = cas.CompareAndSwap("key", int64(2), int64(3))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeFalse())
+				swapped, err = cas.CompareAndSwap("key", int64(1), int64(2))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+
+				var value int64
+				Expect(memdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+
+				swapped, err = cas.CompareAndSwap("key", int64(2), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+				Expect(memdb.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should apply concurrent swaps one at a time", func() {
+				memdb := New(codec)
+				cas := memdb.(db.CompareAndSwapper)
+				Expect(memdb.Insert("counter", int64(0))).NotTo(HaveOccurred())
+
+				numWorkers, numIncrements := 8, 50
+				phi.ParForAll(numWorkers, func(worker int) {
+					for i := 0; i < numIncrements; i++ {
+						for {
+							var value int64
+							Expect(memdb.Get("counter", &value)).NotTo(HaveOccurred())
+							swapped, err := cas.CompareAndSwap("counter", value, value+1)
+							Expect(err).NotTo(HaveOccurred())
+							if swapped {
+								break
+							}
+						}
+					}
+				})
+
+				var value int64
+				Expect(memdb.Get("counter", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(numWorkers * numIncrements)))
+			})
+		})
+
+		Context("when swapping", func() {
+			It("should return the value that it replaces", func() {
+				memdb := New(codec)
+				swapper := memdb.(db.Swapper)
+
+				old := int64(-1)
+				existed, err := swapper.Swap("key", int64(1), &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeFalse())
+				Expect(old).Should(Equal(int64(-1)))
+
+				existed, err = swapper.Swap("key", int64(2), &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeTrue())
+				Expect(old).Should(Equal(int64(1)))
+
+				var value int64
+				Expect(memdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+			})
+
+			It("should return each replaced value to one caller when swapping concurrently", func() {
+				memdb := New(codec)
+				Expect(testutil.RaceSwap(memdb.(testutil.SwapDB), 100)).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when deleting if unchanged", func() {
+			It("should only delete values that are as expected", func() {
+				memdb := New(codec)
+				deleter := memdb.(db.ConditionalDeleter)
+
+				deleted, err := deleter.DeleteIf("key", int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeFalse())
+
+				Expect(memdb.Insert("key", int64(1))).NotTo(HaveOccurred())
+				deleted, err = deleter.DeleteIf("key", int64(2))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeFalse())
+				deleted, err = deleter.DeleteIf("key", int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeTrue())
+
+				var value int64
+				Expect(memdb.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should not delete a value that is updated while it is deleted", func() {
+				memdb := New(codec)
+				Expect(testutil.RaceDeleteIf(memdb.(testutil.ConditionalDeleteDB), 1000)).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when renaming", func() {
+			It("should move the value and replace an existing key", func() {
+				memdb := New(codec)
+				renamer := memdb.(db.Renamer)
+				Expect(memdb.Insert("staging", int64(1))).NotTo(HaveOccurred())
+				Expect(memdb.Insert("live", int64(2))).NotTo(HaveOccurred())
+
+				Expect(renamer.Rename("staging", "live")).NotTo(HaveOccurred())
+				var value int64
+				Expect(memdb.Get("staging", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(memdb.Get("live", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(1)))
+				size, err := memdb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+			})
+
+			It("should fail to rename a missing key, or onto an existing key without replacing", func() {
+				memdb := New(codec)
+				renamer := memdb.(db.Renamer)
+				Expect(renamer.Rename("missing", "live")).Should(Equal(db.ErrKeyNotFound))
+				Expect(renamer.RenameNX("missing", "live")).Should(Equal(db.ErrKeyNotFound))
+
+				Expect(memdb.Insert("staging", int64(1))).NotTo(HaveOccurred())
+				Expect(memdb.Insert("live", int64(2))).NotTo(HaveOccurred())
+				Expect(renamer.RenameNX("staging", "live")).Should(Equal(db.ErrKeyExists))
+				var value int64
+				Expect(memdb.Get("live", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+
+				Expect(memdb.Delete("live")).NotTo(HaveOccurred())
+				Expect(renamer.RenameNX("staging", "live")).NotTo(HaveOccurred())
+				Expect(memdb.Get("live", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(1)))
+				Expect(renamer.Rename("", "live")).Should(Equal(db.ErrEmptyKey))
+				Expect(renamer.Rename("live", "")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when merging", func() {
+			It("should not lose concurrent merges", func() {
+				memdb := New(codec)
+				merger := memdb.(db.Merger)
+
+				numMerges := 100
+				phi.ParForAll(numMerges, func(i int) {
+					var value []byte
+					Expect(merger.Merge("key", &value, func(found bool) (interface{}, error) {
+						Expect(found).Should(Equal(value != nil))
+						return append(value, byte(i)), nil
+					})).NotTo(HaveOccurred())
+				})
+
+				var value []byte
+				Expect(memdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(HaveLen(numMerges))
+				sort.Slice(value, func(i, j int) bool { return value[i] < value[j] })
+				for i := range value {
+					Expect(value[i]).Should(Equal(byte(i)))
+				}
+			})
+
+			It("should not write when the merge function fails", func() {
+				memdb := New(codec)
+				merger := memdb.(db.Merger)
+				Expect(memdb.Insert("key", []byte{1})).NotTo(HaveOccurred())
+
+				errMerge := errors.New("merge failure")
+				var value []byte
+				Expect(merger.Merge("key", &value, func(found bool) (interface{}, error) {
+					Expect(found).Should(BeTrue())
+					Expect(value).Should(Equal([]byte{1}))
+					return nil, errMerge
+				})).Should(Equal(errMerge))
+
+				Expect(memdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal([]byte{1}))
+			})
+		})
+
 		Context("when operating with empty key", func() {
 			It("should return ErrEmptyKey error", func() {
 				memdb := New(codec)
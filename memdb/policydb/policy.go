@@ -0,0 +1,135 @@
+package policydb
+
+import (
+	"container/list"
+	"math/rand"
+)
+
+// An EvictionPolicy decides which key to evict from a full policydb. The
+// policydb tells the policy about every key that is inserted, read, or deleted,
+// and asks it for a key to evict when it is full. Policies do not need to be
+// safe for concurrent use, because the policydb calls them while holding its
+// lock.
+type EvictionPolicy interface {
+	// RecordInsert is called when a key is inserted, including when the value
+	// of an existing key is updated.
+	RecordInsert(key string)
+
+	// RecordAccess is called when the value of a key is read.
+	RecordAccess(key string)
+
+	// RecordDelete is called when a key is deleted, so that the policy can
+	// forget it. It is not called for keys that have been returned by Evict.
+	RecordDelete(key string)
+
+	// Evict returns the key that should be evicted and forgets it, or false if
+	// the policy does not know about any keys.
+	Evict() (string, bool)
+}
+
+// randomPolicy evicts keys uniformly at random.
+type randomPolicy struct {
+	keys    []string
+	indices map[string]int
+}
+
+// NewRandomPolicy returns an `EvictionPolicy` that evicts keys uniformly at
+// random, regardless of how recently they have been inserted or read.
+func NewRandomPolicy() EvictionPolicy {
+	return &randomPolicy{
+		keys:    []string{},
+		indices: map[string]int{},
+	}
+}
+
+// RecordInsert implements the `EvictionPolicy` interface.
+func (policy *randomPolicy) RecordInsert(key string) {
+	if _, ok := policy.indices[key]; ok {
+		return
+	}
+	policy.indices[key] = len(policy.keys)
+	policy.keys = append(policy.keys, key)
+}
+
+// RecordAccess implements the `EvictionPolicy` interface. Reads do not affect
+// which key is evicted.
+func (policy *randomPolicy) RecordAccess(key string) {}
+
+// RecordDelete implements the `EvictionPolicy` interface.
+func (policy *randomPolicy) RecordDelete(key string) {
+	index, ok := policy.indices[key]
+	if !ok {
+		return
+	}
+
+	// Move the last key into the place of the deleted one, so that the keys
+	// stay packed.
+	last := policy.keys[len(policy.keys)-1]
+	policy.keys[index] = last
+	policy.indices[last] = index
+	policy.keys = policy.keys[:len(policy.keys)-1]
+	delete(policy.indices, key)
+}
+
+// Evict implements the `EvictionPolicy` interface.
+func (policy *randomPolicy) Evict() (string, bool) {
+	if len(policy.keys) == 0 {
+		return "", false
+	}
+	key := policy.keys[rand.Intn(len(policy.keys))]
+	policy.RecordDelete(key)
+	return key, true
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	// queue of the keys from the least to the most recently used, and the
+	// element of each key in the queue.
+	queue *list.List
+	elems map[string]*list.Element
+}
+
+// NewLRUPolicy returns an `EvictionPolicy` that evicts the key that has been
+// least recently inserted or read.
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{
+		queue: list.New(),
+		elems: map[string]*list.Element{},
+	}
+}
+
+// RecordInsert implements the `EvictionPolicy` interface.
+func (policy *lruPolicy) RecordInsert(key string) {
+	if elem, ok := policy.elems[key]; ok {
+		policy.queue.MoveToBack(elem)
+		return
+	}
+	policy.elems[key] = policy.queue.PushBack(key)
+}
+
+// RecordAccess implements the `EvictionPolicy` interface.
+func (policy *lruPolicy) RecordAccess(key string) {
+	if elem, ok := policy.elems[key]; ok {
+		policy.queue.MoveToBack(elem)
+	}
+}
+
+// RecordDelete implements the `EvictionPolicy` interface.
+func (policy *lruPolicy) RecordDelete(key string) {
+	if elem, ok := policy.elems[key]; ok {
+		policy.queue.Remove(elem)
+		delete(policy.elems, key)
+	}
+}
+
+// Evict implements the `EvictionPolicy` interface.
+func (policy *lruPolicy) Evict() (string, bool) {
+	elem := policy.queue.Front()
+	if elem == nil {
+		return "", false
+	}
+	key := elem.Value.(string)
+	policy.queue.Remove(elem)
+	delete(policy.elems, key)
+	return key, true
+}
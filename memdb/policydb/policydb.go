@@ -0,0 +1,143 @@
+package policydb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// policydb is a in-memory implementation of the `db.DB` that delegates the
+// choice of which key/value pair to evict to an `EvictionPolicy`.
+type policydb struct {
+	mu     *sync.Mutex
+	data   map[string][]byte
+	codec  db.Codec
+	policy EvictionPolicy
+
+	cap int
+}
+
+// New returns a new `db.DB` that can store at most `cap` key/value pairs. When
+// inserting a new key into a full DB, the policy chooses which key/value pair
+// is evicted. The policy must not be shared with another DB.
+func New(codec db.Codec, cap int, policy EvictionPolicy) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	if cap <= 0 {
+		panic(fmt.Sprintf("cap must be positive, got %v", cap))
+	}
+	if policy == nil {
+		panic("policy cannot be nil")
+	}
+	return &policydb{
+		mu:     new(sync.Mutex),
+		data:   map[string][]byte{},
+		codec:  codec,
+		policy: policy,
+		cap:    cap,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (policydb *policydb) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface.
+func (policydb *policydb) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := policydb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	policydb.mu.Lock()
+	defer policydb.mu.Unlock()
+
+	if _, ok := policydb.data[key]; !ok {
+		for len(policydb.data) >= policydb.cap {
+			evicted, ok := policydb.policy.Evict()
+			if !ok {
+				break
+			}
+			delete(policydb.data, evicted)
+		}
+	}
+	policydb.data[key] = data
+	policydb.policy.RecordInsert(key)
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (policydb *policydb) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	policydb.mu.Lock()
+	defer policydb.mu.Unlock()
+
+	data, ok := policydb.data[key]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	policydb.policy.RecordAccess(key)
+	return policydb.codec.Decode(data, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (policydb *policydb) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	policydb.mu.Lock()
+	defer policydb.mu.Unlock()
+
+	if _, ok := policydb.data[key]; ok {
+		delete(policydb.data, key)
+		policydb.policy.RecordDelete(key)
+	}
+	return nil
+}
+
+// Size implements the `db.DB` interface.
+func (policydb *policydb) Size(prefix string) (int, error) {
+	policydb.mu.Lock()
+	defer policydb.mu.Unlock()
+
+	counter := 0
+	for key := range policydb.data {
+		if strings.HasPrefix(key, prefix) {
+			counter++
+		}
+	}
+	return counter, nil
+}
+
+// Cap implements the `db.Capacitor` interface.
+func (policydb *policydb) Cap() int {
+	return policydb.cap
+}
+
+// Iterator implements the `db.DB` interface. Iterating does not count as
+// reading the key/value pairs, so it does not affect which key is evicted.
+func (policydb *policydb) Iterator(prefix string) db.Iterator {
+	policydb.mu.Lock()
+	defer policydb.mu.Unlock()
+
+	keys := make([]string, 0, len(policydb.data))
+	values := make([][]byte, 0, len(policydb.data))
+	for key, data := range policydb.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+			values = append(values, data)
+		}
+	}
+	return db.SliceIterator(policydb.codec, keys, values)
+}
@@ -0,0 +1,13 @@
+package policydb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPolicydb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Policydb Suite")
+}
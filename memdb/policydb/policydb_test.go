@@ -0,0 +1,193 @@
+package policydb_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/memdb/policydb"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("in-memory implementation of the db with a pluggable eviction policy", func() {
+	keys := func(policydb db.DB) []string {
+		iter := policydb.Iterator("")
+		defer iter.Close()
+
+		keys := []string{}
+		for iter.Next() {
+			key, err := iter.Key()
+			Expect(err).NotTo(HaveOccurred())
+			keys = append(keys, key)
+		}
+		Expect(iter.Err()).NotTo(HaveOccurred())
+		sort.Strings(keys)
+		return keys
+	}
+
+	policies := []struct {
+		name      string
+		newPolicy func() EvictionPolicy
+	}{
+		{"random", NewRandomPolicy},
+		{"lru", NewLRUPolicy},
+	}
+
+	for i := range policies {
+		policy := policies[i]
+
+		for j := range testutil.Codecs {
+			codec := testutil.Codecs[j]
+
+			Context(fmt.Sprintf("when doing operations on a db with the %v policy", policy.name), func() {
+				It("should be able to do read, write and delete", func() {
+					policydb := New(codec, 100, policy.newPolicy())
+					defer policydb.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+
+						val := testutil.TestStruct{D: []byte{}}
+						Expect(policydb.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+						Expect(policydb.Insert(key, value)).NotTo(HaveOccurred())
+						Expect(policydb.Get(key, &val)).NotTo(HaveOccurred())
+						Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+						Expect(policydb.Delete(key)).NotTo(HaveOccurred())
+						Expect(policydb.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+						return true
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+
+				It("should return ErrEmptyKey when doing operations with empty keys", func() {
+					policydb := New(codec, 100, policy.newPolicy())
+					value := testutil.RandomTestStruct()
+					Expect(policydb.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+					Expect(policydb.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+					Expect(policydb.Delete("")).Should(Equal(db.ErrEmptyKey))
+				})
+			})
+		}
+
+		Context(fmt.Sprintf("when a db with the %v policy is full", policy.name), func() {
+			It("should stay bounded and keep the most recent insert", func() {
+				policydb := New(codec.BinaryCodec, 10, policy.newPolicy())
+				for i := 0; i < 100; i++ {
+					key := fmt.Sprintf("%v", i)
+					Expect(policydb.Insert(key, []byte{byte(i)})).NotTo(HaveOccurred())
+
+					var value []byte
+					Expect(policydb.Get(key, &value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal([]byte{byte(i)}))
+
+					size, err := policydb.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					if i < 10 {
+						Expect(size).Should(Equal(i + 1))
+					} else {
+						Expect(size).Should(Equal(10))
+					}
+				}
+			})
+
+			It("should not evict when updating an existing key", func() {
+				policydb := New(codec.BinaryCodec, 3, policy.newPolicy())
+				for _, key := range []string{"a", "b", "c"} {
+					Expect(policydb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+				}
+				Expect(policydb.Insert("b", []byte("B"))).NotTo(HaveOccurred())
+				Expect(keys(policydb)).Should(Equal([]string{"a", "b", "c"}))
+			})
+
+			It("should not evict after a key has been deleted", func() {
+				policydb := New(codec.BinaryCodec, 3, policy.newPolicy())
+				for _, key := range []string{"a", "b", "c"} {
+					Expect(policydb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+				}
+				Expect(policydb.Delete("b")).NotTo(HaveOccurred())
+				Expect(policydb.Insert("d", []byte("d"))).NotTo(HaveOccurred())
+				Expect(keys(policydb)).Should(Equal([]string{"a", "c", "d"}))
+
+				// The deleted key must not be chosen for eviction, so
+				// inserting another key evicts exactly one of the others.
+				Expect(policydb.Insert("e", []byte("e"))).NotTo(HaveOccurred())
+				Expect(keys(policydb)).Should(HaveLen(3))
+				Expect(keys(policydb)).Should(ContainElement("e"))
+			})
+		})
+	}
+
+	Context("when using the random policy", func() {
+		It("should eventually evict every key", func() {
+			evicted := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				policydb := New(codec.BinaryCodec, 3, NewRandomPolicy())
+				for _, key := range []string{"a", "b", "c", "d"} {
+					Expect(policydb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+				}
+				for _, key := range []string{"a", "b", "c"} {
+					var value []byte
+					if policydb.Get(key, &value) == db.ErrKeyNotFound {
+						evicted[key] = true
+					}
+				}
+			}
+			Expect(evicted).Should(HaveLen(3))
+		})
+	})
+
+	Context("when using the lru policy", func() {
+		It("should evict the least recently used key", func() {
+			policydb := New(codec.BinaryCodec, 3, NewLRUPolicy())
+			for _, key := range []string{"a", "b", "c"} {
+				Expect(policydb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+
+			// Reading the oldest key should protect it.
+			var value []byte
+			Expect(policydb.Get("a", &value)).NotTo(HaveOccurred())
+			Expect(policydb.Insert("d", []byte("d"))).NotTo(HaveOccurred())
+			Expect(keys(policydb)).Should(Equal([]string{"a", "c", "d"}))
+
+			// Updating a key should also protect it.
+			Expect(policydb.Insert("c", []byte("C"))).NotTo(HaveOccurred())
+			Expect(policydb.Insert("e", []byte("e"))).NotTo(HaveOccurred())
+			Expect(keys(policydb)).Should(Equal([]string{"c", "d", "e"}))
+		})
+
+		It("should not be affected by iterating", func() {
+			policydb := New(codec.BinaryCodec, 2, NewLRUPolicy())
+			Expect(policydb.Insert("a", []byte("a"))).NotTo(HaveOccurred())
+			Expect(policydb.Insert("b", []byte("b"))).NotTo(HaveOccurred())
+			Expect(keys(policydb)).Should(Equal([]string{"a", "b"}))
+			Expect(policydb.Insert("c", []byte("c"))).NotTo(HaveOccurred())
+			Expect(keys(policydb)).Should(Equal([]string{"b", "c"}))
+		})
+	})
+
+	Context("when reporting the capacity", func() {
+		It("should return the cap that it was created with", func() {
+			policydb := New(codec.BinaryCodec, 10, NewLRUPolicy())
+			capacitor, ok := policydb.(db.Capacitor)
+			Expect(ok).Should(BeTrue())
+			Expect(capacitor.Cap()).Should(Equal(10))
+		})
+	})
+
+	Context("when initializing the db", func() {
+		It("should panic with a nil codec, a non-positive cap, or a nil policy", func() {
+			Expect(func() { New(nil, 10, NewLRUPolicy()) }).Should(Panic())
+			Expect(func() { New(codec.BinaryCodec, 0, NewLRUPolicy()) }).Should(Panic())
+			Expect(func() { New(codec.BinaryCodec, 10, nil) }).Should(Panic())
+		})
+	})
+})
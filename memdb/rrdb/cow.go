@@ -0,0 +1,150 @@
+package rrdb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/renproject/kv/db"
+)
+
+// cowDB is an in-memory implementation of the `db.DB` that uses random
+// replacement when it is full, and copy-on-write so that reads never lock.
+type cowDB struct {
+	// writeMu is held by writers while they copy the current map and swap in
+	// the new one, so that concurrent writes are not lost. Readers only load
+	// the current map, which is never modified once it has been stored.
+	writeMu *sync.Mutex
+	data    atomic.Pointer[map[string][]byte]
+	codec   db.Codec
+
+	maxEntries int
+}
+
+// NewCOW returns a new `db.DB` that can store at most `cap` key/value pairs,
+// and evicts random key/value pairs to make room when it is full. The
+// key/value pairs are held in an immutable map, and every insert or delete
+// copies the map and swaps in the copy. Gets and iterators read the current
+// map without locking, and iterators do not need to copy the key/value pairs,
+// so reads never contend with writers. In exchange, every write costs time
+// and memory proportional to the number of key/value pairs, so it is only
+// suited to small, read-heavy workloads.
+func NewCOW(codec db.Codec, cap int) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	if cap <= 0 {
+		panic(fmt.Sprintf("max entries must be positive, got %v", cap))
+	}
+	cowDB := &cowDB{
+		writeMu:    new(sync.Mutex),
+		codec:      codec,
+		maxEntries: cap,
+	}
+	cowDB.data.Store(&map[string][]byte{})
+	return cowDB
+}
+
+// Close implements the `db.DB` interface.
+func (cowDB *cowDB) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface.
+func (cowDB *cowDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := marshal(cowDB.codec, value)
+	if err != nil {
+		return err
+	}
+
+	cowDB.writeMu.Lock()
+	defer cowDB.writeMu.Unlock()
+
+	old := *cowDB.data.Load()
+	_, exists := old[key]
+	evict := !exists && len(old) >= cowDB.maxEntries
+
+	// We rely on the randomised iteration order of maps to pick the key that
+	// is evicted.
+	next := make(map[string][]byte, len(old)+1)
+	for k, v := range old {
+		if evict {
+			evict = false
+			continue
+		}
+		next[k] = v
+	}
+	next[key] = data
+	cowDB.data.Store(&next)
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (cowDB *cowDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, ok := (*cowDB.data.Load())[key]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	return decode(cowDB.codec, data, value, false)
+}
+
+// Delete implements the `db.DB` interface.
+func (cowDB *cowDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	cowDB.writeMu.Lock()
+	defer cowDB.writeMu.Unlock()
+
+	old := *cowDB.data.Load()
+	if _, ok := old[key]; !ok {
+		return nil
+	}
+	next := make(map[string][]byte, len(old)-1)
+	for k, v := range old {
+		if k != key {
+			next[k] = v
+		}
+	}
+	cowDB.data.Store(&next)
+	return nil
+}
+
+// Size implements the `db.DB` interface.
+func (cowDB *cowDB) Size(prefix string) (int, error) {
+	counter := 0
+	for key := range *cowDB.data.Load() {
+		if strings.HasPrefix(key, prefix) {
+			counter++
+		}
+	}
+	return counter, nil
+}
+
+// Iterator implements the `db.DB` interface. The iterator reads the map that
+// is current when it is created, and is not affected by later writes.
+func (cowDB *cowDB) Iterator(prefix string) db.Iterator {
+	data := *cowDB.data.Load()
+	iter := &iterator{
+		index:  -1,
+		codec:  cowDB.codec,
+		keys:   make([]string, 0, len(data)),
+		values: make([][]byte, 0, len(data)),
+	}
+	for key, value := range data {
+		if strings.HasPrefix(key, prefix) {
+			iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
+			iter.values = append(iter.values, value)
+		}
+	}
+	return iter
+}
@@ -0,0 +1,13 @@
+package rrdb
+
+import "reflect"
+
+// DataPointer returns the address of the map that holds the data of the DB,
+// so that tests can check whether or not it has been rebuilt.
+func DataPointer(db DB) uintptr {
+	rrdb := db.(*rrdb)
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	return reflect.ValueOf(rrdb.data).Pointer()
+}
@@ -0,0 +1,1222 @@
+package rrdb
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// ErrEmptyValue is returned when inserting an empty value into a DB that
+// rejects empty values.
+var ErrEmptyValue = errors.New("value cannot be empty")
+
+// ErrStoreFull is returned when inserting into a full DB that was created with
+// OnFull(RejectInsert).
+var ErrStoreFull = errors.New("store full")
+
+// ErrValueTooLarge is returned when a single encoded value is larger than the
+// maximum number of bytes allowed in the DB.
+type ErrValueTooLarge struct {
+	Size     int
+	MaxBytes int
+}
+
+// Error implements the `error` interface.
+func (err ErrValueTooLarge) Error() string {
+	return fmt.Sprintf("value too large: size = %v, max bytes = %v", err.Size, err.MaxBytes)
+}
+
+// A DB is an in-memory `db.DB` that has a limited capacity. When inserting
+// into a full DB, random key/value pairs will be evicted to make room, unless
+// it was created with OnFull(RejectInsert).
+type DB interface {
+	db.DB
+
+	// Bytes returns the total number of bytes used by the encoded values in
+	// the DB.
+	Bytes() int
+
+	// Cap returns the maximum number of key/value pairs that the DB can hold.
+	// It implements the `db.Capacitor` interface.
+	Cap() int
+
+	// Compact rebuilds the maps that hold the key/value pairs, so that they
+	// are sized for the current number of key/value pairs. Maps never shrink
+	// when key/value pairs are deleted, so this reclaims the memory held after
+	// a spike of inserts is followed by deletes.
+	Compact()
+
+	// ChunkedIterator returns an iterator over the key/value pairs with the
+	// given prefix that reads the values in chunks of the given size. Unlike
+	// Iterator, which copies every value up front, only the keys are copied
+	// up front, and the read lock is released between chunks so that writers
+	// can make progress during long scans. The view is weakly consistent:
+	// key/value pairs inserted after the iterator is created are not seen,
+	// key/value pairs deleted before their chunk is read are skipped, and
+	// values are read as they are when their chunk is read.
+	ChunkedIterator(prefix string, chunkSize int) db.Iterator
+}
+
+// A PriorityDB is a DB where each key/value pair has a priority, and key/value
+// pairs with the lowest priority are always evicted first.
+type PriorityDB interface {
+	DB
+
+	// InsertWithPriority writes the key/value pair into the DB with the given
+	// priority. Inserting a new key with Insert gives it DefaultPriority, and
+	// replacing the value of a key with Insert keeps its priority.
+	InsertWithPriority(key string, value interface{}, priority int) error
+}
+
+// DefaultPriority is the priority of key/value pairs that are inserted into a
+// PriorityDB without a priority.
+const DefaultPriority = 0
+
+// An Option configures a DB when it is created.
+type Option func(*rrdb)
+
+// RejectEmptyValues makes the DB return ErrEmptyValue when inserting a nil
+// value, a value that has a length of zero, or a value that is encoded to zero
+// bytes. By default, empty values are accepted.
+func RejectEmptyValues() Option {
+	return func(rrdb *rrdb) {
+		rrdb.rejectEmptyValues = true
+	}
+}
+
+// CopyOnGet makes the DB copy the encoded value before it is decoded by gets
+// and iterators. This prevents aliasing when the codec decodes a value that
+// shares memory with the encoded bytes, for example a value with an
+// `UnmarshalBinary` method that keeps the slice it is given, in which case
+// mutating the returned value would corrupt the stored value. By default, the
+// encoded value is decoded without copying. The bundled codecs never alias, so
+// this is only needed for custom codecs and values.
+func CopyOnGet() Option {
+	return func(rrdb *rrdb) {
+		rrdb.copyOnGet = true
+	}
+}
+
+// CopyOnInsert makes the DB copy the encoded value before it is stored. This
+// prevents aliasing when the codec encodes a value to bytes that share memory
+// with the value, for example a value with a `MarshalBinary` method that
+// returns its own slice, in which case mutating the value after inserting it
+// would corrupt the stored value. By default, the encoded value is stored
+// without copying. The bundled codecs never alias, so this is only needed for
+// custom codecs and values.
+func CopyOnInsert() Option {
+	return func(rrdb *rrdb) {
+		rrdb.copyOnInsert = true
+	}
+}
+
+// OnFullMode is what a DB does when inserting into it would take it over its
+// max entries or max bytes.
+type OnFullMode int
+
+const (
+	// EvictRandom evicts key/value pairs to make room for the insert, in the
+	// way that the DB was created to evict them. This is random replacement
+	// unless the DB is weighted or prioritised, and evicts a batch of
+	// key/value pairs at once if the DB was created with NewWithEvictBatch.
+	EvictRandom OnFullMode = iota
+
+	// RejectInsert returns ErrStoreFull instead of evicting, and leaves the DB
+	// unchanged, so that callers can apply backpressure instead of silently
+	// losing data. Replacing the value of an existing key is only rejected if
+	// the new value would take the DB over its max bytes.
+	RejectInsert
+
+	// EvictThenInsert evicts key/value pairs, in the same way as EvictRandom,
+	// but only one at a time until there is room for the insert, even if the
+	// DB was created with NewWithEvictBatch.
+	EvictThenInsert
+)
+
+// OnFull sets what the DB does when it is full. By default, it uses
+// EvictRandom.
+func OnFull(mode OnFullMode) Option {
+	return func(rrdb *rrdb) {
+		rrdb.onFull = mode
+	}
+}
+
+// CompactWhenOversized makes the DB compact itself when key/value pairs are
+// deleted, once the number of key/value pairs has fallen below the given
+// fraction of the most that it has held since it was last compacted. DBs that
+// have never held more than MinCompactEntries key/value pairs are not
+// compacted. By default, the DB is only compacted by calling Compact.
+func CompactWhenOversized(fraction float64) Option {
+	return func(rrdb *rrdb) {
+		rrdb.compactFraction = fraction
+	}
+}
+
+// A Compactor rewrites encoded values into smaller encoded values that decode to
+// an equivalent value, such as by removing the duplicates from an encoded set.
+type Compactor interface {
+
+	// Compact the encoded value associated with the given key. The returned
+	// bytes replace the value, and must be decodable by the codec of the DB.
+	Compact(key string, value []byte) ([]byte, error)
+}
+
+// CompactMergedValues makes the DB compact the values written by Merge with
+// the compactor, when they are encoded to more than the given number of bytes.
+// This keeps values that are appended to by merges from growing without bound.
+// Values are compacted before they are checked against the limits of the DB,
+// and if compacting fails, the merge returns the error and nothing is written.
+// By default, values are never compacted.
+func CompactMergedValues(compactor Compactor, threshold int) Option {
+	return func(rrdb *rrdb) {
+		rrdb.compactor = compactor
+		rrdb.compactThreshold = threshold
+	}
+}
+
+// MinCompactEntries is the least number of key/value pairs that a DB must
+// have held before it is compacted by CompactWhenOversized, so that small DBs
+// are not rebuilt constantly.
+const MinCompactEntries = 1024
+
+// rrdb is a in-memory implementation of the `db.DB` that uses random
+// replacement when it is full.
+type rrdb struct {
+	dataMu *sync.RWMutex
+	data   map[string][]byte
+	bytes  int
+	codec  db.Codec
+
+	maxEntries int
+	maxBytes   int
+
+	// evictBatch is the number of key/value pairs evicted at once when the
+	// rrdb has reached the max entries.
+	evictBatch int
+
+	// onFull is what the rrdb does when it is full.
+	onFull OnFullMode
+
+	rejectEmptyValues bool
+	copyOnGet         bool
+	copyOnInsert      bool
+
+	// peak is the most key/value pairs held since the rrdb was last
+	// compacted. The rrdb is compacted automatically when the number of
+	// key/value pairs falls below the compact fraction of the peak, unless
+	// the compact fraction is zero.
+	peak            int
+	compactFraction float64
+
+	// compactor of the values written by merges that are larger than the
+	// compact threshold. It is nil if values are not compacted.
+	compactor        Compactor
+	compactThreshold int
+
+	// weights of the keys, used to pick which key to evict. It is nil if the
+	// rrdb is not weighted.
+	weightFn func(key string, value []byte) int
+	weights  map[string]int
+
+	// priorities of the keys, used to pick which key to evict. It is nil if
+	// the rrdb is not prioritised.
+	priorities map[string]int
+
+	// order of the keys by insertion. It is nil if the rrdb is not ordered.
+	order *list.List
+	elems map[string]*list.Element
+}
+
+// New returns a new rrdb that can store at most `cap` key/value pairs.
+func New(codec db.Codec, cap int, opts ...Option) DB {
+	return NewBounded(codec, cap, 0, opts...)
+}
+
+// NewBounded returns a new rrdb that can store at most `maxEntries` key/value
+// pairs, and at most `maxBytes` bytes of encoded values. Random key/value
+// pairs are evicted until both limits are satisfied. A non-positive
+// `maxBytes` means that the number of bytes is not limited.
+func NewBounded(codec db.Codec, maxEntries, maxBytes int, opts ...Option) DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	if maxEntries <= 0 {
+		panic(fmt.Sprintf("max entries must be positive, got %v", maxEntries))
+	}
+	rrdb := &rrdb{
+		dataMu:     new(sync.RWMutex),
+		data:       map[string][]byte{},
+		codec:      codec,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		evictBatch: 1,
+	}
+	for _, opt := range opts {
+		opt(rrdb)
+	}
+	return rrdb
+}
+
+// NewOrdered returns a new rrdb that can store at most `cap` key/value pairs,
+// and iterates over key/value pairs in the order in which they were inserted.
+// Inserting an existing key moves it to the end of the order.
+func NewOrdered(codec db.Codec, cap int, opts ...Option) DB {
+	rrdb := NewBounded(codec, cap, 0, opts...).(*rrdb)
+	rrdb.order = list.New()
+	rrdb.elems = map[string]*list.Element{}
+	return rrdb
+}
+
+// NewWithEvictBatch returns a new rrdb that can store at most `cap` key/value
+// pairs. When inserting into a full rrdb, `batchSize` random key/value pairs
+// are evicted at once, so that the following inserts do not need to evict.
+// The size of the rrdb fluctuates between `cap-batchSize` and `cap`.
+func NewWithEvictBatch(codec db.Codec, cap, batchSize int, opts ...Option) DB {
+	if batchSize <= 0 || batchSize > cap {
+		panic(fmt.Sprintf("batch size must be between 1 and %v, got %v", cap, batchSize))
+	}
+	rrdb := NewBounded(codec, cap, 0, opts...).(*rrdb)
+	rrdb.evictBatch = batchSize
+	return rrdb
+}
+
+// NewWeighted returns a new rrdb that can store at most `cap` key/value pairs.
+// When evicting, a key/value pair is picked with a probability that is
+// inversely proportional to its weight, so that key/value pairs with a high
+// weight are more likely to be kept. The weight is computed from the key and
+// the encoded value when the key/value pair is inserted. Weights less than one
+// are treated as one, and a rrdb where all weights are equal behaves like one
+// returned by New.
+func NewWeighted(codec db.Codec, cap int, weightFn func(key string, value []byte) int, opts ...Option) DB {
+	if weightFn == nil {
+		panic("weight function cannot be nil")
+	}
+	rrdb := NewBounded(codec, cap, 0, opts...).(*rrdb)
+	rrdb.weightFn = weightFn
+	rrdb.weights = map[string]int{}
+	return rrdb
+}
+
+// NewPriority returns a new rrdb that can store at most `cap` key/value pairs.
+// When evicting, a random key/value pair is picked from those with the lowest
+// priority, so key/value pairs with a higher priority are only evicted once
+// there are no key/value pairs with a lower priority. Picking the key/value
+// pair to evict takes time proportional to the number of key/value pairs.
+func NewPriority(codec db.Codec, cap int, opts ...Option) PriorityDB {
+	rrdb := NewBounded(codec, cap, 0, opts...).(*rrdb)
+	rrdb.priorities = map[string]int{}
+	return rrdb
+}
+
+// Close implements the `db.DB` interface.
+func (rrdb *rrdb) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface. If the value is larger than the
+// maximum number of bytes, then ErrValueTooLarge is returned. If the value is
+// empty and empty values are rejected, then ErrEmptyValue is returned.
+// Otherwise, a nil value is stored as an empty value, and getting it succeeds
+// and gives a non-nil empty slice or map, or the zero value of other types. It
+// is never reported as not found.
+func (rrdb *rrdb) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := rrdb.encode(value)
+	if err != nil {
+		return err
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	return rrdb.store(key, data)
+}
+
+// InsertWithPriority implements the `PriorityDB` interface.
+func (rrdb *rrdb) InsertWithPriority(key string, value interface{}, priority int) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := rrdb.encode(value)
+	if err != nil {
+		return err
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	if err := rrdb.store(key, data); err != nil {
+		return err
+	}
+	rrdb.priorities[key] = priority
+	return nil
+}
+
+// Prewarm implements the `db.Prewarmer` interface. The rrdb never grows beyond
+// its max entries, so no more room than that is allocated.
+func (rrdb *rrdb) Prewarm(expectedEntries int) {
+	if expectedEntries <= 0 {
+		return
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	size := len(rrdb.data) + expectedEntries
+	if size > rrdb.maxEntries {
+		size = rrdb.maxEntries
+	}
+	rrdb.rebuild(size)
+}
+
+// Compact implements the `DB` interface.
+func (rrdb *rrdb) Compact() {
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	rrdb.compact()
+}
+
+// compact rebuilds the maps with the current number of key/value pairs, and
+// resets the peak. The caller must hold the write lock.
+func (rrdb *rrdb) compact() {
+	rrdb.rebuild(len(rrdb.data))
+	rrdb.peak = len(rrdb.data)
+}
+
+// compactIfOversized compacts the rrdb if it has fallen below the compact
+// fraction of its peak. The caller must hold the write lock.
+func (rrdb *rrdb) compactIfOversized() {
+	if rrdb.compactFraction <= 0 || rrdb.peak < MinCompactEntries {
+		return
+	}
+	if float64(len(rrdb.data)) < rrdb.compactFraction*float64(rrdb.peak) {
+		rrdb.compact()
+	}
+}
+
+// rebuild the maps with room for the given number of key/value pairs. The
+// caller must hold the write lock.
+func (rrdb *rrdb) rebuild(size int) {
+	data := make(map[string][]byte, size)
+	for key, value := range rrdb.data {
+		data[key] = value
+	}
+	rrdb.data = data
+	if rrdb.elems != nil {
+		elems := make(map[string]*list.Element, size)
+		for key, elem := range rrdb.elems {
+			elems[key] = elem
+		}
+		rrdb.elems = elems
+	}
+	if rrdb.weights != nil {
+		weights := make(map[string]int, size)
+		for key, weight := range rrdb.weights {
+			weights[key] = weight
+		}
+		rrdb.weights = weights
+	}
+	if rrdb.priorities != nil {
+		priorities := make(map[string]int, size)
+		for key, priority := range rrdb.priorities {
+			priorities[key] = priority
+		}
+		rrdb.priorities = priorities
+	}
+}
+
+// Get implements the `db.DB` interface.
+func (rrdb *rrdb) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	data, ok := rrdb.data[key]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	return rrdb.decode(data, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (rrdb *rrdb) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	rrdb.remove(key)
+	rrdb.compactIfOversized()
+	return nil
+}
+
+// GetAndDelete implements the `db.GetAndDeleter` interface.
+func (rrdb *rrdb) GetAndDelete(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	data, ok := rrdb.data[key]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	if err := rrdb.decode(data, value); err != nil {
+		return err
+	}
+	rrdb.remove(key)
+	rrdb.compactIfOversized()
+	return nil
+}
+
+// CompareAndSwap implements the `db.CompareAndSwapper` interface. If the new
+// value is larger than the maximum number of bytes, then ErrValueTooLarge is
+// returned.
+func (rrdb *rrdb) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	var oldData, newData []byte
+	var err error
+	if old != nil {
+		if oldData, err = rrdb.marshal(old); err != nil {
+			return false, err
+		}
+	}
+	if new != nil {
+		if newData, err = rrdb.encode(new); err != nil {
+			return false, err
+		}
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	data, ok := rrdb.data[key]
+	if old == nil && ok || old != nil && (!ok || !bytes.Equal(data, oldData)) {
+		return false, nil
+	}
+	if new == nil {
+		rrdb.remove(key)
+		rrdb.compactIfOversized()
+	} else if err := rrdb.store(key, newData); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Swap implements the `db.Swapper` interface. If the value is larger than the
+// maximum number of bytes, then ErrValueTooLarge is returned and nothing is
+// written.
+func (rrdb *rrdb) Swap(key string, value, old interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := rrdb.encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	oldData, ok := rrdb.data[key]
+	if ok {
+		if err := rrdb.decode(oldData, old); err != nil {
+			return false, err
+		}
+	}
+	if err := rrdb.store(key, data); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// DeleteIf implements the `db.ConditionalDeleter` interface.
+func (rrdb *rrdb) DeleteIf(key string, expected interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	expectedData, err := rrdb.marshal(expected)
+	if err != nil {
+		return false, err
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	data, ok := rrdb.data[key]
+	if !ok || !bytes.Equal(data, expectedData) {
+		return false, nil
+	}
+	rrdb.remove(key)
+	rrdb.compactIfOversized()
+	return true, nil
+}
+
+// HasBatch implements the `db.BatchChecker` interface. All of the keys are
+// checked under a single read lock.
+func (rrdb *rrdb) HasBatch(keys []string) ([]bool, error) {
+	for _, key := range keys {
+		if key == "" {
+			return nil, db.ErrEmptyKey
+		}
+	}
+
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		_, found[i] = rrdb.data[key]
+	}
+	return found, nil
+}
+
+// Rename implements the `db.Renamer` interface. The new key gets the default
+// weight or priority of its value, as if it had been inserted.
+func (rrdb *rrdb) Rename(oldKey, newKey string) error {
+	return rrdb.rename(oldKey, newKey, true)
+}
+
+// RenameNX implements the `db.Renamer` interface.
+func (rrdb *rrdb) RenameNX(oldKey, newKey string) error {
+	return rrdb.rename(oldKey, newKey, false)
+}
+
+// rename the old key to the new key, replacing the new key only if allowed.
+// The old key is removed first, so the rrdb always has room for the new key
+// and nothing is evicted.
+func (rrdb *rrdb) rename(oldKey, newKey string, replace bool) error {
+	if oldKey == "" || newKey == "" {
+		return db.ErrEmptyKey
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	data, ok := rrdb.data[oldKey]
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	if _, ok := rrdb.data[newKey]; ok && !replace {
+		return db.ErrKeyExists
+	}
+	rrdb.remove(oldKey)
+	rrdb.remove(newKey)
+	return rrdb.store(newKey, data)
+}
+
+// Merge implements the `db.Merger` interface. If the merged value is larger
+// than the maximum number of bytes, then ErrValueTooLarge is returned and
+// nothing is written. Merged values are compacted if the DB was created with
+// CompactMergedValues.
+func (rrdb *rrdb) Merge(key string, value interface{}, mergeFn func(found bool) (interface{}, error)) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	data, ok := rrdb.data[key]
+	if ok {
+		if err := rrdb.decode(data, value); err != nil {
+			return err
+		}
+	}
+	merged, err := mergeFn(ok)
+	if err != nil {
+		return err
+	}
+	mergedData, err := rrdb.marshal(merged)
+	if err != nil {
+		return err
+	}
+	if rrdb.compactor != nil && len(mergedData) > rrdb.compactThreshold {
+		if mergedData, err = rrdb.compactor.Compact(key, mergedData); err != nil {
+			return fmt.Errorf("error compacting key=%v: %w", key, err)
+		}
+	}
+	if mergedData, err = rrdb.check(merged, mergedData); err != nil {
+		return err
+	}
+	return rrdb.store(key, mergedData)
+}
+
+// DeleteRange implements the `db.RangeDeleter` interface.
+func (rrdb *rrdb) DeleteRange(start, end string) (int, error) {
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	keys := []string{}
+	for key := range rrdb.data {
+		if start <= key && key < end {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		rrdb.remove(key)
+	}
+	rrdb.compactIfOversized()
+	return len(keys), nil
+}
+
+// InsertStream implements the `db.StreamStore` interface. The rrdb is held in
+// memory, so the whole value is read from the reader before it is stored. The
+// limits on the number of bytes and empty values are enforced on the encoded
+// value.
+func (rrdb *rrdb) InsertStream(key string, r io.Reader) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if rrdb.rejectEmptyValues && len(data) == 0 {
+		return ErrEmptyValue
+	}
+	if rrdb.maxBytes > 0 && len(data) > rrdb.maxBytes {
+		return ErrValueTooLarge{Size: len(data), MaxBytes: rrdb.maxBytes}
+	}
+
+	rrdb.dataMu.Lock()
+	defer rrdb.dataMu.Unlock()
+
+	return rrdb.store(key, data)
+}
+
+// GetStream implements the `db.StreamStore` interface.
+func (rrdb *rrdb) GetStream(key string) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	data, ok := rrdb.data[key]
+	if !ok {
+		return nil, db.ErrKeyNotFound
+	}
+	if rrdb.copyOnGet {
+		data = copyBytes(data)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Size implements the `db.DB` interface.
+func (rrdb *rrdb) Size(prefix string) (int, error) {
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	counter := 0
+	for key := range rrdb.data {
+		if strings.HasPrefix(key, prefix) {
+			counter++
+		}
+	}
+	return counter, nil
+}
+
+// Iterator implements the `db.DB` interface.
+func (rrdb *rrdb) Iterator(prefix string) db.Iterator {
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	iter := &iterator{
+		index:     -1,
+		codec:     rrdb.codec,
+		copyOnGet: rrdb.copyOnGet,
+		keys:      make([]string, 0, len(rrdb.data)),
+		values:    make([][]byte, 0, len(rrdb.data)),
+	}
+	if rrdb.order != nil {
+		for elem := rrdb.order.Front(); elem != nil; elem = elem.Next() {
+			key := elem.Value.(string)
+			if strings.HasPrefix(key, prefix) {
+				iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
+				iter.values = append(iter.values, rrdb.data[key])
+			}
+		}
+		return iter
+	}
+	for key, value := range rrdb.data {
+		if strings.HasPrefix(key, prefix) {
+			iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
+			iter.values = append(iter.values, value)
+		}
+	}
+
+	return iter
+}
+
+// KeyIterator implements the `db.KeyIterable` interface. Only the keys are
+// copied when the iterator is created.
+func (rrdb *rrdb) KeyIterator(prefix string) db.KeyIterator {
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	iter := &keyIterator{
+		index: -1,
+		keys:  make([]string, 0, len(rrdb.data)),
+	}
+	if rrdb.order != nil {
+		for elem := rrdb.order.Front(); elem != nil; elem = elem.Next() {
+			if key := elem.Value.(string); strings.HasPrefix(key, prefix) {
+				iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
+			}
+		}
+		return iter
+	}
+	for key := range rrdb.data {
+		if strings.HasPrefix(key, prefix) {
+			iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
+		}
+	}
+	return iter
+}
+
+// ChunkedIterator implements the `DB` interface.
+func (rrdb *rrdb) ChunkedIterator(prefix string, chunkSize int) db.Iterator {
+	if chunkSize <= 0 {
+		panic(fmt.Sprintf("chunk size must be positive, got %v", chunkSize))
+	}
+
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	keys := make([]string, 0, len(rrdb.data))
+	if rrdb.order != nil {
+		for elem := rrdb.order.Front(); elem != nil; elem = elem.Next() {
+			if key := elem.Value.(string); strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	} else {
+		for key := range rrdb.data {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return &chunkedIterator{
+		rrdb:      rrdb,
+		prefix:    prefix,
+		chunkSize: chunkSize,
+		keys:      keys,
+		iter:      &iterator{index: -1, codec: rrdb.codec, copyOnGet: rrdb.copyOnGet},
+	}
+}
+
+// Bytes implements the `DB` interface.
+func (rrdb *rrdb) Bytes() int {
+	rrdb.dataMu.RLock()
+	defer rrdb.dataMu.RUnlock()
+
+	return rrdb.bytes
+}
+
+// Cap implements the `db.Capacitor` interface.
+func (rrdb *rrdb) Cap() int {
+	return rrdb.maxEntries
+}
+
+// encode the value, and check that it can be stored.
+func (rrdb *rrdb) encode(value interface{}) ([]byte, error) {
+	data, err := rrdb.marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return rrdb.check(value, data)
+}
+
+// check that the value and its encoding can be stored in the rrdb, and return
+// the encoding that should be stored.
+func (rrdb *rrdb) check(value interface{}, data []byte) ([]byte, error) {
+	if rrdb.rejectEmptyValues && (value == nil || len(data) == 0 || hasZeroLength(value)) {
+		return nil, ErrEmptyValue
+	}
+	if rrdb.maxBytes > 0 && len(data) > rrdb.maxBytes {
+		return nil, ErrValueTooLarge{Size: len(data), MaxBytes: rrdb.maxBytes}
+	}
+	if rrdb.copyOnInsert {
+		data = copyBytes(data)
+	}
+	return data, nil
+}
+
+// marshal the value with the codec of the rrdb.
+func (rrdb *rrdb) marshal(value interface{}) ([]byte, error) {
+	return marshal(rrdb.codec, value)
+}
+
+// marshal the value with the codec, unless it is nil. Nil values are stored as
+// an empty encoded value, without using the codec, so that they can be
+// inserted regardless of whether or not the codec supports them.
+func marshal(codec db.Codec, value interface{}) ([]byte, error) {
+	if isNil(value) {
+		return []byte{}, nil
+	}
+	return codec.Encode(value)
+}
+
+// decode the encoded value, copying it first if the rrdb copies on get.
+func (rrdb *rrdb) decode(data []byte, value interface{}) error {
+	return decode(rrdb.codec, data, value, rrdb.copyOnGet)
+}
+
+// decode the encoded value with the codec, copying it first if copyOnGet is
+// set. An empty encoded value is decoded without the codec, by setting the
+// value to its zero value, except that slices and maps are set to non-nil
+// empty ones. This means that getting a nil value that was inserted always
+// succeeds, and gives a non-nil empty slice or map.
+func decode(codec db.Codec, data []byte, value interface{}, copyOnGet bool) error {
+	if len(data) == 0 {
+		if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && !v.IsNil() {
+			setEmpty(v.Elem())
+			return nil
+		}
+	}
+	if copyOnGet {
+		data = copyBytes(data)
+	}
+	return codec.Decode(data, value)
+}
+
+// setEmpty sets the value to its zero value, or to a non-nil empty slice or
+// map.
+func setEmpty(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+	default:
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
+
+// copyBytes returns a copy of the bytes that does not share memory with them.
+func copyBytes(data []byte) []byte {
+	copied := make([]byte, len(data))
+	copy(copied, data)
+	return copied
+}
+
+// isNil returns whether or not the value is nil, or is a nil slice, map, or
+// pointer.
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// hasZeroLength returns whether or not the value is a slice, map, or string
+// with a length of zero.
+func hasZeroLength(value interface{}) bool {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+// store the encoded value, evicting random key/value pairs until there is
+// enough room, or returning ErrStoreFull if the rrdb rejects inserts when it is
+// full. The caller must hold the write lock.
+func (rrdb *rrdb) store(key string, data []byte) error {
+	if rrdb.onFull == RejectInsert {
+		old, ok := rrdb.data[key]
+		if !ok && len(rrdb.data) >= rrdb.maxEntries {
+			return ErrStoreFull
+		}
+		if rrdb.maxBytes > 0 && rrdb.bytes-len(old)+len(data) > rrdb.maxBytes {
+			return ErrStoreFull
+		}
+	}
+
+	priority, hasPriority := rrdb.priorities[key]
+	rrdb.remove(key)
+	if len(rrdb.data) >= rrdb.maxEntries {
+		evictBatch := rrdb.evictBatch
+		if rrdb.onFull == EvictThenInsert {
+			evictBatch = 1
+		}
+		for i := 0; i < evictBatch; i++ {
+			rrdb.evict()
+		}
+	}
+	for rrdb.maxBytes > 0 && rrdb.bytes+len(data) > rrdb.maxBytes {
+		rrdb.evict()
+	}
+	rrdb.data[key] = data
+	rrdb.bytes += len(data)
+	if len(rrdb.data) > rrdb.peak {
+		rrdb.peak = len(rrdb.data)
+	}
+	if rrdb.order != nil {
+		rrdb.elems[key] = rrdb.order.PushBack(key)
+	}
+	if rrdb.weights != nil {
+		weight := rrdb.weightFn(key, data)
+		if weight < 1 {
+			weight = 1
+		}
+		rrdb.weights[key] = weight
+	}
+	if rrdb.priorities != nil {
+		if !hasPriority {
+			priority = DefaultPriority
+		}
+		rrdb.priorities[key] = priority
+	}
+	return nil
+}
+
+// remove the key from the data and update the number of bytes. The caller
+// must hold the write lock.
+func (rrdb *rrdb) remove(key string) {
+	if data, ok := rrdb.data[key]; ok {
+		rrdb.bytes -= len(data)
+		delete(rrdb.data, key)
+		if rrdb.order != nil {
+			rrdb.order.Remove(rrdb.elems[key])
+			delete(rrdb.elems, key)
+		}
+		if rrdb.weights != nil {
+			delete(rrdb.weights, key)
+		}
+		if rrdb.priorities != nil {
+			delete(rrdb.priorities, key)
+		}
+	}
+}
+
+// evict a random key/value pair. We rely on the randomised iteration order of
+// maps to pick the key. The caller must hold the write lock.
+func (rrdb *rrdb) evict() {
+	if rrdb.weights != nil {
+		rrdb.evictWeighted()
+		return
+	}
+	if rrdb.priorities != nil {
+		rrdb.evictPriority()
+		return
+	}
+	for key := range rrdb.data {
+		rrdb.remove(key)
+		return
+	}
+}
+
+// evictWeighted evicts a key/value pair picked with a probability that is
+// inversely proportional to its weight. The caller must hold the write lock.
+func (rrdb *rrdb) evictWeighted() {
+	total := 0.0
+	for _, weight := range rrdb.weights {
+		total += 1 / float64(weight)
+	}
+	target := rand.Float64() * total
+	last := ""
+	for key, weight := range rrdb.weights {
+		last = key
+		target -= 1 / float64(weight)
+		if target < 0 {
+			break
+		}
+	}
+	rrdb.remove(last)
+}
+
+// evictPriority evicts a random key/value pair from those with the lowest
+// priority. The caller must hold the write lock.
+func (rrdb *rrdb) evictPriority() {
+	lowest, found := 0, false
+	for _, priority := range rrdb.priorities {
+		if !found || priority < lowest {
+			lowest, found = priority, true
+		}
+	}
+
+	// Pick one of the keys with the lowest priority using reservoir sampling,
+	// so that the keys do not need to be collected.
+	picked, seen := "", 0
+	for key, priority := range rrdb.priorities {
+		if priority != lowest {
+			continue
+		}
+		seen++
+		if rand.Intn(seen) == 0 {
+			picked = key
+		}
+	}
+	if seen > 0 {
+		rrdb.remove(picked)
+	}
+}
+
+// iterator is a in-memory implementation of the `db.Iterator`.
+type iterator struct {
+	index     int
+	codec     db.Codec
+	copyOnGet bool
+
+	keys   []string
+	values [][]byte
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *iterator) Next() bool {
+	iter.index++
+	return iter.index < len(iter.keys)
+}
+
+// Key implements the `db.Iterator` interface.
+func (iter *iterator) Key() (string, error) {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return "", db.ErrIndexOutOfRange
+	}
+
+	return iter.keys[iter.index], nil
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *iterator) Value(value interface{}) error {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return db.ErrIndexOutOfRange
+	}
+	return decode(iter.codec, iter.values[iter.index], value, iter.copyOnGet)
+}
+
+// Err implements the `db.Iterator` interface. It always returns nil.
+func (iter *iterator) Err() error {
+	return nil
+}
+
+// Close implements the `db.Iterator` interface.
+func (iter *iterator) Close() {}
+
+// keyIterator is a in-memory implementation of the `db.KeyIterator`.
+type keyIterator struct {
+	index int
+	keys  []string
+}
+
+// Next implements the `db.KeyIterator` interface.
+func (iter *keyIterator) Next() bool {
+	iter.index++
+	return iter.index < len(iter.keys)
+}
+
+// Key implements the `db.KeyIterator` interface.
+func (iter *keyIterator) Key() (string, error) {
+	if iter.index == -1 || iter.index >= len(iter.keys) {
+		return "", db.ErrIndexOutOfRange
+	}
+	return iter.keys[iter.index], nil
+}
+
+// Err implements the `db.KeyIterator` interface. It always returns nil.
+func (iter *keyIterator) Err() error {
+	return nil
+}
+
+// Close implements the `db.KeyIterator` interface.
+func (iter *keyIterator) Close() {}
+
+// chunkedIterator is a `db.Iterator` that reads the values of the keys in
+// chunks, and iterates over each chunk using an iterator.
+type chunkedIterator struct {
+	rrdb      *rrdb
+	prefix    string
+	chunkSize int
+
+	// keys that have not been read yet.
+	keys []string
+	iter *iterator
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *chunkedIterator) Next() bool {
+	for !iter.iter.Next() {
+		if len(iter.keys) == 0 {
+			return false
+		}
+		iter.readChunk()
+	}
+	return true
+}
+
+// readChunk reads the values of the next chunk of keys, skipping the keys that
+// have been deleted.
+func (iter *chunkedIterator) readChunk() {
+	n := iter.chunkSize
+	if n > len(iter.keys) {
+		n = len(iter.keys)
+	}
+	chunk := iter.keys[:n]
+	iter.keys = iter.keys[n:]
+
+	iter.iter.index = -1
+	iter.iter.keys = iter.iter.keys[:0]
+	iter.iter.values = iter.iter.values[:0]
+
+	iter.rrdb.dataMu.RLock()
+	defer iter.rrdb.dataMu.RUnlock()
+
+	for _, key := range chunk {
+		if value, ok := iter.rrdb.data[key]; ok {
+			iter.iter.keys = append(iter.iter.keys, strings.TrimPrefix(key, iter.prefix))
+			iter.iter.values = append(iter.iter.values, value)
+		}
+	}
+}
+
+// Key implements the `db.Iterator` interface.
+func (iter *chunkedIterator) Key() (string, error) {
+	return iter.iter.Key()
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *chunkedIterator) Value(value interface{}) error {
+	return iter.iter.Value(value)
+}
+
+// Err implements the `db.Iterator` interface. It always returns nil.
+func (iter *chunkedIterator) Err() error {
+	return nil
+}
+
+// Close implements the `db.Iterator` interface.
+func (iter *chunkedIterator) Close() {}
@@ -0,0 +1,13 @@
+package rrdb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRrdb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rrdb Suite")
+}
@@ -0,0 +1,1248 @@
+package rrdb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/memdb/rrdb"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+// rawBytes is encoded and decoded by the binary codec without copying, so it
+// shares memory with the encoded bytes.
+type rawBytes []byte
+
+func (raw rawBytes) MarshalBinary() ([]byte, error) {
+	return raw, nil
+}
+
+func (raw *rawBytes) UnmarshalBinary(data []byte) error {
+	*raw = data
+	return nil
+}
+
+// setCompactor is a `Compactor` that removes the duplicates from JSON-encoded
+// slices of strings, and counts the values that it compacts.
+type setCompactor struct {
+	calls int
+}
+
+func (compactor *setCompactor) Compact(key string, value []byte) ([]byte, error) {
+	compactor.calls++
+	var set []string
+	if err := json.Unmarshal(value, &set); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	compacted := []string{}
+	for _, elem := range set {
+		if !seen[elem] {
+			seen[elem] = true
+			compacted = append(compacted, elem)
+		}
+	}
+	return json.Marshal(compacted)
+}
+
+var _ = Describe("in-memory random replacement implementation of the db", func() {
+
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when doing operation on a random replacement db", func() {
+			It("should be able to do read, write and delete", func() {
+				rrdb := New(codec, 100)
+				defer rrdb.Close()
+
+				test := func(key string, value testutil.TestStruct) bool {
+					// Will test empty in negative tests.
+					if key == "" {
+						return true
+					}
+
+					val := testutil.TestStruct{D: []byte{}}
+					err := rrdb.Get(key, &val)
+					Expect(err).Should(Equal(db.ErrKeyNotFound))
+
+					// Should be able to read the values after inserting.
+					Expect(rrdb.Insert(key, value)).NotTo(HaveOccurred())
+					err = rrdb.Get(key, &val)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+
+					// Expect no values exists after deleting the values.
+					Expect(rrdb.Delete(key)).NotTo(HaveOccurred())
+					err = rrdb.Get(key, &val)
+					Expect(err).Should(Equal(db.ErrKeyNotFound))
+
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+
+			It("should only let one caller get and delete each value", func() {
+				rrdb := New(codec, 100)
+
+				numKeys := 100
+				for i := 0; i < numKeys; i++ {
+					Expect(rrdb.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				claims := make([]int64, numKeys)
+				phi.ParForAll(8, func(worker int) {
+					for i := 0; i < numKeys; i++ {
+						var value int64
+						err := rrdb.(db.GetAndDeleter).GetAndDelete(fmt.Sprintf("%v", i), &value)
+						if err == db.ErrKeyNotFound {
+							continue
+						}
+						Expect(err).NotTo(HaveOccurred())
+						Expect(value).Should(Equal(int64(i)))
+						atomic.AddInt64(&claims[i], 1)
+					}
+				})
+				for i := range claims {
+					Expect(claims[i]).Should(Equal(int64(1)))
+				}
+			})
+
+			It("should only swap values that are as expected", func() {
+				rrdb := New(codec, 100)
+				cas := rrdb.(db.CompareAndSwapper)
+
+				swapped, err := cas.CompareAndSwap("key", nil, int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+				swapped, err = cas.CompareAndSwap("key", nil, int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeFalse())
+
+				swapped, err = cas.CompareAndSwap("key", int64(2), int64(3))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeFalse())
+				swapped, err = cas.CompareAndSwap("key", int64(1), int64(2))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+
+				var value int64
+				Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+
+				swapped, err = cas.CompareAndSwap("key", int64(2), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+				Expect(rrdb.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should apply concurrent swaps one at a time", func() {
+				rrdb := New(codec, 100)
+				cas := rrdb.(db.CompareAndSwapper)
+				Expect(rrdb.Insert("counter", int64(0))).NotTo(HaveOccurred())
+
+				numWorkers, numIncrements := 8, 50
+				phi.ParForAll(numWorkers, func(worker int) {
+					for i := 0; i < numIncrements; i++ {
+						for {
+							var value int64
+							Expect(rrdb.Get("counter", &value)).NotTo(HaveOccurred())
+							swapped, err := cas.CompareAndSwap("counter", value, value+1)
+							Expect(err).NotTo(HaveOccurred())
+							if swapped {
+								break
+							}
+						}
+					}
+				})
+
+				var value int64
+				Expect(rrdb.Get("counter", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(numWorkers * numIncrements)))
+			})
+
+			It("should return the value that it replaces", func() {
+				rrdb := New(codec, 100)
+				swapper := rrdb.(db.Swapper)
+
+				old := int64(-1)
+				existed, err := swapper.Swap("key", int64(1), &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeFalse())
+				Expect(old).Should(Equal(int64(-1)))
+
+				existed, err = swapper.Swap("key", int64(2), &old)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).Should(BeTrue())
+				Expect(old).Should(Equal(int64(1)))
+
+				var value int64
+				Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+			})
+
+			It("should return each replaced value to one caller when swapping concurrently", func() {
+				rrdb := New(codec, 100)
+				Expect(testutil.RaceSwap(rrdb.(testutil.SwapDB), 100)).NotTo(HaveOccurred())
+			})
+
+			It("should only delete values that are as expected", func() {
+				rrdb := New(codec, 100)
+				deleter := rrdb.(db.ConditionalDeleter)
+
+				deleted, err := deleter.DeleteIf("key", int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeFalse())
+
+				Expect(rrdb.Insert("key", int64(1))).NotTo(HaveOccurred())
+				deleted, err = deleter.DeleteIf("key", int64(2))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeFalse())
+				deleted, err = deleter.DeleteIf("key", int64(1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).Should(BeTrue())
+
+				var value int64
+				Expect(rrdb.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should not delete a value that is updated while it is deleted", func() {
+				rrdb := New(codec, 100)
+				Expect(testutil.RaceDeleteIf(rrdb.(testutil.ConditionalDeleteDB), 1000)).NotTo(HaveOccurred())
+			})
+
+			It("should return ErrEmptyKey when doing operations with empty keys", func() {
+				rrdb := New(codec, 100)
+				defer rrdb.Close()
+
+				value := testutil.RandomTestStruct()
+				Expect(rrdb.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+				Expect(rrdb.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(rrdb.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when checking whether keys exist in a batch", func() {
+			It("should return whether each key exists in the order of the keys", func() {
+				rrdb := New(codec, 100)
+				checker := rrdb.(db.BatchChecker)
+				for i := 0; i < 10; i += 2 {
+					Expect(rrdb.Insert(fmt.Sprintf("%v", i), int64(i))).NotTo(HaveOccurred())
+				}
+
+				keys := []string{}
+				for i := 9; i >= 0; i-- {
+					keys = append(keys, fmt.Sprintf("%v", i))
+				}
+				found, err := checker.HasBatch(keys)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found).Should(Equal([]bool{false, true, false, true, false, true, false, true, false, true}))
+
+				_, err = checker.HasBatch([]string{""})
+				Expect(err).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when renaming", func() {
+			It("should move the value and replace an existing key", func() {
+				rrdb := New(codec, 100)
+				renamer := rrdb.(db.Renamer)
+				Expect(rrdb.Insert("staging", int64(1))).NotTo(HaveOccurred())
+				Expect(rrdb.Insert("live", int64(2))).NotTo(HaveOccurred())
+
+				Expect(renamer.Rename("staging", "live")).NotTo(HaveOccurred())
+				var value int64
+				Expect(rrdb.Get("staging", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(rrdb.Get("live", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(1)))
+				size, err := rrdb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+			})
+
+			It("should fail to rename a missing key, or onto an existing key without replacing", func() {
+				rrdb := New(codec, 100)
+				renamer := rrdb.(db.Renamer)
+				Expect(renamer.Rename("missing", "live")).Should(Equal(db.ErrKeyNotFound))
+				Expect(renamer.RenameNX("missing", "live")).Should(Equal(db.ErrKeyNotFound))
+
+				Expect(rrdb.Insert("staging", int64(1))).NotTo(HaveOccurred())
+				Expect(rrdb.Insert("live", int64(2))).NotTo(HaveOccurred())
+				Expect(renamer.RenameNX("staging", "live")).Should(Equal(db.ErrKeyExists))
+				var value int64
+				Expect(rrdb.Get("live", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(2)))
+
+				Expect(rrdb.Delete("live")).NotTo(HaveOccurred())
+				Expect(renamer.RenameNX("staging", "live")).NotTo(HaveOccurred())
+				Expect(rrdb.Get("live", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(1)))
+				Expect(renamer.Rename("", "live")).Should(Equal(db.ErrEmptyKey))
+				Expect(renamer.Rename("live", "")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+
+		Context("when merging", func() {
+			It("should not lose concurrent merges", func() {
+				rrdb := New(codec, 100)
+				merger := rrdb.(db.Merger)
+
+				numMerges := 100
+				phi.ParForAll(numMerges, func(i int) {
+					var value []byte
+					Expect(merger.Merge("key", &value, func(found bool) (interface{}, error) {
+						Expect(found).Should(Equal(value != nil))
+						return append(value, byte(i)), nil
+					})).NotTo(HaveOccurred())
+				})
+
+				var value []byte
+				Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(HaveLen(numMerges))
+				sort.Slice(value, func(i, j int) bool { return value[i] < value[j] })
+				for i := range value {
+					Expect(value[i]).Should(Equal(byte(i)))
+				}
+			})
+
+			It("should not write when the merge function fails", func() {
+				rrdb := New(codec, 100)
+				merger := rrdb.(db.Merger)
+				Expect(rrdb.Insert("key", []byte{1})).NotTo(HaveOccurred())
+
+				errMerge := errors.New("merge failure")
+				var value []byte
+				Expect(merger.Merge("key", &value, func(found bool) (interface{}, error) {
+					Expect(found).Should(BeTrue())
+					Expect(value).Should(Equal([]byte{1}))
+					return nil, errMerge
+				})).Should(Equal(errMerge))
+
+				Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal([]byte{1}))
+			})
+		})
+	}
+
+	Context("when compacting merged values", func() {
+		appendFn := func(set *[]string, elem string) func(bool) (interface{}, error) {
+			return func(found bool) (interface{}, error) {
+				return append(*set, elem), nil
+			}
+		}
+
+		It("should compact values over the threshold", func() {
+			compactor := new(setCompactor)
+			rrdb := New(codec.JSONCodec, 100, CompactMergedValues(compactor, 32))
+			merger := rrdb.(db.Merger)
+
+			// Without compaction, the value would hold 100 elements.
+			for i := 0; i < 100; i++ {
+				var set []string
+				Expect(merger.Merge("key", &set, appendFn(&set, fmt.Sprintf("%v", i%3)))).NotTo(HaveOccurred())
+			}
+			// Duplicates are only removed once the value is over the
+			// threshold, so the value stays under it.
+			var set []string
+			Expect(rrdb.Get("key", &set)).NotTo(HaveOccurred())
+			Expect(len(set)).Should(BeNumerically("<", 10))
+			for _, elem := range set {
+				Expect(elem).Should(BeElementOf("0", "1", "2"))
+			}
+			Expect(rrdb.Bytes()).Should(BeNumerically("<=", 32))
+			Expect(compactor.calls).Should(BeNumerically(">", 0))
+		})
+
+		It("should not compact values under the threshold", func() {
+			compactor := new(setCompactor)
+			rrdb := New(codec.JSONCodec, 100, CompactMergedValues(compactor, 1024))
+			merger := rrdb.(db.Merger)
+
+			for i := 0; i < 10; i++ {
+				var set []string
+				Expect(merger.Merge("key", &set, appendFn(&set, "elem"))).NotTo(HaveOccurred())
+			}
+			var set []string
+			Expect(rrdb.Get("key", &set)).NotTo(HaveOccurred())
+			Expect(set).Should(HaveLen(10))
+			Expect(compactor.calls).Should(Equal(0))
+		})
+
+		It("should compact values before checking the max bytes", func() {
+			compactor := new(setCompactor)
+			rrdb := NewBounded(codec.JSONCodec, 100, 64, CompactMergedValues(compactor, 32))
+			merger := rrdb.(db.Merger)
+
+			// Each merge appends more bytes than the max bytes.
+			for i := 0; i < 10; i++ {
+				var set []string
+				Expect(merger.Merge("key", &set, func(found bool) (interface{}, error) {
+					for j := 0; j < 10; j++ {
+						set = append(set, "elem")
+					}
+					return set, nil
+				})).NotTo(HaveOccurred())
+			}
+			var set []string
+			Expect(rrdb.Get("key", &set)).NotTo(HaveOccurred())
+			Expect(set).Should(Equal([]string{"elem"}))
+		})
+
+		It("should not write when compacting fails", func() {
+			rrdb := New(codec.JSONCodec, 100, CompactMergedValues(new(setCompactor), 0))
+			merger := rrdb.(db.Merger)
+			Expect(rrdb.Insert("key", []string{"elem"})).NotTo(HaveOccurred())
+
+			var set []string
+			err := merger.Merge("key", &set, func(found bool) (interface{}, error) {
+				return "not a set", nil
+			})
+			Expect(err).Should(HaveOccurred())
+			Expect(rrdb.Get("key", &set)).NotTo(HaveOccurred())
+			Expect(set).Should(Equal([]string{"elem"}))
+		})
+	})
+
+	Context("when the number of entries is limited", func() {
+		It("should never store more than the max entries", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 10, 0)
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+
+				size, err := rrdb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(BeNumerically("<=", 10))
+			}
+
+			// The most recently inserted key should never be evicted.
+			var value []byte
+			Expect(rrdb.Get("99", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{99}))
+		})
+
+		It("should not evict when overwriting an existing key", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 10, 0)
+			for i := 0; i < 10; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			Expect(rrdb.Insert("0", []byte{42})).NotTo(HaveOccurred())
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(10))
+		})
+
+		It("should report the max entries as its capacity", func() {
+			Expect(New(codec.BinaryCodec, 10).Cap()).Should(Equal(10))
+			Expect(NewBounded(codec.BinaryCodec, 20, 100).Cap()).Should(Equal(20))
+			Expect(NewOrdered(codec.BinaryCodec, 30).Cap()).Should(Equal(30))
+
+			var capacitor db.Capacitor = New(codec.BinaryCodec, 40)
+			Expect(capacitor.Cap()).Should(Equal(40))
+		})
+	})
+
+	Context("when evicting in batches", func() {
+		It("should evict a batch when full and stay bounded", func() {
+			rrdb := NewWithEvictBatch(codec.BinaryCodec, 10, 3)
+			prevSize := 0
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+
+				size, err := rrdb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				if prevSize == 10 {
+					// A full batch should have been evicted to make room.
+					Expect(size).Should(Equal(8))
+				} else {
+					Expect(size).Should(Equal(prevSize + 1))
+				}
+				if i >= 10 {
+					Expect(size).Should(BeNumerically(">=", 10-3))
+				}
+				prevSize = size
+			}
+		})
+
+		It("should panic if the batch size is out of range", func() {
+			Expect(func() { NewWithEvictBatch(codec.BinaryCodec, 10, 0) }).Should(Panic())
+			Expect(func() { NewWithEvictBatch(codec.BinaryCodec, 10, 11) }).Should(Panic())
+		})
+	})
+
+	Context("when configuring what happens when full", func() {
+		It("should reject inserts and leave the size unchanged with RejectInsert", func() {
+			rrdb := New(codec.BinaryCodec, 10, OnFull(RejectInsert))
+			for i := 0; i < 10; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			Expect(rrdb.Insert("new", []byte{42})).Should(Equal(ErrStoreFull))
+			swapped, err := rrdb.(db.Swapper).Swap("new", []byte{42}, new([]byte))
+			Expect(err).Should(Equal(ErrStoreFull))
+			Expect(swapped).Should(BeFalse())
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(10))
+			var value []byte
+			Expect(rrdb.Get("new", &value)).Should(Equal(db.ErrKeyNotFound))
+			for i := 0; i < 10; i++ {
+				Expect(rrdb.Get(fmt.Sprintf("%v", i), &value)).NotTo(HaveOccurred())
+			}
+
+			// Existing keys can still be replaced, and deleting makes room.
+			Expect(rrdb.Insert("0", []byte{42})).NotTo(HaveOccurred())
+			Expect(rrdb.Delete("1")).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("new", []byte{42})).NotTo(HaveOccurred())
+		})
+
+		It("should reject inserts over the max bytes with RejectInsert", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 10, 4, OnFull(RejectInsert))
+			Expect(rrdb.Insert("a", []byte{1, 2})).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("b", []byte{1, 2})).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("c", []byte{1})).Should(Equal(ErrStoreFull))
+			Expect(rrdb.Insert("a", []byte{1, 2, 3})).Should(Equal(ErrStoreFull))
+			Expect(rrdb.Insert("a", []byte{1})).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("c", []byte{1})).NotTo(HaveOccurred())
+			Expect(rrdb.Bytes()).Should(Equal(4))
+		})
+
+		modes := []struct {
+			name string
+			mode OnFullMode
+		}{
+			{"EvictRandom", EvictRandom},
+			{"EvictThenInsert", EvictThenInsert},
+		}
+		for i := range modes {
+			mode := modes[i]
+
+			It(fmt.Sprintf("should keep the size at capacity with %v", mode.name), func() {
+				rrdb := New(codec.BinaryCodec, 10, OnFull(mode.mode))
+				for i := 0; i < 100; i++ {
+					Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+
+					size, err := rrdb.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					if i < 10 {
+						Expect(size).Should(Equal(i + 1))
+					} else {
+						Expect(size).Should(Equal(10))
+					}
+				}
+			})
+		}
+
+		It("should evict one at a time with EvictThenInsert, even with an evict batch", func() {
+			rrdb := NewWithEvictBatch(codec.BinaryCodec, 10, 3, OnFull(EvictThenInsert))
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+
+				size, err := rrdb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				if i >= 10 {
+					Expect(size).Should(Equal(10))
+				}
+			}
+		})
+	})
+
+	Context("when weighting the entries", func() {
+		// survivors inserts 50 heavy keys, followed by enough light keys to
+		// cause 500 evictions, and returns the number of heavy keys that are
+		// left.
+		survivors := func(rrdb DB) int {
+			for i := 0; i < 50; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("heavy_%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			for i := 0; i < 550; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("light_%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			size, err := rrdb.Size("heavy_")
+			Expect(err).NotTo(HaveOccurred())
+			return size
+		}
+
+		It("should keep entries with a high weight", func() {
+			weightFn := func(key string, value []byte) int {
+				if strings.HasPrefix(key, "heavy_") {
+					return 100
+				}
+				return 1
+			}
+			Expect(survivors(NewWeighted(codec.BinaryCodec, 100, weightFn))).Should(BeNumerically(">", 35))
+			Expect(survivors(New(codec.BinaryCodec, 100))).Should(BeNumerically("<", 10))
+		})
+
+		It("should stay bounded", func() {
+			rrdb := NewWeighted(codec.BinaryCodec, 10, func(key string, value []byte) int {
+				return len(key)
+			})
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(10))
+		})
+
+		It("should panic if the weight function is nil", func() {
+			Expect(func() { NewWeighted(codec.BinaryCodec, 10, nil) }).Should(Panic())
+		})
+	})
+
+	Context("when prioritising the entries", func() {
+		It("should keep entries with a high priority through a flood of low priority entries", func() {
+			rrdb := NewPriority(codec.BinaryCodec, 100)
+			for i := 0; i < 50; i++ {
+				Expect(rrdb.InsertWithPriority(fmt.Sprintf("high_%v", i), []byte{byte(i)}, 10)).NotTo(HaveOccurred())
+			}
+			for i := 0; i < 25; i++ {
+				Expect(rrdb.InsertWithPriority(fmt.Sprintf("mid_%v", i), []byte{byte(i)}, 5)).NotTo(HaveOccurred())
+			}
+			for i := 0; i < 1000; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("low_%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(100))
+			size, err = rrdb.Size("high_")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(50))
+			size, err = rrdb.Size("mid_")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(25))
+		})
+
+		It("should evict the lowest priority band first", func() {
+			rrdb := NewPriority(codec.BinaryCodec, 10)
+			for i := 0; i < 10; i++ {
+				Expect(rrdb.InsertWithPriority(fmt.Sprintf("%v", i), []byte{byte(i)}, i)).NotTo(HaveOccurred())
+			}
+
+			// Each insert should evict the key with the lowest priority that
+			// is left, which is never the key that was just inserted.
+			for i := 0; i < 9; i++ {
+				Expect(rrdb.InsertWithPriority(fmt.Sprintf("new_%v", i), []byte{byte(i)}, 100)).NotTo(HaveOccurred())
+				var value []byte
+				Expect(rrdb.Get(fmt.Sprintf("%v", i), &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(rrdb.Get(fmt.Sprintf("%v", i+1), &value)).NotTo(HaveOccurred())
+			}
+		})
+
+		It("should keep the priority when a key is inserted again", func() {
+			rrdb := NewPriority(codec.BinaryCodec, 2)
+			Expect(rrdb.InsertWithPriority("a", []byte{1}, 10)).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("a", []byte{2})).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("b", []byte{1})).NotTo(HaveOccurred())
+			Expect(rrdb.InsertWithPriority("c", []byte{1}, 10)).NotTo(HaveOccurred())
+
+			var value []byte
+			Expect(rrdb.Get("a", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{2}))
+			Expect(rrdb.Get("b", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(rrdb.InsertWithPriority("", []byte{1}, 10)).Should(Equal(db.ErrEmptyKey))
+		})
+
+		It("should replace the priority when a key is inserted again with a priority", func() {
+			rrdb := NewPriority(codec.BinaryCodec, 2)
+			Expect(rrdb.InsertWithPriority("a", []byte{1}, 10)).NotTo(HaveOccurred())
+			Expect(rrdb.InsertWithPriority("a", []byte{2}, 0)).NotTo(HaveOccurred())
+			Expect(rrdb.InsertWithPriority("b", []byte{1}, 5)).NotTo(HaveOccurred())
+			Expect(rrdb.InsertWithPriority("c", []byte{1}, 10)).NotTo(HaveOccurred())
+
+			var value []byte
+			Expect(rrdb.Get("a", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(rrdb.Get("b", &value)).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when deleting a range of keys", func() {
+		It("should delete the keys in the half-open range", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 10, 100)
+			for _, key := range []string{"a", "b", "bb", "c", "d"} {
+				Expect(rrdb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+
+			n, err := rrdb.(db.RangeDeleter).DeleteRange("b", "c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(2))
+			for _, key := range []string{"a", "c", "d"} {
+				var value []byte
+				Expect(rrdb.Get(key, &value)).NotTo(HaveOccurred())
+			}
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+			Expect(rrdb.Bytes()).Should(Equal(3))
+
+			n, err = rrdb.(db.RangeDeleter).DeleteRange("d", "a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(0))
+		})
+	})
+
+	Context("when streaming values", func() {
+		It("should buffer the value and enforce the limits", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 10, 4, RejectEmptyValues())
+			streamStore := rrdb.(db.StreamStore)
+
+			Expect(streamStore.InsertStream("key", bytes.NewReader([]byte{1, 2, 3}))).NotTo(HaveOccurred())
+			Expect(streamStore.InsertStream("key", bytes.NewReader([]byte{1, 2, 3, 4, 5}))).Should(Equal(ErrValueTooLarge{Size: 5, MaxBytes: 4}))
+			Expect(streamStore.InsertStream("key", bytes.NewReader(nil))).Should(Equal(ErrEmptyValue))
+
+			var value []byte
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{1, 2, 3}))
+
+			r, err := streamStore.GetStream("key")
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).Should(Equal([]byte{1, 2, 3}))
+
+			_, err = streamStore.GetStream("missing")
+			Expect(err).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when compacting", func() {
+		It("should rebuild the map and preserve the key/value pairs", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 10000)
+			for i := 0; i < 10000; i++ {
+				key := fmt.Sprintf("%v", i)
+				Expect(rrdb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+			for i := 0; i < 10000; i += 100 {
+				for j := i + 1; j < i+100; j++ {
+					Expect(rrdb.Delete(fmt.Sprintf("%v", j))).NotTo(HaveOccurred())
+				}
+			}
+
+			pointer := DataPointer(rrdb)
+			rrdb.Compact()
+			Expect(DataPointer(rrdb)).ShouldNot(Equal(pointer))
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(100))
+			Expect(rrdb.Bytes()).Should(BeNumerically(">", 0))
+
+			iter := rrdb.Iterator("")
+			defer iter.Close()
+			for i := 0; iter.Next(); i += 100 {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal(fmt.Sprintf("%v", i)))
+				var value []byte
+				Expect(iter.Value(&value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal([]byte(key)))
+			}
+
+			Expect(rrdb.Insert("new", []byte("new"))).NotTo(HaveOccurred())
+			Expect(rrdb.Delete("0")).NotTo(HaveOccurred())
+			size, err = rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(100))
+		})
+
+		It("should compact automatically when oversized if configured to", func() {
+			rrdb := New(codec.BinaryCodec, 2*MinCompactEntries, CompactWhenOversized(0.25))
+			for i := 0; i < 2*MinCompactEntries; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{1})).NotTo(HaveOccurred())
+			}
+
+			pointer := DataPointer(rrdb)
+			deleted := 0
+			for ; DataPointer(rrdb) == pointer; deleted++ {
+				Expect(rrdb.Delete(fmt.Sprintf("%v", deleted))).NotTo(HaveOccurred())
+			}
+			Expect(2*MinCompactEntries - deleted).Should(Equal(MinCompactEntries/2 - 1))
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(2*MinCompactEntries - deleted))
+		})
+
+		It("should not compact small dbs automatically", func() {
+			rrdb := New(codec.BinaryCodec, 100, CompactWhenOversized(0.25))
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{1})).NotTo(HaveOccurred())
+			}
+
+			pointer := DataPointer(rrdb)
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Delete(fmt.Sprintf("%v", i))).NotTo(HaveOccurred())
+			}
+			Expect(DataPointer(rrdb)).Should(Equal(pointer))
+		})
+	})
+
+	Context("when prewarming", func() {
+		It("should ignore a number of entries that is not positive", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 10)
+			Expect(rrdb.Insert("key", []byte{1})).NotTo(HaveOccurred())
+			rrdb.(db.Prewarmer).Prewarm(-100)
+
+			var value []byte
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{1}))
+		})
+
+		It("should keep the existing entries and stay bounded", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 10)
+			for i := 0; i < 5; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			rrdb.(db.Prewarmer).Prewarm(100)
+
+			iter := rrdb.Iterator("")
+			for i := 0; iter.Next(); i++ {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal(fmt.Sprintf("%v", i)))
+			}
+			iter.Close()
+
+			for i := 5; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(10))
+		})
+	})
+
+	Context("when inserting empty values", func() {
+		It("should accept them by default", func() {
+			rrdb := New(codec.BinaryCodec, 10)
+			Expect(rrdb.Insert("nil", []byte(nil))).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("empty", []byte{})).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("value", []byte{1})).NotTo(HaveOccurred())
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+		})
+
+		It("should get nil values as non-nil empty values with any codec", func() {
+			for _, codec := range testutil.Codecs {
+				rrdb := New(codec, 10)
+				Expect(rrdb.Insert("nil", nil)).NotTo(HaveOccurred())
+				Expect(rrdb.Insert("nilSlice", []byte(nil))).NotTo(HaveOccurred())
+				Expect(rrdb.Insert("nilMap", map[string]int64(nil))).NotTo(HaveOccurred())
+
+				for _, key := range []string{"nil", "nilSlice"} {
+					value := []byte{1}
+					Expect(rrdb.Get(key, &value)).NotTo(HaveOccurred())
+					Expect(value).ShouldNot(BeNil())
+					Expect(value).Should(BeEmpty())
+				}
+				m := map[string]int64{"stale": 1}
+				Expect(rrdb.Get("nilMap", &m)).NotTo(HaveOccurred())
+				Expect(m).ShouldNot(BeNil())
+				Expect(m).Should(BeEmpty())
+				n := int64(1)
+				Expect(rrdb.Get("nil", &n)).NotTo(HaveOccurred())
+				Expect(n).Should(Equal(int64(0)))
+
+				iter := rrdb.Iterator("nil")
+				for iter.Next() {
+					value := []byte{1}
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(value).ShouldNot(BeNil())
+					Expect(value).Should(BeEmpty())
+				}
+				iter.Close()
+
+				// Nil values should be compared as empty values.
+				swapped, err := rrdb.(db.CompareAndSwapper).CompareAndSwap("nilSlice", []byte(nil), []byte{1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(swapped).Should(BeTrue())
+			}
+		})
+
+		It("should reject them if configured to", func() {
+			rrdb := New(codec.BinaryCodec, 10, RejectEmptyValues())
+			Expect(rrdb.Insert("nil", nil)).Should(Equal(ErrEmptyValue))
+			Expect(rrdb.Insert("nil", []byte(nil))).Should(Equal(ErrEmptyValue))
+			Expect(rrdb.Insert("empty", []byte{})).Should(Equal(ErrEmptyValue))
+			Expect(rrdb.Insert("value", []byte{1})).NotTo(HaveOccurred())
+
+			merger := rrdb.(db.Merger)
+			var value []byte
+			Expect(merger.Merge("value", &value, func(bool) (interface{}, error) {
+				return []byte{}, nil
+			})).Should(Equal(ErrEmptyValue))
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+		})
+
+		It("should reject values with a length of zero regardless of the codec", func() {
+			rrdb := New(codec.JSONCodec, 10, RejectEmptyValues())
+			Expect(rrdb.Insert("empty", "")).Should(Equal(ErrEmptyValue))
+			Expect(rrdb.Insert("empty", map[string]int{})).Should(Equal(ErrEmptyValue))
+			Expect(rrdb.Insert("value", "value")).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when values share memory with their encoding", func() {
+		It("should not copy them by default", func() {
+			rrdb := New(codec.BinaryCodec, 10)
+			Expect(rrdb.Insert("key", rawBytes{1, 2, 3})).NotTo(HaveOccurred())
+
+			var value rawBytes
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			value[0] = 0
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(rawBytes{0, 2, 3}))
+		})
+
+		It("should copy them on get if configured to", func() {
+			rrdb := New(codec.BinaryCodec, 10, CopyOnGet())
+			Expect(rrdb.Insert("key", rawBytes{1, 2, 3})).NotTo(HaveOccurred())
+
+			var value rawBytes
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			value[0] = 0
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(rawBytes{1, 2, 3}))
+
+			iter := rrdb.Iterator("")
+			defer iter.Close()
+			Expect(iter.Next()).Should(BeTrue())
+			Expect(iter.Value(&value)).NotTo(HaveOccurred())
+			value[0] = 0
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(rawBytes{1, 2, 3}))
+		})
+
+		It("should copy them on insert if configured to", func() {
+			rrdb := New(codec.BinaryCodec, 10, CopyOnInsert())
+			inserted := rawBytes{1, 2, 3}
+			Expect(rrdb.Insert("key", inserted)).NotTo(HaveOccurred())
+			inserted[0] = 0
+
+			var value rawBytes
+			Expect(rrdb.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(rawBytes{1, 2, 3}))
+		})
+	})
+
+	Context("when the number of bytes is limited", func() {
+		It("should never store more than the max bytes", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 1000, 100)
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%v", i), make([]byte, 30))).NotTo(HaveOccurred())
+				Expect(rrdb.Bytes()).Should(BeNumerically("<=", 100))
+			}
+
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+			Expect(rrdb.Bytes()).Should(Equal(90))
+		})
+
+		It("should update the number of bytes when deleting", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 1000, 100)
+			Expect(rrdb.Insert("key", make([]byte, 30))).NotTo(HaveOccurred())
+			Expect(rrdb.Bytes()).Should(Equal(30))
+			Expect(rrdb.Delete("key")).NotTo(HaveOccurred())
+			Expect(rrdb.Bytes()).Should(Equal(0))
+		})
+
+		It("should reject a value that is larger than the max bytes", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 1000, 100)
+			Expect(rrdb.Insert("small", make([]byte, 100))).NotTo(HaveOccurred())
+
+			err := rrdb.Insert("large", make([]byte, 101))
+			Expect(err).Should(Equal(ErrValueTooLarge{Size: 101, MaxBytes: 100}))
+
+			// The existing value should not be evicted by the rejected value.
+			var value []byte
+			Expect(rrdb.Get("small", &value)).NotTo(HaveOccurred())
+			Expect(rrdb.Get("large", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when both the number of entries and bytes are limited", func() {
+		It("should satisfy both limits", func() {
+			rrdb := NewBounded(codec.BinaryCodec, 5, 100)
+
+			// Small values will trip the entries limit.
+			for i := 0; i < 20; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("small%v", i), make([]byte, 1))).NotTo(HaveOccurred())
+			}
+			size, err := rrdb.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(5))
+			Expect(rrdb.Bytes()).Should(Equal(5))
+
+			// Large values will trip the bytes limit.
+			for i := 0; i < 20; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("large%v", i), make([]byte, 40))).NotTo(HaveOccurred())
+
+				size, err := rrdb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(BeNumerically("<=", 5))
+				Expect(rrdb.Bytes()).Should(BeNumerically("<=", 100))
+			}
+		})
+	})
+
+	Context("when iterating in chunks", func() {
+		It("should iterate over every key/value pair with the prefix", func() {
+			for _, chunkSize := range []int{1, 7, 100, 1000} {
+				rrdb := New(codec.BinaryCodec, 1000)
+				for i := 0; i < 100; i++ {
+					Expect(rrdb.Insert(fmt.Sprintf("key%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+					Expect(rrdb.Insert(fmt.Sprintf("other%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+				}
+
+				iter := rrdb.ChunkedIterator("key", chunkSize)
+				_, err := iter.Key()
+				Expect(err).Should(Equal(db.ErrIndexOutOfRange))
+
+				seen := map[string]bool{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value []byte
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(key).Should(Equal(fmt.Sprintf("%v", value[0])))
+					Expect(seen[key]).Should(BeFalse())
+					seen[key] = true
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(seen).Should(HaveLen(100))
+				Expect(iter.Value(new([]byte))).Should(Equal(db.ErrIndexOutOfRange))
+				iter.Close()
+			}
+		})
+
+		It("should let writers make progress between chunks", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 1000)
+			for i := 0; i < 100; i++ {
+				Expect(rrdb.Insert(fmt.Sprintf("%03d", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+
+			iter := rrdb.ChunkedIterator("", 10)
+			defer iter.Close()
+			Expect(iter.Next()).Should(BeTrue())
+
+			// Writes should not be blocked by the iterator.
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(rrdb.Insert("new", []byte{0})).NotTo(HaveOccurred())
+				Expect(rrdb.Delete("050")).NotTo(HaveOccurred())
+				Expect(rrdb.Insert("060", []byte{255})).NotTo(HaveOccurred())
+			}()
+			Eventually(done).Should(BeClosed())
+
+			keys := []string{"000"}
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				var value []byte
+				Expect(iter.Value(&value)).NotTo(HaveOccurred())
+				if key == "060" {
+					Expect(value).Should(Equal([]byte{255}))
+				}
+				keys = append(keys, key)
+			}
+
+			// Keys inserted after the iterator was created are not seen, and
+			// keys deleted before their chunk was read are skipped.
+			Expect(keys).Should(HaveLen(99))
+			Expect(keys).ShouldNot(ContainElement("new"))
+			Expect(keys).ShouldNot(ContainElement("050"))
+		})
+
+		It("should panic if the chunk size is not positive", func() {
+			rrdb := New(codec.BinaryCodec, 10)
+			Expect(func() { rrdb.ChunkedIterator("", 0) }).Should(Panic())
+		})
+	})
+
+	Context("when the db is ordered", func() {
+		keys := func(rrdb DB, prefix string) []string {
+			iter := rrdb.Iterator(prefix)
+			defer iter.Close()
+
+			keys := []string{}
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				keys = append(keys, key)
+			}
+			Expect(iter.Err()).NotTo(HaveOccurred())
+			return keys
+		}
+
+		It("should iterate in insertion order", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 100)
+			expected := []string{}
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprintf("%v", (i*7)%50)
+				Expect(rrdb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+				expected = append(expected, key)
+			}
+			Expect(keys(rrdb, "")).Should(Equal(expected))
+
+			// Iterating over a prefix should preserve the order.
+			expectedWithPrefix := []string{}
+			for _, key := range expected {
+				if strings.HasPrefix(key, "1") {
+					expectedWithPrefix = append(expectedWithPrefix, strings.TrimPrefix(key, "1"))
+				}
+			}
+			Expect(keys(rrdb, "1")).Should(Equal(expectedWithPrefix))
+		})
+
+		It("should keep the order consistent after deletes and re-inserts", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 100)
+			for _, key := range []string{"a", "b", "c", "d"} {
+				Expect(rrdb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+			}
+			Expect(rrdb.Delete("b")).NotTo(HaveOccurred())
+			Expect(rrdb.Insert("a", []byte("a"))).NotTo(HaveOccurred())
+			Expect(keys(rrdb, "")).Should(Equal([]string{"c", "d", "a"}))
+
+			iter := rrdb.Iterator("")
+			defer iter.Close()
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				var value []byte
+				Expect(iter.Value(&value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal([]byte(key)))
+			}
+		})
+
+		It("should keep the order consistent after evictions", func() {
+			rrdb := NewOrdered(codec.BinaryCodec, 10)
+			inserted := []string{}
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("%v", i)
+				Expect(rrdb.Insert(key, []byte(key))).NotTo(HaveOccurred())
+				inserted = append(inserted, key)
+			}
+
+			// The remaining keys should be a subsequence of the inserted keys.
+			remaining := keys(rrdb, "")
+			Expect(remaining).Should(HaveLen(10))
+			j := 0
+			for _, key := range inserted {
+				if j < len(remaining) && remaining[j] == key {
+					j++
+				}
+			}
+			Expect(j).Should(Equal(len(remaining)))
+		})
+	})
+
+	Context("when using copy-on-write", func() {
+		It("should be able to do read, write and delete", func() {
+			for _, codec := range testutil.Codecs {
+				cow := NewCOW(codec, 100)
+				value := testutil.RandomTestStruct()
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(cow.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+				Expect(cow.Insert("key", value)).NotTo(HaveOccurred())
+				Expect(cow.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+				Expect(cow.Delete("key")).NotTo(HaveOccurred())
+				Expect(cow.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+
+				Expect(cow.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+				Expect(cow.Get("", &stored)).Should(Equal(db.ErrEmptyKey))
+				Expect(cow.Delete("")).Should(Equal(db.ErrEmptyKey))
+			}
+		})
+
+		It("should never store more than the max entries", func() {
+			cow := NewCOW(codec.BinaryCodec, 10)
+			for i := 0; i < 100; i++ {
+				Expect(cow.Insert(fmt.Sprintf("%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+
+				size, err := cow.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				if i < 10 {
+					Expect(size).Should(Equal(i + 1))
+				} else {
+					Expect(size).Should(Equal(10))
+				}
+			}
+
+			// The most recently inserted key should never be evicted, and
+			// overwriting an existing key should not evict.
+			var value []byte
+			Expect(cow.Get("99", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal([]byte{99}))
+			Expect(cow.Insert("99", []byte{42})).NotTo(HaveOccurred())
+			size, err := cow.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(10))
+		})
+
+		It("should not let writes affect iterators that have been created", func() {
+			cow := NewCOW(codec.BinaryCodec, 100)
+			for i := 0; i < 10; i++ {
+				Expect(cow.Insert(fmt.Sprintf("key%v", i), []byte{byte(i)})).NotTo(HaveOccurred())
+			}
+
+			iter := cow.Iterator("key")
+			defer iter.Close()
+			Expect(cow.Delete("key0")).NotTo(HaveOccurred())
+			Expect(cow.Insert("key1", []byte{42})).NotTo(HaveOccurred())
+			Expect(cow.Insert("key10", []byte{10})).NotTo(HaveOccurred())
+
+			seen := map[string]byte{}
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				var value []byte
+				Expect(iter.Value(&value)).NotTo(HaveOccurred())
+				seen[key] = value[0]
+			}
+			Expect(seen).Should(HaveLen(10))
+			for i := 0; i < 10; i++ {
+				Expect(seen[fmt.Sprintf("%v", i)]).Should(Equal(byte(i)))
+			}
+		})
+
+		It("should not lose concurrent writes", func() {
+			cow := NewCOW(codec.BinaryCodec, 1000)
+			phi.ParForAll(100, func(i int) {
+				key := fmt.Sprintf("%v", i)
+				Expect(cow.Insert(key, []byte{byte(i)})).NotTo(HaveOccurred())
+				var value []byte
+				Expect(cow.Get(key, &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal([]byte{byte(i)}))
+			})
+
+			size, err := cow.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(100))
+		})
+	})
+})
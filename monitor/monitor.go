@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"errors"
+	"expvar"
+	"sync/atomic"
+
+	"github.com/renproject/kv/db"
+)
+
+// A Sizer is a `db.DB` that knows the number of bytes used by its values.
+type Sizer interface {
+	Bytes() int
+}
+
+// The names of the variables in the expvar map of a monitored `db.DB`.
+const (
+	VarSize     = "size"
+	VarCapacity = "capacity"
+	VarBytes    = "bytes"
+	VarInserts  = "inserts"
+	VarGets     = "gets"
+	VarDeletes  = "deletes"
+	VarMisses   = "misses"
+	VarErrors   = "errors"
+)
+
+type monitorDB struct {
+	// The counters are accessed atomically, so they are the first fields to
+	// keep them 64-bit aligned on 32-bit platforms.
+	inserts int64
+	gets    int64
+	deletes int64
+	misses  int64
+	errors  int64
+
+	inner db.DB
+}
+
+// Wrap returns a `db.DB` that publishes gauges and counters of the inner
+// `db.DB` as an expvar map with the given name, so that they are served by the
+// expvar handler along with the other variables of the process. The map holds
+// the current size, the capacity if the inner `db.DB` is a `db.Capacitor`, the
+// number of bytes if it is a Sizer, and the number of inserts, gets, and
+// deletes. Gets of keys that are not found are counted as misses, and other
+// failed operations are counted as errors. The size is read from the inner
+// `db.DB` whenever the map is read, and is -1 if it cannot be read. Like
+// `expvar.NewMap`, it panics if the name is already in use.
+func Wrap(inner db.DB, name string) db.DB {
+	monitorDB := &monitorDB{inner: inner}
+
+	vars := expvar.NewMap(name)
+	vars.Set(VarSize, expvar.Func(func() interface{} {
+		size, err := inner.Size("")
+		if err != nil {
+			return -1
+		}
+		return size
+	}))
+	if capacitor, ok := inner.(db.Capacitor); ok {
+		vars.Set(VarCapacity, expvar.Func(func() interface{} {
+			return capacitor.Cap()
+		}))
+	}
+	if sizer, ok := inner.(Sizer); ok {
+		vars.Set(VarBytes, expvar.Func(func() interface{} {
+			return sizer.Bytes()
+		}))
+	}
+	vars.Set(VarInserts, counter(&monitorDB.inserts))
+	vars.Set(VarGets, counter(&monitorDB.gets))
+	vars.Set(VarDeletes, counter(&monitorDB.deletes))
+	vars.Set(VarMisses, counter(&monitorDB.misses))
+	vars.Set(VarErrors, counter(&monitorDB.errors))
+	return monitorDB
+}
+
+// Close implements the `db.DB` interface.
+func (monitorDB *monitorDB) Close() error {
+	return monitorDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (monitorDB *monitorDB) Insert(key string, value interface{}) error {
+	atomic.AddInt64(&monitorDB.inserts, 1)
+	return monitorDB.record(monitorDB.inner.Insert(key, value))
+}
+
+// Get implements the `db.DB` interface.
+func (monitorDB *monitorDB) Get(key string, value interface{}) error {
+	atomic.AddInt64(&monitorDB.gets, 1)
+	return monitorDB.record(monitorDB.inner.Get(key, value))
+}
+
+// Delete implements the `db.DB` interface.
+func (monitorDB *monitorDB) Delete(key string) error {
+	atomic.AddInt64(&monitorDB.deletes, 1)
+	return monitorDB.record(monitorDB.inner.Delete(key))
+}
+
+// Size implements the `db.DB` interface.
+func (monitorDB *monitorDB) Size(prefix string) (int, error) {
+	return monitorDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (monitorDB *monitorDB) Iterator(prefix string) db.Iterator {
+	return monitorDB.inner.Iterator(prefix)
+}
+
+// record the error of an operation in the counters, and return it.
+func (monitorDB *monitorDB) record(err error) error {
+	if errors.Is(err, db.ErrKeyNotFound) {
+		atomic.AddInt64(&monitorDB.misses, 1)
+	} else if err != nil {
+		atomic.AddInt64(&monitorDB.errors, 1)
+	}
+	return err
+}
+
+// counter returns an expvar variable that reads the atomic counter.
+func counter(n *int64) expvar.Func {
+	return func() interface{} {
+		return atomic.LoadInt64(n)
+	}
+}
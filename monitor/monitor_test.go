@@ -0,0 +1,75 @@
+package monitor_test
+
+import (
+	"expvar"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/monitor"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+// readVar reads the variable from the expvar map with the given name.
+func readVar(name, key string) string {
+	vars, ok := expvar.Get(name).(*expvar.Map)
+	Expect(ok).Should(BeTrue())
+	v := vars.Get(key)
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+var _ = Describe("monitored db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when operating on the db", func() {
+			It("should publish the gauges and counters", func() {
+				name := fmt.Sprintf("rrdb-%v", codec)
+				inner := rrdb.New(codec, 100)
+				database := Wrap(inner, name)
+
+				for i := 0; i < 10; i++ {
+					Expect(database.Insert(fmt.Sprintf("%v", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+				Expect(database.Delete("0")).Should(Succeed())
+				value := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("1", &value)).Should(Succeed())
+				Expect(database.Get("0", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+
+				Expect(readVar(name, VarSize)).Should(Equal("9"))
+				Expect(readVar(name, VarCapacity)).Should(Equal("100"))
+				Expect(readVar(name, VarBytes)).Should(Equal(fmt.Sprintf("%v", inner.Bytes())))
+				Expect(readVar(name, VarInserts)).Should(Equal("11"))
+				Expect(readVar(name, VarGets)).Should(Equal("2"))
+				Expect(readVar(name, VarDeletes)).Should(Equal("1"))
+				Expect(readVar(name, VarMisses)).Should(Equal("1"))
+				Expect(readVar(name, VarErrors)).Should(Equal("1"))
+			})
+
+			It("should only publish the gauges that the db supports", func() {
+				name := fmt.Sprintf("memdb-%v", codec)
+				database := Wrap(memdb.New(codec), name)
+				Expect(database.Insert("key", testutil.RandomTestStruct())).Should(Succeed())
+
+				Expect(readVar(name, VarSize)).Should(Equal("1"))
+				Expect(readVar(name, VarCapacity)).Should(BeEmpty())
+				Expect(readVar(name, VarBytes)).Should(BeEmpty())
+			})
+		})
+	}
+
+	Context("when the name is already in use", func() {
+		It("should panic", func() {
+			Wrap(memdb.New(testutil.Codecs[0]), "duplicate")
+			Expect(func() { Wrap(memdb.New(testutil.Codecs[0]), "duplicate") }).Should(Panic())
+		})
+	})
+})
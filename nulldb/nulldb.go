@@ -0,0 +1,80 @@
+package nulldb
+
+import (
+	"github.com/renproject/kv/db"
+)
+
+// nulldb is an implementation of the `db.DB` that discards all of the data
+// written to it. It is useful as a baseline when benchmarking code that uses a
+// `db.DB`, and as a sink for data that is not needed.
+type nulldb struct{}
+
+// New returns a new nulldb. It is safe for concurrent use.
+func New() db.DB {
+	return nulldb{}
+}
+
+// Close implements the `db.DB` interface.
+func (nulldb) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface. The value is discarded.
+func (nulldb) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return nil
+}
+
+// Get implements the `db.DB` interface. It always returns ErrKeyNotFound.
+func (nulldb) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return db.ErrKeyNotFound
+}
+
+// Delete implements the `db.DB` interface.
+func (nulldb) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return nil
+}
+
+// Size implements the `db.DB` interface. It always returns zero.
+func (nulldb) Size(prefix string) (int, error) {
+	return 0, nil
+}
+
+// Iterator implements the `db.DB` interface. The iterator is always empty.
+func (nulldb) Iterator(prefix string) db.Iterator {
+	return iterator{}
+}
+
+// iterator is an empty implementation of the `db.Iterator`.
+type iterator struct{}
+
+// Next implements the `db.Iterator` interface.
+func (iterator) Next() bool {
+	return false
+}
+
+// Key implements the `db.Iterator` interface.
+func (iterator) Key() (string, error) {
+	return "", db.ErrIndexOutOfRange
+}
+
+// Value implements the `db.Iterator` interface.
+func (iterator) Value(value interface{}) error {
+	return db.ErrIndexOutOfRange
+}
+
+// Err implements the `db.Iterator` interface.
+func (iterator) Err() error {
+	return nil
+}
+
+// Close implements the `db.Iterator` interface.
+func (iterator) Close() {}
@@ -0,0 +1,13 @@
+package nulldb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNulldb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Nulldb Suite")
+}
@@ -0,0 +1,67 @@
+package nulldb_test
+
+import (
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/nulldb"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("null implementation of the db", func() {
+	Context("when doing operations on a null db", func() {
+		It("should never store anything", func() {
+			nulldb := New()
+			defer nulldb.Close()
+
+			test := func(key string, value testutil.TestStruct) bool {
+				// Will test empty in negative tests.
+				if key == "" {
+					return true
+				}
+
+				Expect(nulldb.Insert(key, value)).NotTo(HaveOccurred())
+				val := testutil.TestStruct{}
+				Expect(nulldb.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+				Expect(nulldb.Delete(key)).NotTo(HaveOccurred())
+
+				size, err := nulldb.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+
+				return true
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+		})
+
+		It("should return an empty iterator", func() {
+			nulldb := New()
+			defer nulldb.Close()
+
+			Expect(nulldb.Insert("key", []byte{1, 2, 3})).NotTo(HaveOccurred())
+
+			iter := nulldb.Iterator("")
+			defer iter.Close()
+			Expect(iter.Next()).Should(BeFalse())
+
+			_, err := iter.Key()
+			Expect(err).Should(Equal(db.ErrIndexOutOfRange))
+			var value []byte
+			Expect(iter.Value(&value)).Should(Equal(db.ErrIndexOutOfRange))
+		})
+
+		It("should return ErrEmptyKey when doing operations with empty keys", func() {
+			nulldb := New()
+			defer nulldb.Close()
+
+			value := testutil.RandomTestStruct()
+			Expect(nulldb.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+			Expect(nulldb.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+			Expect(nulldb.Delete("")).Should(Equal(db.ErrEmptyKey))
+		})
+	})
+})
@@ -0,0 +1,481 @@
+package readrepair
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// A Version of a key read from the primary or the replica.
+type Version struct {
+	// Found is false if the key does not exist.
+	Found bool
+	// Value is a pointer to the value.
+	Value interface{}
+	// Timestamp is the time at which the value was written. If the key has
+	// been deleted, it is the time at which it was deleted, and if the key has
+	// never been written, it is the zero time.
+	Timestamp time.Time
+}
+
+// A Resolver decides which version of a key wins when the primary and the
+// replica disagree. It returns the winning version, which can be a new version
+// that merges both, and whether or not the winning version should be written
+// back to both the primary and the replica. If the winning version is not
+// found, then the key is reported as not found, and writing it back deletes
+// the key.
+type Resolver func(key string, primary, replica Version) (Version, bool, error)
+
+// LastWriterWins returns a Resolver that picks the version with the latest
+// timestamp, so a delete wins over an older value, and the other way around.
+// If both versions have the same timestamp, the primary wins.
+func LastWriterWins(writeBack bool) Resolver {
+	return func(key string, primary, replica Version) (Version, bool, error) {
+		if replica.Timestamp.After(primary.Timestamp) {
+			return replica, writeBack, nil
+		}
+		return primary, writeBack, nil
+	}
+}
+
+// An Option configures the `db.DB` returned by Wrap.
+type Option func(*readRepairDB)
+
+// WithResolver reads from both the primary and the replica, and uses the
+// resolver to decide which value is returned when they disagree. This
+// requires the time at which each value was written, so values are stored in
+// the primary and the replica as the timestamp followed by the value encoded
+// with the codec. Deletes are stored as tombstones with the time at which the
+// key was deleted, so that a delete that only reached one of them is not
+// undone by the other. Tombstones are kept until the key is written again.
+// The primary and the replica must therefore only be written to using a
+// `db.DB` with a resolver.
+func WithResolver(codec db.Codec, resolver Resolver) Option {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	return func(readRepairDB *readRepairDB) {
+		readRepairDB.codec = codec
+		readRepairDB.resolver = resolver
+	}
+}
+
+// WithClock replaces the clock that is used to timestamp values written with a
+// resolver. By default, `time.Now` is used.
+func WithClock(now func() time.Time) Option {
+	return func(readRepairDB *readRepairDB) {
+		readRepairDB.now = now
+	}
+}
+
+type readRepairDB struct {
+	primary db.DB
+	replica db.DB
+	now     func() time.Time
+
+	// writeMu is held for reading by inserts and deletes, and for writing by
+	// repairs, so that a repair cannot overwrite a write that happens between
+	// reading the key and repairing it.
+	writeMu *sync.RWMutex
+
+	// resolver is nil if values are read from the primary, and used to repair
+	// the replica.
+	resolver Resolver
+	codec    db.Codec
+
+	// repairs that are in progress, so that they can be waited on before
+	// closing. No repairs are started once closed is set, which is protected
+	// by closeMu, so that adding to repairs never races with waiting on it.
+	repairs *sync.WaitGroup
+	closeMu *sync.Mutex
+	closed  bool
+}
+
+// Wrap returns a `db.DB` that writes to both the primary and the replica, and
+// reads from the primary. After each successful read, the replica is repaired
+// in the background if it is missing the key or has a different value, so
+// that the replica becomes eventually consistent through normal traffic.
+// Values are compared using `reflect.DeepEqual`. By default, the primary
+// always wins, but this can be changed by using WithResolver. Repairs are only
+// atomic with respect to writes made through the returned `db.DB`.
+func Wrap(primary, replica db.DB, opts ...Option) db.DB {
+	readRepairDB := &readRepairDB{
+		primary: primary,
+		replica: replica,
+		now:     time.Now,
+		writeMu: new(sync.RWMutex),
+		repairs: new(sync.WaitGroup),
+		closeMu: new(sync.Mutex),
+	}
+	for _, opt := range opts {
+		opt(readRepairDB)
+	}
+	return readRepairDB
+}
+
+// Close implements the `db.DB` interface. It waits for repairs that are in
+// progress, and then closes both the primary and the replica. Reads that
+// happen after Close has been called do not start repairs.
+func (readRepairDB *readRepairDB) Close() error {
+	readRepairDB.closeMu.Lock()
+	readRepairDB.closed = true
+	readRepairDB.closeMu.Unlock()
+
+	readRepairDB.repairs.Wait()
+	if err := readRepairDB.primary.Close(); err != nil {
+		return err
+	}
+	return readRepairDB.replica.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (readRepairDB *readRepairDB) Insert(key string, value interface{}) error {
+	if readRepairDB.resolver != nil {
+		return readRepairDB.write(key, Version{Found: true, Value: value, Timestamp: readRepairDB.now()})
+	}
+	return readRepairDB.insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (readRepairDB *readRepairDB) Get(key string, value interface{}) error {
+	if readRepairDB.resolver != nil {
+		return readRepairDB.resolve(key, value)
+	}
+	if err := readRepairDB.primary.Get(key, value); err != nil {
+		return err
+	}
+
+	valueType := reflect.TypeOf(value).Elem()
+	readRepairDB.goRepair(func() {
+		if err := readRepairDB.repair(key, valueType); err != nil {
+			log.Println(fmt.Errorf("failed to repair key=%v: %w", key, err))
+		}
+	})
+	return nil
+}
+
+// Delete implements the `db.DB` interface. With a resolver, a tombstone is
+// written instead of deleting the key.
+func (readRepairDB *readRepairDB) Delete(key string) error {
+	if readRepairDB.resolver != nil {
+		if key == "" {
+			return db.ErrEmptyKey
+		}
+		return readRepairDB.write(key, Version{Timestamp: readRepairDB.now()})
+	}
+
+	readRepairDB.writeMu.RLock()
+	defer readRepairDB.writeMu.RUnlock()
+
+	if err := readRepairDB.primary.Delete(key); err != nil {
+		return err
+	}
+	if err := readRepairDB.replica.Delete(key); err != nil {
+		return fmt.Errorf("error deleting from replica: %w", err)
+	}
+	return nil
+}
+
+// Size implements the `db.DB` interface. With a resolver, the values in the
+// primary are iterated over so that tombstones are not counted.
+func (readRepairDB *readRepairDB) Size(prefix string) (int, error) {
+	if readRepairDB.resolver == nil {
+		return readRepairDB.primary.Size(prefix)
+	}
+
+	iter := readRepairDB.Iterator(prefix)
+	defer iter.Close()
+
+	size := 0
+	for iter.Next() {
+		size++
+	}
+	return size, iter.Err()
+}
+
+// Iterator implements the `db.DB` interface. With a resolver, tombstones are
+// skipped.
+func (readRepairDB *readRepairDB) Iterator(prefix string) db.Iterator {
+	if readRepairDB.resolver != nil {
+		return &versionIterator{
+			Iterator:     readRepairDB.primary.Iterator(prefix),
+			readRepairDB: readRepairDB,
+		}
+	}
+	return readRepairDB.primary.Iterator(prefix)
+}
+
+// goRepair runs the repair in the background, unless the db has been closed.
+func (readRepairDB *readRepairDB) goRepair(repair func()) {
+	readRepairDB.closeMu.Lock()
+	defer readRepairDB.closeMu.Unlock()
+
+	if readRepairDB.closed {
+		return
+	}
+	readRepairDB.repairs.Add(1)
+	go func() {
+		defer readRepairDB.repairs.Done()
+		repair()
+	}()
+}
+
+// insert the value into both the primary and the replica.
+func (readRepairDB *readRepairDB) insert(key string, value interface{}) error {
+	readRepairDB.writeMu.RLock()
+	defer readRepairDB.writeMu.RUnlock()
+
+	if err := readRepairDB.primary.Insert(key, value); err != nil {
+		return err
+	}
+	if err := readRepairDB.replica.Insert(key, value); err != nil {
+		return fmt.Errorf("error writing to replica: %w", err)
+	}
+	return nil
+}
+
+// write the encoded version into both the primary and the replica.
+func (readRepairDB *readRepairDB) write(key string, version Version) error {
+	data, err := readRepairDB.encode(version)
+	if err != nil {
+		return err
+	}
+	return readRepairDB.insert(key, data)
+}
+
+// repair the key in the replica. The value is read from the primary again,
+// instead of using the value that was returned to the caller, so that the
+// caller is free to modify it, and so that a write since the read is not
+// overwritten.
+func (readRepairDB *readRepairDB) repair(key string, valueType reflect.Type) error {
+	readRepairDB.writeMu.Lock()
+	defer readRepairDB.writeMu.Unlock()
+
+	primaryValue := reflect.New(valueType)
+	if err := readRepairDB.primary.Get(key, primaryValue.Interface()); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	replicaValue := reflect.New(valueType)
+	err := readRepairDB.replica.Get(key, replicaValue.Interface())
+	if err == nil && reflect.DeepEqual(primaryValue.Elem().Interface(), replicaValue.Elem().Interface()) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+		return err
+	}
+	return readRepairDB.replica.Insert(key, primaryValue.Elem().Interface())
+}
+
+// resolve the value of the key from the primary and the replica.
+func (readRepairDB *readRepairDB) resolve(key string, value interface{}) error {
+	dest := reflect.ValueOf(value)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("expected non-nil pointer, got %T", value)
+	}
+	valueType := dest.Elem().Type()
+
+	primaryData, primary, err := readRepairDB.version(readRepairDB.primary, key, valueType)
+	if err != nil {
+		return err
+	}
+	replicaData, replica, err := readRepairDB.version(readRepairDB.replica, key, valueType)
+	if err != nil {
+		return fmt.Errorf("error reading from replica: %w", err)
+	}
+	if !primary.Found && !replica.Found {
+		return db.ErrKeyNotFound
+	}
+
+	winner, writeBack, err := readRepairDB.resolver(key, primary, replica)
+	if err != nil {
+		return err
+	}
+	if winner.Found {
+		src := reflect.ValueOf(winner.Value)
+		if src.Kind() != reflect.Ptr || src.Type() != dest.Type() {
+			return fmt.Errorf("expected resolved value of type %v, got %T", dest.Type(), winner.Value)
+		}
+		dest.Elem().Set(src.Elem())
+	}
+
+	if writeBack {
+		readRepairDB.goRepair(func() {
+			if err := readRepairDB.writeBack(key, winner, primary, replica, primaryData, replicaData); err != nil {
+				log.Println(fmt.Errorf("failed to write back key=%v: %w", key, err))
+			}
+		})
+	}
+	if !winner.Found {
+		return db.ErrKeyNotFound
+	}
+	return nil
+}
+
+// writeBack the winning version to the primary and the replica, if it is
+// different from their version. Each of them is only written if it still has
+// the data that was read before resolving, so that a write that happened since
+// is not overwritten.
+func (readRepairDB *readRepairDB) writeBack(key string, winner, primary, replica Version, primaryData, replicaData []byte) error {
+	data, err := readRepairDB.encode(winner)
+	if err != nil {
+		return err
+	}
+
+	readRepairDB.writeMu.Lock()
+	defer readRepairDB.writeMu.Unlock()
+
+	if !sameVersion(winner, primary) {
+		if err := writeIfUnchanged(readRepairDB.primary, key, primaryData, data); err != nil {
+			return err
+		}
+	}
+	if !sameVersion(winner, replica) {
+		if err := writeIfUnchanged(readRepairDB.replica, key, replicaData, data); err != nil {
+			return fmt.Errorf("error writing to replica: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeIfUnchanged writes the data to the key, only if the key still has the
+// data that was read. Nil data means that the key was not found.
+func writeIfUnchanged(database db.DB, key string, read, data []byte) error {
+	current, err := get(database, key)
+	if err != nil {
+		return err
+	}
+	if (current == nil) != (read == nil) || !bytes.Equal(current, read) {
+		return nil
+	}
+	return database.Insert(key, data)
+}
+
+// get the data of the key, or nil if the key is not found.
+func get(database db.DB, key string) ([]byte, error) {
+	data := []byte{}
+	if err := database.Get(key, &data); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// version of the key in the database, along with its data, which is nil if the
+// key is not found. The value is decoded into a new value of the given type.
+func (readRepairDB *readRepairDB) version(database db.DB, key string, valueType reflect.Type) ([]byte, Version, error) {
+	data, err := get(database, key)
+	if err != nil || data == nil {
+		return nil, Version{}, err
+	}
+	version, err := readRepairDB.decode(data, valueType)
+	return data, version, err
+}
+
+// Flags that follow the timestamp of an encoded version.
+const (
+	flagTombstone = 0
+	flagValue     = 1
+)
+
+// encode the timestamp of the version, followed by a flag for whether or not
+// it was found, and then the value of the version if it was.
+func (readRepairDB *readRepairDB) encode(version Version) ([]byte, error) {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, uint64(version.Timestamp.UnixNano()))
+	if !version.Found {
+		data[8] = flagTombstone
+		return data, nil
+	}
+	data[8] = flagValue
+	value, err := readRepairDB.codec.Encode(version.Value)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, value...), nil
+}
+
+// decode a version that was encoded by encode.
+func (readRepairDB *readRepairDB) decode(data []byte, valueType reflect.Type) (Version, error) {
+	if len(data) < 9 {
+		return Version{}, fmt.Errorf("expected at least 9 bytes, got %v", len(data))
+	}
+	version := Version{Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(data[:8])))}
+	if data[8] == flagTombstone {
+		return version, nil
+	}
+	value := reflect.New(valueType)
+	if err := readRepairDB.codec.Decode(data[9:], value.Interface()); err != nil {
+		return Version{}, err
+	}
+	version.Found = true
+	version.Value = value.Interface()
+	return version, nil
+}
+
+// sameVersion returns whether or not the versions have the same timestamp and
+// value.
+func sameVersion(a, b Version) bool {
+	return a.Found == b.Found && a.Timestamp.Equal(b.Timestamp) && reflect.DeepEqual(a.Value, b.Value)
+}
+
+// versionIterator is a `db.Iterator` that decodes values written with a
+// resolver, and skips tombstones.
+type versionIterator struct {
+	db.Iterator
+	readRepairDB *readRepairDB
+	err          error
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *versionIterator) Next() bool {
+	for iter.Iterator.Next() {
+		var data []byte
+		if err := iter.Iterator.Value(&data); err != nil {
+			iter.err = err
+			return false
+		}
+		if len(data) < 9 || data[8] != flagTombstone {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *versionIterator) Value(value interface{}) error {
+	dest := reflect.ValueOf(value)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("expected non-nil pointer, got %T", value)
+	}
+	var data []byte
+	if err := iter.Iterator.Value(&data); err != nil {
+		return err
+	}
+	version, err := iter.readRepairDB.decode(data, dest.Elem().Type())
+	if err != nil {
+		return err
+	}
+	dest.Elem().Set(reflect.ValueOf(version.Value).Elem())
+	return nil
+}
+
+// Err implements the `db.Iterator` interface.
+func (iter *versionIterator) Err() error {
+	if iter.err != nil {
+		return iter.err
+	}
+	return iter.Iterator.Err()
+}
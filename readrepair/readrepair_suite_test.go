@@ -0,0 +1,13 @@
+package readrepair_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestReadRepair(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Read Repair Suite")
+}
@@ -0,0 +1,323 @@
+package readrepair_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/readrepair"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/nulldb"
+	"github.com/renproject/kv/testutil"
+)
+
+// hookDB is a `db.DB` that calls a hook after the first get.
+type hookDB struct {
+	db.DB
+	once     *sync.Once
+	afterGet func()
+}
+
+func (hookDB *hookDB) Get(key string, value interface{}) error {
+	err := hookDB.DB.Get(key, value)
+	hookDB.once.Do(hookDB.afterGet)
+	return err
+}
+
+// unclosableDB is a `db.DB` that ignores being closed.
+type unclosableDB struct {
+	db.DB
+}
+
+func (unclosableDB) Close() error {
+	return nil
+}
+
+var _ = Describe("read repair db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when writing", func() {
+			It("should write to both the primary and the replica", func() {
+				primary := memdb.New(codec)
+				replica := memdb.New(codec)
+				database := Wrap(primary, replica)
+
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+				for _, inner := range []db.DB{primary, replica} {
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(inner.Get("key", &stored)).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(value))
+				}
+
+				Expect(database.Delete("key")).NotTo(HaveOccurred())
+				for _, inner := range []db.DB{primary, replica} {
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(inner.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+				}
+				Expect(database.Close()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when reading", func() {
+			It("should repair a stale replica", func() {
+				primary := memdb.New(codec)
+				replica := memdb.New(codec)
+				database := Wrap(primary, replica)
+
+				value := testutil.RandomTestStruct()
+				Expect(primary.Insert("key", value)).NotTo(HaveOccurred())
+				Expect(replica.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				// Closing waits for the repair to finish.
+				Expect(database.Close()).NotTo(HaveOccurred())
+				replicated := testutil.TestStruct{D: []byte{}}
+				Expect(replica.Get("key", &replicated)).NotTo(HaveOccurred())
+				Expect(replicated).Should(Equal(value))
+			})
+
+			It("should repair a replica that is missing the key", func() {
+				primary := memdb.New(codec)
+				replica := memdb.New(codec)
+				database := Wrap(primary, replica)
+
+				value := testutil.RandomTestStruct()
+				Expect(primary.Insert("key", value)).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Eventually(func() testutil.TestStruct {
+					replicated := testutil.TestStruct{D: []byte{}}
+					replica.Get("key", &replicated)
+					return replicated
+				}).Should(Equal(value))
+			})
+
+			It("should not repair the replica after being closed", func() {
+				primary := memdb.New(codec)
+				replica := memdb.New(codec)
+				database := Wrap(unclosableDB{primary}, unclosableDB{replica})
+				Expect(database.Close()).NotTo(HaveOccurred())
+
+				Expect(primary.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Consistently(func() error {
+					return replica.Get("key", &testutil.TestStruct{D: []byte{}})
+				}).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should wait for the repairs of reads that race with closing", func() {
+				primary := memdb.New(codec)
+				replica := memdb.New(codec)
+				Expect(primary.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				database := Wrap(unclosableDB{primary}, unclosableDB{replica})
+
+				wg := new(sync.WaitGroup)
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						for j := 0; j < 100; j++ {
+							stored := testutil.TestStruct{D: []byte{}}
+							Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+						}
+					}()
+				}
+				Expect(database.Close()).NotTo(HaveOccurred())
+				wg.Wait()
+			})
+
+			It("should not read from the replica when the primary is missing the key", func() {
+				replica := memdb.New(codec)
+				database := Wrap(memdb.New(codec), replica)
+
+				Expect(replica.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Close()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when resolving conflicts", func() {
+			start := time.Now()
+
+			// at returns an option for a clock that is stopped at the given
+			// number of seconds after the start.
+			at := func(seconds int) Option {
+				return WithClock(func() time.Time { return start.Add(time.Duration(seconds) * time.Second) })
+			}
+
+			// get the value of the key from a single db that was written to
+			// with a resolver.
+			get := func(database db.DB, key string) testutil.TestStruct {
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(Wrap(database, nulldb.New(), WithResolver(codec, LastWriterWins(false))).Get(key, &stored)).NotTo(HaveOccurred())
+				return stored
+			}
+
+			// diverge the replica from the primary by writing a newer value
+			// to the replica only.
+			diverge := func(primary, replica db.DB) (testutil.TestStruct, testutil.TestStruct) {
+				older := testutil.RandomTestStruct()
+				Expect(Wrap(primary, replica, WithResolver(codec, LastWriterWins(false)), at(1)).Insert("key", older)).NotTo(HaveOccurred())
+				newer := testutil.RandomTestStruct()
+				Expect(Wrap(replica, nulldb.New(), WithResolver(codec, LastWriterWins(false)), at(2)).Insert("key", newer)).NotTo(HaveOccurred())
+				return older, newer
+			}
+
+			It("should let the last writer win", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				_, newer := diverge(primary, replica)
+				database := Wrap(primary, replica, WithResolver(codec, LastWriterWins(true)))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(newer))
+
+				// Closing waits for the write back to finish.
+				Expect(database.Close()).NotTo(HaveOccurred())
+				Expect(get(primary, "key")).Should(Equal(newer))
+				Expect(get(replica, "key")).Should(Equal(newer))
+			})
+
+			It("should not write back unless the resolver asks to", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				older, newer := diverge(primary, replica)
+				database := Wrap(primary, replica, WithResolver(codec, LastWriterWins(false)))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(newer))
+
+				Expect(database.Close()).NotTo(HaveOccurred())
+				Expect(get(primary, "key")).Should(Equal(older))
+			})
+
+			It("should apply the choice of a custom resolver", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				older, _ := diverge(primary, replica)
+				database := Wrap(primary, replica, WithResolver(codec, func(key string, primary, replica Version) (Version, bool, error) {
+					Expect(key).Should(Equal("key"))
+					Expect(primary.Found).Should(BeTrue())
+					Expect(replica.Found).Should(BeTrue())
+					Expect(replica.Timestamp.After(primary.Timestamp)).Should(BeTrue())
+					return primary, true, nil
+				}))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(older))
+
+				Expect(database.Close()).NotTo(HaveOccurred())
+				Expect(get(replica, "key")).Should(Equal(older))
+			})
+
+			It("should read keys that are only in the replica", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				value := testutil.RandomTestStruct()
+				Expect(Wrap(replica, nulldb.New(), WithResolver(codec, LastWriterWins(false))).Insert("key", value)).NotTo(HaveOccurred())
+				database := Wrap(primary, replica, WithResolver(codec, LastWriterWins(true)))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+				Expect(database.Get("missing", &stored)).Should(Equal(db.ErrKeyNotFound))
+
+				Expect(database.Close()).NotTo(HaveOccurred())
+				Expect(get(primary, "key")).Should(Equal(value))
+			})
+
+			It("should not overwrite a write that happens before the write back", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				diverge(primary, replica)
+
+				// Write the newest value to the primary right after it has
+				// been read.
+				newest := testutil.RandomTestStruct()
+				hooked := &hookDB{DB: primary, once: new(sync.Once), afterGet: func() {
+					Expect(Wrap(primary, nulldb.New(), WithResolver(codec, LastWriterWins(false)), at(3)).Insert("key", newest)).NotTo(HaveOccurred())
+				}}
+				database := Wrap(hooked, replica, WithResolver(codec, LastWriterWins(true)))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(database.Close()).NotTo(HaveOccurred())
+				Expect(get(primary, "key")).Should(Equal(newest))
+			})
+
+			It("should not resurrect a key that was deleted from one of them", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				diverge(primary, replica)
+				Expect(Wrap(replica, nulldb.New(), WithResolver(codec, LastWriterWins(false)), at(3)).Delete("key")).NotTo(HaveOccurred())
+				database := Wrap(primary, replica, WithResolver(codec, LastWriterWins(true)))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Close()).NotTo(HaveOccurred())
+
+				// The delete has been written back to the primary.
+				for _, inner := range []db.DB{primary, replica} {
+					Expect(Wrap(inner, nulldb.New(), WithResolver(codec, LastWriterWins(false))).Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+				}
+			})
+
+			It("should let a newer insert win over a delete", func() {
+				primary, replica := memdb.New(codec), memdb.New(codec)
+				Expect(Wrap(primary, replica, WithResolver(codec, LastWriterWins(false)), at(1)).Delete("key")).NotTo(HaveOccurred())
+				value := testutil.RandomTestStruct()
+				Expect(Wrap(replica, nulldb.New(), WithResolver(codec, LastWriterWins(false)), at(2)).Insert("key", value)).NotTo(HaveOccurred())
+				database := Wrap(primary, replica, WithResolver(codec, LastWriterWins(true)))
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+				Expect(database.Close()).NotTo(HaveOccurred())
+				Expect(get(primary, "key")).Should(Equal(value))
+			})
+
+			It("should skip deleted keys when iterating and counting", func() {
+				database := Wrap(memdb.New(codec), memdb.New(codec), WithResolver(codec, LastWriterWins(false)))
+				Expect(database.Insert("deleted", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				Expect(database.Delete("deleted")).NotTo(HaveOccurred())
+				Expect(database.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+
+				iter := database.Iterator("")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeTrue())
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("key"))
+				Expect(iter.Next()).Should(BeFalse())
+				Expect(iter.Err()).NotTo(HaveOccurred())
+			})
+
+			It("should iterate over the values", func() {
+				database := Wrap(memdb.New(codec), memdb.New(codec), WithResolver(codec, LastWriterWins(false)))
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+
+				iter := database.Iterator("")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeTrue())
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(iter.Value(&stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+				Expect(iter.Next()).Should(BeFalse())
+			})
+		})
+	}
+})
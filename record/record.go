@@ -0,0 +1,251 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/renproject/kv/db"
+)
+
+// ErrMismatch is returned by Replay, when verifying, if a get returns a
+// different result from the one that was recorded.
+var ErrMismatch = errors.New("mismatched result")
+
+// Operations that are recorded.
+const (
+	opInsert = "insert"
+	opGet    = "get"
+	opDelete = "delete"
+)
+
+// entry is a line of a recording. Keys are written in the same way as
+// `db.ExportJSONL`, so that keys that are not valid UTF-8 are not lost. The
+// value of an insert is the value that was inserted, and the value of a get is
+// the value that was read, if it was found.
+type entry struct {
+	Op        string `json:"op"`
+	Key       string `json:"key,omitempty"`
+	KeyBase64 []byte `json:"key_base64,omitempty"`
+	Value     []byte `json:"value,omitempty"`
+	Found     bool   `json:"found,omitempty"`
+}
+
+// key of the entry.
+func (entry entry) key() string {
+	if len(entry.KeyBase64) > 0 {
+		return string(entry.KeyBase64)
+	}
+	return entry.Key
+}
+
+type recordDB struct {
+	mu      *sync.Mutex
+	inner   db.DB
+	encoder *json.Encoder
+	codec   db.Codec
+}
+
+// Wrap returns a `db.DB` that records each insert, get, and delete to the
+// writer as JSON lines, so that the workload can be replayed against another
+// `db.DB` with Replay. Values are encoded with the given codec. Gets are
+// recorded along with their result, so that Replay can check that they
+// return the same result. Operations are recorded after they are applied to
+// the inner `db.DB`, in the order in which they complete, and failed
+// operations are not recorded. Unlike the write-ahead log, the recording is
+// meant for reproducing bugs, and not for recovering from crashes.
+func Wrap(inner db.DB, w io.Writer, codec db.Codec) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	return &recordDB{
+		mu:      new(sync.Mutex),
+		inner:   inner,
+		encoder: json.NewEncoder(w),
+		codec:   codec,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (recordDB *recordDB) Close() error {
+	return recordDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (recordDB *recordDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := recordDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	recordDB.mu.Lock()
+	defer recordDB.mu.Unlock()
+
+	if err := recordDB.inner.Insert(key, value); err != nil {
+		return err
+	}
+	return recordDB.write(opInsert, key, data, false)
+}
+
+// Get implements the `db.DB` interface. Gets of keys that are not found are
+// recorded as misses.
+func (recordDB *recordDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	recordDB.mu.Lock()
+	defer recordDB.mu.Unlock()
+
+	err := recordDB.inner.Get(key, value)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		if err := recordDB.write(opGet, key, nil, false); err != nil {
+			return err
+		}
+		return db.ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	data, err := recordDB.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("error encoding value of key=%v: %w", key, err)
+	}
+	return recordDB.write(opGet, key, data, true)
+}
+
+// Delete implements the `db.DB` interface.
+func (recordDB *recordDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	recordDB.mu.Lock()
+	defer recordDB.mu.Unlock()
+
+	if err := recordDB.inner.Delete(key); err != nil {
+		return err
+	}
+	return recordDB.write(opDelete, key, nil, false)
+}
+
+// Size implements the `db.DB` interface.
+func (recordDB *recordDB) Size(prefix string) (int, error) {
+	return recordDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (recordDB *recordDB) Iterator(prefix string) db.Iterator {
+	return recordDB.inner.Iterator(prefix)
+}
+
+// write an entry of the operation to the writer. The caller must hold the
+// lock.
+func (recordDB *recordDB) write(op, key string, data []byte, found bool) error {
+	entry := entry{Op: op, Value: data, Found: found}
+	if utf8.ValidString(key) {
+		entry.Key = key
+	} else {
+		entry.KeyBase64 = []byte(key)
+	}
+	if err := recordDB.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("error writing %v of key=%v: %w", op, key, err)
+	}
+	return nil
+}
+
+// An Option configures a replay.
+type Option func(*replay)
+
+// Verify makes Replay check that each get returns the same result as the one
+// that was recorded, and return ErrMismatch if it does not. A value that was
+// found is decoded in the same way as the recorded value, and compared with it
+// using `reflect.DeepEqual`, because some codecs do not encode maps
+// deterministically. By default, gets are replayed, but their results are
+// ignored.
+func Verify() Option {
+	return func(replay *replay) {
+		replay.verify = true
+	}
+}
+
+type replay struct {
+	verify bool
+}
+
+// Replay reads the operations recorded by a `db.DB` returned by Wrap, and
+// applies them to the target in order. Gets are replayed as well, because they
+// can change the state of DBs such as caches. Each value is decoded using the
+// codec into the value returned by `newValue`, which must be a pointer.
+func Replay(r io.Reader, target db.DB, codec db.Codec, newValue func() interface{}, opts ...Option) error {
+	replay := &replay{}
+	for _, opt := range opts {
+		opt(replay)
+	}
+
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var entry entry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading line %v: %w", line, err)
+		}
+		if err := replay.apply(target, entry, codec, newValue); err != nil {
+			return fmt.Errorf("error replaying line %v: %w", line, err)
+		}
+	}
+}
+
+// apply the operation of the entry to the target.
+func (replay *replay) apply(target db.DB, entry entry, codec db.Codec, newValue func() interface{}) error {
+	key := entry.key()
+	switch entry.Op {
+	case opInsert:
+		value := newValue()
+		if err := codec.Decode(entry.Value, value); err != nil {
+			return fmt.Errorf("error decoding value of key=%v: %w", key, err)
+		}
+		if err := target.Insert(key, value); err != nil {
+			return fmt.Errorf("error inserting key=%v: %w", key, err)
+		}
+	case opGet:
+		value := newValue()
+		err := target.Get(key, value)
+		if err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+			return fmt.Errorf("error getting key=%v: %w", key, err)
+		}
+		if !replay.verify {
+			return nil
+		}
+		found := err == nil
+		if found != entry.Found {
+			return fmt.Errorf("%w: key=%v was found=%v, but was recorded as found=%v", ErrMismatch, key, found, entry.Found)
+		}
+		if !found {
+			return nil
+		}
+		recorded := newValue()
+		if err := codec.Decode(entry.Value, recorded); err != nil {
+			return fmt.Errorf("error decoding value of key=%v: %w", key, err)
+		}
+		if !reflect.DeepEqual(value, recorded) {
+			return fmt.Errorf("%w: key=%v has a different value from the one recorded", ErrMismatch, key)
+		}
+	case opDelete:
+		if err := target.Delete(key); err != nil {
+			return fmt.Errorf("error deleting key=%v: %w", key, err)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", entry.Op)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package record_test
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/record"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/memdb/rrdb"
+	"github.com/renproject/kv/testutil"
+)
+
+// overwritingDB is a `db.DB` that overwrites the values of a key after they
+// have been inserted, to simulate nondeterminism.
+type overwritingDB struct {
+	db.DB
+	key   string
+	value interface{}
+}
+
+func (overwritingDB *overwritingDB) Insert(key string, value interface{}) error {
+	if key == overwritingDB.key {
+		value = overwritingDB.value
+	}
+	return overwritingDB.DB.Insert(key, value)
+}
+
+var _ = Describe("recording db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newValue := func() interface{} {
+			return &testutil.TestStruct{D: []byte{}}
+		}
+
+		// run a sequence of inserts, overwrites, deletes, and gets.
+		run := func(database db.DB) {
+			Expect(testutil.WriteSequence(database)).NotTo(HaveOccurred())
+			Expect(testutil.ReadSequence(database, newValue)).NotTo(HaveOccurred())
+		}
+
+		Context("when replaying a recording", func() {
+			It("should rebuild the state of the db and verify the gets", func() {
+				recording := new(bytes.Buffer)
+				inner := memdb.New(codec)
+				run(Wrap(inner, recording, codec))
+
+				replayed := memdb.New(codec)
+				Expect(Replay(bytes.NewReader(recording.Bytes()), replayed, codec, newValue)).NotTo(HaveOccurred())
+				Expect(testutil.CheckSame(inner, replayed, newValue)).NotTo(HaveOccurred())
+
+				verified := memdb.New(codec)
+				Expect(Replay(bytes.NewReader(recording.Bytes()), verified, codec, newValue, Verify())).NotTo(HaveOccurred())
+				Expect(testutil.CheckSame(inner, verified, newValue)).NotTo(HaveOccurred())
+			})
+
+			It("should detect gets that are missing when they were found", func() {
+				recording := new(bytes.Buffer)
+				run(Wrap(memdb.New(codec), recording, codec))
+
+				// The rrdb cannot hold all of the keys, so some of the gets
+				// will miss.
+				target := rrdb.New(codec, 5)
+				Expect(Replay(bytes.NewReader(recording.Bytes()), target, codec, newValue)).NotTo(HaveOccurred())
+				err := Replay(bytes.NewReader(recording.Bytes()), rrdb.New(codec, 5), codec, newValue, Verify())
+				Expect(errors.Is(err, ErrMismatch)).Should(BeTrue())
+			})
+
+			It("should detect gets that return a different value", func() {
+				recording := new(bytes.Buffer)
+				run(Wrap(memdb.New(codec), recording, codec))
+
+				target := &overwritingDB{DB: memdb.New(codec), key: "5", value: testutil.RandomTestStruct()}
+				err := Replay(bytes.NewReader(recording.Bytes()), target, codec, newValue, Verify())
+				Expect(errors.Is(err, ErrMismatch)).Should(BeTrue())
+				Expect(err.Error()).Should(ContainSubstring("key=5"))
+			})
+		})
+	}
+
+	Context("when recording keys that are not valid utf-8", func() {
+		It("should replay them exactly", func() {
+			recording := new(bytes.Buffer)
+			inner := memdb.New(codec.JSONCodec)
+			database := Wrap(inner, recording, codec.JSONCodec)
+			key := string([]byte{0xff, 0xfe, 'a'})
+			Expect(database.Insert(key, "value")).NotTo(HaveOccurred())
+
+			replayed := memdb.New(codec.JSONCodec)
+			Expect(Replay(recording, replayed, codec.JSONCodec, func() interface{} { return new(string) })).NotTo(HaveOccurred())
+			var value string
+			Expect(replayed.Get(key, &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+		})
+	})
+
+	Context("when the recording is malformed", func() {
+		It("should return an error with the line", func() {
+			recording := bytes.NewBufferString("{\"op\":\"insert\",\"key\":\"a\",\"value\":\"MQ==\"}\n{\"op\":\"rename\",\"key\":\"a\"}\n")
+			err := Replay(recording, memdb.New(codec.JSONCodec), codec.JSONCodec, func() interface{} { return new(int) })
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("line 2"))
+		})
+	})
+
+	Context("when wrapping with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() { Wrap(memdb.New(codec.JSONCodec), new(bytes.Buffer), nil) }).Should(Panic())
+		})
+	})
+})
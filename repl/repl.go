@@ -0,0 +1,186 @@
+package repl
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// An Op is the kind of a Mutation.
+type Op uint8
+
+// Kinds of Mutations.
+const (
+	// OpInsert is a Mutation that inserts a key/value pair.
+	OpInsert Op = iota + 1
+	// OpDelete is a Mutation that deletes a key/value pair.
+	OpDelete
+)
+
+// String implements the `fmt.Stringer` interface.
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("op(%d)", uint8(op))
+	}
+}
+
+// A Mutation is an insert or delete that has been applied to a `db.DB`. The
+// Value is the encoded value of an insert, and is nil for a delete.
+type Mutation struct {
+	Op    Op
+	Key   string
+	Value []byte
+}
+
+type producer struct {
+	// mu is held while applying a mutation to the inner `db.DB` and sending it,
+	// so that mutations are sent in the order in which they were applied.
+	mu        *sync.Mutex
+	inner     db.DB
+	codec     db.Codec
+	mutations chan Mutation
+	closed    bool
+
+	// done is closed as soon as the producer starts closing, without holding
+	// mu, so that inserts and deletes that are blocked on sending a mutation
+	// can give up and release mu.
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// NewProducer returns a `db.DB` that sends every insert and delete that has
+// been applied to the inner `db.DB` to the returned channel, in the order in
+// which they were applied. Values are encoded with the given codec. The
+// channel has a buffer of the given size, and once it is full, inserts and
+// deletes block until the mutations are received, so that none are lost. The
+// channel is closed when the `db.DB` is closed. Closing the `db.DB` unblocks
+// the inserts and deletes that are waiting, which return `db.ErrClosed`. Their
+// mutations have been applied to the inner `db.DB`, but are not sent.
+func NewProducer(inner db.DB, codec db.Codec, buffer int) (db.DB, <-chan Mutation) {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	producer := &producer{
+		mu:        new(sync.Mutex),
+		inner:     inner,
+		codec:     codec,
+		mutations: make(chan Mutation, buffer),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+	return producer, producer.mutations
+}
+
+// Close implements the `db.DB` interface. It closes the channel of mutations.
+func (producer *producer) Close() error {
+	producer.closeOnce.Do(func() { close(producer.done) })
+
+	producer.mu.Lock()
+	defer producer.mu.Unlock()
+
+	if !producer.closed {
+		producer.closed = true
+		close(producer.mutations)
+	}
+	return producer.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (producer *producer) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := producer.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	producer.mu.Lock()
+	defer producer.mu.Unlock()
+
+	if producer.closed {
+		return db.ErrClosed
+	}
+	if err := producer.inner.Insert(key, value); err != nil {
+		return err
+	}
+	return producer.send(Mutation{Op: OpInsert, Key: key, Value: data})
+}
+
+// send the mutation, unless the producer is closed while waiting for it to be
+// received, in which case `db.ErrClosed` is returned. It must be called while
+// holding mu.
+func (producer *producer) send(mutation Mutation) error {
+	select {
+	case producer.mutations <- mutation:
+		return nil
+	case <-producer.done:
+		return db.ErrClosed
+	}
+}
+
+// Get implements the `db.DB` interface.
+func (producer *producer) Get(key string, value interface{}) error {
+	return producer.inner.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (producer *producer) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	producer.mu.Lock()
+	defer producer.mu.Unlock()
+
+	if producer.closed {
+		return db.ErrClosed
+	}
+	if err := producer.inner.Delete(key); err != nil {
+		return err
+	}
+	return producer.send(Mutation{Op: OpDelete, Key: key})
+}
+
+// Size implements the `db.DB` interface.
+func (producer *producer) Size(prefix string) (int, error) {
+	return producer.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (producer *producer) Iterator(prefix string) db.Iterator {
+	return producer.inner.Iterator(prefix)
+}
+
+// Apply receives mutations from the channel and applies them to the target, in
+// order, until the channel is closed. Values are decoded using the codec into
+// the value returned by `newValue`, which must be a pointer. If a mutation
+// cannot be applied, then Apply stops and returns the error, and the
+// remaining mutations are not received.
+func Apply(target db.ReadWriter, mutations <-chan Mutation, codec db.Codec, newValue func() interface{}) error {
+	for mutation := range mutations {
+		switch mutation.Op {
+		case OpInsert:
+			value := newValue()
+			if err := codec.Decode(mutation.Value, value); err != nil {
+				return fmt.Errorf("error decoding value of key=%v: %w", mutation.Key, err)
+			}
+			if err := target.Insert(mutation.Key, value); err != nil {
+				return fmt.Errorf("error inserting key=%v: %w", mutation.Key, err)
+			}
+		case OpDelete:
+			if err := target.Delete(mutation.Key); err != nil {
+				return fmt.Errorf("error deleting key=%v: %w", mutation.Key, err)
+			}
+		default:
+			return fmt.Errorf("unknown mutation %v of key=%v", mutation.Op, mutation.Key)
+		}
+	}
+	return nil
+}
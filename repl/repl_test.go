@@ -0,0 +1,135 @@
+package repl_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/repl"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("replication", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+		newValue := func() interface{} { return new(int64) }
+
+		Context("when applying the mutations of a producer to another db", func() {
+			It("should replicate every insert and delete", func() {
+				source, mutations := NewProducer(memdb.New(codec), codec, 0)
+				target := memdb.New(codec)
+
+				done := make(chan error, 1)
+				go func() {
+					done <- Apply(target, mutations, codec, newValue)
+				}()
+
+				for i := int64(0); i < 100; i++ {
+					Expect(source.Insert(fmt.Sprintf("key%v", i), i)).Should(Succeed())
+				}
+				for i := int64(0); i < 100; i += 3 {
+					Expect(source.Delete(fmt.Sprintf("key%v", i))).Should(Succeed())
+				}
+				for i := int64(0); i < 100; i += 5 {
+					Expect(source.Insert(fmt.Sprintf("key%v", i), -i)).Should(Succeed())
+				}
+				size, err := source.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(source.Close()).Should(Succeed())
+				Expect(<-done).NotTo(HaveOccurred())
+
+				targetSize, err := target.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(targetSize).Should(Equal(size))
+
+				// The source has been closed, so compare against a new db that
+				// the same mutations have been applied to directly.
+				expected := memdb.New(codec)
+				for i := int64(0); i < 100; i++ {
+					key := fmt.Sprintf("key%v", i)
+					switch {
+					case i%5 == 0:
+						Expect(expected.Insert(key, -i)).Should(Succeed())
+					case i%3 != 0:
+						Expect(expected.Insert(key, i)).Should(Succeed())
+					}
+				}
+				Expect(testutil.CheckSame(expected, target, newValue)).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when a mutation fails to apply to the inner db", func() {
+			It("should not emit the mutation", func() {
+				inner := memdb.New(codec)
+				source, mutations := NewProducer(inner, codec, 1)
+				Expect(source.Insert("key", int64(1))).Should(Succeed())
+				Expect(source.Insert("", int64(1))).Should(Equal(db.ErrEmptyKey))
+
+				mutation := <-mutations
+				Expect(mutation.Op).Should(Equal(OpInsert))
+				Expect(mutation.Key).Should(Equal("key"))
+				Expect(source.Close()).Should(Succeed())
+				_, ok := <-mutations
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		Context("when writing to a closed producer", func() {
+			It("should return ErrClosed", func() {
+				source, _ := NewProducer(memdb.New(codec), codec, 1)
+				Expect(source.Close()).Should(Succeed())
+				Expect(source.Insert("key", int64(1))).Should(Equal(db.ErrClosed))
+				Expect(source.Delete("key")).Should(Equal(db.ErrClosed))
+			})
+		})
+
+		Context("when closing a producer whose mutations are not received", func() {
+			It("should unblock the writers and return ErrClosed", func() {
+				source, mutations := NewProducer(memdb.New(codec), codec, 1)
+				Expect(source.Insert("key", int64(1))).Should(Succeed())
+
+				// The buffer is full and nothing receives from it, like when
+				// Apply has stopped after an error.
+				errs := make(chan error, 2)
+				go func() { errs <- source.Insert("key", int64(2)) }()
+				go func() { errs <- source.Delete("key") }()
+				Consistently(errs).ShouldNot(Receive())
+
+				Expect(source.Close()).Should(Succeed())
+				Eventually(errs).Should(Receive(Equal(db.ErrClosed)))
+				Eventually(errs).Should(Receive(Equal(db.ErrClosed)))
+
+				mutation := <-mutations
+				Expect(mutation.Key).Should(Equal("key"))
+				_, ok := <-mutations
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		Context("when applying a mutation fails", func() {
+			It("should return the error", func() {
+				target := memdb.New(codec)
+				mutations := make(chan Mutation, 2)
+				mutations <- Mutation{Op: OpInsert, Key: "", Value: []byte{}}
+				mutations <- Mutation{Op: OpDelete, Key: "key"}
+				close(mutations)
+				Expect(Apply(target, mutations, codec, func() interface{} { return new([]byte) })).Should(HaveOccurred())
+
+				// The remaining mutations should not be received.
+				_, ok := <-mutations
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	}
+
+	Context("when initializing a producer with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() {
+				NewProducer(memdb.New(testutil.Codecs[0]), nil, 0)
+			}).Should(Panic())
+		})
+	})
+})
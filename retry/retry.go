@@ -0,0 +1,120 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// A Policy defines which failed operations are retried, and how often.
+type Policy struct {
+	// MaxAttempts is the maximum number of times an operation is attempted,
+	// including the first attempt.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry. The backoff
+	// doubles after every retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum time to wait between retries. A non-positive
+	// MaxBackoff means the backoff is not capped.
+	MaxBackoff time.Duration
+
+	// Retryable returns whether or not an operation that failed with the given
+	// error should be retried. If it is nil, all errors are retried.
+	Retryable func(err error) bool
+}
+
+type retryDB struct {
+	ctx    context.Context
+	inner  db.DB
+	policy Policy
+}
+
+// Wrap returns a `db.DB` that retries failed inserts, gets, and deletes on the
+// inner `db.DB` using exponential backoff. ErrKeyNotFound and ErrEmptyKey are
+// never retried. Retrying stops when the context is done, and the last error is
+// returned.
+func Wrap(ctx context.Context, inner db.DB, policy Policy) db.DB {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	return &retryDB{
+		ctx:    ctx,
+		inner:  inner,
+		policy: policy,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (retryDB *retryDB) Close() error {
+	return retryDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (retryDB *retryDB) Insert(key string, value interface{}) error {
+	return retryDB.do(func() error {
+		return retryDB.inner.Insert(key, value)
+	})
+}
+
+// Get implements the `db.DB` interface.
+func (retryDB *retryDB) Get(key string, value interface{}) error {
+	return retryDB.do(func() error {
+		return retryDB.inner.Get(key, value)
+	})
+}
+
+// Delete implements the `db.DB` interface.
+func (retryDB *retryDB) Delete(key string) error {
+	return retryDB.do(func() error {
+		return retryDB.inner.Delete(key)
+	})
+}
+
+// Size implements the `db.DB` interface.
+func (retryDB *retryDB) Size(prefix string) (int, error) {
+	return retryDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (retryDB *retryDB) Iterator(prefix string) db.Iterator {
+	return retryDB.inner.Iterator(prefix)
+}
+
+// do the operation until it succeeds, it fails with an error that cannot be
+// retried, the max attempts is reached, or the context is done.
+func (retryDB *retryDB) do(operation func() error) error {
+	backoff := retryDB.policy.InitialBackoff
+	err := operation()
+	for attempt := 1; attempt < retryDB.policy.MaxAttempts && retryDB.retryable(err); attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-retryDB.ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if retryDB.policy.MaxBackoff > 0 && backoff > retryDB.policy.MaxBackoff {
+			backoff = retryDB.policy.MaxBackoff
+		}
+		err = operation()
+	}
+	return err
+}
+
+// retryable returns true if the error is not nil, is not a definitive error,
+// and is allowed to be retried by the policy.
+func (retryDB *retryDB) retryable(err error) bool {
+	if err == nil || errors.Is(err, db.ErrKeyNotFound) || errors.Is(err, db.ErrEmptyKey) {
+		return false
+	}
+	if retryDB.policy.Retryable == nil {
+		return true
+	}
+	return retryDB.policy.Retryable(err)
+}
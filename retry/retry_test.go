@@ -0,0 +1,133 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/retry"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+)
+
+var errTransient = errors.New("transient failure")
+
+// flakyDB is a `db.DB` that fails a number of times before delegating to the
+// underlying `db.DB`.
+type flakyDB struct {
+	db.DB
+	failures int
+	calls    int
+}
+
+func (flakyDB *flakyDB) Insert(key string, value interface{}) error {
+	flakyDB.calls++
+	if flakyDB.calls <= flakyDB.failures {
+		return errTransient
+	}
+	return flakyDB.DB.Insert(key, value)
+}
+
+func (flakyDB *flakyDB) Get(key string, value interface{}) error {
+	flakyDB.calls++
+	if flakyDB.calls <= flakyDB.failures {
+		return errTransient
+	}
+	return flakyDB.DB.Get(key, value)
+}
+
+func (flakyDB *flakyDB) Delete(key string) error {
+	flakyDB.calls++
+	if flakyDB.calls <= flakyDB.failures {
+		return errTransient
+	}
+	return flakyDB.DB.Delete(key)
+}
+
+var _ = Describe("retry db", func() {
+	policy := Policy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     4 * time.Millisecond,
+	}
+
+	Context("when the inner db fails fewer times than the max attempts", func() {
+		It("should eventually succeed", func() {
+			inner := &flakyDB{DB: memdb.New(codec.JSONCodec), failures: 4}
+			database := Wrap(context.Background(), inner, policy)
+
+			Expect(database.Insert("key", "value")).NotTo(HaveOccurred())
+			Expect(inner.calls).Should(Equal(5))
+
+			inner.calls = 0
+			var value string
+			Expect(database.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal("value"))
+			Expect(inner.calls).Should(Equal(5))
+
+			inner.calls = 0
+			Expect(database.Delete("key")).NotTo(HaveOccurred())
+			Expect(inner.calls).Should(Equal(5))
+		})
+	})
+
+	Context("when the inner db fails more times than the max attempts", func() {
+		It("should return the last error", func() {
+			inner := &flakyDB{DB: memdb.New(codec.JSONCodec), failures: 5}
+			database := Wrap(context.Background(), inner, policy)
+
+			Expect(database.Insert("key", "value")).Should(Equal(errTransient))
+			Expect(inner.calls).Should(Equal(5))
+		})
+	})
+
+	Context("when the error is definitive", func() {
+		It("should not retry", func() {
+			inner := &flakyDB{DB: memdb.New(codec.JSONCodec)}
+			database := Wrap(context.Background(), inner, policy)
+
+			var value string
+			Expect(database.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(inner.calls).Should(Equal(1))
+
+			inner.calls = 0
+			Expect(database.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+			Expect(inner.calls).Should(Equal(1))
+		})
+
+		It("should not retry errors rejected by the policy", func() {
+			inner := &flakyDB{DB: memdb.New(codec.JSONCodec), failures: 1}
+			database := Wrap(context.Background(), inner, Policy{
+				MaxAttempts:    5,
+				InitialBackoff: time.Millisecond,
+				Retryable: func(err error) bool {
+					return err != errTransient
+				},
+			})
+
+			Expect(database.Insert("key", "value")).Should(Equal(errTransient))
+			Expect(inner.calls).Should(Equal(1))
+		})
+	})
+
+	Context("when the context is done", func() {
+		It("should stop retrying", func() {
+			inner := &flakyDB{DB: memdb.New(codec.JSONCodec), failures: 100}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			database := Wrap(ctx, inner, Policy{
+				MaxAttempts:    100,
+				InitialBackoff: 20 * time.Millisecond,
+			})
+
+			start := time.Now()
+			Expect(database.Insert("key", "value")).Should(Equal(errTransient))
+			Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+			Expect(inner.calls).Should(BeNumerically("<", 100))
+		})
+	})
+})
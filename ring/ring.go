@@ -0,0 +1,169 @@
+package ring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/renproject/kv/db"
+	"golang.org/x/crypto/sha3"
+)
+
+// A DB is a `db.DB` that routes each key to one of a set of backends using
+// consistent hashing. Adding or removing a backend only changes the backend of
+// the keys that are moved to, or from, that backend.
+type DB interface {
+	db.DB
+
+	// Backend returns the name of the backend that the key is routed to.
+	Backend(key string) string
+}
+
+// point is a point on the ring owned by a backend.
+type point struct {
+	hash    uint64
+	backend string
+}
+
+type ring struct {
+	backends map[string]db.DB
+	points   []point
+}
+
+// New returns a `DB` that routes keys across the given backends. Each backend
+// is placed on the ring at the given number of points, and a key is routed to
+// the backend that owns the first point at, or after, the hash of the key.
+// More replicas give a more even distribution of keys. The map of backends is
+// copied, so it can be modified once the `DB` has been created.
+func New(backends map[string]db.DB, replicas int) DB {
+	if len(backends) == 0 {
+		panic("backends cannot be empty")
+	}
+	if replicas <= 0 {
+		replicas = 1
+	}
+	copied := make(map[string]db.DB, len(backends))
+	for name, backend := range backends {
+		copied[name] = backend
+	}
+	backends = copied
+
+	points := make([]point, 0, len(backends)*replicas)
+	for name := range backends {
+		for i := 0; i < replicas; i++ {
+			points = append(points, point{
+				hash:    hash(fmt.Sprintf("%v-%d", name, i)),
+				backend: name,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash == points[j].hash {
+			return points[i].backend < points[j].backend
+		}
+		return points[i].hash < points[j].hash
+	})
+
+	return &ring{
+		backends: backends,
+		points:   points,
+	}
+}
+
+// Close implements the `db.DB` interface. All backends are closed, and the
+// first error is returned.
+func (ring *ring) Close() error {
+	var closeErr error
+	for _, backend := range ring.backends {
+		if err := backend.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// Insert implements the `db.DB` interface.
+func (ring *ring) Insert(key string, value interface{}) error {
+	return ring.backends[ring.Backend(key)].Insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (ring *ring) Get(key string, value interface{}) error {
+	return ring.backends[ring.Backend(key)].Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (ring *ring) Delete(key string) error {
+	return ring.backends[ring.Backend(key)].Delete(key)
+}
+
+// Size implements the `db.DB` interface. It returns the total size of all
+// backends.
+func (ring *ring) Size(prefix string) (int, error) {
+	total := 0
+	for name, backend := range ring.backends {
+		size, err := backend.Size(prefix)
+		if err != nil {
+			return 0, fmt.Errorf("error getting size of backend=%v: %w", name, err)
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// Iterator implements the `db.DB` interface. It iterates over each backend in
+// turn.
+func (ring *ring) Iterator(prefix string) db.Iterator {
+	iters := make([]db.Iterator, 0, len(ring.backends))
+	for _, backend := range ring.backends {
+		iters = append(iters, backend.Iterator(prefix))
+	}
+	return db.ConcatIterator(iters...)
+}
+
+// HasBatch implements the `db.BatchChecker` interface. The keys are grouped by
+// backend, so that each backend is only asked once, using `db.HasBatch`.
+func (ring *ring) HasBatch(keys []string) ([]bool, error) {
+	groups := map[string][]int{}
+	for i, key := range keys {
+		if key == "" {
+			return nil, db.ErrEmptyKey
+		}
+		name := ring.Backend(key)
+		groups[name] = append(groups[name], i)
+	}
+
+	found := make([]bool, len(keys))
+	for name, indices := range groups {
+		group := make([]string, len(indices))
+		for j, i := range indices {
+			group[j] = keys[i]
+		}
+		groupFound, err := db.HasBatch(ring.backends[name], group)
+		if err != nil {
+			return nil, fmt.Errorf("error checking keys of backend=%v: %w", name, err)
+		}
+		for j, i := range indices {
+			found[i] = groupFound[j]
+		}
+	}
+	return found, nil
+}
+
+// Backend implements the `DB` interface.
+func (ring *ring) Backend(key string) string {
+	keyHash := hash(key)
+	i := sort.Search(len(ring.points), func(i int) bool {
+		return ring.points[i].hash >= keyHash
+	})
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.points[i].backend
+}
+
+// hash returns the position of the data on the ring.
+func hash(data string) uint64 {
+	digest := sha3.Sum256([]byte(data))
+	return binary.BigEndian.Uint64(digest[:8])
+}
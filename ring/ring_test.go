@@ -0,0 +1,165 @@
+package ring_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/ring"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+func newBackends(codec db.Codec, n int) map[string]db.DB {
+	backends := map[string]db.DB{}
+	for i := 0; i < n; i++ {
+		backends[fmt.Sprintf("backend%v", i)] = memdb.New(codec)
+	}
+	return backends
+}
+
+var _ = Describe("consistent hashing ring", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when reading and writing", func() {
+			It("should store each key in the backend it is routed to", func() {
+				backends := newBackends(codec, 4)
+				ring := New(backends, 100)
+				defer ring.Close()
+
+				test := func(key string, value testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+
+					Expect(ring.Insert(key, value)).NotTo(HaveOccurred())
+					val := testutil.TestStruct{D: []byte{}}
+					Expect(backends[ring.Backend(key)].Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+					Expect(ring.Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+
+					Expect(ring.Delete(key)).NotTo(HaveOccurred())
+					Expect(ring.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+
+			It("should iterate over all backends", func() {
+				ring := New(newBackends(codec, 4), 100)
+				defer ring.Close()
+
+				numKeys := 100
+				for i := 0; i < numKeys; i++ {
+					Expect(ring.Insert(fmt.Sprintf("%v", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				}
+
+				size, err := ring.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(numKeys))
+
+				iter := ring.Iterator("")
+				defer iter.Close()
+
+				keys := map[string]struct{}{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys[key] = struct{}{}
+				}
+				Expect(keys).Should(HaveLen(numKeys))
+			})
+		})
+	}
+
+	Context("when routing many keys", func() {
+		It("should balance the keys across the backends", func() {
+			ring := New(newBackends(testutil.Codecs[0], 4), 100)
+
+			numKeys := 10000
+			counts := map[string]int{}
+			for i := 0; i < numKeys; i++ {
+				counts[ring.Backend(fmt.Sprintf("key%v", i))]++
+			}
+			Expect(counts).Should(HaveLen(4))
+			for _, count := range counts {
+				Expect(count).Should(BeNumerically("~", numKeys/4, numKeys/10))
+			}
+		})
+
+		It("should only remap keys to a new backend", func() {
+			backends := newBackends(testutil.Codecs[0], 4)
+			before := New(backends, 100)
+			backends["new"] = memdb.New(testutil.Codecs[0])
+			after := New(backends, 100)
+
+			numKeys := 10000
+			remapped := 0
+			for i := 0; i < numKeys; i++ {
+				key := fmt.Sprintf("key%v", i)
+				if before.Backend(key) != after.Backend(key) {
+					Expect(after.Backend(key)).Should(Equal("new"))
+					remapped++
+				}
+			}
+			Expect(remapped).Should(BeNumerically("~", numKeys/5, numKeys/10))
+		})
+	})
+
+	Context("when the map of backends is modified", func() {
+		It("should keep routing keys to the original backends", func() {
+			backends := newBackends(testutil.Codecs[0], 4)
+			ring := New(backends, 100)
+			for name := range backends {
+				delete(backends, name)
+			}
+
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key%v", i)
+				Expect(ring.Insert(key, int64(i))).NotTo(HaveOccurred())
+				var value int64
+				Expect(ring.Get(key, &value)).NotTo(HaveOccurred())
+				Expect(value).Should(Equal(int64(i)))
+			}
+		})
+	})
+
+	Context("when checking whether keys exist in a batch", func() {
+		It("should return whether each key exists in the order of the keys", func() {
+			ring := New(newBackends(testutil.Codecs[0], 4), 100)
+			keys := []string{}
+			expected := []bool{}
+			backends := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key%v", i)
+				keys = append(keys, key)
+				expected = append(expected, i%3 == 0)
+				if i%3 == 0 {
+					Expect(ring.Insert(key, int64(i))).NotTo(HaveOccurred())
+					backends[ring.Backend(key)] = true
+				}
+			}
+			// The keys should be spread across the backends.
+			Expect(backends).Should(HaveLen(4))
+
+			found, err := ring.(db.BatchChecker).HasBatch(keys)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).Should(Equal(expected))
+		})
+	})
+
+	Context("when initializing the ring without backends", func() {
+		It("should panic", func() {
+			Expect(func() {
+				New(map[string]db.DB{}, 100)
+			}).Should(Panic())
+		})
+	})
+})
@@ -0,0 +1,154 @@
+package seqlog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// SeqKey is the key in the underlying table where the next sequence number is
+// stored. It cannot be confused with the key of an entry, because those keys
+// only contain digits.
+const SeqKey = "seq"
+
+// A Log is an append-only log where each value is stored under a sequence
+// number. Sequence numbers start from zero and increase by one with each
+// append.
+type Log interface {
+
+	// Append the value to the log and return its sequence number.
+	Append(value interface{}) (uint64, error)
+
+	// ReadFrom returns an iterator over the values in the log, in order,
+	// starting from the given sequence number. The keys of the iterator are
+	// the zero-padded sequence numbers. Values appended after the iterator is
+	// created are not iterated.
+	ReadFrom(seq uint64) db.Iterator
+}
+
+type log struct {
+	// appendMu is used to make sure that concurrent appends are assigned
+	// unique sequence numbers without gaps.
+	appendMu *sync.Mutex
+	table    db.Table
+}
+
+// New returns a new Log that stores its values in the given table. The next
+// sequence number is persisted in the table, so a Log created over a table
+// that already has values will continue from the end of those values. The
+// table must not be shared with anything else.
+func New(table db.Table) Log {
+	return &log{
+		appendMu: new(sync.Mutex),
+		table:    table,
+	}
+}
+
+// Key returns the key under which the value with the given sequence number is
+// stored. Sequence numbers are zero-padded so that the keys are ordered
+// lexicographically.
+func Key(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// Append implements the `Log` interface. The value is written before the
+// sequence number is advanced, so a failed append never leaves a gap.
+func (log *log) Append(value interface{}) (uint64, error) {
+	log.appendMu.Lock()
+	defer log.appendMu.Unlock()
+
+	seq, err := log.nextSeq()
+	if err != nil {
+		return 0, err
+	}
+	if err := log.table.Insert(Key(seq), value); err != nil {
+		return 0, fmt.Errorf("error inserting value: %w", err)
+	}
+	if err := log.table.Insert(SeqKey, seq+1); err != nil {
+		return 0, fmt.Errorf("error updating sequence number: %w", err)
+	}
+	return seq, nil
+}
+
+// ReadFrom implements the `Log` interface. Values are read lazily as the
+// iterator progresses.
+func (log *log) ReadFrom(seq uint64) db.Iterator {
+	log.appendMu.Lock()
+	defer log.appendMu.Unlock()
+
+	end, err := log.nextSeq()
+	return &iterator{
+		table: log.table,
+		seq:   seq,
+		end:   end,
+		err:   err,
+	}
+}
+
+func (log *log) nextSeq() (uint64, error) {
+	var seq uint64
+	if err := log.table.Get(SeqKey, &seq); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error getting sequence number: %w", err)
+	}
+	return seq, nil
+}
+
+// iterator over a range of sequence numbers in the log.
+type iterator struct {
+	table   db.Table
+	started bool
+	seq     uint64
+	end     uint64
+
+	// err is returned by Key, Value, and Err if the end of the log could not
+	// be read.
+	err error
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *iterator) Next() bool {
+	if iter.err != nil {
+		return false
+	}
+	if !iter.started {
+		iter.started = true
+	} else if iter.seq < iter.end {
+		iter.seq++
+	}
+	return iter.seq < iter.end
+}
+
+// Key implements the `db.Iterator` interface.
+func (iter *iterator) Key() (string, error) {
+	if iter.err != nil {
+		return "", iter.err
+	}
+	if !iter.started || iter.seq >= iter.end {
+		return "", db.ErrIndexOutOfRange
+	}
+	return Key(iter.seq), nil
+}
+
+// Value implements the `db.Iterator` interface.
+func (iter *iterator) Value(value interface{}) error {
+	if iter.err != nil {
+		return iter.err
+	}
+	if !iter.started || iter.seq >= iter.end {
+		return db.ErrIndexOutOfRange
+	}
+	return iter.table.Get(Key(iter.seq), value)
+}
+
+// Err implements the `db.Iterator` interface.
+func (iter *iterator) Err() error {
+	return iter.err
+}
+
+// Close implements the `db.Iterator` interface.
+func (iter *iterator) Close() {}
@@ -0,0 +1,13 @@
+package seqlog_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSeqlog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Seqlog Suite")
+}
@@ -0,0 +1,98 @@
+package seqlog_test
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/seqlog"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/phi"
+)
+
+var _ = Describe("append-only log", func() {
+	codecs := []db.Codec{codec.JSONCodec, codec.GobCodec, codec.BinaryCodec}
+	for i := range codecs {
+		codec := codecs[i]
+
+		Context("when appending concurrently", func() {
+			It("should assign a contiguous sequence", func() {
+				log := New(db.NewTable(memdb.New(codec), "log"))
+
+				numAppends := 100
+				seqs := make([]uint64, numAppends)
+				phi.ParForAll(numAppends, func(i int) {
+					seq, err := log.Append(int64(i))
+					Expect(err).NotTo(HaveOccurred())
+					seqs[i] = seq
+				})
+
+				sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+				for i := range seqs {
+					Expect(seqs[i]).Should(Equal(uint64(i)))
+				}
+			})
+		})
+
+		Context("when replaying the log", func() {
+			It("should iterate in order from the given sequence number", func() {
+				table := db.NewTable(memdb.New(codec), "log")
+				log := New(table)
+				for i := 0; i < 10; i++ {
+					seq, err := log.Append(int64(i * i))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(seq).Should(Equal(uint64(i)))
+				}
+
+				iter := log.ReadFrom(4)
+				defer iter.Close()
+
+				// Appends after the iterator is created should not be
+				// iterated.
+				_, err := log.Append(int64(-1))
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = iter.Key()
+				Expect(err).Should(Equal(db.ErrIndexOutOfRange))
+
+				next := 4
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal(Key(uint64(next))))
+
+					var value int64
+					Expect(iter.Value(&value)).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(int64(next * next)))
+					next++
+				}
+				Expect(next).Should(Equal(10))
+
+				var value int64
+				Expect(iter.Value(&value)).Should(Equal(db.ErrIndexOutOfRange))
+			})
+
+			It("should not iterate when reading from the end", func() {
+				log := New(db.NewTable(memdb.New(codec), "log"))
+				_, err := log.Append(int64(1))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(log.ReadFrom(1).Next()).Should(BeFalse())
+				Expect(log.ReadFrom(10).Next()).Should(BeFalse())
+			})
+
+			It("should continue from the persisted sequence number", func() {
+				table := db.NewTable(memdb.New(codec), "log")
+				_, err := New(table).Append(int64(1))
+				Expect(err).NotTo(HaveOccurred())
+
+				seq, err := New(table).Append(int64(2))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(seq).Should(Equal(uint64(1)))
+			})
+		})
+	}
+})
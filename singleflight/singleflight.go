@@ -0,0 +1,125 @@
+package singleflight
+
+import (
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// call is a Get that is in flight. The result is shared with the callers that
+// get the same key while it is in flight.
+type call struct {
+	wg   *sync.WaitGroup
+	data []byte
+	err  error
+}
+
+type singleflightDB struct {
+	inner db.DB
+	codec db.Codec
+
+	// mu protects the calls that are in flight.
+	mu    *sync.Mutex
+	calls map[string]*call
+}
+
+// Wrap returns a `db.DB` where concurrent Gets of the same key only call Get
+// on the inner `db.DB` once. The first caller gets the value from the inner
+// `db.DB`, and the callers that arrive while it is in flight wait for it, and
+// share its error or a copy of its value. Values are copied by encoding them
+// with the given codec, and decoding them into the value of each caller.
+// Results are not cached, so a Get that starts after the previous one has
+// finished always calls Get on the inner `db.DB`. Gets that start after an
+// Insert or Delete of the same key are never given the result of a Get that
+// started before it.
+func Wrap(inner db.DB, codec db.Codec) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	return &singleflightDB{
+		inner: inner,
+		codec: codec,
+		mu:    new(sync.Mutex),
+		calls: map[string]*call{},
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (singleflightDB *singleflightDB) Close() error {
+	return singleflightDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (singleflightDB *singleflightDB) Insert(key string, value interface{}) error {
+	if err := singleflightDB.inner.Insert(key, value); err != nil {
+		return err
+	}
+	singleflightDB.forget(key)
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (singleflightDB *singleflightDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	singleflightDB.mu.Lock()
+	if c, ok := singleflightDB.calls[key]; ok {
+		singleflightDB.mu.Unlock()
+		c.wg.Wait()
+		if c.err != nil {
+			return c.err
+		}
+		return singleflightDB.codec.Decode(c.data, value)
+	}
+	c := &call{wg: new(sync.WaitGroup)}
+	c.wg.Add(1)
+	singleflightDB.calls[key] = c
+	singleflightDB.mu.Unlock()
+
+	err := singleflightDB.inner.Get(key, value)
+	c.err = err
+	if err == nil {
+		// The error is only returned to the callers that are waiting, because
+		// this caller already has the value.
+		c.data, c.err = singleflightDB.codec.Encode(value)
+	}
+
+	singleflightDB.mu.Lock()
+	if singleflightDB.calls[key] == c {
+		delete(singleflightDB.calls, key)
+	}
+	singleflightDB.mu.Unlock()
+	c.wg.Done()
+	return err
+}
+
+// Delete implements the `db.DB` interface.
+func (singleflightDB *singleflightDB) Delete(key string) error {
+	if err := singleflightDB.inner.Delete(key); err != nil {
+		return err
+	}
+	singleflightDB.forget(key)
+	return nil
+}
+
+// Size implements the `db.DB` interface.
+func (singleflightDB *singleflightDB) Size(prefix string) (int, error) {
+	return singleflightDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (singleflightDB *singleflightDB) Iterator(prefix string) db.Iterator {
+	return singleflightDB.inner.Iterator(prefix)
+}
+
+// forget removes the Get of the key that is in flight, if there is one, so
+// that later Gets call Get on the inner `db.DB` again. The callers that are
+// already waiting for it still share its result.
+func (singleflightDB *singleflightDB) forget(key string) {
+	singleflightDB.mu.Lock()
+	defer singleflightDB.mu.Unlock()
+
+	delete(singleflightDB.calls, key)
+}
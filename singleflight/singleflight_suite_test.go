@@ -0,0 +1,13 @@
+package singleflight_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSingleflight(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Singleflight Suite")
+}
@@ -0,0 +1,131 @@
+package singleflight_test
+
+import (
+	"sync"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/singleflight"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+// blockingDB is a `db.DB` that counts Gets, and blocks them until it is
+// released.
+type blockingDB struct {
+	db.DB
+	gets    int64
+	release chan struct{}
+}
+
+func (blockingDB *blockingDB) Get(key string, value interface{}) error {
+	atomic.AddInt64(&blockingDB.gets, 1)
+	<-blockingDB.release
+	return blockingDB.DB.Get(key, value)
+}
+
+var _ = Describe("singleflight db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when getting a missing key concurrently", func() {
+			It("should only get it from the inner db once", func() {
+				inner := &blockingDB{DB: memdb.New(codec), release: make(chan struct{})}
+				database := Wrap(inner, codec)
+
+				started := new(sync.WaitGroup)
+				started.Add(100)
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					phi.ParForAll(100, func(i int) {
+						started.Done()
+						var value testutil.TestStruct
+						Expect(database.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+					})
+				}()
+
+				// Release the inner Get once one caller is blocked in it, and
+				// all of the others are about to join it. Callers that have
+				// not joined it by then start a Get of their own.
+				started.Wait()
+				Eventually(func() int64 { return atomic.LoadInt64(&inner.gets) }).Should(Equal(int64(1)))
+				close(inner.release)
+				<-done
+				Expect(atomic.LoadInt64(&inner.gets)).Should(BeNumerically("<", 100))
+			})
+		})
+
+		Context("when getting a key concurrently", func() {
+			It("should give every caller its own copy of the value", func() {
+				inner := &blockingDB{DB: memdb.New(codec), release: make(chan struct{})}
+				database := Wrap(inner, codec)
+				value := testutil.RandomTestStruct()
+				Expect(database.Insert("key", value)).Should(Succeed())
+
+				values := make([]testutil.TestStruct, 100)
+				started := new(sync.WaitGroup)
+				started.Add(len(values))
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					phi.ParForAll(values, func(i int) {
+						started.Done()
+						values[i].D = []byte{}
+						Expect(database.Get("key", &values[i])).Should(Succeed())
+					})
+				}()
+
+				started.Wait()
+				Eventually(func() int64 { return atomic.LoadInt64(&inner.gets) }).Should(Equal(int64(1)))
+				close(inner.release)
+				<-done
+				Expect(atomic.LoadInt64(&inner.gets)).Should(BeNumerically("<", 100))
+				for i := range values {
+					Expect(values[i]).Should(Equal(value))
+				}
+
+				// Modifying one copy should not modify the others.
+				values[0].D = append(values[0].D[:0], 0xFF)
+				Expect(values[1]).Should(Equal(value))
+			})
+		})
+
+		Context("when getting a key after a previous get has finished", func() {
+			It("should get it from the inner db again", func() {
+				inner := &blockingDB{DB: memdb.New(codec), release: make(chan struct{})}
+				close(inner.release)
+				database := Wrap(inner, codec)
+
+				var value testutil.TestStruct
+				Expect(database.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(database.Insert("key", testutil.RandomTestStruct())).Should(Succeed())
+				value.D = []byte{}
+				Expect(database.Get("key", &value)).Should(Succeed())
+				Expect(atomic.LoadInt64(&inner.gets)).Should(Equal(int64(2)))
+			})
+		})
+
+		Context("when doing operations with empty keys", func() {
+			It("should return ErrEmptyKey", func() {
+				database := Wrap(memdb.New(codec), codec)
+				var value testutil.TestStruct
+				Expect(database.Insert("", value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+	}
+
+	Context("when the codec is nil", func() {
+		It("should panic", func() {
+			Expect(func() { Wrap(memdb.New(testutil.Codecs[0]), nil) }).Should(Panic())
+		})
+	})
+})
@@ -0,0 +1,246 @@
+package tagged
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+const (
+	// dataPrefix is the prefix of the keys used to store the data.
+	dataPrefix = "data_"
+
+	// indexPrefix is the prefix of the keys used to store the inverted index
+	// from tags to keys.
+	indexPrefix = "index_"
+
+	// tagsPrefix is the prefix of the keys used to store the tags of each key,
+	// so that the inverted index can be cleaned up.
+	tagsPrefix = "tags_"
+)
+
+// A DB is a `db.DB` where key/value pairs can be tagged, and keys can be
+// queried by tag. Inserting a key/value pair with Insert removes all of its
+// tags.
+type DB interface {
+	db.DB
+
+	// InsertTagged writes the key/value pair into the DB and replaces the tags
+	// of the key with the given tags.
+	InsertTagged(key string, value interface{}, tags ...string) error
+
+	// KeysByTag returns all keys that are tagged with the given tag. Index
+	// entries for keys that no longer exist (for example, because they have
+	// been evicted by the underlying db) are removed.
+	KeysByTag(tag string) ([]string, error)
+}
+
+type taggedDB struct {
+	// indexMu is used to keep the index consistent with the data.
+	indexMu *sync.Mutex
+	inner   db.DB
+}
+
+// Wrap returns a `DB` that stores the data and the index in the inner `db.DB`.
+// The inner `db.DB` must not be shared with anything else.
+func Wrap(inner db.DB) DB {
+	return &taggedDB{
+		indexMu: new(sync.Mutex),
+		inner:   inner,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (taggedDB *taggedDB) Close() error {
+	return taggedDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (taggedDB *taggedDB) Insert(key string, value interface{}) error {
+	return taggedDB.InsertTagged(key, value)
+}
+
+// InsertTagged implements the `DB` interface.
+func (taggedDB *taggedDB) InsertTagged(key string, value interface{}, tags ...string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	taggedDB.indexMu.Lock()
+	defer taggedDB.indexMu.Unlock()
+
+	if err := taggedDB.removeTags(key); err != nil {
+		return err
+	}
+	if err := taggedDB.inner.Insert(dataPrefix+key, value); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	for _, tag := range tags {
+		if err := taggedDB.inner.Insert(indexKey(tag, key), []byte{}); err != nil {
+			return fmt.Errorf("error inserting index entry for tag=%v: %w", tag, err)
+		}
+	}
+	if err := taggedDB.inner.Insert(tagsPrefix+key, encodeTags(tags)); err != nil {
+		return fmt.Errorf("error inserting tags: %w", err)
+	}
+	return nil
+}
+
+// Get implements the `db.DB` interface.
+func (taggedDB *taggedDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return taggedDB.inner.Get(dataPrefix+key, value)
+}
+
+// Delete implements the `db.DB` interface. The key is also removed from the
+// index.
+func (taggedDB *taggedDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	taggedDB.indexMu.Lock()
+	defer taggedDB.indexMu.Unlock()
+
+	if err := taggedDB.inner.Delete(dataPrefix + key); err != nil {
+		return err
+	}
+	return taggedDB.removeTags(key)
+}
+
+// Size implements the `db.DB` interface. Only the data is counted.
+func (taggedDB *taggedDB) Size(prefix string) (int, error) {
+	return taggedDB.inner.Size(dataPrefix + prefix)
+}
+
+// Iterator implements the `db.DB` interface. Only the data is iterated.
+func (taggedDB *taggedDB) Iterator(prefix string) db.Iterator {
+	return taggedDB.inner.Iterator(dataPrefix + prefix)
+}
+
+// KeysByTag implements the `DB` interface.
+func (taggedDB *taggedDB) KeysByTag(tag string) ([]string, error) {
+	taggedDB.indexMu.Lock()
+	defer taggedDB.indexMu.Unlock()
+
+	indexed, err := taggedDB.indexedKeys(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(indexed))
+	for _, key := range indexed {
+		ok, err := taggedDB.exists(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys = append(keys, key)
+			continue
+		}
+
+		// The data has been removed without going through the wrapper, so the
+		// stale index entries are removed.
+		if err := taggedDB.inner.Delete(indexKey(tag, key)); err != nil {
+			return nil, fmt.Errorf("error deleting stale index entry for key=%v: %w", key, err)
+		}
+		if err := taggedDB.removeTags(key); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (taggedDB *taggedDB) indexedKeys(tag string) ([]string, error) {
+	iter := taggedDB.inner.Iterator(indexKey(tag, ""))
+	defer iter.Close()
+
+	keys := []string{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, fmt.Errorf("error reading index entry: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error reading index: %w", err)
+	}
+	return keys, nil
+}
+
+// exists returns whether there is data associated with the key. The value is
+// not needed, so only ErrKeyNotFound is treated as the data being missing and
+// decoding errors are ignored.
+func (taggedDB *taggedDB) exists(key string) (bool, error) {
+	var value []byte
+	err := taggedDB.inner.Get(dataPrefix+key, &value)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// removeTags removes the key from the index of all of its tags.
+func (taggedDB *taggedDB) removeTags(key string) error {
+	var data []byte
+	if err := taggedDB.inner.Get(tagsPrefix+key, &data); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error getting tags: %w", err)
+	}
+	tags, err := decodeTags(data)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := taggedDB.inner.Delete(indexKey(tag, key)); err != nil {
+			return fmt.Errorf("error deleting index entry for tag=%v: %w", tag, err)
+		}
+	}
+	if err := taggedDB.inner.Delete(tagsPrefix + key); err != nil {
+		return fmt.Errorf("error deleting tags: %w", err)
+	}
+	return nil
+}
+
+// indexKey returns the key of the index entry for the given tag and key. The
+// tag is prefixed by its length so that no tag can be a prefix of another.
+func indexKey(tag, key string) string {
+	return fmt.Sprintf("%v%d_%v%v", indexPrefix, len(tag), tag, key)
+}
+
+func encodeTags(tags []string) []byte {
+	data := []byte{}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, tag := range tags {
+		n := binary.PutUvarint(buf, uint64(len(tag)))
+		data = append(data, buf[:n]...)
+		data = append(data, tag...)
+	}
+	return data
+}
+
+func decodeTags(data []byte) ([]string, error) {
+	tags := []string{}
+	for len(data) > 0 {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < length {
+			return nil, errors.New("malformed tags")
+		}
+		tags = append(tags, string(data[n:n+int(length)]))
+		data = data[n+int(length):]
+	}
+	return tags, nil
+}
@@ -0,0 +1,13 @@
+package tagged_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTagged(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tagged Suite")
+}
@@ -0,0 +1,134 @@
+package tagged_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/tagged"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("tagged db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when inserting tagged values", func() {
+			It("should be able to query keys by tag", func() {
+				database := Wrap(memdb.New(codec))
+
+				value := testutil.RandomTestStruct()
+				Expect(database.InsertTagged("a", value, "red", "big")).NotTo(HaveOccurred())
+				Expect(database.InsertTagged("b", value, "red")).NotTo(HaveOccurred())
+				Expect(database.InsertTagged("c", value, "re")).NotTo(HaveOccurred())
+				Expect(database.Insert("d", value)).NotTo(HaveOccurred())
+
+				keys, err := database.KeysByTag("red")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(ConsistOf("a", "b"))
+
+				keys, err = database.KeysByTag("big")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(ConsistOf("a"))
+
+				keys, err = database.KeysByTag("re")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(ConsistOf("c"))
+
+				keys, err = database.KeysByTag("small")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(BeEmpty())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("a", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				size, err := database.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(4))
+			})
+
+			It("should replace the tags when inserting again", func() {
+				database := Wrap(memdb.New(codec))
+
+				value := testutil.RandomTestStruct()
+				Expect(database.InsertTagged("a", value, "red")).NotTo(HaveOccurred())
+				Expect(database.InsertTagged("a", value, "blue")).NotTo(HaveOccurred())
+
+				keys, err := database.KeysByTag("red")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(BeEmpty())
+
+				keys, err = database.KeysByTag("blue")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(ConsistOf("a"))
+
+				Expect(database.Insert("a", value)).NotTo(HaveOccurred())
+				keys, err = database.KeysByTag("blue")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(BeEmpty())
+			})
+		})
+
+		Context("when deleting tagged values", func() {
+			It("should remove the key from the index", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner)
+
+				value := testutil.RandomTestStruct()
+				Expect(database.InsertTagged("a", value, "red", "big")).NotTo(HaveOccurred())
+				Expect(database.Delete("a")).NotTo(HaveOccurred())
+
+				keys, err := database.KeysByTag("red")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(BeEmpty())
+
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+		})
+
+		Context("when the data is removed from the underlying db", func() {
+			It("should reconcile the stale index entries", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner)
+
+				value := testutil.RandomTestStruct()
+				Expect(database.InsertTagged("a", value, "red", "big")).NotTo(HaveOccurred())
+				Expect(database.InsertTagged("b", value, "red")).NotTo(HaveOccurred())
+
+				// Simulate the data being evicted by the underlying db.
+				Expect(inner.Delete("data_a")).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("a", &stored)).Should(Equal(db.ErrKeyNotFound))
+
+				keys, err := database.KeysByTag("red")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(ConsistOf("b"))
+
+				// All index entries for the evicted key should be removed,
+				// including those for other tags.
+				keys, err = database.KeysByTag("big")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).Should(BeEmpty())
+
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(3))
+			})
+		})
+
+		Context("when operating with empty key", func() {
+			It("should return ErrEmptyKey error", func() {
+				database := Wrap(memdb.New(codec))
+				value := testutil.RandomTestStruct()
+				Expect(database.InsertTagged("", value, "red")).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(database.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+	}
+})
@@ -0,0 +1,153 @@
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// ErrQuotaExceeded is returned when inserting a new key into a tenant that
+// already holds as many key/value pairs as its quota allows.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// A Manager partitions a `db.DB` between tenants.
+type Manager interface {
+
+	// Tenant returns a `db.DB` that only sees the key/value pairs of the
+	// tenant with the given id, and holds at most the given number of them.
+	// Views of the same tenant share the same key/value pairs, and inserts
+	// are checked against the quota of the view that is used. Closing a view
+	// does nothing, and the inner `db.DB` must be closed instead.
+	Tenant(id string, quota int) db.DB
+}
+
+type manager struct {
+	inner db.DB
+
+	// tenantsMu protects the locks of the tenants. Each tenant has its own
+	// lock, so that inserts into different tenants do not block each other.
+	tenantsMu *sync.Mutex
+	tenants   map[string]*sync.Mutex
+}
+
+// New returns a Manager over the inner `db.DB`. The key/value pairs of each
+// tenant are stored with a prefix derived from the length of its id and the
+// id, so no tenant can see the key/value pairs of another, even if its id is
+// a prefix of the other id.
+func New(inner db.DB) Manager {
+	return &manager{
+		inner:     inner,
+		tenantsMu: new(sync.Mutex),
+		tenants:   map[string]*sync.Mutex{},
+	}
+}
+
+// Tenant implements the `Manager` interface.
+func (manager *manager) Tenant(id string, quota int) db.DB {
+	if quota <= 0 {
+		panic(fmt.Sprintf("quota must be positive, got %v", quota))
+	}
+
+	manager.tenantsMu.Lock()
+	defer manager.tenantsMu.Unlock()
+
+	mu, ok := manager.tenants[id]
+	if !ok {
+		mu = new(sync.Mutex)
+		manager.tenants[id] = mu
+	}
+	return &tenantDB{
+		mu:     mu,
+		inner:  manager.inner,
+		id:     id,
+		prefix: fmt.Sprintf("tenant_%d_%v_", len(id), id),
+		quota:  quota,
+	}
+}
+
+// tenantDB is a `db.DB` over the key/value pairs of one tenant.
+type tenantDB struct {
+	// mu is held while inserting, so that concurrent inserts cannot exceed
+	// the quota.
+	mu     *sync.Mutex
+	inner  db.DB
+	id     string
+	prefix string
+	quota  int
+}
+
+// Close implements the `db.DB` interface. It does nothing.
+func (tenantDB *tenantDB) Close() error {
+	return nil
+}
+
+// Insert implements the `db.DB` interface. If the key does not exist, and the
+// tenant already holds as many key/value pairs as its quota allows, then
+// ErrQuotaExceeded is returned. Checking the quota counts the key/value pairs
+// of the tenant in the inner `db.DB`, so it stays correct when key/value pairs
+// are evicted or written through other views.
+func (tenantDB *tenantDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	tenantDB.mu.Lock()
+	defer tenantDB.mu.Unlock()
+
+	exists, err := tenantDB.exists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		size, err := tenantDB.inner.Size(tenantDB.prefix)
+		if err != nil {
+			return err
+		}
+		if size >= tenantDB.quota {
+			return fmt.Errorf("%w: tenant = %v, quota = %v", ErrQuotaExceeded, tenantDB.id, tenantDB.quota)
+		}
+	}
+	return tenantDB.inner.Insert(tenantDB.prefix+key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (tenantDB *tenantDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return tenantDB.inner.Get(tenantDB.prefix+key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (tenantDB *tenantDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return tenantDB.inner.Delete(tenantDB.prefix + key)
+}
+
+// Size implements the `db.DB` interface. It only counts the key/value pairs of
+// the tenant.
+func (tenantDB *tenantDB) Size(prefix string) (int, error) {
+	return tenantDB.inner.Size(tenantDB.prefix + prefix)
+}
+
+// Iterator implements the `db.DB` interface. It only iterates over the
+// key/value pairs of the tenant.
+func (tenantDB *tenantDB) Iterator(prefix string) db.Iterator {
+	return tenantDB.inner.Iterator(tenantDB.prefix + prefix)
+}
+
+// exists returns whether or not the key is held by the tenant, without
+// decoding its value. It is checked with `db.HasBatch`, so the inner `db.DB`
+// does not need to iterate over the keys that begin with it if it can check
+// keys directly.
+func (tenantDB *tenantDB) exists(key string) (bool, error) {
+	found, err := db.HasBatch(tenantDB.inner, []string{tenantDB.prefix + key})
+	if err != nil {
+		return false, err
+	}
+	return found[0], nil
+}
@@ -0,0 +1,144 @@
+package tenant_test
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/tenant"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+// scanningDB is a `db.DB` that counts the number of iterators that are
+// created. It checks keys in batches using the inner `db.DB`, which must
+// implement `db.BatchChecker`.
+type scanningDB struct {
+	db.DB
+	scans int
+}
+
+func (scanningDB *scanningDB) Iterator(prefix string) db.Iterator {
+	scanningDB.scans++
+	return scanningDB.DB.Iterator(prefix)
+}
+
+func (scanningDB *scanningDB) HasBatch(keys []string) ([]bool, error) {
+	return scanningDB.DB.(db.BatchChecker).HasBatch(keys)
+}
+
+var _ = Describe("multi-tenant db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when using several tenants", func() {
+			It("should isolate their key/value pairs", func() {
+				inner := memdb.New(codec)
+				manager := New(inner)
+				a := manager.Tenant("a", 100)
+				ab := manager.Tenant("ab", 100)
+
+				Expect(a.Insert("bkey", int64(1))).Should(Succeed())
+				Expect(ab.Insert("key", int64(2))).Should(Succeed())
+				Expect(ab.Insert("other", int64(3))).Should(Succeed())
+
+				var value int64
+				Expect(a.Get("bkey", &value)).Should(Succeed())
+				Expect(value).Should(Equal(int64(1)))
+				Expect(a.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(ab.Get("bkey", &value)).Should(Equal(db.ErrKeyNotFound))
+				Expect(ab.Get("key", &value)).Should(Succeed())
+				Expect(value).Should(Equal(int64(2)))
+
+				size, err := a.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+				size, err = ab.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(2))
+				size, err = inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(3))
+
+				iter := ab.Iterator("")
+				defer iter.Close()
+				keys := []string{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys = append(keys, key)
+				}
+				Expect(keys).Should(ConsistOf("key", "other"))
+
+				Expect(a.Delete("key")).Should(Succeed())
+				Expect(ab.Get("key", &value)).Should(Succeed())
+			})
+
+			It("should enforce the quota of each tenant separately", func() {
+				manager := New(memdb.New(codec))
+				small := manager.Tenant("small", 3)
+				large := manager.Tenant("large", 10)
+
+				for i := 0; i < 3; i++ {
+					Expect(small.Insert(fmt.Sprintf("%v", i), int64(i))).Should(Succeed())
+				}
+				err := small.Insert("3", int64(3))
+				Expect(errors.Is(err, ErrQuotaExceeded)).Should(BeTrue())
+
+				// Overwriting an existing key should not count against the
+				// quota, and deleting should make room.
+				Expect(small.Insert("0", int64(42))).Should(Succeed())
+				Expect(small.Delete("1")).Should(Succeed())
+				Expect(small.Insert("3", int64(3))).Should(Succeed())
+
+				for i := 0; i < 10; i++ {
+					Expect(large.Insert(fmt.Sprintf("%v", i), int64(i))).Should(Succeed())
+				}
+				err = large.Insert("10", int64(10))
+				Expect(errors.Is(err, ErrQuotaExceeded)).Should(BeTrue())
+			})
+
+			It("should check whether a key exists without iterating over the keys", func() {
+				inner := &scanningDB{DB: memdb.New(codec)}
+				tenant := New(inner).Tenant("tenant", 2)
+				for _, key := range []string{"a", "a/a", "a"} {
+					Expect(tenant.Insert(key, int64(1))).Should(Succeed())
+				}
+				Expect(inner.scans).Should(Equal(0))
+			})
+
+			It("should not exceed the quota with concurrent inserts", func() {
+				manager := New(memdb.New(codec))
+				phi.ParForAll(50, func(i int) {
+					tenant := manager.Tenant("tenant", 10)
+					err := tenant.Insert(fmt.Sprintf("%v", i), int64(i))
+					if err != nil {
+						Expect(errors.Is(err, ErrQuotaExceeded)).Should(BeTrue())
+					}
+				})
+
+				size, err := manager.Tenant("tenant", 10).Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+			})
+
+			It("should return ErrEmptyKey when doing operations with empty keys", func() {
+				tenant := New(memdb.New(codec)).Tenant("tenant", 10)
+				var value int64
+				Expect(tenant.Insert("", int64(1))).Should(Equal(db.ErrEmptyKey))
+				Expect(tenant.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+				Expect(tenant.Delete("")).Should(Equal(db.ErrEmptyKey))
+			})
+		})
+	}
+
+	Context("when the quota is not positive", func() {
+		It("should panic", func() {
+			Expect(func() { New(memdb.New(testutil.Codecs[0])).Tenant("tenant", 0) }).Should(Panic())
+		})
+	})
+})
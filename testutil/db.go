@@ -1,6 +1,9 @@
 package testutil
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/renproject/kv/badgerdb"
 	"github.com/renproject/kv/codec"
 	"github.com/renproject/kv/db"
@@ -27,3 +30,244 @@ var DbInitalizer = []func(db.Codec) db.DB{
 		return badgerdb.New(".badgerdb", codec)
 	},
 }
+
+// ConditionalDeleteDB is a DB, or a Table, that can delete values if they are
+// unchanged.
+type ConditionalDeleteDB interface {
+	Insert(key string, value interface{}) error
+	Get(key string, value interface{}) error
+	db.ConditionalDeleter
+}
+
+// RaceDeleteIf races an update of a value against deleting its previous value
+// if it is unchanged, the given number of times. Whichever happens first, the
+// updated value must be left in the DB. It returns the first error that is
+// found.
+func RaceDeleteIf(database ConditionalDeleteDB, n int) error {
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("race-%v", i)
+		if err := database.Insert(key, int64(1)); err != nil {
+			return err
+		}
+
+		start := make(chan struct{})
+		errs := make([]error, 2)
+		wg := new(sync.WaitGroup)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[0] = database.Insert(key, int64(2))
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[1] = database.DeleteIf(key, int64(1))
+		}()
+		close(start)
+		wg.Wait()
+		if err := CheckErrors(errs); err != nil {
+			return err
+		}
+
+		var value int64
+		if err := database.Get(key, &value); err != nil {
+			return fmt.Errorf("error getting updated value of key=%v: %w", key, err)
+		}
+		if value != 2 {
+			return fmt.Errorf("unexpected value of key=%v: expected 2, got %v", key, value)
+		}
+	}
+	return nil
+}
+
+// OrderedDB is a DB that can peek at its smallest and largest keys.
+type OrderedDB interface {
+	db.DB
+	db.Ordered
+}
+
+// CheckFirstLast checks that the first and last keys of an empty DB follow the
+// smallest and largest keys as they are inserted and deleted. The DB is left
+// empty. It returns the first error that is found.
+func CheckFirstLast(database OrderedDB) error {
+	// expect the first and last keys, and their values. An empty key expects
+	// ErrKeyNotFound.
+	expect := func(first, last string) error {
+		for _, peek := range []struct {
+			name string
+			key  string
+			f    func(value interface{}) (string, error)
+		}{{"first", first, database.First}, {"last", last, database.Last}} {
+			var value int64
+			key, err := peek.f(&value)
+			if peek.key == "" {
+				if err != db.ErrKeyNotFound {
+					return fmt.Errorf("unexpected %v key: expected %v, got key=%v, err=%v", peek.name, db.ErrKeyNotFound, key, err)
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("error getting %v key: %w", peek.name, err)
+			}
+			if key != peek.key || fmt.Sprintf("key%v", value) != key {
+				return fmt.Errorf("unexpected %v key: expected %v, got key=%v, value=%v", peek.name, peek.key, key, value)
+			}
+		}
+		return nil
+	}
+
+	if err := expect("", ""); err != nil {
+		return err
+	}
+	for _, i := range []int64{5, 3, 7, 4, 6} {
+		if err := database.Insert(fmt.Sprintf("key%v", i), i); err != nil {
+			return err
+		}
+	}
+	if err := expect("key3", "key7"); err != nil {
+		return err
+	}
+
+	// Deleting the extremes should move them inwards.
+	for _, key := range []string{"key3", "key7"} {
+		if err := database.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := expect("key4", "key6"); err != nil {
+		return err
+	}
+
+	// Inserting new extremes should move them outwards.
+	for _, i := range []int64{1, 9} {
+		if err := database.Insert(fmt.Sprintf("key%v", i), i); err != nil {
+			return err
+		}
+	}
+	if err := expect("key1", "key9"); err != nil {
+		return err
+	}
+
+	for _, key := range []string{"key1", "key4", "key5", "key6", "key9"} {
+		if err := database.Delete(key); err != nil {
+			return err
+		}
+	}
+	return expect("", "")
+}
+
+// SwapDB is a DB, or a Table, that can swap values.
+type SwapDB interface {
+	Get(key string, value interface{}) error
+	db.Swapper
+}
+
+// RaceSwap swaps the given number of values into the same key concurrently.
+// Every value except the last one must be returned to exactly one caller as
+// the previous value, and exactly one caller must find the key missing. The key
+// must not exist beforehand. It returns the first error that is found.
+func RaceSwap(database SwapDB, n int) error {
+	olds := make([]int64, n)
+	existed := make([]bool, n)
+	errs := make([]error, n)
+	wg := new(sync.WaitGroup)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			existed[i], errs[i] = database.Swap("key", int64(i), &olds[i])
+		}(i)
+	}
+	wg.Wait()
+	if err := CheckErrors(errs); err != nil {
+		return err
+	}
+
+	var last int64
+	if err := database.Get("key", &last); err != nil {
+		return fmt.Errorf("error getting last value: %w", err)
+	}
+	replaced := map[int64]bool{}
+	numNew := 0
+	for i := range olds {
+		if !existed[i] {
+			numNew++
+			continue
+		}
+		if replaced[olds[i]] {
+			return fmt.Errorf("value %v was replaced more than once", olds[i])
+		}
+		replaced[olds[i]] = true
+	}
+	if numNew != 1 {
+		return fmt.Errorf("unexpected number of swaps into a missing key: expected 1, got %v", numNew)
+	}
+	if len(replaced) != n-1 || replaced[last] {
+		return fmt.Errorf("unexpected replaced values: got %v, with last value %v", len(replaced), last)
+	}
+	return nil
+}
+
+// CheckSame returns an error if the two DBs do not hold the same key/value
+// pairs. Values are decoded into the value returned by `newValue`.
+func CheckSame(a, b db.DB, newValue func() interface{}) error {
+	iterA, iterB := a.Iterator(""), b.Iterator("")
+	defer iterA.Close()
+	defer iterB.Close()
+
+	onlyInA, onlyInB, different, err := db.Diff(iterA, iterB, newValue)
+	if err != nil {
+		return err
+	}
+	if len(onlyInA) > 0 || len(onlyInB) > 0 || len(different) > 0 {
+		return fmt.Errorf("dbs are different: only in a = %v, only in b = %v, different = %v", onlyInA, onlyInB, different)
+	}
+	return nil
+}
+
+// SequenceLength is the number of keys written by WriteSequence.
+const SequenceLength = 20
+
+// WriteSequence inserts random values for the keys 0 to SequenceLength-1,
+// overwrites every third key, and then deletes every fourth key. It returns
+// the first error that is found.
+func WriteSequence(database db.DB) error {
+	for i := 0; i < SequenceLength; i++ {
+		if err := database.Insert(fmt.Sprintf("%v", i), RandomTestStruct()); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < SequenceLength; i += 3 {
+		if err := database.Insert(fmt.Sprintf("%v", i), RandomTestStruct()); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < SequenceLength; i += 4 {
+		if err := database.Delete(fmt.Sprintf("%v", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSequence gets the keys written by WriteSequence, along with some keys
+// that were never written, and returns an error if a key is not found when it
+// should be, or is found when it should not be. Values are decoded into the
+// value returned by `newValue`.
+func ReadSequence(database db.DB, newValue func() interface{}) error {
+	for i := 0; i < SequenceLength+5; i++ {
+		key := fmt.Sprintf("%v", i)
+		err := database.Get(key, newValue())
+		if i%4 == 0 || i >= SequenceLength {
+			if err != db.ErrKeyNotFound {
+				return fmt.Errorf("unexpected result of getting key=%v: expected %v, got %v", key, db.ErrKeyNotFound, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error getting key=%v: %w", key, err)
+		}
+	}
+	return nil
+}
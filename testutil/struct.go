@@ -26,36 +26,36 @@ func (s TestStruct) MarshalBinary() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	aBytes := []byte(s.A)
 	if err := binary.Write(buf, binary.LittleEndian, uint64(len(aBytes))); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.A len: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.A len: %w", err)
 	}
 	if err := binary.Write(buf, binary.LittleEndian, aBytes); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.A data: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.A data: %w", err)
 	}
 	if err := binary.Write(buf, binary.LittleEndian, uint64(s.B)); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.B: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.B: %w", err)
 	}
 	if err := binary.Write(buf, binary.LittleEndian, s.C); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.C: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.C: %w", err)
 	}
 	if err := binary.Write(buf, binary.LittleEndian, uint64(len(s.D))); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.D len: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.D len: %w", err)
 	}
 	if err := binary.Write(buf, binary.LittleEndian, s.D); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.D data: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.D data: %w", err)
 	}
 	if err := binary.Write(buf, binary.LittleEndian, uint64(len(s.E))); err != nil {
-		return buf.Bytes(), fmt.Errorf("cannot write s.E len: %v", err)
+		return buf.Bytes(), fmt.Errorf("cannot write s.E len: %w", err)
 	}
 	for key, val := range s.E {
 		keyBytes := []byte(key)
 		if err := binary.Write(buf, binary.LittleEndian, uint64(len(keyBytes))); err != nil {
-			return buf.Bytes(), fmt.Errorf("cannot write key len: %v", err)
+			return buf.Bytes(), fmt.Errorf("cannot write key len: %w", err)
 		}
 		if err := binary.Write(buf, binary.LittleEndian, keyBytes); err != nil {
-			return buf.Bytes(), fmt.Errorf("cannot write key data: %v", err)
+			return buf.Bytes(), fmt.Errorf("cannot write key data: %w", err)
 		}
 		if err := binary.Write(buf, binary.LittleEndian, val); err != nil {
-			return buf.Bytes(), fmt.Errorf("cannot write val: %v", err)
+			return buf.Bytes(), fmt.Errorf("cannot write val: %w", err)
 		}
 	}
 	return buf.Bytes(), nil
@@ -66,45 +66,45 @@ func (s *TestStruct) UnmarshalBinary(data []byte) error {
 	buf := bytes.NewBuffer(data)
 	var numBytes uint64
 	if err := binary.Read(buf, binary.LittleEndian, &numBytes); err != nil {
-		return fmt.Errorf("cannot read s.A len: %v", err)
+		return fmt.Errorf("cannot read s.A len: %w", err)
 	}
 	aBytes := make([]byte, numBytes)
 	if _, err := buf.Read(aBytes); err != nil {
-		return fmt.Errorf("cannot read s.A data: %v", err)
+		return fmt.Errorf("cannot read s.A data: %w", err)
 	}
 	s.A = string(aBytes)
 	var b int64
 	if err := binary.Read(buf, binary.LittleEndian, &b); err != nil {
-		return fmt.Errorf("cannot read s.B: %v", err)
+		return fmt.Errorf("cannot read s.B: %w", err)
 	}
 	s.B = int(b)
 	if err := binary.Read(buf, binary.LittleEndian, &s.C); err != nil {
-		return fmt.Errorf("cannot read s.C: %v", err)
+		return fmt.Errorf("cannot read s.C: %w", err)
 	}
 	if err := binary.Read(buf, binary.LittleEndian, &numBytes); err != nil {
-		return fmt.Errorf("cannot read s.D len: %v", err)
+		return fmt.Errorf("cannot read s.D len: %w", err)
 	}
 	dBytes := make([]byte, numBytes)
 	if _, err := buf.Read(dBytes); err != nil {
-		return fmt.Errorf("cannot read s.D data: %v", err)
+		return fmt.Errorf("cannot read s.D data: %w", err)
 	}
 	s.D = dBytes
 	var lenE uint64
 	if err := binary.Read(buf, binary.LittleEndian, &lenE); err != nil {
-		return fmt.Errorf("cannot read s.E len: %v", err)
+		return fmt.Errorf("cannot read s.E len: %w", err)
 	}
 	s.E = make(map[string]float64, lenE)
 	for i := uint64(0); i < lenE; i++ {
 		if err := binary.Read(buf, binary.LittleEndian, &numBytes); err != nil {
-			return fmt.Errorf("cannot read key len: %v", err)
+			return fmt.Errorf("cannot read key len: %w", err)
 		}
 		keyBytes := make([]byte, numBytes)
 		if _, err := buf.Read(keyBytes); err != nil {
-			return fmt.Errorf("cannot read key data: %v", err)
+			return fmt.Errorf("cannot read key data: %w", err)
 		}
 		var val float64
 		if err := binary.Read(buf, binary.LittleEndian, &val); err != nil {
-			return fmt.Errorf("cannot read val: %v", err)
+			return fmt.Errorf("cannot read val: %w", err)
 		}
 		s.E[string(keyBytes)] = val
 	}
@@ -0,0 +1,100 @@
+package timeout
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+type timeoutDB struct {
+	inner   db.DB
+	timeout time.Duration
+}
+
+// Wrap returns a `db.DB` where inserts, gets, and deletes on the inner `db.DB`
+// return `context.DeadlineExceeded` if they take longer than the given
+// timeout.
+//
+// The inner `db.DB` is not cancelled when an operation times out. The operation
+// is abandoned, and may still complete in the background. This means that an
+// insert or delete which has timed out may, or may not, eventually be applied.
+// A get which has timed out will never write to the value it was given, or to
+// anything that the value refers to, but a value given to an insert which has
+// timed out may still be read, so it must not be modified.
+func Wrap(inner db.DB, timeout time.Duration) db.DB {
+	return &timeoutDB{
+		inner:   inner,
+		timeout: timeout,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (timeoutDB *timeoutDB) Close() error {
+	return timeoutDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (timeoutDB *timeoutDB) Insert(key string, value interface{}) error {
+	return timeoutDB.do(func() error {
+		return timeoutDB.inner.Insert(key, value)
+	})
+}
+
+// Get implements the `db.DB` interface. The value is read into a new zero
+// value of the same type, which replaces the value only if the get finishes in
+// time. Fields that are not set by decoding are left as zero, instead of
+// keeping their current values.
+func (timeoutDB *timeoutDB) Get(key string, value interface{}) error {
+	dest := reflect.ValueOf(value)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("expected non-nil pointer, got %T", value)
+	}
+
+	result := reflect.New(dest.Elem().Type())
+	if err := timeoutDB.do(func() error {
+		return timeoutDB.inner.Get(key, result.Interface())
+	}); err != nil {
+		return err
+	}
+	dest.Elem().Set(result.Elem())
+	return nil
+}
+
+// Delete implements the `db.DB` interface.
+func (timeoutDB *timeoutDB) Delete(key string) error {
+	return timeoutDB.do(func() error {
+		return timeoutDB.inner.Delete(key)
+	})
+}
+
+// Size implements the `db.DB` interface.
+func (timeoutDB *timeoutDB) Size(prefix string) (int, error) {
+	return timeoutDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (timeoutDB *timeoutDB) Iterator(prefix string) db.Iterator {
+	return timeoutDB.inner.Iterator(prefix)
+}
+
+// do the operation in the background, and return its error or
+// `context.DeadlineExceeded` if it does not finish before the timeout.
+func (timeoutDB *timeoutDB) do(operation func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- operation()
+	}()
+
+	timer := time.NewTimer(timeoutDB.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return context.DeadlineExceeded
+	}
+}
@@ -0,0 +1,13 @@
+package timeout_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTimeout(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Timeout Suite")
+}
@@ -0,0 +1,91 @@
+package timeout_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/timeout"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+// slowDB is a `db.DB` where every operation is delayed.
+type slowDB struct {
+	db.DB
+	delay time.Duration
+}
+
+func (slowDB slowDB) Insert(key string, value interface{}) error {
+	time.Sleep(slowDB.delay)
+	return slowDB.DB.Insert(key, value)
+}
+
+func (slowDB slowDB) Get(key string, value interface{}) error {
+	time.Sleep(slowDB.delay)
+	return slowDB.DB.Get(key, value)
+}
+
+func (slowDB slowDB) Delete(key string) error {
+	time.Sleep(slowDB.delay)
+	return slowDB.DB.Delete(key)
+}
+
+var _ = Describe("timeout db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when operations finish in time", func() {
+			It("should return their results", func() {
+				database := Wrap(slowDB{DB: memdb.New(codec)}, time.Second)
+
+				// Gob does not encode empty slices, so they would be read
+				// back as nil.
+				value := testutil.RandomTestStruct()
+				value.D = append(value.D, 0)
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).NotTo(HaveOccurred())
+				Expect(stored).Should(Equal(value))
+
+				Expect(database.Delete("key")).NotTo(HaveOccurred())
+				Expect(database.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+			})
+		})
+
+		Context("when operations are too slow", func() {
+			It("should return a deadline exceeded error", func() {
+				inner := memdb.New(codec)
+				database := Wrap(slowDB{DB: inner, delay: 50 * time.Millisecond}, 10*time.Millisecond)
+
+				value := testutil.RandomTestStruct()
+				Expect(inner.Insert("key", value)).NotTo(HaveOccurred())
+
+				start := time.Now()
+				stored := testutil.TestStruct{D: []byte{}}
+				Expect(database.Get("key", &stored)).Should(Equal(context.DeadlineExceeded))
+				Expect(time.Since(start)).Should(BeNumerically("<", 50*time.Millisecond))
+
+				// The abandoned get should not write to the value.
+				time.Sleep(100 * time.Millisecond)
+				Expect(stored).Should(Equal(testutil.TestStruct{D: []byte{}}))
+
+				// Nor to the slices that the value refers to.
+				stored = testutil.TestStruct{D: make([]byte, len(value.D), len(value.D)+1024)}
+				Expect(database.Get("key", &stored)).Should(Equal(context.DeadlineExceeded))
+				time.Sleep(100 * time.Millisecond)
+				Expect(stored.D[:cap(stored.D)]).Should(Equal(make([]byte, len(value.D)+1024)))
+
+				// The abandoned delete may still complete in the background.
+				Expect(database.Delete("key")).Should(Equal(context.DeadlineExceeded))
+				Eventually(func() error {
+					return inner.Get("key", &stored)
+				}).Should(Equal(db.ErrKeyNotFound))
+			})
+		})
+	}
+})
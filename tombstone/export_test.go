@@ -0,0 +1,8 @@
+package tombstone
+
+import "time"
+
+// SetNow replaces the clock used by the DB.
+func SetNow(database DB, now func() time.Time) {
+	database.(*tombstoneDB).now = now
+}
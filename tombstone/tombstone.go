@@ -0,0 +1,310 @@
+package tombstone
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv/db"
+)
+
+// The prefixes of the keys in the inner `db.DB`. Values are stored under the
+// value prefix, and the time at which they were soft deleted is stored under
+// the tombstone prefix. Neither prefix is a prefix of the other.
+const (
+	valuePrefix     = "value_"
+	tombstonePrefix = "tombstone_"
+)
+
+// A DB is a `db.DB` where key/value pairs can be soft deleted, leaving a
+// tombstone that can be seen by sync code until it is purged. Soft deleted
+// key/value pairs are treated as missing by Get, Size, and Iterator.
+type DB interface {
+	db.DB
+
+	// SoftDelete marks the key/value pair as deleted, without removing it.
+	// Inserting the key again removes the tombstone. Soft deleting a key that
+	// does not exist does nothing.
+	SoftDelete(key string) error
+
+	// PurgeTombstones removes the key/value pairs that were soft deleted at
+	// least the given duration ago, along with their tombstones, and returns
+	// the number of key/value pairs removed.
+	PurgeTombstones(olderThan time.Duration) (int, error)
+
+	// IteratorWithOptions over the key/value pairs in the DB where the key
+	// begins with the given prefix. By default, it skips soft deleted
+	// key/value pairs in the same way as Iterator.
+	IteratorWithOptions(prefix string, opts ...IteratorOption) Iterator
+}
+
+// An Iterator is a `db.Iterator` that can report whether the current
+// key/value pair has been soft deleted.
+type Iterator interface {
+	db.Iterator
+
+	// Deleted returns the time at which the current key/value pair was soft
+	// deleted, and whether or not it was.
+	Deleted() (time.Time, bool)
+}
+
+// An IteratorOption configures an Iterator when it is created.
+type IteratorOption func(*iterator)
+
+// IncludeTombstones makes the Iterator yield the key/value pairs that have
+// been soft deleted, but not purged, along with the others.
+func IncludeTombstones() IteratorOption {
+	return func(iter *iterator) {
+		iter.includeTombstones = true
+	}
+}
+
+type tombstoneDB struct {
+	mu    *sync.RWMutex
+	inner db.DB
+	now   func() time.Time
+}
+
+// Wrap returns a `DB` that stores its key/value pairs, and their tombstones, in
+// the inner `db.DB`. The inner `db.DB` must not be written to by anything
+// else, and its codec must be able to encode an int64, which is used to store
+// the time of each tombstone.
+func Wrap(inner db.DB) DB {
+	return &tombstoneDB{
+		mu:    new(sync.RWMutex),
+		inner: inner,
+		now:   time.Now,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (tombstoneDB *tombstoneDB) Close() error {
+	return tombstoneDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface. It removes the tombstone of the key,
+// if it has been soft deleted.
+func (tombstoneDB *tombstoneDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	tombstoneDB.mu.Lock()
+	defer tombstoneDB.mu.Unlock()
+
+	if err := tombstoneDB.inner.Insert(valuePrefix+key, value); err != nil {
+		return err
+	}
+	return tombstoneDB.inner.Delete(tombstonePrefix + key)
+}
+
+// Get implements the `db.DB` interface. If the key has been soft deleted, then
+// ErrKeyNotFound is returned.
+func (tombstoneDB *tombstoneDB) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	tombstoneDB.mu.RLock()
+	defer tombstoneDB.mu.RUnlock()
+
+	_, deleted, err := tombstoneDB.tombstone(key)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return db.ErrKeyNotFound
+	}
+	return tombstoneDB.inner.Get(valuePrefix+key, value)
+}
+
+// Delete implements the `db.DB` interface. It removes the key/value pair
+// immediately, along with its tombstone, without leaving a tombstone.
+func (tombstoneDB *tombstoneDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	tombstoneDB.mu.Lock()
+	defer tombstoneDB.mu.Unlock()
+
+	if err := tombstoneDB.inner.Delete(valuePrefix + key); err != nil {
+		return err
+	}
+	return tombstoneDB.inner.Delete(tombstonePrefix + key)
+}
+
+// SoftDelete implements the `DB` interface. Soft deleting a key again does not
+// change the time of its tombstone.
+func (tombstoneDB *tombstoneDB) SoftDelete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	tombstoneDB.mu.Lock()
+	defer tombstoneDB.mu.Unlock()
+
+	_, deleted, err := tombstoneDB.tombstone(key)
+	if err != nil || deleted {
+		return err
+	}
+	exists, err := db.HasBatch(tombstoneDB.inner, []string{valuePrefix + key})
+	if err != nil {
+		return err
+	}
+	if !exists[0] {
+		return nil
+	}
+	return tombstoneDB.inner.Insert(tombstonePrefix+key, tombstoneDB.now().UnixNano())
+}
+
+// PurgeTombstones implements the `DB` interface.
+func (tombstoneDB *tombstoneDB) PurgeTombstones(olderThan time.Duration) (int, error) {
+	tombstoneDB.mu.Lock()
+	defer tombstoneDB.mu.Unlock()
+
+	tombstones, err := tombstoneDB.tombstones("")
+	if err != nil {
+		return 0, err
+	}
+	cutoff := tombstoneDB.now().Add(-olderThan)
+	purged := 0
+	for key, deletedAt := range tombstones {
+		if deletedAt.After(cutoff) {
+			continue
+		}
+		if err := tombstoneDB.inner.Delete(valuePrefix + key); err != nil {
+			return purged, fmt.Errorf("error purging key=%v: %w", key, err)
+		}
+		if err := tombstoneDB.inner.Delete(tombstonePrefix + key); err != nil {
+			return purged, fmt.Errorf("error purging tombstone of key=%v: %w", key, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Size implements the `db.DB` interface. It does not count key/value pairs that
+// have been soft deleted.
+func (tombstoneDB *tombstoneDB) Size(prefix string) (int, error) {
+	tombstoneDB.mu.RLock()
+	defer tombstoneDB.mu.RUnlock()
+
+	size, err := tombstoneDB.inner.Size(valuePrefix + prefix)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := tombstoneDB.inner.Size(tombstonePrefix + prefix)
+	if err != nil {
+		return 0, err
+	}
+	return size - deleted, nil
+}
+
+// Iterator implements the `db.DB` interface. It skips key/value pairs that have
+// been soft deleted.
+func (tombstoneDB *tombstoneDB) Iterator(prefix string) db.Iterator {
+	return tombstoneDB.IteratorWithOptions(prefix)
+}
+
+// IteratorWithOptions implements the `DB` interface. The tombstones are read
+// when the iterator is created.
+func (tombstoneDB *tombstoneDB) IteratorWithOptions(prefix string, opts ...IteratorOption) Iterator {
+	tombstoneDB.mu.RLock()
+	defer tombstoneDB.mu.RUnlock()
+
+	tombstones, err := tombstoneDB.tombstones(prefix)
+	iter := &iterator{
+		Iterator:   tombstoneDB.inner.Iterator(valuePrefix + prefix),
+		prefix:     prefix,
+		tombstones: tombstones,
+		err:        err,
+	}
+	for _, opt := range opts {
+		opt(iter)
+	}
+	return iter
+}
+
+// tombstone returns the time at which the key was soft deleted, and whether
+// or not it was. The caller must hold the lock.
+func (tombstoneDB *tombstoneDB) tombstone(key string) (time.Time, bool, error) {
+	var deletedAt int64
+	if err := tombstoneDB.inner.Get(tombstonePrefix+key, &deletedAt); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("error getting tombstone of key=%v: %w", key, err)
+	}
+	return time.Unix(0, deletedAt), true, nil
+}
+
+// tombstones returns the time at which each key that begins with the prefix
+// was soft deleted. The caller must hold the lock.
+func (tombstoneDB *tombstoneDB) tombstones(prefix string) (map[string]time.Time, error) {
+	iter := tombstoneDB.inner.Iterator(tombstonePrefix + prefix)
+	defer iter.Close()
+
+	tombstones := map[string]time.Time{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, err
+		}
+		var deletedAt int64
+		if err := iter.Value(&deletedAt); err != nil {
+			return nil, fmt.Errorf("error reading tombstone of key=%v: %w", prefix+key, err)
+		}
+		tombstones[prefix+key] = time.Unix(0, deletedAt)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return tombstones, nil
+}
+
+// iterator is an `Iterator` over the values in the inner `db.DB`.
+type iterator struct {
+	db.Iterator
+	prefix            string
+	tombstones        map[string]time.Time
+	includeTombstones bool
+
+	// err from reading the tombstones, which is returned by Err.
+	err error
+}
+
+// Next implements the `db.Iterator` interface.
+func (iter *iterator) Next() bool {
+	if iter.err != nil {
+		return false
+	}
+	for iter.Iterator.Next() {
+		if iter.includeTombstones {
+			return true
+		}
+		if _, deleted := iter.Deleted(); !deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// Err implements the `db.Iterator` interface.
+func (iter *iterator) Err() error {
+	if iter.err != nil {
+		return iter.err
+	}
+	return iter.Iterator.Err()
+}
+
+// Deleted implements the `Iterator` interface.
+func (iter *iterator) Deleted() (time.Time, bool) {
+	key, err := iter.Iterator.Key()
+	if err != nil {
+		return time.Time{}, false
+	}
+	deletedAt, ok := iter.tombstones[iter.prefix+key]
+	return deletedAt, ok
+}
@@ -0,0 +1,13 @@
+package tombstone_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTombstone(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tombstone Suite")
+}
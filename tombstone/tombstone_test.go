@@ -0,0 +1,175 @@
+package tombstone_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing/quick"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/tombstone"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("tombstone db", func() {
+	// keys yielded by the iterator, along with whether each of them was soft
+	// deleted.
+	keys := func(iter Iterator) map[string]bool {
+		defer iter.Close()
+
+		keys := map[string]bool{}
+		for iter.Next() {
+			key, err := iter.Key()
+			Expect(err).NotTo(HaveOccurred())
+			_, deleted := iter.Deleted()
+			keys[key] = deleted
+		}
+		Expect(iter.Err()).NotTo(HaveOccurred())
+		return keys
+	}
+
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when doing operations without soft deleting", func() {
+			It("should behave like the inner db", func() {
+				database := Wrap(memdb.New(codec))
+				defer database.Close()
+
+				test := func(key string, value testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+
+					val := testutil.TestStruct{D: []byte{}}
+					Expect(database.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					Expect(database.Insert(key, value)).NotTo(HaveOccurred())
+					Expect(database.Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+					Expect(database.Delete(key)).NotTo(HaveOccurred())
+					Expect(database.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+		})
+	}
+
+	Context("when soft deleting", func() {
+		It("should treat tombstoned keys as missing, but show them to the tombstone-aware iterator", func() {
+			start := time.Now()
+			database := Wrap(memdb.New(codec.JSONCodec))
+			SetNow(database, func() time.Time { return start })
+			for i := 0; i < 5; i++ {
+				Expect(database.Insert(fmt.Sprintf("key%v", i), i)).NotTo(HaveOccurred())
+			}
+			Expect(database.Insert("other", 5)).NotTo(HaveOccurred())
+			Expect(database.SoftDelete("key1")).NotTo(HaveOccurred())
+			Expect(database.SoftDelete("key3")).NotTo(HaveOccurred())
+			Expect(database.SoftDelete("missing")).NotTo(HaveOccurred())
+
+			var value int
+			Expect(database.Get("key1", &value)).Should(Equal(db.ErrKeyNotFound))
+			Expect(database.Get("key2", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(2))
+			Expect(database.Get("missing", &value)).Should(Equal(db.ErrKeyNotFound))
+
+			size, err := database.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(4))
+			size, err = database.Size("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(3))
+
+			Expect(keys(database.IteratorWithOptions("key"))).Should(Equal(map[string]bool{"0": false, "2": false, "4": false}))
+			Expect(keys(database.IteratorWithOptions("key", IncludeTombstones()))).Should(Equal(map[string]bool{"0": false, "1": true, "2": false, "3": true, "4": false}))
+
+			iter := database.IteratorWithOptions("", IncludeTombstones())
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				deletedAt, deleted := iter.Deleted()
+				if deleted {
+					Expect(key).Should(BeElementOf("key1", "key3"))
+					Expect(deletedAt.Equal(start)).Should(BeTrue())
+				}
+			}
+			iter.Close()
+
+			plain := []string{}
+			plainIter := database.Iterator("")
+			for plainIter.Next() {
+				key, err := plainIter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				plain = append(plain, key)
+			}
+			plainIter.Close()
+			sort.Strings(plain)
+			Expect(plain).Should(Equal([]string{"key0", "key2", "key4", "other"}))
+		})
+
+		It("should remove the tombstone when the key is inserted again", func() {
+			database := Wrap(memdb.New(codec.JSONCodec))
+			Expect(database.Insert("key", 1)).NotTo(HaveOccurred())
+			Expect(database.SoftDelete("key")).NotTo(HaveOccurred())
+			Expect(database.Insert("key", 2)).NotTo(HaveOccurred())
+
+			var value int
+			Expect(database.Get("key", &value)).NotTo(HaveOccurred())
+			Expect(value).Should(Equal(2))
+			Expect(keys(database.IteratorWithOptions("", IncludeTombstones()))).Should(Equal(map[string]bool{"key": false}))
+		})
+	})
+
+	Context("when purging tombstones", func() {
+		It("should only purge tombstones that are old enough", func() {
+			start := time.Now()
+			now := start
+			inner := memdb.New(codec.JSONCodec)
+			database := Wrap(inner)
+			SetNow(database, func() time.Time { return now })
+			for _, key := range []string{"a", "b", "c"} {
+				Expect(database.Insert(key, key)).NotTo(HaveOccurred())
+			}
+			Expect(database.SoftDelete("a")).NotTo(HaveOccurred())
+			now = start.Add(time.Minute)
+			Expect(database.SoftDelete("b")).NotTo(HaveOccurred())
+
+			now = start.Add(90 * time.Second)
+			n, err := database.PurgeTombstones(time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(1))
+			Expect(keys(database.IteratorWithOptions("", IncludeTombstones()))).Should(Equal(map[string]bool{"b": true, "c": false}))
+
+			now = start.Add(2 * time.Minute)
+			n, err = database.PurgeTombstones(time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).Should(Equal(1))
+			Expect(keys(database.IteratorWithOptions("", IncludeTombstones()))).Should(Equal(map[string]bool{"c": false}))
+
+			// Only the value of the remaining key should be left in the
+			// inner db.
+			size, err := inner.Size("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).Should(Equal(1))
+		})
+	})
+
+	Context("when doing operations with empty keys", func() {
+		It("should return ErrEmptyKey", func() {
+			database := Wrap(memdb.New(codec.JSONCodec))
+			var value int
+			Expect(database.Insert("", 1)).Should(Equal(db.ErrEmptyKey))
+			Expect(database.Get("", &value)).Should(Equal(db.ErrEmptyKey))
+			Expect(database.Delete("")).Should(Equal(db.ErrEmptyKey))
+			Expect(database.SoftDelete("")).Should(Equal(db.ErrEmptyKey))
+		})
+	})
+})
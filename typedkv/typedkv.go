@@ -0,0 +1,200 @@
+package typedkv
+
+import (
+	"strconv"
+
+	"github.com/renproject/kv/db"
+)
+
+// A KeyCodec converts keys of type K to and from strings. Encoding must be
+// deterministic, so that equal keys are always encoded to the same string.
+type KeyCodec[K comparable] interface {
+
+	// EncodeKey returns the string representation of the key.
+	EncodeKey(key K) (string, error)
+
+	// DecodeKey parses a key from its string representation.
+	DecodeKey(key string) (K, error)
+}
+
+// IntKeyCodec encodes int keys as base 10 strings.
+type IntKeyCodec struct{}
+
+// EncodeKey implements the `KeyCodec` interface.
+func (IntKeyCodec) EncodeKey(key int) (string, error) {
+	return strconv.Itoa(key), nil
+}
+
+// DecodeKey implements the `KeyCodec` interface.
+func (IntKeyCodec) DecodeKey(key string) (int, error) {
+	return strconv.Atoi(key)
+}
+
+// StringKeyCodec uses string keys as they are.
+type StringKeyCodec struct{}
+
+// EncodeKey implements the `KeyCodec` interface.
+func (StringKeyCodec) EncodeKey(key string) (string, error) {
+	return key, nil
+}
+
+// DecodeKey implements the `KeyCodec` interface.
+func (StringKeyCodec) DecodeKey(key string) (string, error) {
+	return key, nil
+}
+
+// A Store is a key-value store with keys of type K and values of type V.
+type Store[K comparable, V any] interface {
+
+	// Insert writes the key-value.
+	Insert(key K, value V) error
+
+	// Get the value associated with the given key. If the key cannot be found,
+	// then `db.ErrKeyNotFound` is returned.
+	Get(key K) (V, error)
+
+	// Delete the value with the given key.
+	Delete(key K) error
+
+	// Size returns the number of key-values in the Store.
+	Size() (int, error)
+
+	// Iterator over the key-values in the Store.
+	Iterator() Iterator[K, V]
+}
+
+// An Iterator is used to iterate through the key-values in a Store.
+type Iterator[K comparable, V any] interface {
+
+	// Next will progress the iterator to the next element. If there are more
+	// elements in the iterator, then it will return true, otherwise it will
+	// return false.
+	Next() bool
+
+	// Key of the current key-value.
+	Key() (K, error)
+
+	// Value of the current key-value.
+	Value() (V, error)
+
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+
+	// Close must be called after finishing the iteration to release
+	// associated resources.
+	Close()
+}
+
+type store[K comparable, V any] struct {
+	inner    db.DB
+	keyCodec KeyCodec[K]
+	valCodec db.Codec
+}
+
+// New returns a Store over the inner `db.DB`. Keys are encoded with the key
+// codec, and values are encoded with the value codec and stored in the inner
+// `db.DB` as bytes.
+func New[K comparable, V any](inner db.DB, keyCodec KeyCodec[K], valCodec db.Codec) Store[K, V] {
+	if keyCodec == nil {
+		panic("key codec cannot be nil")
+	}
+	if valCodec == nil {
+		panic("value codec cannot be nil")
+	}
+	return &store[K, V]{
+		inner:    inner,
+		keyCodec: keyCodec,
+		valCodec: valCodec,
+	}
+}
+
+// Insert implements the `Store` interface.
+func (store *store[K, V]) Insert(key K, value V) error {
+	encodedKey, err := store.keyCodec.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := store.valCodec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return store.inner.Insert(encodedKey, data)
+}
+
+// Get implements the `Store` interface.
+func (store *store[K, V]) Get(key K) (V, error) {
+	var value V
+	encodedKey, err := store.keyCodec.EncodeKey(key)
+	if err != nil {
+		return value, err
+	}
+	var data []byte
+	if err := store.inner.Get(encodedKey, &data); err != nil {
+		return value, err
+	}
+	err = store.valCodec.Decode(data, &value)
+	return value, err
+}
+
+// Delete implements the `Store` interface.
+func (store *store[K, V]) Delete(key K) error {
+	encodedKey, err := store.keyCodec.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return store.inner.Delete(encodedKey)
+}
+
+// Size implements the `Store` interface.
+func (store *store[K, V]) Size() (int, error) {
+	return store.inner.Size("")
+}
+
+// Iterator implements the `Store` interface.
+func (store *store[K, V]) Iterator() Iterator[K, V] {
+	return &iterator[K, V]{
+		inner: store.inner.Iterator(""),
+		store: store,
+	}
+}
+
+type iterator[K comparable, V any] struct {
+	inner db.Iterator
+	store *store[K, V]
+}
+
+// Next implements the `Iterator` interface.
+func (iter *iterator[K, V]) Next() bool {
+	return iter.inner.Next()
+}
+
+// Key implements the `Iterator` interface.
+func (iter *iterator[K, V]) Key() (K, error) {
+	key, err := iter.inner.Key()
+	if err != nil {
+		var zero K
+		return zero, err
+	}
+	return iter.store.keyCodec.DecodeKey(key)
+}
+
+// Value implements the `Iterator` interface.
+func (iter *iterator[K, V]) Value() (V, error) {
+	var value V
+	var data []byte
+	if err := iter.inner.Value(&data); err != nil {
+		return value, err
+	}
+	err := iter.store.valCodec.Decode(data, &value)
+	return value, err
+}
+
+// Err implements the `Iterator` interface.
+func (iter *iterator[K, V]) Err() error {
+	return iter.inner.Err()
+}
+
+// Close implements the `Iterator` interface.
+func (iter *iterator[K, V]) Close() {
+	iter.inner.Close()
+}
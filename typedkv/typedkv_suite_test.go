@@ -0,0 +1,13 @@
+package typedkv_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTypedkv(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Typedkv Suite")
+}
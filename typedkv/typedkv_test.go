@@ -0,0 +1,72 @@
+package typedkv_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/typedkv"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("typed store", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when using int keys and struct values", func() {
+			It("should round trip the values", func() {
+				store := New[int, testutil.TestStruct](memdb.New(codec), IntKeyCodec{}, codec)
+
+				values := map[int]testutil.TestStruct{}
+				for i := -5; i < 5; i++ {
+					values[i] = testutil.RandomTestStruct()
+					Expect(store.Insert(i, values[i])).NotTo(HaveOccurred())
+				}
+				for key, value := range values {
+					stored, err := store.Get(key)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stored).Should(Equal(value))
+				}
+
+				size, err := store.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(len(values)))
+
+				Expect(store.Delete(0)).NotTo(HaveOccurred())
+				_, err = store.Get(0)
+				Expect(err).Should(Equal(db.ErrKeyNotFound))
+			})
+
+			It("should iterate over the keys and values", func() {
+				store := New[int, testutil.TestStruct](memdb.New(codec), IntKeyCodec{}, codec)
+
+				values := map[int]testutil.TestStruct{}
+				for i := 0; i < 10; i++ {
+					values[i*i] = testutil.RandomTestStruct()
+					Expect(store.Insert(i*i, values[i*i])).NotTo(HaveOccurred())
+				}
+
+				iter := store.Iterator()
+				defer iter.Close()
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					value, err := iter.Value()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(values[key]))
+					delete(values, key)
+				}
+				Expect(values).Should(BeEmpty())
+			})
+		})
+	}
+
+	Context("when creating a store with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() { New[string, int64](memdb.New(codec.JSONCodec), nil, codec.JSONCodec) }).Should(Panic())
+			Expect(func() { New[string, int64](memdb.New(codec.JSONCodec), StringKeyCodec{}, nil) }).Should(Panic())
+		})
+	})
+})
@@ -0,0 +1,104 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/renproject/kv/cache/ttl"
+	"github.com/renproject/kv/db"
+)
+
+// ErrInvalidKey is returned by the built-in validators when a key is invalid.
+var ErrInvalidKey = errors.New("invalid key")
+
+type validateDB struct {
+	inner    db.DB
+	validate func(key string) error
+}
+
+// Wrap returns a `db.DB` that validates keys before inserting, getting, or
+// deleting them from the inner `db.DB`. If the validator returns an error, the
+// error is returned without calling the inner `db.DB`.
+func Wrap(inner db.DB, validate func(key string) error) db.DB {
+	return &validateDB{
+		inner:    inner,
+		validate: validate,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (validateDB *validateDB) Close() error {
+	return validateDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (validateDB *validateDB) Insert(key string, value interface{}) error {
+	if err := validateDB.validate(key); err != nil {
+		return err
+	}
+	return validateDB.inner.Insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (validateDB *validateDB) Get(key string, value interface{}) error {
+	if err := validateDB.validate(key); err != nil {
+		return err
+	}
+	return validateDB.inner.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (validateDB *validateDB) Delete(key string) error {
+	if err := validateDB.validate(key); err != nil {
+		return err
+	}
+	return validateDB.inner.Delete(key)
+}
+
+// Size implements the `db.DB` interface.
+func (validateDB *validateDB) Size(prefix string) (int, error) {
+	return validateDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (validateDB *validateDB) Iterator(prefix string) db.Iterator {
+	return validateDB.inner.Iterator(prefix)
+}
+
+// MaxLength returns a validator that rejects keys longer than the given number
+// of bytes.
+func MaxLength(n int) func(key string) error {
+	return func(key string) error {
+		if len(key) > n {
+			return fmt.Errorf("%w: key length = %v, max length = %v", ErrInvalidKey, len(key), n)
+		}
+		return nil
+	}
+}
+
+// NoReservedTokens returns a validator that rejects keys containing tokens that
+// are reserved by the ttl table. This prevents keys written directly to a
+// `db.DB` from being confused with the internal keys of a ttl table that shares
+// the same `db.DB`. It must not be used on a `db.DB` that a ttl table writes to.
+func NoReservedTokens() func(key string) error {
+	return func(key string) error {
+		if strings.Contains(key, ttl.SlotToken) {
+			return fmt.Errorf("%w: key contains reserved token %q", ErrInvalidKey, ttl.SlotToken)
+		}
+		return nil
+	}
+}
+
+// All returns a validator that runs each of the given validators in order, and
+// returns the first error.
+func All(validators ...func(key string) error) func(key string) error {
+	return func(key string) error {
+		for _, validate := range validators {
+			if err := validate(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package validate_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/validate"
+
+	"github.com/renproject/kv/cache/ttl"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("key validating db", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		Context("when keys are valid", func() {
+			It("should pass operations through to the inner db", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, All(MaxLength(64), NoReservedTokens()))
+
+				test := func(key string, value testutil.TestStruct) bool {
+					if key == "" || len(key) > 64 || strings.Contains(key, ttl.SlotToken) {
+						return true
+					}
+
+					Expect(database.Insert(key, value)).NotTo(HaveOccurred())
+					val := testutil.TestStruct{D: []byte{}}
+					Expect(inner.Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+					Expect(database.Get(key, &val)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
+
+					Expect(database.Delete(key)).NotTo(HaveOccurred())
+					Expect(inner.Get(key, &val)).Should(Equal(db.ErrKeyNotFound))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when keys are invalid", func() {
+			It("should reject keys that are too long", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, MaxLength(4))
+				value := testutil.RandomTestStruct()
+
+				Expect(database.Insert("abcd", value)).NotTo(HaveOccurred())
+				for _, err := range []error{
+					database.Insert("abcde", value),
+					database.Get("abcde", &value),
+					database.Delete("abcde"),
+				} {
+					Expect(errors.Is(err, ErrInvalidKey)).Should(BeTrue())
+				}
+
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+			})
+
+			It("should reject keys that contain reserved tokens", func() {
+				inner := memdb.New(codec)
+				database := Wrap(inner, NoReservedTokens())
+				value := testutil.RandomTestStruct()
+
+				err := database.Insert("key"+ttl.SlotToken+"1_key", value)
+				Expect(errors.Is(err, ErrInvalidKey)).Should(BeTrue())
+
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+			})
+
+			It("should return the error from a custom validator", func() {
+				errCustom := errors.New("custom")
+				value := testutil.RandomTestStruct()
+				database := Wrap(memdb.New(codec), func(key string) error {
+					if strings.HasPrefix(key, "tmp") {
+						return errCustom
+					}
+					return nil
+				})
+
+				Expect(database.Insert("tmp1", value)).Should(Equal(errCustom))
+				Expect(database.Insert("key", value)).NotTo(HaveOccurred())
+			})
+		})
+	}
+})
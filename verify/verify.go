@@ -0,0 +1,198 @@
+package verify
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/renproject/kv/db"
+	"golang.org/x/crypto/sha3"
+)
+
+// ErrInvalidSampleRate is returned when the sample rate is not greater than 0
+// and at most 1.
+var ErrInvalidSampleRate = errors.New("sample rate must be greater than 0 and at most 1")
+
+// MaxMismatches is the maximum number of mismatched keys returned by Equal.
+const MaxMismatches = 100
+
+// Equal checks whether or not two `db.DB`s have the same key/value pairs, and
+// returns the keys that are different (in the first `db.DB` only, in the
+// second `db.DB` only, or with different values), sorted. Values are decoded
+// into the value returned by `newValue`, and compared using
+// `reflect.DeepEqual`. The comparison stops once MaxMismatches keys have been
+// found.
+//
+// A sample rate of 1 compares every key. A sample rate between 0 and 1
+// compares that fraction of the keys, for a quick probabilistic check of large
+// `db.DB`s. Keys are sampled using a hash, so the same keys are sampled from
+// both `db.DB`s, and a key is either compared in full or not at all. Keys are
+// sampled before their values are read.
+//
+// If both `db.DB`s are `db.Ordered`, they are compared side by side, and the
+// first MaxMismatches keys that are different are returned. Otherwise, the keys
+// of each `db.DB` are iterated over, and the values of the sampled keys are
+// read with Get, so neither `db.DB` is read into memory. In this case, which
+// keys are returned when there are more than MaxMismatches is unspecified.
+func Equal(a, b db.DB, sampleRate float64, newValue func() interface{}) (bool, []string, error) {
+	if !(sampleRate > 0 && sampleRate <= 1) {
+		return false, nil, ErrInvalidSampleRate
+	}
+
+	compare := compareByKey
+	_, orderedA := a.(db.Ordered)
+	_, orderedB := b.(db.Ordered)
+	if orderedA && orderedB {
+		compare = compareSorted
+	}
+	mismatches, err := compare(a, b, sampleRate, newValue)
+	if err != nil {
+		return false, nil, err
+	}
+	sort.Strings(mismatches)
+	return len(mismatches) == 0, mismatches, nil
+}
+
+// compareByKey compares the values of the sampled keys of the first `db.DB`
+// with the second, and then finds the sampled keys of the second `db.DB` that
+// are missing from the first.
+func compareByKey(a, b db.DB, sampleRate float64, newValue func() interface{}) ([]string, error) {
+	mismatches := []string{}
+	err := iterateSampled(a, sampleRate, func(key string) (bool, error) {
+		valueA, okA, err := get(a, key, newValue)
+		if err != nil || !okA {
+			// The key was deleted while iterating.
+			return true, err
+		}
+		valueB, okB, err := get(b, key, newValue)
+		if err != nil {
+			return false, err
+		}
+		if !okB || !reflect.DeepEqual(valueA, valueB) {
+			mismatches = append(mismatches, key)
+		}
+		return len(mismatches) < MaxMismatches, nil
+	})
+	if err != nil || len(mismatches) == MaxMismatches {
+		return mismatches, err
+	}
+
+	err = iterateSampled(b, sampleRate, func(key string) (bool, error) {
+		_, ok, err := get(a, key, newValue)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			mismatches = append(mismatches, key)
+		}
+		return len(mismatches) < MaxMismatches, nil
+	})
+	return mismatches, err
+}
+
+// iterateSampled calls `f` with each sampled key of the `db.DB`, until it
+// returns false or an error. Values are not read by the iteration.
+func iterateSampled(database db.DB, sampleRate float64, f func(key string) (bool, error)) error {
+	iter := db.NewKeyIterator(database, "")
+	defer iter.Close()
+
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return fmt.Errorf("error reading key: %w", err)
+		}
+		if !sampled(key, sampleRate) {
+			continue
+		}
+		ok, err := f(key)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// get the value of the key, and whether or not it exists.
+func get(database db.DB, key string, newValue func() interface{}) (interface{}, bool, error) {
+	value := newValue()
+	if err := database.Get(key, value); err != nil {
+		if errors.Is(err, db.ErrKeyNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error reading value of key=%v: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// compareSorted reads the sampled keys of both `db.DB`s side by side, in order,
+// and only reads the values of keys that are in both.
+func compareSorted(a, b db.DB, sampleRate float64, newValue func() interface{}) ([]string, error) {
+	keep := func(key string, decode func(value interface{}) error) bool {
+		return sampled(key, sampleRate)
+	}
+	iterA := db.FilterIterator(a.Iterator(""), keep)
+	defer iterA.Close()
+	iterB := db.FilterIterator(b.Iterator(""), keep)
+	defer iterB.Close()
+
+	mismatches := []string{}
+	keyA, okA, err := next(iterA)
+	if err != nil {
+		return nil, err
+	}
+	keyB, okB, err := next(iterB)
+	if err != nil {
+		return nil, err
+	}
+	for (okA || okB) && len(mismatches) < MaxMismatches {
+		switch {
+		case okA && (!okB || keyA < keyB):
+			mismatches = append(mismatches, keyA)
+			keyA, okA, err = next(iterA)
+		case okB && (!okA || keyB < keyA):
+			mismatches = append(mismatches, keyB)
+			keyB, okB, err = next(iterB)
+		default:
+			valueA, valueB := newValue(), newValue()
+			if err := iterA.Value(valueA); err != nil {
+				return nil, fmt.Errorf("error reading value of key=%v: %w", keyA, err)
+			}
+			if err := iterB.Value(valueB); err != nil {
+				return nil, fmt.Errorf("error reading value of key=%v: %w", keyB, err)
+			}
+			if !reflect.DeepEqual(valueA, valueB) {
+				mismatches = append(mismatches, keyA)
+			}
+			if keyA, okA, err = next(iterA); err == nil {
+				keyB, okB, err = next(iterB)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mismatches, nil
+}
+
+// next progresses the iterator and returns the next key.
+func next(iter db.Iterator) (string, bool, error) {
+	if !iter.Next() {
+		return "", false, iter.Err()
+	}
+	key, err := iter.Key()
+	if err != nil {
+		return "", false, fmt.Errorf("error reading key: %w", err)
+	}
+	return key, true, nil
+}
+
+// sampled returns whether or not the key is in the sample. The hash must mix
+// every byte of the key into its high bits, so that similar short keys are
+// sampled at the expected rate.
+func sampled(key string, sampleRate float64) bool {
+	hash := sha3.Sum256([]byte(key))
+	return float64(binary.BigEndian.Uint64(hash[:8])) < sampleRate*math.MaxUint64
+}
@@ -0,0 +1,178 @@
+package verify_test
+
+import (
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/leveldb"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/kv/verify"
+)
+
+// countingDB is a `db.DB` that counts the number of values that are read with
+// Get.
+type countingDB struct {
+	db.DB
+	gets int
+}
+
+func (countingDB *countingDB) Get(key string, value interface{}) error {
+	countingDB.gets++
+	return countingDB.DB.Get(key, value)
+}
+
+var _ = Describe("verify", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newValue := func() interface{} {
+			return &testutil.TestStruct{D: []byte{}}
+		}
+
+		// fill both dbs with the same key/value pairs.
+		fill := func(a, b db.DB, n int) {
+			for i := 0; i < n; i++ {
+				key := fmt.Sprintf("%03d", i)
+				value := testutil.RandomTestStruct()
+				Expect(a.Insert(key, value)).NotTo(HaveOccurred())
+				Expect(b.Insert(key, value)).NotTo(HaveOccurred())
+			}
+		}
+
+		Context(fmt.Sprintf("when comparing dbs using %v", codec), func() {
+			It("should find identical dbs to be equal", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				fill(a, b, 100)
+
+				equal, mismatches, err := verify.Equal(a, b, 1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeTrue())
+				Expect(mismatches).Should(BeEmpty())
+			})
+
+			It("should return the keys that are different", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				fill(a, b, 100)
+				Expect(a.Insert("only-a", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				Expect(b.Insert("only-b", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				Expect(b.Insert("050", testutil.TestStruct{A: "different", D: []byte{}})).NotTo(HaveOccurred())
+
+				equal, mismatches, err := verify.Equal(a, b, 1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeFalse())
+				Expect(mismatches).Should(Equal([]string{"050", "only-a", "only-b"}))
+			})
+
+			It("should stop once the maximum number of keys have been found", func() {
+				a := &countingDB{DB: memdb.New(codec)}
+				b := memdb.New(codec)
+				for i := 0; i < 2*verify.MaxMismatches; i++ {
+					Expect(a.Insert(fmt.Sprintf("%03d", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				}
+
+				equal, mismatches, err := verify.Equal(a, b, 1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeFalse())
+				Expect(mismatches).Should(HaveLen(verify.MaxMismatches))
+				Expect(a.gets).Should(Equal(verify.MaxMismatches))
+			})
+
+			It("should compare ordered dbs side by side", func() {
+				a := leveldb.New(".leveldb-a", codec)
+				defer os.RemoveAll(".leveldb-a")
+				defer a.Close()
+				b := leveldb.New(".leveldb-b", codec)
+				defer os.RemoveAll(".leveldb-b")
+				defer b.Close()
+				fill(a, b, 100)
+
+				equal, mismatches, err := verify.Equal(a, b, 1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeTrue())
+				Expect(mismatches).Should(BeEmpty())
+
+				Expect(a.Delete("010")).NotTo(HaveOccurred())
+				Expect(b.Insert("020", testutil.TestStruct{A: "different", D: []byte{}})).NotTo(HaveOccurred())
+				equal, mismatches, err = verify.Equal(a, b, 1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeFalse())
+				Expect(mismatches).Should(Equal([]string{"010", "020"}))
+			})
+
+			It("should return the first keys that are different in ordered dbs", func() {
+				a := leveldb.New(".leveldb-a", codec)
+				defer os.RemoveAll(".leveldb-a")
+				defer a.Close()
+				b := leveldb.New(".leveldb-b", codec)
+				defer os.RemoveAll(".leveldb-b")
+				defer b.Close()
+				for i := 0; i < 2*verify.MaxMismatches; i++ {
+					Expect(a.Insert(fmt.Sprintf("%03d", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				}
+
+				equal, mismatches, err := verify.Equal(a, b, 1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeFalse())
+				Expect(mismatches).Should(HaveLen(verify.MaxMismatches))
+				Expect(mismatches[0]).Should(Equal("000"))
+				Expect(mismatches[verify.MaxMismatches-1]).Should(Equal(fmt.Sprintf("%03d", verify.MaxMismatches-1)))
+			})
+		})
+
+		Context(fmt.Sprintf("when sampling dbs using %v", codec), func() {
+			It("should find identical dbs to be equal", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				fill(a, b, 100)
+
+				equal, mismatches, err := verify.Equal(a, b, 0.1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeTrue())
+				Expect(mismatches).Should(BeEmpty())
+			})
+
+			It("should only read the values of the sampled keys", func() {
+				a, b := &countingDB{DB: memdb.New(codec)}, &countingDB{DB: memdb.New(codec)}
+				fill(a, b, 1000)
+
+				equal, _, err := verify.Equal(a, b, 0.1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeTrue())
+				Expect(a.gets).Should(BeNumerically(">", 0))
+				Expect(a.gets).Should(BeNumerically("<", 500))
+				Expect(b.gets).Should(BeNumerically("<", 250))
+			})
+
+			It("should only find the differences in the sampled keys", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				fill(a, b, 100)
+				for i := 0; i < 500; i++ {
+					Expect(a.Insert(fmt.Sprintf("only-a-%v", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				}
+
+				equal, mismatches, err := verify.Equal(a, b, 0.1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(equal).Should(BeFalse())
+				Expect(len(mismatches)).Should(BeNumerically(">", 0))
+				Expect(len(mismatches)).Should(BeNumerically("<", verify.MaxMismatches))
+
+				// The same keys are sampled each time.
+				_, again, err := verify.Equal(a, b, 0.1, newValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(again).Should(Equal(mismatches))
+			})
+
+			It("should return an error for an invalid sample rate", func() {
+				a, b := memdb.New(codec), memdb.New(codec)
+				for _, sampleRate := range []float64{0, -0.5, 1.5} {
+					_, _, err := verify.Equal(a, b, sampleRate, newValue)
+					Expect(err).Should(Equal(verify.ErrInvalidSampleRate))
+				}
+			})
+		})
+	}
+})
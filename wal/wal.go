@@ -0,0 +1,207 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/renproject/kv/db"
+)
+
+// ErrCorruptRecord is returned by Replay when a complete record does not match
+// its checksum, or its length is greater than MaxRecordSize.
+var ErrCorruptRecord = errors.New("corrupt record")
+
+// ErrRecordTooLarge is returned when writing an operation whose record would
+// be greater than MaxRecordSize.
+var ErrRecordTooLarge = errors.New("record too large")
+
+// MaxRecordSize is the maximum size of a record, not including its length and
+// checksum. It bounds the memory that is allocated by Replay before the
+// checksum of a record has been checked.
+const MaxRecordSize = 64 << 20
+
+// Operations that are written to the log.
+const (
+	opInsert byte = 1
+	opDelete byte = 2
+)
+
+// headerSize is the size of the length and the checksum of a record.
+const headerSize = 8
+
+type walDB struct {
+	mu    *sync.Mutex
+	inner db.DB
+	w     io.Writer
+	codec db.Codec
+}
+
+// Wrap returns a `db.DB` that writes each insert and delete to the writer
+// before applying it to the inner `db.DB`, so that the state of the inner
+// `db.DB` can be rebuilt with Replay. Values are encoded with the given codec.
+// Each record is written with a single call to the writer, and holds its
+// length and checksum so that a partially written record can be detected. If
+// applying an operation to the inner `db.DB` fails after it has been written,
+// it is still applied by Replay.
+func Wrap(inner db.DB, w io.Writer, codec db.Codec) db.DB {
+	if codec == nil {
+		panic("codec cannot be nil")
+	}
+	return &walDB{
+		mu:    new(sync.Mutex),
+		inner: inner,
+		w:     w,
+		codec: codec,
+	}
+}
+
+// Close implements the `db.DB` interface.
+func (walDB *walDB) Close() error {
+	return walDB.inner.Close()
+}
+
+// Insert implements the `db.DB` interface.
+func (walDB *walDB) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := walDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	walDB.mu.Lock()
+	defer walDB.mu.Unlock()
+
+	if err := walDB.write(opInsert, key, data); err != nil {
+		return err
+	}
+	return walDB.inner.Insert(key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (walDB *walDB) Get(key string, value interface{}) error {
+	return walDB.inner.Get(key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (walDB *walDB) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	walDB.mu.Lock()
+	defer walDB.mu.Unlock()
+
+	if err := walDB.write(opDelete, key, nil); err != nil {
+		return err
+	}
+	return walDB.inner.Delete(key)
+}
+
+// Size implements the `db.DB` interface.
+func (walDB *walDB) Size(prefix string) (int, error) {
+	return walDB.inner.Size(prefix)
+}
+
+// Iterator implements the `db.DB` interface.
+func (walDB *walDB) Iterator(prefix string) db.Iterator {
+	return walDB.inner.Iterator(prefix)
+}
+
+// write a record of the operation to the writer. The caller must hold the
+// lock.
+func (walDB *walDB) write(op byte, key string, data []byte) error {
+	keyLen := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(keyLen, uint64(len(key)))
+
+	size := 1 + n + len(key) + len(data)
+	if size > MaxRecordSize {
+		return ErrRecordTooLarge
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, op)
+	payload = append(payload, keyLen[:n]...)
+	payload = append(payload, key...)
+	payload = append(payload, data...)
+
+	record := make([]byte, headerSize, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:headerSize], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+	if _, err := walDB.w.Write(record); err != nil {
+		return fmt.Errorf("error writing record: %w", err)
+	}
+	return nil
+}
+
+// Replay reads the records written by a `db.DB` returned by Wrap, and applies
+// them to the target in order. Each value is decoded using the codec into the
+// value returned by `newValue`, which must be a pointer. A partial record at
+// the end of the reader, for example because of a crash while it was being
+// written, is skipped. If a complete record does not match its checksum, or a
+// record is longer than MaxRecordSize, then ErrCorruptRecord is returned.
+func Replay(r io.Reader, target db.ReadWriter, codec db.Codec, newValue func() interface{}) error {
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return fmt.Errorf("error reading record: %w", err)
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		if size > MaxRecordSize {
+			return ErrCorruptRecord
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return fmt.Errorf("error reading record: %w", err)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:headerSize]) {
+			return ErrCorruptRecord
+		}
+		if err := apply(target, payload, codec, newValue); err != nil {
+			return err
+		}
+	}
+}
+
+// apply the operation in the payload of a record to the target.
+func apply(target db.ReadWriter, payload []byte, codec db.Codec, newValue func() interface{}) error {
+	if len(payload) == 0 {
+		return ErrCorruptRecord
+	}
+	op := payload[0]
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < keyLen {
+		return ErrCorruptRecord
+	}
+	key := string(payload[1+n : 1+n+int(keyLen)])
+	data := payload[1+n+int(keyLen):]
+
+	switch op {
+	case opInsert:
+		value := newValue()
+		if err := codec.Decode(data, value); err != nil {
+			return fmt.Errorf("error decoding value of key=%v: %w", key, err)
+		}
+		if err := target.Insert(key, value); err != nil {
+			return fmt.Errorf("error inserting key=%v: %w", key, err)
+		}
+	case opDelete:
+		if err := target.Delete(key); err != nil {
+			return fmt.Errorf("error deleting key=%v: %w", key, err)
+		}
+	default:
+		return ErrCorruptRecord
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package wal_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/wal"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+	"github.com/renproject/kv/testutil"
+)
+
+var errWrite = errors.New("write failure")
+
+// failingWriter is an `io.Writer` where all writes fail.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+var _ = Describe("write-ahead log", func() {
+	for i := range testutil.Codecs {
+		codec := testutil.Codecs[i]
+
+		newValue := func() interface{} {
+			return &testutil.TestStruct{D: []byte{}}
+		}
+
+		Context("when replaying the log", func() {
+			It("should rebuild the state of the db", func() {
+				log := new(bytes.Buffer)
+				inner := memdb.New(codec)
+				Expect(testutil.WriteSequence(Wrap(inner, log, codec))).NotTo(HaveOccurred())
+
+				replayed := memdb.New(codec)
+				Expect(Replay(log, replayed, codec, newValue)).NotTo(HaveOccurred())
+				Expect(testutil.CheckSame(inner, replayed, newValue)).NotTo(HaveOccurred())
+			})
+
+			It("should skip a partial record at the end", func() {
+				log := new(bytes.Buffer)
+				inner := memdb.New(codec)
+				database := Wrap(inner, log, codec)
+				Expect(testutil.WriteSequence(database)).NotTo(HaveOccurred())
+				complete := log.Len()
+				Expect(database.Insert("partial", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				Expect(inner.Delete("partial")).NotTo(HaveOccurred())
+
+				for _, length := range []int{complete + 1, complete + 8, log.Len() - 1} {
+					replayed := memdb.New(codec)
+					Expect(Replay(bytes.NewReader(log.Bytes()[:length]), replayed, codec, newValue)).NotTo(HaveOccurred())
+					Expect(testutil.CheckSame(inner, replayed, newValue)).NotTo(HaveOccurred())
+				}
+			})
+
+			It("should return an error for a corrupt record", func() {
+				log := new(bytes.Buffer)
+				Expect(testutil.WriteSequence(Wrap(memdb.New(codec), log, codec))).NotTo(HaveOccurred())
+
+				// Flip the first byte after the length and checksum of the
+				// first record.
+				data := log.Bytes()
+				data[8] ^= 0xFF
+				Expect(Replay(bytes.NewReader(data), memdb.New(codec), codec, newValue)).Should(Equal(ErrCorruptRecord))
+			})
+
+			It("should return an error for a record that is too long, without reading it", func() {
+				log := new(bytes.Buffer)
+				Expect(testutil.WriteSequence(Wrap(memdb.New(codec), log, codec))).NotTo(HaveOccurred())
+
+				// Corrupt the length of the first record.
+				data := log.Bytes()
+				binary.BigEndian.PutUint32(data[:4], 0xFFFFFFFF)
+				Expect(Replay(bytes.NewReader(data), memdb.New(codec), codec, newValue)).Should(Equal(ErrCorruptRecord))
+			})
+		})
+
+		Context("when the log cannot be written", func() {
+			It("should not apply the operation", func() {
+				inner := memdb.New(codec)
+				Expect(inner.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+				database := Wrap(inner, failingWriter{}, codec)
+
+				Expect(errors.Is(database.Insert("other", testutil.RandomTestStruct()), errWrite)).Should(BeTrue())
+				Expect(errors.Is(database.Delete("key"), errWrite)).Should(BeTrue())
+
+				size, err := inner.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+				Expect(inner.Get("key", newValue())).NotTo(HaveOccurred())
+			})
+		})
+	}
+
+	Context("when writing a value that is too large", func() {
+		It("should not write or apply the operation", func() {
+			log := new(bytes.Buffer)
+			inner := memdb.New(codec.BinaryCodec)
+			database := Wrap(inner, log, codec.BinaryCodec)
+
+			Expect(database.Insert("key", make([]byte, MaxRecordSize))).Should(Equal(ErrRecordTooLarge))
+			Expect(log.Len()).Should(Equal(0))
+			var value []byte
+			Expect(inner.Get("key", &value)).Should(Equal(db.ErrKeyNotFound))
+		})
+	})
+
+	Context("when wrapping with a nil codec", func() {
+		It("should panic", func() {
+			Expect(func() { Wrap(memdb.New(codec.JSONCodec), new(bytes.Buffer), nil) }).Should(Panic())
+		})
+	})
+})